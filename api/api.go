@@ -54,6 +54,14 @@ func (srv *Server) initAPI() {
 	// Consensus API Calls
 	if srv.cs != nil {
 		router.GET("/consensus", srv.consensusHandler)
+		router.GET("/consensus/blocks", srv.consensusBlocksHandler)
+		router.GET("/consensus/siacoinoutputs/:id", srv.consensusSiacoinOutputsHandler)
+		router.GET("/consensus/filecontracts/:id", srv.consensusFileContractsHandler)
+		router.GET("/consensus/siafundpool", srv.consensusSiafundPoolHandler)
+		router.GET("/consensus/consistency", srv.consensusConsistencyHandler)
+		router.GET("/consensus/forks", srv.consensusForksHandler)
+		router.POST("/consensus/snapshot", srv.consensusSnapshotHandler)
+		router.GET("/consensus/subscribe/:id", srv.consensusSubscribeHandler)
 	}
 
 	// Explorer API Calls
@@ -68,6 +76,9 @@ func (srv *Server) initAPI() {
 		router.GET("/gateway", srv.gatewayHandler)
 		router.POST("/gateway/add/:netaddress", srv.gatewayAddHandler)
 		router.POST("/gateway/remove/:netaddress", srv.gatewayRemoveHandler)
+		router.GET("/gateway/blocklist", srv.gatewayBlocklistHandler)
+		router.POST("/gateway/blocklist/add/:netaddress", srv.gatewayBlocklistAddHandler)
+		router.POST("/gateway/blocklist/remove/:netaddress", srv.gatewayBlocklistRemoveHandler)
 	}
 
 	// Host API Calls
@@ -92,6 +103,9 @@ func (srv *Server) initAPI() {
 		router.POST("/miner/header", srv.minerHeaderHandlerPOST)
 		router.GET("/miner/start", srv.minerStartHandler)
 		router.GET("/miner/stop", srv.minerStopHandler)
+		router.GET("/miner/pool", srv.minerPoolHandler)
+		router.GET("/miner/pool/start", srv.minerPoolStartHandler)
+		router.GET("/miner/pool/stop", srv.minerPoolStopHandler)
 		router.GET("/miner/headerforwork", srv.minerHeaderHandlerGET)  // COMPATv0.4.8
 		router.POST("/miner/submitheader", srv.minerHeaderHandlerPOST) // COMPATv0.4.8
 	}
@@ -121,6 +135,7 @@ func (srv *Server) initAPI() {
 	// TransactionPool API Calls
 	if srv.tpool != nil {
 		router.GET("/transactionpool/transactions", srv.transactionpoolTransactionsHandler)
+		router.POST("/transactionpool/transactions", srv.transactionpoolTransactionsPOSTHandler)
 	}
 
 	// Wallet API Calls
@@ -130,17 +145,34 @@ func (srv *Server) initAPI() {
 		router.GET("/wallet/address", srv.walletAddressHandler)
 		router.GET("/wallet/addresses", srv.walletAddressesHandler)
 		router.GET("/wallet/backup", srv.walletBackupHandler)
+		router.POST("/wallet/changepassword", srv.walletChangePasswordHandler)
+		router.POST("/wallet/defrag", srv.walletDefragHandler)
+		router.GET("/wallet/history", srv.walletHistoryHandler)
+		router.GET("/wallet/history/export", srv.walletHistoryExportHandler)
 		router.POST("/wallet/init", srv.walletInitHandler)
 		router.POST("/wallet/lock", srv.walletLockHandler)
+		router.POST("/wallet/multisig/create", srv.walletMultisigCreateHandler)
+		router.POST("/wallet/multisig/merge", srv.walletMultisigMergeHandler)
+		router.GET("/wallet/multisig/publickey", srv.walletMultisigPublicKeyHandler)
+		router.POST("/wallet/multisig/transaction", srv.walletMultisigTransactionHandler)
 		router.POST("/wallet/seed", srv.walletSeedHandler)
 		router.GET("/wallet/seeds", srv.walletSeedsHandler)
 		router.POST("/wallet/siacoins", srv.walletSiacoinsHandler)
 		router.POST("/wallet/siafunds", srv.walletSiafundsHandler)
+		router.POST("/wallet/siafunds/claim", srv.walletSiafundsClaimHandler)
+		router.GET("/wallet/siafunds/claims", srv.walletSiafundsClaimsHandler)
 		router.POST("/wallet/siagkey", srv.walletSiagkeyHandler)
+		router.POST("/wallet/sign", srv.walletSignHandler)
+		router.POST("/wallet/sweep/seed", srv.walletSweepSeedHandler)
 		router.GET("/wallet/transaction/:id", srv.walletTransactionHandler)
 		router.GET("/wallet/transactions", srv.walletTransactionsHandler)
 		router.GET("/wallet/transactions/:addr", srv.walletTransactionsAddrHandler)
 		router.POST("/wallet/unlock", srv.walletUnlockHandler)
+		router.GET("/wallet/unspent", srv.walletUnspentHandler)
+		router.GET("/wallet/watch", srv.walletWatchHandler)
+		router.POST("/wallet/watch/add", srv.walletWatchAddHandler)
+		router.POST("/wallet/watch/remove", srv.walletWatchRemoveHandler)
+		router.POST("/wallet/watch/transaction", srv.walletWatchTransactionHandler)
 		router.POST("/wallet/encrypt", srv.walletInitHandler) // COMPATv0.4.0
 	}
 
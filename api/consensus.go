@@ -1,8 +1,13 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
 
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/julienschmidt/httprouter"
@@ -13,10 +18,74 @@ import (
 type ConsensusGET struct {
 	Synced       bool              `json:"synced"`
 	Height       types.BlockHeight `json:"height"`
+	HeaderHeight types.BlockHeight `json:"headerheight"`
 	CurrentBlock types.BlockID     `json:"currentblock"`
 	Target       types.Target      `json:"target"`
 }
 
+// ConsensusBlocksGET is the object returned by a GET request to
+// /consensus/blocks.
+type ConsensusBlocksGET struct {
+	ID     types.BlockID     `json:"id"`
+	Height types.BlockHeight `json:"height"`
+	Block  types.Block       `json:"block"`
+}
+
+// ConsensusSiacoinOutputsGET is the object returned by a GET request to
+// /consensus/siacoinoutputs/:id.
+type ConsensusSiacoinOutputsGET struct {
+	SiacoinOutput types.SiacoinOutput `json:"siacoinoutput"`
+}
+
+// ConsensusFileContractsGET is the object returned by a GET request to
+// /consensus/filecontracts/:id.
+type ConsensusFileContractsGET struct {
+	FileContract types.FileContract `json:"filecontract"`
+}
+
+// ConsensusSiafundPoolGET is the object returned by a GET request to
+// /consensus/siafundpool.
+type ConsensusSiafundPoolGET struct {
+	SiafundPool types.Currency `json:"siafundpool"`
+}
+
+// ConsensusChangeGET is the object written to the /consensus/subscribe
+// stream for each consensus change. The fields mirror
+// modules.ConsensusChange.
+type ConsensusChangeGET struct {
+	ID                        crypto.Hash                        `json:"id"`
+	RevertedBlocks            []types.Block                      `json:"revertedblocks"`
+	AppliedBlocks             []types.Block                      `json:"appliedblocks"`
+	SiacoinOutputDiffs        []modules.SiacoinOutputDiff        `json:"siacoinoutputdiffs"`
+	FileContractDiffs         []modules.FileContractDiff         `json:"filecontractdiffs"`
+	SiafundOutputDiffs        []modules.SiafundOutputDiff        `json:"siafundoutputdiffs"`
+	DelayedSiacoinOutputDiffs []modules.DelayedSiacoinOutputDiff `json:"delayedsiacoinoutputdiffs"`
+	SiafundPoolDiffs          []modules.SiafundPoolDiff          `json:"siafundpooldiffs"`
+}
+
+// ConsensusConsistencyGET is the object returned by a GET request to
+// /consensus/consistency.
+type ConsensusConsistencyGET struct {
+	Inconsistent bool `json:"inconsistent"`
+}
+
+// ConsensusForksGET is the object returned by a GET request to
+// /consensus/forks.
+type ConsensusForksGET struct {
+	Forks       []modules.ConsensusFork `json:"forks"`
+	StaleBlocks []modules.StaleBlock    `json:"staleblocks"`
+}
+
+// ConsensusSnapshotPOST is the object returned by a POST request to
+// /consensus/snapshot.
+type ConsensusSnapshotPOST struct {
+	Height   types.BlockHeight `json:"height"`
+	BlockID  types.BlockID     `json:"blockid"`
+	ChangeID crypto.Hash       `json:"changeid"`
+	Checksum crypto.Hash       `json:"checksum"`
+	Filename string            `json:"filename"`
+}
+
 // consensusHandler handles the API calls to /consensus.
 func (srv *Server) consensusHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	cbid := srv.cs.CurrentBlock().ID()
@@ -24,7 +93,307 @@ func (srv *Server) consensusHandler(w http.ResponseWriter, req *http.Request, _
 	writeJSON(w, ConsensusGET{
 		Synced:       srv.cs.Synced(),
 		Height:       srv.cs.Height(),
+		HeaderHeight: srv.cs.HeaderHeight(),
 		CurrentBlock: cbid,
 		Target:       currentTarget,
 	})
 }
+
+// consensusBlocksHandler handles the API calls to /consensus/blocks. The block
+// is selected by either its id or its height in the current path.
+func (srv *Server) consensusBlocksHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	idStr, heightStr := req.FormValue("id"), req.FormValue("height")
+	if (idStr == "") == (heightStr == "") {
+		writeError(w, "exactly one of 'id' or 'height' must be provided", http.StatusBadRequest)
+		return
+	}
+
+	var block types.Block
+	var height types.BlockHeight
+	var exists bool
+	if idStr != "" {
+		id, err := scanHash(idStr)
+		if err != nil {
+			writeError(w, "could not parse block id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		block, height, exists = srv.cs.Block(types.BlockID(id))
+	} else {
+		if _, err := fmt.Sscan(heightStr, &height); err != nil {
+			writeError(w, "could not parse block height: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		block, exists = srv.cs.BlockAtHeight(height)
+	}
+	if !exists {
+		writeError(w, "block not found", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ConsensusBlocksGET{
+		ID:     block.ID(),
+		Height: height,
+		Block:  block,
+	})
+}
+
+// consensusSiacoinOutputsHandler handles the API calls to
+// /consensus/siacoinoutputs/:id.
+func (srv *Server) consensusSiacoinOutputsHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, err := scanHash(ps.ByName("id"))
+	if err != nil {
+		writeError(w, "could not parse siacoin output id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sco, exists := srv.cs.SiacoinOutput(types.SiacoinOutputID(id))
+	if !exists {
+		writeError(w, "siacoin output not found", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ConsensusSiacoinOutputsGET{
+		SiacoinOutput: sco,
+	})
+}
+
+// consensusFileContractsHandler handles the API calls to
+// /consensus/filecontracts/:id.
+func (srv *Server) consensusFileContractsHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, err := scanHash(ps.ByName("id"))
+	if err != nil {
+		writeError(w, "could not parse file contract id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fc, exists := srv.cs.FileContract(types.FileContractID(id))
+	if !exists {
+		writeError(w, "file contract not found", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ConsensusFileContractsGET{
+		FileContract: fc,
+	})
+}
+
+// consensusSiafundPoolHandler handles the API calls to /consensus/siafundpool.
+func (srv *Server) consensusSiafundPoolHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, ConsensusSiafundPoolGET{
+		SiafundPool: srv.cs.SiafundPool(),
+	})
+}
+
+// consensusConsistencyHandler handles the API calls to
+// /consensus/consistency.
+func (srv *Server) consensusConsistencyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, ConsensusConsistencyGET{
+		Inconsistent: srv.cs.Inconsistent(),
+	})
+}
+
+// consensusForksHandler handles the API calls to /consensus/forks. If
+// 'mindepth' is provided, only forks at least that deep are returned.
+func (srv *Server) consensusForksHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var minDepth types.BlockHeight
+	if minDepthStr := req.FormValue("mindepth"); minDepthStr != "" {
+		if _, err := fmt.Sscan(minDepthStr, &minDepth); err != nil {
+			writeError(w, "could not parse mindepth: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	forks := []modules.ConsensusFork{}
+	for _, fork := range srv.cs.Forks() {
+		if fork.Depth >= minDepth {
+			forks = append(forks, fork)
+		}
+	}
+	staleBlocks := srv.cs.StaleBlocks()
+	if staleBlocks == nil {
+		staleBlocks = []modules.StaleBlock{}
+	}
+	writeJSON(w, ConsensusForksGET{
+		Forks:       forks,
+		StaleBlocks: staleBlocks,
+	})
+}
+
+// consensusSnapshotHandler handles the API calls to /consensus/snapshot.
+func (srv *Server) consensusSnapshotHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var height types.BlockHeight
+	if _, err := fmt.Sscan(req.FormValue("height"), &height); err != nil {
+		writeError(w, "could not parse height: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	destination := req.FormValue("destination")
+	if destination == "" {
+		writeError(w, "destination must be provided", http.StatusBadRequest)
+		return
+	}
+	snapshot, err := srv.cs.ExportSnapshot(height, destination)
+	if err != nil {
+		writeError(w, "could not export snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ConsensusSnapshotPOST{
+		Height:   snapshot.Height,
+		BlockID:  snapshot.BlockID,
+		ChangeID: crypto.Hash(snapshot.ChangeID),
+		Checksum: snapshot.Checksum,
+		Filename: snapshot.Filename,
+	})
+}
+
+const (
+	// consensusStreamBuffer is the number of consensus changes that are
+	// queued for a /consensus/subscribe client. A client that has caught up
+	// with the consensus set and then falls further behind is disconnected,
+	// and can resume the stream from the last change it received.
+	consensusStreamBuffer = 100
+)
+
+// consensusStream is a consensus set subscriber that queues consensus changes
+// for a /consensus/subscribe client.
+type consensusStream struct {
+	changes   chan modules.ConsensusChange
+	caughtUp  chan struct{}
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber. While the
+// existing changes are replayed by ConsensusSetSubscribe, it waits for the
+// client to receive each change, so that a client catching up from an old
+// change is not disconnected. Afterwards, the consensus set calls
+// ProcessConsensusChange while holding its lock, so it never blocks. If the
+// queue is full, the stream is closed instead, and no later changes are
+// queued, so the client receives an unbroken sequence of changes that it can
+// resume from.
+func (s *consensusStream) ProcessConsensusChange(cc modules.ConsensusChange) {
+	select {
+	case <-s.closeChan:
+		return
+	default:
+	}
+	select {
+	case <-s.caughtUp:
+	default:
+		select {
+		case s.changes <- cc:
+		case <-s.closeChan:
+		}
+		return
+	}
+	select {
+	case s.changes <- cc:
+	default:
+		s.close()
+	}
+}
+
+// close stops the stream. It is safe to call close more than once.
+func (s *consensusStream) close() {
+	s.closeOnce.Do(func() { close(s.closeChan) })
+}
+
+// scanConsensusChangeID scans a consensus change id from a string. The
+// strings "beginning" and "recent" correspond to
+// modules.ConsensusChangeBeginning and modules.ConsensusChangeRecent.
+func scanConsensusChangeID(idStr string) (modules.ConsensusChangeID, error) {
+	switch idStr {
+	case "beginning":
+		return modules.ConsensusChangeBeginning, nil
+	case "recent":
+		return modules.ConsensusChangeRecent, nil
+	}
+	h, err := scanHash(idStr)
+	if err != nil {
+		return modules.ConsensusChangeID{}, err
+	}
+	return modules.ConsensusChangeID(h), nil
+}
+
+// consensusSubscribeHandler handles the API calls to /consensus/subscribe/:id.
+// It streams every consensus change after the change with the given id as a
+// sequence of JSON objects, until the client disconnects.
+func (srv *Server) consensusSubscribeHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	start, err := scanConsensusChangeID(ps.ByName("id"))
+	if err != nil {
+		writeError(w, "could not parse consensus change id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	var clientGone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		clientGone = cn.CloseNotify()
+	}
+
+	// ConsensusSetSubscribe does not return until the client has been sent
+	// every existing change, so it is called in its own goroutine. The
+	// subscriber is removed once the handler has returned and the
+	// subscription has finished.
+	s := &consensusStream{
+		changes:   make(chan modules.ConsensusChange, consensusStreamBuffer),
+		caughtUp:  make(chan struct{}),
+		closeChan: make(chan struct{}),
+	}
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- srv.cs.ConsensusSetSubscribe(s, start)
+		close(s.caughtUp)
+	}()
+	defer func() {
+		s.close()
+		go func() {
+			<-s.caughtUp
+			srv.cs.Unsubscribe(s)
+		}()
+	}()
+
+	enc := json.NewEncoder(w)
+	send := func(cc modules.ConsensusChange) error {
+		err := enc.Encode(ConsensusChangeGET{
+			ID:                        crypto.Hash(cc.ID),
+			RevertedBlocks:            cc.RevertedBlocks,
+			AppliedBlocks:             cc.AppliedBlocks,
+			SiacoinOutputDiffs:        cc.SiacoinOutputDiffs,
+			FileContractDiffs:         cc.FileContractDiffs,
+			SiafundOutputDiffs:        cc.SiafundOutputDiffs,
+			DelayedSiacoinOutputDiffs: cc.DelayedSiacoinOutputDiffs,
+			SiafundPoolDiffs:          cc.SiafundPoolDiffs,
+		})
+		if err != nil {
+			return err
+		}
+		f.Flush()
+		return nil
+	}
+	for {
+		select {
+		case cc := <-s.changes:
+			if send(cc) != nil {
+				return
+			}
+		case err := <-subscribeErr:
+			if err != nil {
+				writeError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case <-s.closeChan:
+			// The client fell behind. Send the changes that were queued
+			// before the stream was closed, so that the client can resume
+			// from the last of them.
+			for {
+				select {
+				case cc := <-s.changes:
+					if send(cc) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-clientGone:
+			return
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -33,3 +37,248 @@ func TestIntegrationConsensusGET(t *testing.T) {
 		t.Error("wrong target returned in consensus GET call")
 	}
 }
+
+// TestIntegrationConsensusQueries probes the GET calls to /consensus/blocks,
+// /consensus/siacoinoutputs, /consensus/filecontracts, /consensus/siafundpool,
+// /consensus/forks and /consensus/consistency.
+func TestIntegrationConsensusQueries(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	st, err := createServerTester("TestIntegrationConsensusQueries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Fetch a block by height, then by id.
+	var cbg ConsensusBlocksGET
+	err = st.getAPI("/consensus/blocks?height=1", &cbg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := st.server.cs.BlockAtHeight(1)
+	if cbg.Height != 1 || cbg.ID != block.ID() || cbg.Block.ID() != block.ID() {
+		t.Error("wrong block returned when querying by height")
+	}
+	var cbg2 ConsensusBlocksGET
+	err = st.getAPI("/consensus/blocks?id="+block.ID().String(), &cbg2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cbg2.Height != 1 || cbg2.ID != block.ID() {
+		t.Error("wrong block returned when querying by id")
+	}
+	if err := st.stdGetAPI("/consensus/blocks"); err == nil {
+		t.Error("expected an error when neither id nor height is provided")
+	}
+	if err := st.stdGetAPI("/consensus/blocks?height=1000"); err == nil {
+		t.Error("expected an error when querying a nonexistent block")
+	}
+
+	// The miner payout of the first block has matured, and should be in the
+	// consensus set.
+	var csog ConsensusSiacoinOutputsGET
+	err = st.getAPI("/consensus/siacoinoutputs/"+block.MinerPayoutID(0).String(), &csog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csog.SiacoinOutput.Value.Cmp(block.MinerPayouts[0].Value) != 0 {
+		t.Error("wrong siacoin output returned")
+	}
+	if err := st.stdGetAPI("/consensus/siacoinoutputs/foo"); err == nil {
+		t.Error("expected an error when querying a malformed id")
+	}
+
+	// No file contracts have been formed.
+	if err := st.stdGetAPI("/consensus/filecontracts/" + types.FileContractID{}.String()); err == nil {
+		t.Error("expected an error when querying a nonexistent file contract")
+	}
+
+	var csfpg ConsensusSiafundPoolGET
+	err = st.getAPI("/consensus/siafundpool", &csfpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csfpg.SiafundPool.Cmp(st.server.cs.SiafundPool()) != 0 {
+		t.Error("wrong siafund pool returned")
+	}
+
+	var cfg ConsensusForksGET
+	err = st.getAPI("/consensus/forks", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Forks) != 0 || len(cfg.StaleBlocks) != 0 {
+		t.Error("forks were reported without any reorgs")
+	}
+	if err := st.stdGetAPI("/consensus/forks?mindepth=foo"); err == nil {
+		t.Error("expected an error when mindepth is malformed")
+	}
+
+	var ccg ConsensusConsistencyGET
+	err = st.getAPI("/consensus/consistency", &ccg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ccg.Inconsistent {
+		t.Error("consensus set reported as inconsistent")
+	}
+}
+
+// TestIntegrationConsensusSubscribe probes the /consensus/subscribe stream,
+// including resuming the stream from a consensus change id.
+func TestIntegrationConsensusSubscribe(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	st, err := createServerTester("TestIntegrationConsensusSubscribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	streamURL := "http://" + st.server.listener.Addr().String() + "/consensus/subscribe/"
+
+	// Subscribe from the beginning and read changes until the current block
+	// has been applied.
+	resp, err := HttpGET(streamURL + "beginning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(resp.Body)
+	var ids []crypto.Hash
+	for {
+		var cc ConsensusChangeGET
+		if err := dec.Decode(&cc); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) == 0 && (len(cc.AppliedBlocks) != 1 || cc.AppliedBlocks[0].ID() != types.GenesisBlock.ID()) {
+			t.Fatal("first consensus change does not apply the genesis block")
+		}
+		ids = append(ids, cc.ID)
+		if cc.AppliedBlocks[len(cc.AppliedBlocks)-1].ID() == st.server.cs.CurrentBlock().ID() {
+			break
+		}
+	}
+
+	// New blocks should be streamed as they are added.
+	block, err := st.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cc ConsensusChangeGET
+	if err := dec.Decode(&cc); err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.AppliedBlocks) != 1 || cc.AppliedBlocks[0].ID() != block.ID() {
+		t.Fatal("new block was not streamed")
+	}
+	resp.Body.Close()
+
+	// Resume the stream from the second change.
+	resp, err = HttpGET(streamURL + ids[1].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&cc); err != nil {
+		t.Fatal(err)
+	}
+	if cc.ID != ids[2] {
+		t.Fatal("resumed stream did not start after the provided change")
+	}
+
+	// Subscribing from an unknown change should fail.
+	if err := st.stdGetAPI("/consensus/subscribe/" + crypto.Hash{2}.String()); err == nil {
+		t.Fatal("expected an error when subscribing from an unknown change")
+	}
+}
+
+// TestConsensusStreamFull checks that a consensus stream with a full queue is
+// closed instead of blocking the consensus set, and that no changes are
+// queued after it has been closed.
+func TestConsensusStreamFull(t *testing.T) {
+	s := &consensusStream{
+		changes:   make(chan modules.ConsensusChange, 2),
+		caughtUp:  make(chan struct{}),
+		closeChan: make(chan struct{}),
+	}
+	close(s.caughtUp)
+	for i := byte(0); i < 3; i++ {
+		done := make(chan struct{})
+		go func(id modules.ConsensusChangeID) {
+			s.ProcessConsensusChange(modules.ConsensusChange{ID: id})
+			close(done)
+		}(modules.ConsensusChangeID{i})
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("ProcessConsensusChange blocked on a full queue")
+		}
+	}
+	select {
+	case <-s.closeChan:
+	default:
+		t.Fatal("stream was not closed when its queue was full")
+	}
+
+	// Draining the queue should not allow further changes to be queued.
+	<-s.changes
+	<-s.changes
+	s.ProcessConsensusChange(modules.ConsensusChange{ID: modules.ConsensusChangeID{3}})
+	if len(s.changes) != 0 {
+		t.Fatal("change was queued after the stream was closed")
+	}
+}
+
+// TestConsensusStreamReplay checks that a consensus stream waits for the
+// client while the existing changes are replayed, instead of closing once its
+// queue is full, and that it stops waiting when it is closed.
+func TestConsensusStreamReplay(t *testing.T) {
+	s := &consensusStream{
+		changes:   make(chan modules.ConsensusChange, 2),
+		caughtUp:  make(chan struct{}),
+		closeChan: make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := byte(0); i < 5; i++ {
+			s.ProcessConsensusChange(modules.ConsensusChange{ID: modules.ConsensusChangeID{i}})
+		}
+		close(done)
+	}()
+	for i := byte(0); i < 5; i++ {
+		select {
+		case cc := <-s.changes:
+			if cc.ID != (modules.ConsensusChangeID{i}) {
+				t.Fatal("changes were not queued in order")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("change was not queued during the replay")
+		}
+	}
+	<-done
+	select {
+	case <-s.closeChan:
+		t.Fatal("stream was closed during the replay")
+	default:
+	}
+
+	// A closed stream should not block the replay.
+	for i := byte(0); i < 2; i++ {
+		s.ProcessConsensusChange(modules.ConsensusChange{})
+	}
+	done = make(chan struct{})
+	go func() {
+		s.ProcessConsensusChange(modules.ConsensusChange{})
+		close(done)
+	}()
+	s.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("closed stream blocked the replay")
+	}
+}
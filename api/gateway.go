@@ -12,6 +12,12 @@ import (
 type GatewayInfo struct {
 	NetAddress modules.NetAddress `json:"netaddress"`
 	Peers      []modules.Peer     `json:"peers"`
+	Nodes      []modules.Node     `json:"nodes"`
+}
+
+// GatewayBlocklistGET contains the hosts that the gateway has banned.
+type GatewayBlocklistGET struct {
+	Blocklist []modules.BannedPeer `json:"blocklist"`
 }
 
 // gatewayHandler handles the API call asking for the gatway status.
@@ -23,7 +29,11 @@ func (srv *Server) gatewayHandler(w http.ResponseWriter, req *http.Request, _ ht
 	if peers == nil {
 		peers = make([]modules.Peer, 0)
 	}
-	writeJSON(w, GatewayInfo{srv.gateway.Address(), peers})
+	nodes := srv.gateway.Nodes()
+	if nodes == nil {
+		nodes = make([]modules.Node, 0)
+	}
+	writeJSON(w, GatewayInfo{srv.gateway.Address(), peers, nodes})
 }
 
 // gatewayAddHandler handles the API call to add a peer to the gateway.
@@ -49,3 +59,37 @@ func (srv *Server) gatewayRemoveHandler(w http.ResponseWriter, req *http.Request
 
 	writeSuccess(w)
 }
+
+// gatewayBlocklistHandler handles the API call asking for the gateway's
+// blocklist.
+func (srv *Server) gatewayBlocklistHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	blocklist := srv.gateway.Blocklist()
+	if blocklist == nil {
+		blocklist = make([]modules.BannedPeer, 0)
+	}
+	writeJSON(w, GatewayBlocklistGET{blocklist})
+}
+
+// gatewayBlocklistAddHandler handles the API call to ban a peer.
+func (srv *Server) gatewayBlocklistAddHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	addr := modules.NetAddress(ps.ByName("netaddress"))
+	err := srv.gateway.Ban(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
+
+// gatewayBlocklistRemoveHandler handles the API call to unban a peer.
+func (srv *Server) gatewayBlocklistRemoveHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	addr := modules.NetAddress(ps.ByName("netaddress"))
+	err := srv.gateway.Unban(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
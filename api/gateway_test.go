@@ -72,3 +72,44 @@ func TestGatewayPeerRemove(t *testing.T) {
 		t.Fatal("/gateway/remove did not remove peer", peer.Address())
 	}
 }
+
+// TestGatewayBlocklist tests the /gateway/blocklist calls.
+func TestGatewayBlocklist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestGatewayBlocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	peer, err := gateway.New("localhost:0", build.TempDir("api", "TestGatewayBlocklist", "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.stdPostAPI("/gateway/add/"+string(peer.Address()), nil)
+
+	err = st.stdPostAPI("/gateway/blocklist/add/"+string(peer.Address()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bl GatewayBlocklistGET
+	st.getAPI("/gateway/blocklist", &bl)
+	if len(bl.Blocklist) != 1 || bl.Blocklist[0].Host != peer.Address().Host() {
+		t.Fatal("/gateway/blocklist/add did not ban peer", peer.Address())
+	}
+	var info GatewayInfo
+	st.getAPI("/gateway", &info)
+	if len(info.Peers) != 0 {
+		t.Fatal("/gateway/blocklist/add did not disconnect peer", peer.Address())
+	}
+
+	err = st.stdPostAPI("/gateway/blocklist/remove/"+string(peer.Address()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.getAPI("/gateway/blocklist", &bl)
+	if len(bl.Blocklist) != 0 {
+		t.Fatal("/gateway/blocklist/remove did not unban peer", peer.Address())
+	}
+}
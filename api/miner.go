@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/julienschmidt/httprouter"
@@ -18,6 +19,14 @@ type (
 		CPUMining        bool `json:"cpumining"`
 		StaleBlocksMined int  `json:"staleblocksmined"`
 	}
+
+	// MinerPoolGET contains the information that is returned after a GET
+	// request to /miner/pool.
+	MinerPoolGET struct {
+		Address string               `json:"address"`
+		Running bool                 `json:"running"`
+		Workers []modules.PoolWorker `json:"workers"`
+	}
 )
 
 // minerHandler handles the API call that queries the miner's status.
@@ -71,3 +80,43 @@ func (srv *Server) minerHeaderHandlerPOST(w http.ResponseWriter, req *http.Reque
 	}
 	writeSuccess(w)
 }
+
+// minerPoolHandler handles the API call that queries the status of the pool
+// server.
+func (srv *Server) minerPoolHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr := srv.miner.PoolAddress()
+	workers := srv.miner.PoolWorkers()
+	if workers == nil {
+		workers = []modules.PoolWorker{}
+	}
+	writeJSON(w, MinerPoolGET{
+		Address: addr,
+		Running: addr != "",
+		Workers: workers,
+	})
+}
+
+// minerPoolStartHandler handles the API call that starts the pool server.
+func (srv *Server) minerPoolStartHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr := req.FormValue("addr")
+	if addr == "" {
+		writeError(w, "addr must be specified", http.StatusBadRequest)
+		return
+	}
+	err := srv.miner.StartPool(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// minerPoolStopHandler handles the API call that stops the pool server.
+func (srv *Server) minerPoolStopHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	err := srv.miner.StopPool()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
@@ -147,3 +147,48 @@ func TestIntegrationMinerHeader(t *testing.T) {
 		t.Errorf("block height did not increase after trying to mine a block through the api, started at %v and ended at %v", startingHeight, st.cs.Height())
 	}
 }
+
+// TestIntegrationMinerPool checks that the pool server can be started and
+// stopped through the api.
+func TestIntegrationMinerPool(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationMinerPool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	var mpg MinerPoolGET
+	if err := st.getAPI("/miner/pool", &mpg); err != nil {
+		t.Fatal(err)
+	}
+	if mpg.Running || mpg.Workers == nil {
+		t.Fatal("pool server is reported as running before it was started")
+	}
+	if err := st.stdGetAPI("/miner/pool/start"); err == nil {
+		t.Error("pool server was started without an address")
+	}
+	if err := st.stdGetAPI("/miner/pool/start?addr=localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.getAPI("/miner/pool", &mpg); err != nil {
+		t.Fatal(err)
+	}
+	if !mpg.Running || mpg.Address != st.server.miner.PoolAddress() {
+		t.Error("pool server is not reported as running")
+	}
+	if err := st.stdGetAPI("/miner/pool/stop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdGetAPI("/miner/pool/stop"); err == nil {
+		t.Error("stopping a stopped pool server did not return an error")
+	}
+	if err := st.getAPI("/miner/pool", &mpg); err != nil {
+		t.Fatal(err)
+	}
+	if mpg.Running {
+		t.Error("pool server is reported as running after it was stopped")
+	}
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/hex"
 	"math/big"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -25,3 +27,15 @@ func scanAddress(addrStr string) (addr types.UnlockHash, err error) {
 	}
 	return addr, nil
 }
+
+// scanHash scans a crypto.Hash from a hex string. The result can be typecast
+// to any of the id types.
+func scanHash(hashStr string) (h crypto.Hash, err error) {
+	if len(hashStr) != crypto.HashSize*2 {
+		return crypto.Hash{}, crypto.ErrHashWrongLen
+	}
+	if _, err = hex.Decode(h[:], []byte(hashStr)); err != nil {
+		return crypto.Hash{}, err
+	}
+	return h, nil
+}
@@ -126,11 +126,8 @@ func (srv *Server) Close() error {
 		}
 	}
 	if srv.wallet != nil {
-		// TODO: close wallet and lock the wallet in the wallet's Close method.
-		if srv.wallet.Unlocked() {
-			if err := srv.wallet.Lock(); err != nil {
-				errs = append(errs, fmt.Errorf("wallet.Lock failed: %v", err))
-			}
+		if err := srv.wallet.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("wallet.Close failed: %v", err))
 		}
 	}
 	// TODO: close transaction pool
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/NebulousLabs/Sia/types"
@@ -17,3 +18,21 @@ type TransactionPoolGET struct {
 func (srv *Server) transactionpoolTransactionsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	writeJSON(w, TransactionPoolGET{Transactions: srv.tpool.TransactionList()})
 }
+
+// transactionpoolTransactionsPOSTHandler handles the API call to submit a
+// transaction set, such as a transaction that was signed offline, to the
+// transaction pool.
+func (srv *Server) transactionpoolTransactionsPOSTHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var txns []types.Transaction
+	err := json.Unmarshal([]byte(req.FormValue("transactions")), &txns)
+	if err != nil {
+		writeError(w, "could not read 'transactions' from POST call to /transactionpool/transactions: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = srv.tpool.AcceptTransactionSet(txns)
+	if err != nil {
+		writeError(w, "error after call to /transactionpool/transactions: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +17,20 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+const (
+	// defaultHistoryLimit is the number of transactions returned by
+	// /wallet/history if no limit is provided.
+	defaultHistoryLimit = 50
+
+	// historyExportPageSize is the number of transactions that are read from
+	// the wallet at a time by /wallet/history/export.
+	historyExportPageSize = 1000
+
+	// historyExportErrorTrailer is the HTTP trailer that reports an error that
+	// interrupted /wallet/history/export after the response was started.
+	historyExportErrorTrailer = "Sia-Export-Error"
+)
+
 type (
 	// WalletGET contains general information about the wallet.
 	WalletGET struct {
@@ -39,6 +57,12 @@ type (
 		Addresses []types.UnlockHash `json:"addresses"`
 	}
 
+	// WalletDefragPOST contains the transactions created in the POST call to
+	// /wallet/defrag.
+	WalletDefragPOST struct {
+		TransactionIDs []types.TransactionID `json:"transactionids"`
+	}
+
 	// WalletInitPOST contains the primary seed that gets generated during a
 	// POST call to /wallet/init.
 	WalletInitPOST struct {
@@ -53,6 +77,40 @@ type (
 		PrimarySeed string `json:"primaryseed"`
 	}
 
+	// WalletHistoryGET contains a page of the transaction history returned by
+	// /wallet/history. NextCursor is the cursor of the next page, and is zero
+	// once the end of the history has been reached.
+	WalletHistoryGET struct {
+		Transactions []modules.ProcessedTransaction `json:"transactions"`
+		NextCursor   uint64                         `json:"nextcursor"`
+	}
+
+	// WalletHistoryExportEntry is a transaction of the history exported by
+	// /wallet/history/export, reduced to the siacoins and siafunds that it
+	// moved into and out of the wallet.
+	WalletHistoryExportEntry struct {
+		TransactionID         types.TransactionID `json:"transactionid"`
+		ConfirmationHeight    types.BlockHeight   `json:"confirmationheight"`
+		ConfirmationTimestamp types.Timestamp     `json:"confirmationtimestamp"`
+		IncomingSiacoins      types.Currency      `json:"incomingsiacoins"`
+		OutgoingSiacoins      types.Currency      `json:"outgoingsiacoins"`
+		IncomingSiafunds      types.Currency      `json:"incomingsiafunds"`
+		OutgoingSiafunds      types.Currency      `json:"outgoingsiafunds"`
+	}
+
+	// WalletMultisigCreatePOST contains the multisig address created in the
+	// POST call to /wallet/multisig/create.
+	WalletMultisigCreatePOST struct {
+		Address          types.UnlockHash       `json:"address"`
+		UnlockConditions types.UnlockConditions `json:"unlockconditions"`
+	}
+
+	// WalletMultisigPublicKeyGET contains a public key of the wallet that can
+	// be given to a cosigner of a multisig address.
+	WalletMultisigPublicKeyGET struct {
+		PublicKey types.SiaPublicKey `json:"publickey"`
+	}
+
 	// WalletSiacoinsPOST contains the transaction sent in the POST call to
 	// /wallet/siafunds.
 	WalletSiacoinsPOST struct {
@@ -65,6 +123,20 @@ type (
 		TransactionIDs []types.TransactionID `json:"transactionids"`
 	}
 
+	// WalletSiafundsClaimPOST contains the transactions created in the POST
+	// call to /wallet/siafunds/claim.
+	WalletSiafundsClaimPOST struct {
+		TransactionIDs []types.TransactionID `json:"transactionids"`
+	}
+
+	// WalletSiafundsClaimsGET contains the siacoin claims of the siafund
+	// outputs of the wallet, and the claims that were paid out when siafund
+	// outputs of the wallet were spent.
+	WalletSiafundsClaimsGET struct {
+		Claims  []modules.SiafundClaim `json:"claims"`
+		Payouts []modules.ClaimPayout  `json:"payouts"`
+	}
+
 	// WalletSeedsGET contains the seeds used by the wallet.
 	WalletSeedsGET struct {
 		PrimarySeed        string   `json:"primaryseed"`
@@ -72,6 +144,13 @@ type (
 		AllSeeds           []string `json:"allseeds"`
 	}
 
+	// WalletSweepPOST contains the coins and funds returned by a call to
+	// /wallet/sweep/seed.
+	WalletSweepPOST struct {
+		Coins types.Currency `json:"coins"`
+		Funds types.Currency `json:"funds"`
+	}
+
 	// WalletTransactionGETid contains the transaction returned by a call to
 	// /wallet/transaction/$(id)
 	WalletTransactionGETid struct {
@@ -92,6 +171,19 @@ type (
 		ConfirmedTransactions   []modules.ProcessedTransaction `json:"confirmedtransactions"`
 		UnconfirmedTransactions []modules.ProcessedTransaction `json:"unconfirmedtransactions"`
 	}
+
+	// WalletWatchGET contains the addresses watched by the wallet and their
+	// confirmed balance.
+	WalletWatchGET struct {
+		Addresses      []modules.WatchedAddress `json:"addresses"`
+		SiacoinBalance types.Currency           `json:"siacoinbalance"`
+		SiafundBalance types.Currency           `json:"siafundbalance"`
+	}
+
+	// WalletUnspentGET contains the outputs that are spendable by the wallet.
+	WalletUnspentGET struct {
+		Outputs []modules.UnspentOutput `json:"outputs"`
+	}
 )
 
 // encryptionKeys enumerates the possible encryption keys that can be derived
@@ -173,6 +265,22 @@ func (srv *Server) walletBackupHandler(w http.ResponseWriter, req *http.Request,
 	writeSuccess(w)
 }
 
+// walletDefragHandler handles API calls to /wallet/defrag.
+func (srv *Server) walletDefragHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	txns, err := srv.wallet.Defrag()
+	if err != nil {
+		writeError(w, "error after call to /wallet/defrag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var txids []types.TransactionID
+	for _, txn := range txns {
+		txids = append(txids, txn.ID())
+	}
+	writeJSON(w, WalletDefragPOST{
+		TransactionIDs: txids,
+	})
+}
+
 // walletInitHandler handles API calls to /wallet/init.
 func (srv *Server) walletInitHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var encryptionKey crypto.TwofishKey
@@ -224,6 +332,28 @@ func (srv *Server) walletSeedHandler(w http.ResponseWriter, req *http.Request, _
 	writeError(w, "error when calling /wallet/seed: "+modules.ErrBadEncryptionKey.Error(), http.StatusBadRequest)
 }
 
+// walletSweepSeedHandler handles API calls to /wallet/sweep/seed.
+func (srv *Server) walletSweepSeedHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	dictID := mnemonics.DictionaryID(req.FormValue("dictionary"))
+	seed, err := modules.StringToSeed(req.FormValue("seed"), dictID)
+	if err != nil {
+		writeError(w, "error when calling /wallet/sweep/seed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	coins, funds, err := srv.wallet.SweepSeed(seed)
+	if err != nil && (!coins.IsZero() || !funds.IsZero()) {
+		writeError(w, fmt.Sprintf("error when calling /wallet/sweep/seed: %v (%v hastings and %v siafunds were swept before the error)", err, coins, funds), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeError(w, "error when calling /wallet/sweep/seed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, WalletSweepPOST{
+		Coins: coins,
+		Funds: funds,
+	})
+}
+
 // walletSiagkeyHandler handles API calls to /wallet/siagkey.
 func (srv *Server) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	// Fetch the list of keyfiles from the post body.
@@ -296,21 +426,40 @@ func (srv *Server) walletSeedsHandler(w http.ResponseWriter, req *http.Request,
 
 // walletSiacoinsHandler handles API calls to /wallet/siacoins.
 func (srv *Server) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	amount, ok := scanAmount(req.FormValue("amount"))
-	if !ok {
-		writeError(w, "could not read 'amount' from POST call to /wallet/siacoins", http.StatusBadRequest)
-		return
-	}
-	dest, err := scanAddress(req.FormValue("destination"))
-	if err != nil {
-		writeError(w, "error after call to /wallet/siacoins: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	txns, err := srv.wallet.SendSiacoins(amount, dest)
-	if err != nil {
-		writeError(w, "error after call to /wallet/siacoins: "+err.Error(), http.StatusInternalServerError)
-		return
+	var txns []types.Transaction
+	if req.FormValue("outputs") != "" {
+		// Multiple outputs are paid in a single transaction.
+		if req.FormValue("amount") != "" || req.FormValue("destination") != "" {
+			writeError(w, "cannot combine 'outputs' with 'amount' or 'destination' in POST call to /wallet/siacoins", http.StatusBadRequest)
+			return
+		}
+		var outputs []types.SiacoinOutput
+		err := json.Unmarshal([]byte(req.FormValue("outputs")), &outputs)
+		if err != nil {
+			writeError(w, "could not read 'outputs' from POST call to /wallet/siacoins: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		txns, err = srv.wallet.SendSiacoinsMulti(outputs)
+		if err != nil {
+			writeError(w, "error after call to /wallet/siacoins: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		amount, ok := scanAmount(req.FormValue("amount"))
+		if !ok {
+			writeError(w, "could not read 'amount' from POST call to /wallet/siacoins", http.StatusBadRequest)
+			return
+		}
+		dest, err := scanAddress(req.FormValue("destination"))
+		if err != nil {
+			writeError(w, "error after call to /wallet/siacoins: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		txns, err = srv.wallet.SendSiacoins(amount, dest)
+		if err != nil {
+			writeError(w, "error after call to /wallet/siacoins: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 	var txids []types.TransactionID
 	for _, txn := range txns {
@@ -348,6 +497,35 @@ func (srv *Server) walletSiafundsHandler(w http.ResponseWriter, req *http.Reques
 	})
 }
 
+// walletSiafundsClaimHandler handles API calls to /wallet/siafunds/claim.
+func (srv *Server) walletSiafundsClaimHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	txns, err := srv.wallet.ClaimSiafunds()
+	if err != nil {
+		writeError(w, "error after call to /wallet/siafunds/claim: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var txids []types.TransactionID
+	for _, txn := range txns {
+		txids = append(txids, txn.ID())
+	}
+	writeJSON(w, WalletSiafundsClaimPOST{
+		TransactionIDs: txids,
+	})
+}
+
+// walletSiafundsClaimsHandler handles API calls to /wallet/siafunds/claims.
+func (srv *Server) walletSiafundsClaimsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	payouts, err := srv.wallet.ClaimHistory()
+	if err != nil {
+		writeError(w, "error after call to /wallet/siafunds/claims: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, WalletSiafundsClaimsGET{
+		Claims:  srv.wallet.SiafundClaims(),
+		Payouts: payouts,
+	})
+}
+
 // walletTransactionHandler handles API calls to /wallet/transaction/:id.
 func (srv *Server) walletTransactionHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Parse the id from the url.
@@ -415,6 +593,170 @@ func (srv *Server) walletTransactionsAddrHandler(w http.ResponseWriter, req *htt
 	})
 }
 
+// scanTransactionFilter parses the history filter of a call to
+// /wallet/history or /wallet/history/export.
+func scanTransactionFilter(req *http.Request) (filter modules.TransactionFilter, err error) {
+	filter.Direction = req.FormValue("direction")
+	if fundType := req.FormValue("fundtype"); fundType != "" {
+		if len(fundType) > types.SpecifierLen {
+			return modules.TransactionFilter{}, errors.New("could not read fund type")
+		}
+		copy(filter.FundType[:], fundType)
+	}
+	if addr := req.FormValue("address"); addr != "" {
+		filter.Address, err = scanAddress(addr)
+		if err != nil {
+			return modules.TransactionFilter{}, errors.New("could not read address: " + err.Error())
+		}
+	}
+	if minAmount := req.FormValue("minamount"); minAmount != "" {
+		var ok bool
+		filter.MinAmount, ok = scanAmount(minAmount)
+		if !ok {
+			return modules.TransactionFilter{}, errors.New("could not read minimum amount")
+		}
+	}
+	if maxAmount := req.FormValue("maxamount"); maxAmount != "" {
+		var ok bool
+		filter.MaxAmount, ok = scanAmount(maxAmount)
+		if !ok {
+			return modules.TransactionFilter{}, errors.New("could not read maximum amount")
+		}
+	}
+	return filter, nil
+}
+
+// walletHistoryHandler handles API calls to /wallet/history.
+func (srv *Server) walletHistoryHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	filter, err := scanTransactionFilter(req)
+	if err != nil {
+		writeError(w, "error after call to /wallet/history: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var cursor uint64
+	if cursorStr := req.FormValue("cursor"); cursorStr != "" {
+		cursor, err = strconv.ParseUint(cursorStr, 10, 64)
+		if err != nil {
+			writeError(w, "error after call to /wallet/history: could not read cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultHistoryLimit
+	if limitStr := req.FormValue("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			writeError(w, "error after call to /wallet/history: could not read limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pts, next, err := srv.wallet.TransactionHistory(cursor, limit, filter)
+	if err != nil {
+		writeError(w, "error after call to /wallet/history: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, WalletHistoryGET{
+		Transactions: pts,
+		NextCursor:   next,
+	})
+}
+
+// walletHistoryExportHandler handles API calls to /wallet/history/export. The
+// history is read and written one page at a time, so that the whole history
+// is never held in memory. Once the response has been started, an error can
+// no longer be reported with a status code; instead the document is left
+// unterminated and the error is sent in the historyExportErrorTrailer
+// trailer.
+func (srv *Server) walletHistoryExportHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	filter, err := scanTransactionFilter(req)
+	if err != nil {
+		writeError(w, "error after call to /wallet/history/export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := req.FormValue("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "csv" && format != "json" {
+		writeError(w, "error after call to /wallet/history/export: format must be 'csv' or 'json'", http.StatusBadRequest)
+		return
+	}
+
+	// Read the first page before writing anything, so that an invalid filter
+	// can still be reported as an error.
+	pts, next, err := srv.wallet.TransactionHistory(0, historyExportPageSize, filter)
+	if err != nil {
+		writeError(w, "error after call to /wallet/history/export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Trailer", historyExportErrorTrailer)
+	var csvw *csv.Writer
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		csvw = csv.NewWriter(w)
+		csvw.Write([]string{"transactionid", "confirmationheight", "confirmationtimestamp", "incomingsiacoins", "outgoingsiacoins", "incomingsiafunds", "outgoingsiafunds"})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+	}
+	first := true
+	for {
+		for _, pt := range pts {
+			entry := WalletHistoryExportEntry{
+				TransactionID:         pt.TransactionID,
+				ConfirmationHeight:    pt.ConfirmationHeight,
+				ConfirmationTimestamp: pt.ConfirmationTimestamp,
+			}
+			entry.IncomingSiacoins, entry.OutgoingSiacoins, entry.IncomingSiafunds, entry.OutgoingSiafunds = modules.WalletFlows(pt)
+			if csvw != nil {
+				csvw.Write([]string{
+					entry.TransactionID.String(),
+					strconv.FormatUint(uint64(entry.ConfirmationHeight), 10),
+					strconv.FormatUint(uint64(entry.ConfirmationTimestamp), 10),
+					entry.IncomingSiacoins.String(),
+					entry.OutgoingSiacoins.String(),
+					entry.IncomingSiafunds.String(),
+					entry.OutgoingSiafunds.String(),
+				})
+				continue
+			}
+			b, err := json.Marshal(entry)
+			if err != nil {
+				w.Header().Set(historyExportErrorTrailer, err.Error())
+				return
+			}
+			if !first {
+				w.Write([]byte(","))
+			}
+			w.Write(b)
+			first = false
+		}
+		if next == 0 {
+			break
+		}
+		pts, next, err = srv.wallet.TransactionHistory(next, historyExportPageSize, filter)
+		if err != nil {
+			// Neither close the JSON array nor flush the rest of the CSV, so
+			// that the export is not mistaken for a complete one.
+			w.Header().Set(historyExportErrorTrailer, err.Error())
+			return
+		}
+	}
+	if csvw != nil {
+		csvw.Flush()
+	} else {
+		w.Write([]byte("]\n"))
+	}
+}
+
+// walletUnspentHandler handles API calls to /wallet/unspent.
+func (srv *Server) walletUnspentHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, WalletUnspentGET{
+		Outputs: srv.wallet.UnspentOutputs(),
+	})
+}
+
 // walletUnlockHandler handles API calls to /wallet/unlock.
 func (srv *Server) walletUnlockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
@@ -431,3 +773,186 @@ func (srv *Server) walletUnlockHandler(w http.ResponseWriter, req *http.Request,
 	}
 	writeError(w, "error when calling /wallet/unlock: "+modules.ErrBadEncryptionKey.Error(), http.StatusBadRequest)
 }
+
+// walletChangePasswordHandler handles API calls to /wallet/changepassword.
+func (srv *Server) walletChangePasswordHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	newPassword := req.FormValue("newpassword")
+	if newPassword == "" {
+		writeError(w, "error when calling /wallet/changepassword: a new password must be provided", http.StatusBadRequest)
+		return
+	}
+	newKey := crypto.TwofishKey(crypto.HashObject(newPassword))
+	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
+	for _, key := range potentialKeys {
+		err := srv.wallet.ChangeKey(key, newKey)
+		if err == nil {
+			writeSuccess(w)
+			return
+		}
+		if err != nil && err != modules.ErrBadEncryptionKey {
+			writeError(w, "error when calling /wallet/changepassword: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	writeError(w, "error when calling /wallet/changepassword: "+modules.ErrBadEncryptionKey.Error(), http.StatusBadRequest)
+}
+
+// walletWatchHandler handles API calls to /wallet/watch.
+func (srv *Server) walletWatchHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	siacoinBal, siafundBal := srv.wallet.WatchOnlyBalance()
+	writeJSON(w, WalletWatchGET{
+		Addresses:      srv.wallet.WatchAddresses(),
+		SiacoinBalance: siacoinBal,
+		SiafundBalance: siafundBal,
+	})
+}
+
+// walletWatchAddHandler handles API calls to /wallet/watch/add.
+func (srv *Server) walletWatchAddHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var wa modules.WatchedAddress
+	if req.FormValue("address") != "" {
+		addr, err := scanAddress(req.FormValue("address"))
+		if err != nil {
+			writeError(w, "error after call to /wallet/watch/add: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		wa.UnlockHash = addr
+	}
+	if req.FormValue("unlockconditions") != "" {
+		var uc types.UnlockConditions
+		err := json.Unmarshal([]byte(req.FormValue("unlockconditions")), &uc)
+		if err != nil {
+			writeError(w, "could not read 'unlockconditions' from POST call to /wallet/watch/add: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		wa.UnlockConditions = &uc
+	}
+	err := srv.wallet.AddWatchAddress(wa)
+	if err != nil {
+		writeError(w, "error after call to /wallet/watch/add: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// walletWatchRemoveHandler handles API calls to /wallet/watch/remove.
+func (srv *Server) walletWatchRemoveHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr, err := scanAddress(req.FormValue("address"))
+	if err != nil {
+		writeError(w, "error after call to /wallet/watch/remove: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = srv.wallet.RemoveWatchAddress(addr)
+	if err != nil {
+		writeError(w, "error after call to /wallet/watch/remove: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// walletWatchTransactionHandler handles API calls to /wallet/watch/transaction.
+func (srv *Server) walletWatchTransactionHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var outputs []types.SiacoinOutput
+	err := json.Unmarshal([]byte(req.FormValue("outputs")), &outputs)
+	if err != nil {
+		writeError(w, "could not read 'outputs' from POST call to /wallet/watch/transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ut, err := srv.wallet.UnsignedWatchOnlyTransaction(outputs)
+	if err != nil {
+		writeError(w, "error after call to /wallet/watch/transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ut)
+}
+
+// walletMultisigCreateHandler handles API calls to /wallet/multisig/create.
+func (srv *Server) walletMultisigCreateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	required, err := strconv.ParseUint(req.FormValue("required"), 10, 64)
+	if err != nil {
+		writeError(w, "could not read 'required' from POST call to /wallet/multisig/create: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var cosigners []types.SiaPublicKey
+	err = json.Unmarshal([]byte(req.FormValue("publickeys")), &cosigners)
+	if err != nil {
+		writeError(w, "could not read 'publickeys' from POST call to /wallet/multisig/create: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	uc, err := srv.wallet.CreateMultisigAddress(required, cosigners)
+	if err != nil {
+		writeError(w, "error after call to /wallet/multisig/create: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, WalletMultisigCreatePOST{
+		Address:          uc.UnlockHash(),
+		UnlockConditions: uc,
+	})
+}
+
+// walletMultisigMergeHandler handles API calls to /wallet/multisig/merge.
+func (srv *Server) walletMultisigMergeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var uts []modules.UnsignedTransaction
+	err := json.Unmarshal([]byte(req.FormValue("transactions")), &uts)
+	if err != nil {
+		writeError(w, "could not read 'transactions' from POST call to /wallet/multisig/merge: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	merged, err := srv.wallet.MergeSignatures(uts)
+	if err != nil {
+		writeError(w, "error after call to /wallet/multisig/merge: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, merged)
+}
+
+// walletMultisigPublicKeyHandler handles API calls to
+// /wallet/multisig/publickey.
+func (srv *Server) walletMultisigPublicKeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	uc, err := srv.wallet.NextAddress()
+	if err != nil {
+		writeError(w, "error after call to /wallet/multisig/publickey: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, WalletMultisigPublicKeyGET{
+		PublicKey: uc.PublicKeys[0],
+	})
+}
+
+// walletMultisigTransactionHandler handles API calls to
+// /wallet/multisig/transaction.
+func (srv *Server) walletMultisigTransactionHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr, err := scanAddress(req.FormValue("address"))
+	if err != nil {
+		writeError(w, "error after call to /wallet/multisig/transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var outputs []types.SiacoinOutput
+	err = json.Unmarshal([]byte(req.FormValue("outputs")), &outputs)
+	if err != nil {
+		writeError(w, "could not read 'outputs' from POST call to /wallet/multisig/transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ut, err := srv.wallet.UnsignedMultisigTransaction(addr, outputs)
+	if err != nil {
+		writeError(w, "error after call to /wallet/multisig/transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ut)
+}
+
+// walletSignHandler handles API calls to /wallet/sign.
+func (srv *Server) walletSignHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var ut modules.UnsignedTransaction
+	err := json.Unmarshal([]byte(req.FormValue("transaction")), &ut)
+	if err != nil {
+		writeError(w, "could not read 'transaction' from POST call to /wallet/sign: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	signed, err := srv.wallet.SignTransaction(ut)
+	if err != nil {
+		writeError(w, "error after call to /wallet/sign: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, signed)
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"path/filepath"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/modules/gateway"
@@ -239,6 +242,400 @@ func TestIntegrationWalletGETSiacoins(t *testing.T) {
 	}
 }
 
+// TestIntegrationWalletSiacoinsMulti probes the POST call to /wallet/siacoins
+// with a list of outputs.
+func TestIntegrationWalletSiacoinsMulti(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletSiacoinsMulti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// 'outputs' cannot be combined with 'amount', and must be valid JSON.
+	values := url.Values{}
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"}]`)
+	values.Set("amount", "1234")
+	if err = st.stdPostAPI("/wallet/siacoins", values); err == nil {
+		t.Error("expected an error when combining 'outputs' and 'amount'")
+	}
+	values.Del("amount")
+	values.Set("outputs", "[")
+	if err = st.stdPostAPI("/wallet/siacoins", values); err == nil {
+		t.Error("expected an error when 'outputs' is not valid JSON")
+	}
+
+	// Pay two addresses in a single transaction.
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"},{"unlockhash":"`+st.coinAddress()+`","value":"5678"}]`)
+	var wsp WalletSiacoinsPOST
+	if err = st.postAPI("/wallet/siacoins", values, &wsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(wsp.TransactionIDs) == 0 {
+		t.Fatal("no transaction ids were returned")
+	}
+	var wtg WalletTransactionsGET
+	if err = st.getAPI("/wallet/transactions?startheight=0&endheight=10", &wtg); err != nil {
+		t.Fatal(err)
+	}
+	txid := wsp.TransactionIDs[len(wsp.TransactionIDs)-1]
+	found := false
+	for _, pt := range wtg.UnconfirmedTransactions {
+		if pt.TransactionID == txid {
+			found = len(pt.Transaction.SiacoinOutputs) >= 2
+		}
+	}
+	if !found {
+		t.Error("transaction paying both outputs is not in the unconfirmed set")
+	}
+}
+
+// TestIntegrationWalletUnspentDefrag probes the /wallet/unspent and
+// /wallet/defrag api calls.
+func TestIntegrationWalletUnspentDefrag(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletUnspentDefrag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Split the wallet's coins into several outputs.
+	values := url.Values{}
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"},{"unlockhash":"`+st.coinAddress()+`","value":"5678"}]`)
+	if err = st.stdPostAPI("/wallet/siacoins", values); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unspent siacoin outputs should add up to the confirmed balance.
+	var wug WalletUnspentGET
+	if err = st.getAPI("/wallet/unspent", &wug); err != nil {
+		t.Fatal(err)
+	}
+	var wg WalletGET
+	if err = st.getAPI("/wallet", &wg); err != nil {
+		t.Fatal(err)
+	}
+	total := types.ZeroCurrency
+	for _, uo := range wug.Outputs {
+		if uo.FundType == types.SpecifierSiacoinOutput {
+			total = total.Add(uo.Value)
+		}
+	}
+	if len(wug.Outputs) < 3 || total.Cmp(wg.ConfirmedSiacoinBalance) != 0 {
+		t.Fatal("unspent outputs do not match the confirmed balance:", len(wug.Outputs), total, wg.ConfirmedSiacoinBalance)
+	}
+
+	// Defrag the outputs.
+	var wdp WalletDefragPOST
+	if err = st.postAPI("/wallet/defrag", url.Values{}, &wdp); err != nil {
+		t.Fatal(err)
+	}
+	if len(wdp.TransactionIDs) != 1 {
+		t.Fatal("expected 1 defrag transaction, got", len(wdp.TransactionIDs))
+	}
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	var wug2 WalletUnspentGET
+	if err = st.getAPI("/wallet/unspent", &wug2); err != nil {
+		t.Fatal(err)
+	}
+	if len(wug2.Outputs) >= len(wug.Outputs) {
+		t.Error("defrag did not reduce the number of outputs:", len(wug.Outputs), len(wug2.Outputs))
+	}
+}
+
+// TestIntegrationWalletWatch probes the /wallet/watch api calls.
+func TestIntegrationWalletWatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletWatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Watch a cold storage address.
+	_, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: pk[:]}},
+		SignaturesRequired: 1,
+	}
+	encUC, err := json.Marshal(uc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("unlockconditions", string(encUC))
+	if err = st.stdPostAPI("/wallet/watch/add", values); err != nil {
+		t.Fatal(err)
+	}
+	values.Set("address", st.coinAddress())
+	if err = st.stdPostAPI("/wallet/watch/add", values); err == nil {
+		t.Error("expected an error when the unlock conditions do not match the address")
+	}
+
+	// Send coins to the watched address.
+	values = url.Values{}
+	values.Set("amount", types.SiacoinPrecision.Mul(types.NewCurrency64(100)).String())
+	values.Set("destination", uc.UnlockHash().String())
+	if err = st.stdPostAPI("/wallet/siacoins", values); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	var wwg WalletWatchGET
+	if err = st.getAPI("/wallet/watch", &wwg); err != nil {
+		t.Fatal(err)
+	}
+	if len(wwg.Addresses) != 1 || wwg.Addresses[0].UnlockHash != uc.UnlockHash() || wwg.Addresses[0].UnlockConditions == nil {
+		t.Fatal("watched address was not added:", wwg.Addresses)
+	}
+	if wwg.SiacoinBalance.Cmp(types.SiacoinPrecision.Mul(types.NewCurrency64(100))) != 0 {
+		t.Error("wrong watch-only balance:", wwg.SiacoinBalance)
+	}
+
+	// Build an unsigned transaction from the watched address.
+	values = url.Values{}
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"}]`)
+	var ut modules.UnsignedTransaction
+	if err = st.postAPI("/wallet/watch/transaction", values, &ut); err != nil {
+		t.Fatal(err)
+	}
+	if len(ut.Transaction.SiacoinInputs) != 1 || ut.Transaction.SiacoinInputs[0].UnlockConditions.UnlockHash() != uc.UnlockHash() {
+		t.Error("unsigned transaction does not spend from the watched address")
+	}
+	if len(ut.RequiredSignatures) != 1 {
+		t.Error("unsigned transaction should require one signature:", ut.RequiredSignatures)
+	}
+
+	// Stop watching the address.
+	values = url.Values{}
+	values.Set("address", uc.UnlockHash().String())
+	if err = st.stdPostAPI("/wallet/watch/remove", values); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/wallet/watch", &wwg); err != nil {
+		t.Fatal(err)
+	}
+	if len(wwg.Addresses) != 0 || !wwg.SiacoinBalance.IsZero() {
+		t.Error("watched address was not removed")
+	}
+}
+
+// TestIntegrationWalletSign probes the offline signing workflow: an unsigned
+// transaction is built by a watch-only node, signed by /wallet/sign on a node
+// holding the keys, and broadcast by /transactionpool/transactions.
+func TestIntegrationWalletSign(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletSign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	offline, err := createServerTester("TestIntegrationWalletSign - offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offline.server.Close()
+
+	// Watch and fund an address of the offline node.
+	uc, err := offline.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encUC, err := json.Marshal(uc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("unlockconditions", string(encUC))
+	if err = st.stdPostAPI("/wallet/watch/add", values); err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("amount", types.SiacoinPrecision.Mul(types.NewCurrency64(100)).String())
+	values.Set("destination", uc.UnlockHash().String())
+	if err = st.stdPostAPI("/wallet/siacoins", values); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the unsigned transaction.
+	values = url.Values{}
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"}]`)
+	var ut modules.UnsignedTransaction
+	if err = st.postAPI("/wallet/watch/transaction", values, &ut); err != nil {
+		t.Fatal(err)
+	}
+	encUT, err := json.Marshal(ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The watch-only node cannot sign the transaction, but the offline node
+	// can.
+	values = url.Values{}
+	values.Set("transaction", string(encUT))
+	if err = st.stdPostAPI("/wallet/sign", values); err == nil {
+		t.Error("expected an error when signing without the required keys")
+	}
+	var signed modules.UnsignedTransaction
+	if err = offline.postAPI("/wallet/sign", values, &signed); err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.RequiredSignatures) != 0 || len(signed.Transaction.TransactionSignatures) != 1 {
+		t.Fatal("transaction was not fully signed:", signed)
+	}
+
+	// Broadcast the signed transaction from the watch-only node.
+	encTxns, err := json.Marshal(append(signed.Parents, signed.Transaction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("transactions", string(encTxns))
+	if err = st.stdPostAPI("/transactionpool/transactions", values); err != nil {
+		t.Fatal(err)
+	}
+	var tpg TransactionPoolGET
+	if err = st.getAPI("/transactionpool/transactions", &tpg); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, txn := range tpg.Transactions {
+		found = found || txn.ID() == signed.Transaction.ID()
+	}
+	if !found {
+		t.Error("signed transaction was not added to the transaction pool")
+	}
+}
+
+// TestIntegrationWalletMultisig probes the /wallet/multisig api calls by
+// spending from a 2-of-2 address shared between two nodes.
+func TestIntegrationWalletMultisig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletMultisig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	cosigner, err := createServerTester("TestIntegrationWalletMultisig - cosigner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cosigner.server.Close()
+
+	// Create the address from a public key of the cosigner, and have the
+	// cosigner watch it.
+	var wmpg WalletMultisigPublicKeyGET
+	if err = cosigner.getAPI("/wallet/multisig/publickey", &wmpg); err != nil {
+		t.Fatal(err)
+	}
+	encKeys, err := json.Marshal([]types.SiaPublicKey{wmpg.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	values.Set("required", "2")
+	values.Set("publickeys", string(encKeys))
+	var wmcp WalletMultisigCreatePOST
+	if err = st.postAPI("/wallet/multisig/create", values, &wmcp); err != nil {
+		t.Fatal(err)
+	}
+	if wmcp.Address != wmcp.UnlockConditions.UnlockHash() || wmcp.UnlockConditions.SignaturesRequired != 2 {
+		t.Fatal("unexpected multisig address:", wmcp)
+	}
+	encUC, err := json.Marshal(wmcp.UnlockConditions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("unlockconditions", string(encUC))
+	if err = cosigner.stdPostAPI("/wallet/watch/add", values); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fund the address.
+	values = url.Values{}
+	values.Set("amount", types.SiacoinPrecision.Mul(types.NewCurrency64(100)).String())
+	values.Set("destination", wmcp.Address.String())
+	if err = st.stdPostAPI("/wallet/siacoins", values); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the transaction, and sign it on both nodes.
+	values = url.Values{}
+	values.Set("address", wmcp.Address.String())
+	values.Set("outputs", `[{"unlockhash":"`+st.coinAddress()+`","value":"1234"}]`)
+	var ut modules.UnsignedTransaction
+	if err = st.postAPI("/wallet/multisig/transaction", values, &ut); err != nil {
+		t.Fatal(err)
+	}
+	encUT, err := json.Marshal(ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("transaction", string(encUT))
+	var ownSigned, cosignerSigned modules.UnsignedTransaction
+	if err = st.postAPI("/wallet/sign", values, &ownSigned); err != nil {
+		t.Fatal(err)
+	}
+	if err = cosigner.postAPI("/wallet/sign", values, &cosignerSigned); err != nil {
+		t.Fatal(err)
+	}
+	if len(ownSigned.RequiredSignatures) != 1 || len(cosignerSigned.RequiredSignatures) != 1 {
+		t.Fatal("each node should only add a partial signature")
+	}
+
+	// Merge the signatures and broadcast the result.
+	encUTs, err := json.Marshal([]modules.UnsignedTransaction{ownSigned, cosignerSigned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("transactions", string(encUTs))
+	var merged modules.UnsignedTransaction
+	if err = st.postAPI("/wallet/multisig/merge", values, &merged); err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.RequiredSignatures) != 0 {
+		t.Fatal("merged transaction is not complete:", merged.RequiredSignatures)
+	}
+	encTxns, err := json.Marshal(append(merged.Parents, merged.Transaction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = url.Values{}
+	values.Set("transactions", string(encTxns))
+	if err = st.stdPostAPI("/transactionpool/transactions", values); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestIntegrationWalletTransactionGETid queries the /wallet/transaction/$(id)
 // api call.
 func TestIntegrationWalletTransactionGETid(t *testing.T) {
@@ -283,3 +680,108 @@ func TestIntegrationWalletTransactionGETid(t *testing.T) {
 		t.Error("fund type should be a miner payout")
 	}
 }
+
+// TestIntegrationWalletHistory probes the /wallet/history and
+// /wallet/history/export api calls.
+func TestIntegrationWalletHistory(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletHistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	var wtg WalletTransactionsGET
+	if err = st.getAPI("/wallet/transactions?startheight=0&endheight=10000", &wtg); err != nil {
+		t.Fatal(err)
+	}
+	total := len(wtg.ConfirmedTransactions)
+	if total < 3 {
+		t.Fatal("expecting a few wallet transactions, got", total)
+	}
+
+	// Page through the history two transactions at a time.
+	var count int
+	var cursor uint64
+	for {
+		var whg WalletHistoryGET
+		if err = st.getAPI(fmt.Sprintf("/wallet/history?cursor=%v&limit=2", cursor), &whg); err != nil {
+			t.Fatal(err)
+		}
+		if len(whg.Transactions) > 2 {
+			t.Fatal("page is larger than the limit:", len(whg.Transactions))
+		}
+		count += len(whg.Transactions)
+		if whg.NextCursor == 0 {
+			break
+		}
+		cursor = whg.NextCursor
+	}
+	if count != total {
+		t.Errorf("expected %v transactions, got %v", total, count)
+	}
+	if err = st.stdGetAPI("/wallet/history?direction=sideways"); err == nil {
+		t.Error("invalid direction was accepted")
+	}
+
+	// Export the history as JSON and as CSV.
+	var entries []WalletHistoryExportEntry
+	if err = st.getAPI("/wallet/history/export?format=json&direction=incoming", &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != total {
+		t.Errorf("expected %v exported transactions, got %v", total, len(entries))
+	}
+	for _, entry := range entries {
+		if entry.IncomingSiacoins.IsZero() {
+			t.Error("miner payout was exported without incoming siacoins")
+		}
+	}
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/wallet/history/export?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != total+1 || records[0][0] != "transactionid" {
+		t.Errorf("expected a header and %v rows, got %v rows", total, len(records))
+	}
+	if _, exists := resp.Trailer[historyExportErrorTrailer]; !exists {
+		t.Error("export did not declare the error trailer")
+	}
+	if msg := resp.Trailer.Get(historyExportErrorTrailer); msg != "" {
+		t.Error("complete export reported an error:", msg)
+	}
+	if err = st.stdGetAPI("/wallet/history/export?format=xml"); err == nil {
+		t.Error("invalid format was accepted")
+	}
+}
+
+// TestIntegrationWalletSiafundClaims probes the /wallet/siafunds/claim and
+// /wallet/siafunds/claims endpoints of a wallet without siafunds.
+func TestIntegrationWalletSiafundClaims(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationWalletSiafundClaims")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	var wsg WalletSiafundsClaimsGET
+	if err = st.getAPI("/wallet/siafunds/claims", &wsg); err != nil {
+		t.Fatal(err)
+	}
+	if len(wsg.Claims) != 0 || len(wsg.Payouts) != 0 {
+		t.Error("wallet without siafunds reported claims:", len(wsg.Claims), len(wsg.Payouts))
+	}
+	if err = st.stdPostAPI("/wallet/siafunds/claim", url.Values{}); err == nil {
+		t.Error("wallet without siafunds was able to claim")
+	}
+}
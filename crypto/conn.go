@@ -0,0 +1,169 @@
+package crypto
+
+// conn.go contains a key exchange and a connection type that encrypts all
+// traffic that is sent over it. The key exchange alone does not prove who the
+// remote peer is; peers with a long-term key can authenticate themselves by
+// signing the transcript of the key exchange.
+
+import (
+	"crypto/cipher"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/encoding"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// MaxFrameSize is the largest amount of plaintext that is sealed into a
+	// single frame of an encrypted connection.
+	MaxFrameSize = 1 << 16
+)
+
+var (
+	// ErrBadKeyConfirmation is returned if the remote peer derived different
+	// session keys, which happens if the key exchange or the handshake data
+	// was tampered with.
+	ErrBadKeyConfirmation = errors.New("peer could not confirm the session keys")
+
+	// ErrLowOrderPoint is returned if the remote peer sent a public key that
+	// results in an all-zero shared secret.
+	ErrLowOrderPoint = errors.New("peer sent an invalid public key")
+)
+
+// EncryptedConn is a net.Conn that seals everything written to it in
+// length-prefixed frames using Twofish-GCM, and opens everything read from it.
+// Each direction of the connection uses its own key, and frames are numbered
+// so that they cannot be reordered, replayed or dropped without detection.
+type EncryptedConn struct {
+	net.Conn
+
+	readMu    sync.Mutex
+	readAEAD  cipher.AEAD
+	readNonce uint64
+	readBuf   []byte
+
+	writeMu    sync.Mutex
+	writeAEAD  cipher.AEAD
+	writeNonce uint64
+}
+
+// newAEAD returns the AEAD used for one direction of an encrypted connection.
+func newAEAD(key TwofishKey) cipher.AEAD {
+	// NOTE: NewGCM only returns an error if twofishCipher.BlockSize != 16.
+	aead, _ := cipher.NewGCM(key.NewCipher())
+	return aead
+}
+
+// frameNonce returns the nonce for the frame with the given sequence number.
+func frameNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, encoding.EncUint64(n))
+	return nonce
+}
+
+// Read implements the net.Conn interface.
+func (ec *EncryptedConn) Read(b []byte) (int, error) {
+	ec.readMu.Lock()
+	defer ec.readMu.Unlock()
+	if len(ec.readBuf) == 0 {
+		frame, err := encoding.ReadPrefix(ec.Conn, MaxFrameSize+uint64(ec.readAEAD.Overhead()))
+		if err != nil {
+			return 0, err
+		}
+		ec.readBuf, err = ec.readAEAD.Open(frame[:0], frameNonce(ec.readAEAD, ec.readNonce), frame, nil)
+		if err != nil {
+			return 0, err
+		}
+		ec.readNonce++
+	}
+	n := copy(b, ec.readBuf)
+	ec.readBuf = ec.readBuf[n:]
+	return n, nil
+}
+
+// Write implements the net.Conn interface.
+func (ec *EncryptedConn) Write(b []byte) (int, error) {
+	ec.writeMu.Lock()
+	defer ec.writeMu.Unlock()
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > MaxFrameSize {
+			chunk = chunk[:MaxFrameSize]
+		}
+		frame := ec.writeAEAD.Seal(nil, frameNonce(ec.writeAEAD, ec.writeNonce), chunk, nil)
+		if err := encoding.WritePrefix(ec.Conn, frame); err != nil {
+			return written, err
+		}
+		ec.writeNonce++
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// EncryptConn performs an X25519 key exchange over conn and returns a
+// connection that encrypts all further traffic, along with the transcript of
+// the key exchange. Each peer sends an ephemeral public key, derives a key for
+// each direction from the shared secret and the transcript, and then sends the
+// transcript over the encrypted connection. A peer whose session keys do not
+// match will fail this confirmation before the connection is used.
+//
+// The transcript covers the public keys of both peers and handshakeData,
+// which should contain everything that the peers exchanged in plaintext
+// before the key exchange, such as their version strings. Both peers must
+// supply the same handshakeData, so tampering with the plaintext handshake is
+// detected by the key confirmation.
+func EncryptConn(conn net.Conn, initiator bool, handshakeData ...interface{}) (*EncryptedConn, Hash, error) {
+	var ourSK, ourPK, theirPK, secret [32]byte
+	entropy, err := RandBytes(len(ourSK))
+	if err != nil {
+		return nil, Hash{}, err
+	}
+	copy(ourSK[:], entropy)
+	curve25519.ScalarBaseMult(&ourPK, &ourSK)
+
+	// Exchange public keys.
+	if err := encoding.WriteObject(conn, ourPK); err != nil {
+		return nil, Hash{}, err
+	}
+	if err := encoding.ReadObject(conn, &theirPK, uint64(len(theirPK))); err != nil {
+		return nil, Hash{}, err
+	}
+	curve25519.ScalarMult(&secret, &ourSK, &theirPK)
+	if secret == [32]byte{} {
+		return nil, Hash{}, ErrLowOrderPoint
+	}
+
+	// Derive the session keys. The keys are bound to the public keys of both
+	// peers, ordered so that both peers arrive at the same transcript.
+	initiatorPK, responderPK := ourPK, theirPK
+	if !initiator {
+		initiatorPK, responderPK = theirPK, ourPK
+	}
+	transcript := HashAll(append([]interface{}{initiatorPK, responderPK}, handshakeData...)...)
+	initiatorKey := TwofishKey(HashAll(secret, transcript, "initiator"))
+	responderKey := TwofishKey(HashAll(secret, transcript, "responder"))
+	ec := &EncryptedConn{Conn: conn}
+	if initiator {
+		ec.writeAEAD, ec.readAEAD = newAEAD(initiatorKey), newAEAD(responderKey)
+	} else {
+		ec.writeAEAD, ec.readAEAD = newAEAD(responderKey), newAEAD(initiatorKey)
+	}
+
+	// Confirm that both peers derived the same keys.
+	if err := encoding.WriteObject(ec, transcript); err != nil {
+		return nil, Hash{}, err
+	}
+	var theirTranscript Hash
+	if err := encoding.ReadObject(ec, &theirTranscript, HashSize); err != nil {
+		return nil, Hash{}, ErrBadKeyConfirmation
+	}
+	if theirTranscript != transcript {
+		return nil, Hash{}, ErrBadKeyConfirmation
+	}
+	return ec, transcript, nil
+}
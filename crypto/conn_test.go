@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// encryptedConnPair returns a pair of connected EncryptedConns. The handshake
+// data supplied by each side is passed to EncryptConn.
+func encryptedConnPair(initiatorData, responderData []interface{}) (*EncryptedConn, *EncryptedConn, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer l.Close()
+
+	type result struct {
+		ec  *EncryptedConn
+		err error
+	}
+	resultChan := make(chan result)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			resultChan <- result{nil, err}
+			return
+		}
+		ec, _, err := EncryptConn(conn, false, responderData...)
+		if err != nil {
+			conn.Close()
+		}
+		resultChan <- result{ec, err}
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	initiator, _, err := EncryptConn(conn, true, initiatorData...)
+	r := <-resultChan
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return initiator, r.ec, nil
+}
+
+// TestEncryptConn tests that data written to one end of an encrypted
+// connection can be read from the other end, including writes that span
+// multiple frames.
+func TestEncryptConn(t *testing.T) {
+	initiator, responder, err := encryptedConnPair(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer initiator.Close()
+	defer responder.Close()
+
+	for _, size := range []int{1, 100, MaxFrameSize, 3*MaxFrameSize + 7} {
+		data, err := RandBytes(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go initiator.Write(data)
+		received := make([]byte, size)
+		if _, err := io.ReadFull(responder, received); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, received) {
+			t.Fatal("received data does not match sent data for size", size)
+		}
+
+		go responder.Write(data)
+		if _, err := io.ReadFull(initiator, received); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, received) {
+			t.Fatal("received data does not match sent data for size", size)
+		}
+	}
+}
+
+// TestEncryptConnTampering tests that frames which have been modified in
+// transit are rejected.
+func TestEncryptConnTampering(t *testing.T) {
+	initiator, responder, err := encryptedConnPair(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer initiator.Close()
+	defer responder.Close()
+
+	// Write a frame sealed with the wrong nonce, as an attacker replaying an
+	// earlier frame would.
+	frame := initiator.writeAEAD.Seal(nil, frameNonce(initiator.writeAEAD, initiator.writeNonce+1), []byte("foo"), nil)
+	go encoding.WritePrefix(initiator.Conn, frame)
+	if _, err := responder.Read(make([]byte, 3)); err == nil {
+		t.Fatal("expected tampered frame to be rejected")
+	}
+}
+
+// TestEncryptConnHandshakeData tests that the key exchange fails if the peers
+// supply different handshake data, as they would if an attacker rewrote the
+// plaintext handshake.
+func TestEncryptConnHandshakeData(t *testing.T) {
+	initiator, responder, err := encryptedConnPair([]interface{}{"1.0.0", "1.0.0"}, []interface{}{"1.0.0", "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator.Close()
+	responder.Close()
+
+	_, _, err = encryptedConnPair([]interface{}{"1.0.0", "1.0.0"}, []interface{}{"1.0.1", "1.0.0"})
+	if err != ErrBadKeyConfirmation {
+		t.Fatal("expected ErrBadKeyConfirmation, got", err)
+	}
+}
@@ -46,6 +46,13 @@ var (
 	// should be handled by the module, and not reported to the user.
 	ErrInvalidConsensusChangeID = errors.New("consensus subscription has invalid id - files are inconsistent")
 
+	// ErrPrunedConsensusChangeID indicates that ConsensusSetSubscribe was
+	// called with a consensus change id that is older than the pruning
+	// horizon of a pruned consensus set. The blocks needed to compute the
+	// consensus changes since that id are no longer available, so the module
+	// cannot be brought up to date by this consensus set.
+	ErrPrunedConsensusChangeID = errors.New("consensus subscription id is older than the pruning horizon of the consensus set")
+
 	// ErrNonExtendingBlock indicates that a block is valid but does not result
 	// in a fork that is the heaviest known fork - the consensus set has not
 	// changed as a result of seeing the block.
@@ -70,6 +77,19 @@ type (
 		ProcessConsensusChange(ConsensusChange)
 	}
 
+	// A FilteredConsensusSetSubscriber is a ConsensusSetSubscriber that is
+	// only interested in the blocks involving a set of addresses. A light
+	// consensus set only downloads the full blocks that involve the addresses
+	// of its filtered subscribers, and only reports the outputs sent to those
+	// addresses.
+	FilteredConsensusSetSubscriber interface {
+		ConsensusSetSubscriber
+
+		// WatchedAddresses returns the addresses that the subscriber is
+		// interested in.
+		WatchedAddresses() []types.UnlockHash
+	}
+
 	// A ConsensusChange enumerates a set of changes that occured to the consensus set.
 	ConsensusChange struct {
 		// ID is a unique id for the consensus change derived from the reverted
@@ -156,6 +176,41 @@ type (
 		Adjusted  types.Currency
 	}
 
+	// A ConsensusSnapshot describes a snapshot of the consensus database.
+	// Importing a snapshot allows a node to skip downloading and validating
+	// the blockchain up to the snapshot's height, so a snapshot should only
+	// be imported if its Checksum matches a value obtained from a trusted
+	// source.
+	ConsensusSnapshot struct {
+		Height   types.BlockHeight `json:"height"`
+		BlockID  types.BlockID     `json:"blockid"`
+		ChangeID ConsensusChangeID `json:"changeid"`
+		Checksum crypto.Hash       `json:"checksum"`
+		Filename string            `json:"filename"`
+	}
+
+	// A ConsensusFork describes a reorg of the consensus set, in which the
+	// blocks after CommonParent were reverted and replaced by the blocks of
+	// a heavier chain.
+	ConsensusFork struct {
+		CommonParent       types.BlockID     `json:"commonparent"`
+		CommonParentHeight types.BlockHeight `json:"commonparentheight"`
+		RevertedBlocks     []types.BlockID   `json:"revertedblocks"`
+		AppliedBlocks      []types.BlockID   `json:"appliedblocks"`
+		Depth              types.BlockHeight `json:"depth"`
+		Timestamp          types.Timestamp   `json:"timestamp"`
+	}
+
+	// A StaleBlock describes a valid block that did not extend the current
+	// path when it was received. Timestamp is the time that the block was
+	// received, not the timestamp of the block.
+	StaleBlock struct {
+		ID        types.BlockID     `json:"id"`
+		ParentID  types.BlockID     `json:"parentid"`
+		Height    types.BlockHeight `json:"height"`
+		Timestamp types.Timestamp   `json:"timestamp"`
+	}
+
 	// A ConsensusSet accepts blocks and builds an understanding of network
 	// consensus.
 	ConsensusSet interface {
@@ -167,6 +222,11 @@ type (
 		// still be returned.
 		AcceptBlock(types.Block) error
 
+		// Block returns the block with the given id and the height of the
+		// block, with a bool to indicate whether the block is known. The
+		// block may not be in the current path.
+		Block(types.BlockID) (types.Block, types.BlockHeight, bool)
+
 		// BlockAtHeight returns the block found at the input height, with a
 		// bool to indicate whether that block exists.
 		BlockAtHeight(types.BlockHeight) (types.Block, bool)
@@ -190,9 +250,33 @@ type (
 		// blockchain.
 		CurrentBlock() types.Block
 
+		// ExportSnapshot writes a snapshot of the consensus database, as it
+		// was at the given height in the current path, to a new file with the
+		// given name in the snapshots folder of the consensus directory.
+		ExportSnapshot(types.BlockHeight, string) (ConsensusSnapshot, error)
+
+		// FileContract returns the file contract with the given id, with a bool
+		// to indicate whether the file contract is open in the current
+		// consensus set.
+		FileContract(types.FileContractID) (types.FileContract, bool)
+
+		// Forks returns every reorg that the consensus set has performed, in
+		// the order that they happened.
+		Forks() []ConsensusFork
+
+		// HeaderHeight returns the height of the best header chain known to
+		// the consensus set, which is never lower than the current height.
+		// During initial blockchain download, it is the height that the
+		// consensus set is synchronizing to.
+		HeaderHeight() types.BlockHeight
+
 		// Height returns the current height of consensus.
 		Height() types.BlockHeight
 
+		// Inconsistent returns true if the consensus database has been
+		// marked as inconsistent by a failed consistency check.
+		Inconsistent() bool
+
 		// Synced returns true if the consensus set is synced with the network.
 		Synced() bool
 
@@ -206,6 +290,18 @@ type (
 		// risk of mining invalid blocks.
 		MinimumValidChildTimestamp(types.BlockID) (types.Timestamp, bool)
 
+		// SiacoinOutput returns the siacoin output with the given id, with a
+		// bool to indicate whether the output is unspent in the current
+		// consensus set.
+		SiacoinOutput(types.SiacoinOutputID) (types.SiacoinOutput, bool)
+
+		// SiafundPool returns the current value of the siafund pool.
+		SiafundPool() types.Currency
+
+		// StaleBlocks returns the most recently received blocks that did not
+		// extend the current path, oldest first.
+		StaleBlocks() []StaleBlock
+
 		// StorageProofSegment returns the segment to be used in the storage proof for
 		// a given file contract.
 		StorageProofSegment(types.FileContractID) (uint64, error)
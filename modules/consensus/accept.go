@@ -51,6 +51,11 @@ func (cs *ConsensusSet) validateHeaderAndBlock(tx dbTx, b types.Block) error {
 	if err != nil {
 		return err
 	}
+	// Check that the block does not conflict with a checkpoint.
+	err = cs.validateCheckpoints(tx, id, parent.Height+1)
+	if err != nil {
+		return err
+	}
 	// Check that the timestamp is not too far in the past to be acceptable.
 	minTimestamp := cs.blockRuleHelper.minimumValidChildTimestamp(blockMap, &parent)
 
@@ -101,6 +106,12 @@ func (cs *ConsensusSet) validateHeader(tx dbTx, h types.BlockHeader) error {
 		return modules.ErrBlockUnsolved
 	}
 
+	// Check that the block does not conflict with a checkpoint.
+	err = cs.validateCheckpoints(tx, id, parent.Height+1)
+	if err != nil {
+		return err
+	}
+
 	// TODO: check if the block is a non extending block once headers-first
 	// downloads are implemented.
 
@@ -153,13 +164,17 @@ func (cs *ConsensusSet) addBlockToTree(b types.Block) (ce changeEntry, err error
 		// set to indicate that modules.ErrNonExtending should be returned.
 		nonExtending = !newNode.heavierThan(currentNode)
 		if nonExtending {
-			return nil
+			return recordStaleBlock(tx, newNode)
 		}
 		var revertedBlocks, appliedBlocks []*processedBlock
 		revertedBlocks, appliedBlocks, err = cs.forkBlockchain(tx, newNode)
 		if err != nil {
 			return err
 		}
+		err = recordFork(tx, revertedBlocks, appliedBlocks)
+		if err != nil {
+			return err
+		}
 		for _, rn := range revertedBlocks {
 			ce.RevertedBlocks = append(ce.RevertedBlocks, rn.Block.ID())
 		}
@@ -179,7 +194,8 @@ func (cs *ConsensusSet) addBlockToTree(b types.Block) (ce changeEntry, err error
 		if err != nil {
 			return err
 		}
-		return nil
+		// Prune the blocks that are now beyond the prune depth.
+		return pruneBlocks(tx, cs.pruneDepth)
 	})
 	if err != nil {
 		return changeEntry{}, err
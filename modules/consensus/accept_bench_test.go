@@ -1,8 +1,10 @@
 package consensus
 
 import (
+	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
@@ -166,3 +168,118 @@ func BenchmarkAcceptSmallBlocks(b *testing.B) {
 		b.StopTimer()
 	}
 }
+
+// benchmarkCheckpointedSync measures how quickly a new consensus set
+// synchronizes to a blockchain containing transactions, with or without a
+// checkpoint at the tip of that blockchain. The headers are marked as
+// ancestors of the checkpoint before the blocks are accepted, as they are by
+// the headers-first download of the initial blockchain download.
+func benchmarkCheckpointedSync(b *testing.B, name string, checkpointed bool) {
+	cst, err := createConsensusSetTester(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Add blocks containing signed transactions and file contracts.
+	for i := 0; i < 20; i++ {
+		txnBuilder := cst.wallet.StartTransaction()
+		err = txnBuilder.FundSiacoins(types.NewCurrency64(125e6))
+		if err != nil {
+			b.Fatal(err)
+		}
+		txnBuilder.AddMinerFee(types.NewCurrency64(5e6))
+		txnBuilder.AddSiacoinOutput(types.SiacoinOutput{Value: types.NewCurrency64(20e6)})
+		txnBuilder.AddFileContract(types.FileContract{
+			WindowStart: 1000,
+			WindowEnd:   10005,
+			Payout:      types.NewCurrency64(100e6),
+			ValidProofOutputs: []types.SiacoinOutput{{
+				Value: types.NewCurrency64(96100e3),
+			}},
+			MissedProofOutputs: []types.SiacoinOutput{{
+				Value: types.NewCurrency64(96100e3),
+			}},
+		})
+		txnSet, err := txnBuilder.Sign(true)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = cst.tpool.AcceptTransactionSet(txnSet)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = cst.miner.AddBlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	h := cst.cs.dbBlockHeight()
+	var blocks []types.Block
+	for i := types.BlockHeight(1); i <= h; i++ {
+		block, _ := cst.cs.BlockAtHeight(i)
+		blocks = append(blocks, block)
+	}
+	checkpoints := make(map[types.BlockHeight]types.BlockID)
+	var headers []types.BlockHeader
+	if checkpointed {
+		checkpoints[h] = blocks[len(blocks)-1].ID()
+		for _, block := range blocks {
+			headers = append(headers, block.Header())
+		}
+	}
+
+	b.ResetTimer()
+	b.StopTimer()
+	for j := 0; j < b.N; j++ {
+		// Create a new consensus set that is still in initial blockchain
+		// download. (untimed)
+		cs, g, err := newCheckpointedConsensusSet(fmt.Sprintf("%v - %v", name, j), checkpoints)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for {
+			cs.mu.Lock()
+			synced := cs.synced
+			cs.synced = false
+			cs.mu.Unlock()
+			if synced {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cs.mu.Lock()
+		cs.addCheckpointAncestors(headers, 0)
+		trusted := cs.trustedBlock(blocks[0].ID(), false)
+		cs.mu.Unlock()
+		if trusted != checkpointed {
+			b.Fatalf("expected trustedBlock to be %v, got %v", checkpointed, trusted)
+		}
+
+		// Synchronize the new consensus set. (timed)
+		b.StartTimer()
+		for _, block := range blocks {
+			err = cs.AcceptBlock(block)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		cs.Close()
+		g.Close()
+	}
+}
+
+// BenchmarkSyncWithoutCheckpoint measures how quickly a new consensus set
+// synchronizes when every block is fully validated.
+func BenchmarkSyncWithoutCheckpoint(b *testing.B) {
+	benchmarkCheckpointedSync(b, "BenchmarkSyncWithoutCheckpoint", false)
+}
+
+// BenchmarkSyncWithCheckpoint measures how quickly a new consensus set
+// synchronizes when every block is below a checkpoint, and therefore
+// signatures and storage proofs are not verified. Comparing the result to
+// BenchmarkSyncWithoutCheckpoint gives the time saved by checkpoints.
+func BenchmarkSyncWithCheckpoint(b *testing.B) {
+	benchmarkCheckpointedSync(b, "BenchmarkSyncWithCheckpoint", true)
+}
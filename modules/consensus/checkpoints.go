@@ -0,0 +1,143 @@
+package consensus
+
+// checkpoints.go contains the logic for consensus checkpoints. A checkpoint
+// fixes the id of the block at a given height. Blocks that conflict with a
+// checkpoint are rejected, and the consensus set will not reorganize below the
+// highest checkpoint that it has reached. During initial blockchain download,
+// blocks that are known to be ancestors of a checkpointed block are assumed to
+// be valid enough that signatures and storage proofs do not need to be
+// verified. A block is known to be an ancestor of a checkpointed block if it
+// precedes the checkpointed block in the path being applied, or in a header
+// chain downloaded from a peer; the ids in a chain commit to every block
+// before them, so the ancestors cannot be forged.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	errCheckpointConflict = errors.New("current path conflicts with a checkpoint")
+	errCheckpointMismatch = errors.New("block does not match the checkpoint at its height")
+	errCheckpointReorg    = errors.New("block would cause a reorg below a checkpoint")
+
+	// defaultCheckpoints are the checkpoints that every consensus set uses.
+	// Additional checkpoints can be supplied to NewWithSettings.
+	//
+	// TODO: add checkpoints for blocks on the main chain. Only ids that have
+	// been checked against several independent nodes belong here; until then,
+	// signatures are only skipped for blocks below user-supplied checkpoints.
+	defaultCheckpoints = map[types.BlockHeight]types.BlockID{
+		0: types.GenesisBlock.ID(),
+	}
+)
+
+// mergeCheckpoints combines the default checkpoints with the user-supplied
+// checkpoints. An error is returned if a user-supplied checkpoint conflicts
+// with a default checkpoint.
+func mergeCheckpoints(checkpoints map[types.BlockHeight]types.BlockID) (map[types.BlockHeight]types.BlockID, error) {
+	merged := make(map[types.BlockHeight]types.BlockID)
+	for height, id := range defaultCheckpoints {
+		merged[height] = id
+	}
+	for height, id := range checkpoints {
+		if defaultID, exists := merged[height]; exists && defaultID != id {
+			return nil, errCheckpointConflict
+		}
+		merged[height] = id
+	}
+	return merged, nil
+}
+
+// validateCheckpoints checks that a block with the given id and height does
+// not conflict with any checkpoint, and that accepting it would not cause a
+// reorg below a checkpoint that the current path has already reached.
+func (cs *ConsensusSet) validateCheckpoints(tx dbTx, id types.BlockID, height types.BlockHeight) error {
+	checkpointID, exists := cs.checkpoints[height]
+	if exists && checkpointID != id {
+		return errCheckpointMismatch
+	}
+
+	// A new block at or below a checkpoint that is already in the current
+	// path can only be part of a fork that leaves the current path before the
+	// checkpoint.
+	bh := tx.Bucket(BlockHeight)
+	if bh == nil {
+		return nil
+	}
+	var currentHeight types.BlockHeight
+	err := encoding.Unmarshal(bh.Get(BlockHeight), &currentHeight)
+	if err != nil {
+		return err
+	}
+	for checkpointHeight := range cs.checkpoints {
+		if height <= checkpointHeight && checkpointHeight <= currentHeight {
+			return errCheckpointReorg
+		}
+	}
+	return nil
+}
+
+// checkCurrentPath returns an error if the current path conflicts with any of
+// the checkpoints that it has reached.
+func (cs *ConsensusSet) checkCurrentPath(tx *bolt.Tx) error {
+	currentHeight := blockHeight(tx)
+	for height, id := range cs.checkpoints {
+		if height > currentHeight {
+			continue
+		}
+		pathID, err := getPath(tx, height)
+		if err != nil {
+			return err
+		}
+		if pathID != id {
+			return errCheckpointConflict
+		}
+	}
+	return nil
+}
+
+// checkpointIndex returns the index of the highest checkpointed block in
+// 'path', or -1 if the path does not contain a checkpointed block.
+func (cs *ConsensusSet) checkpointIndex(path []*processedBlock) int {
+	for i := len(path) - 1; i >= 0; i-- {
+		id, exists := cs.checkpoints[path[i].Height]
+		if exists && id == path[i].Block.ID() {
+			return i
+		}
+	}
+	return -1
+}
+
+// addCheckpointAncestors marks the headers in 'headers' up to and including
+// the highest checkpointed header as ancestors of a checkpoint. 'base' is the
+// height of the parent of the first header, and the headers must form a
+// chain.
+func (cs *ConsensusSet) addCheckpointAncestors(headers []types.BlockHeader, base types.BlockHeight) {
+	highest := -1
+	for i := range headers {
+		id, exists := cs.checkpoints[base+types.BlockHeight(i)+1]
+		if exists && id == headers[i].ID() {
+			highest = i
+		}
+	}
+	for i := 0; i <= highest; i++ {
+		cs.checkpointAncestors[headers[i].ID()] = struct{}{}
+	}
+}
+
+// trustedBlock returns true if the expensive parts of validating the block
+// with the given id can be skipped. This is only the case during initial
+// blockchain download, for blocks that precede a checkpointed block in the
+// path being applied or in a downloaded header chain.
+func (cs *ConsensusSet) trustedBlock(id types.BlockID, precedesCheckpoint bool) bool {
+	if cs.synced {
+		return false
+	}
+	_, exists := cs.checkpointAncestors[id]
+	return precedesCheckpoint || exists
+}
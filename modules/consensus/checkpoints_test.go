@@ -0,0 +1,170 @@
+package consensus
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// newCheckpointedConsensusSet returns a consensus set with the given
+// checkpoints, using its own gateway.
+func newCheckpointedConsensusSet(name string, checkpoints map[types.BlockHeight]types.BlockID) (*ConsensusSet, modules.Gateway, error) {
+	testdir := build.TempDir(modules.ConsensusDir, name)
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := NewWithSettings(g, filepath.Join(testdir, modules.ConsensusDir), Settings{Checkpoints: checkpoints})
+	if err != nil {
+		g.Close()
+		return nil, nil, err
+	}
+	return cs, g, nil
+}
+
+// TestCheckpointConflict checks that user-supplied checkpoints cannot
+// conflict with the default checkpoints.
+func TestCheckpointConflict(t *testing.T) {
+	_, err := mergeCheckpoints(map[types.BlockHeight]types.BlockID{0: {1}})
+	if err != errCheckpointConflict {
+		t.Fatal("expected errCheckpointConflict, got", err)
+	}
+	checkpoints, err := mergeCheckpoints(map[types.BlockHeight]types.BlockID{5: {1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0] != types.GenesisBlock.ID() {
+		t.Fatal("checkpoints were not merged correctly:", checkpoints)
+	}
+}
+
+// TestIntegrationCheckpointMismatch checks that a block which does not match
+// the checkpoint at its height is rejected.
+func TestIntegrationCheckpointMismatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationCheckpointMismatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	cs, g, err := newCheckpointedConsensusSet("TestIntegrationCheckpointMismatch - 2", map[types.BlockHeight]types.BlockID{
+		2: {1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	defer cs.Close()
+
+	b1, _ := cst.cs.BlockAtHeight(1)
+	b2, _ := cst.cs.BlockAtHeight(2)
+	if err := cs.AcceptBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.AcceptBlock(b2); err != errCheckpointMismatch {
+		t.Fatal("expected errCheckpointMismatch, got", err)
+	}
+}
+
+// TestIntegrationCheckpointReorg checks that the consensus set will not
+// reorganize below a checkpoint that it has reached, even when presented with
+// a heavier fork.
+func TestIntegrationCheckpointReorg(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst1, err := createConsensusSetTester("TestIntegrationCheckpointReorg - 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst1.Close()
+	cst2, err := createConsensusSetTester("TestIntegrationCheckpointReorg - 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst2.Close()
+	b2, _ := cst1.cs.BlockAtHeight(2)
+	cs, g, err := newCheckpointedConsensusSet("TestIntegrationCheckpointReorg - 3", map[types.BlockHeight]types.BlockID{
+		2: b2.ID(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	defer cs.Close()
+
+	// Bring the checkpointed consensus set past the checkpoint.
+	for h := types.BlockHeight(1); h <= 3; h++ {
+		b, _ := cst1.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The chain of cst2 forks from the genesis block, and should be rejected.
+	b, _ := cst2.cs.BlockAtHeight(1)
+	if err := cs.AcceptBlock(b); err != errCheckpointReorg {
+		t.Fatal("expected errCheckpointReorg, got", err)
+	}
+	b3, _ := cst1.cs.BlockAtHeight(3)
+	if cs.CurrentBlock().ID() != b3.ID() {
+		t.Fatal("consensus set left the checkpointed chain")
+	}
+}
+
+// TestTrustedBlock checks that only blocks that are known to be ancestors of a
+// checkpointed block are trusted during initial blockchain download.
+func TestTrustedBlock(t *testing.T) {
+	b1 := types.Block{ParentID: types.GenesisBlock.ID()}
+	b2 := types.Block{ParentID: b1.ID()}
+	b3 := types.Block{ParentID: b2.ID()}
+	fork := types.Block{ParentID: types.GenesisBlock.ID(), Nonce: types.BlockNonce{1}}
+	cs := &ConsensusSet{
+		checkpoints:         map[types.BlockHeight]types.BlockID{2: b2.ID()},
+		checkpointAncestors: make(map[types.BlockID]struct{}),
+	}
+
+	// A path that contains the checkpointed block trusts the blocks up to and
+	// including the checkpointed block.
+	path := []*processedBlock{
+		{Block: types.GenesisBlock, Height: 0},
+		{Block: b1, Height: 1},
+		{Block: b2, Height: 2},
+		{Block: b3, Height: 3},
+	}
+	if i := cs.checkpointIndex(path); i != 2 {
+		t.Fatal("wrong checkpoint index:", i)
+	}
+	if i := cs.checkpointIndex(path[:2]); i != -1 {
+		t.Fatal("path without a checkpoint has checkpoint index", i)
+	}
+
+	// A block below the checkpoint height is not trusted unless it is known to
+	// be an ancestor of the checkpointed block.
+	if cs.trustedBlock(fork.ID(), false) || cs.trustedBlock(b1.ID(), false) {
+		t.Fatal("block that is not known to precede a checkpoint is trusted")
+	}
+
+	// Headers that lead to the checkpointed header are trusted.
+	cs.addCheckpointAncestors([]types.BlockHeader{fork.Header()}, 0)
+	cs.addCheckpointAncestors([]types.BlockHeader{b1.Header(), b2.Header(), b3.Header()}, 0)
+	if !cs.trustedBlock(b1.ID(), false) || !cs.trustedBlock(b2.ID(), false) {
+		t.Fatal("ancestors of a checkpointed header are not trusted")
+	}
+	if cs.trustedBlock(b3.ID(), false) || cs.trustedBlock(fork.ID(), false) {
+		t.Fatal("header that does not precede a checkpoint is trusted")
+	}
+
+	// Nothing is trusted once the consensus set is synced.
+	cs.synced = true
+	if cs.trustedBlock(b1.ID(), true) {
+		t.Fatal("block is trusted after initial blockchain download")
+	}
+}
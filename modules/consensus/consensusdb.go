@@ -74,9 +74,12 @@ func (cs *ConsensusSet) createConsensusDB(tx *bolt.Tx) error {
 		FileContracts,
 		SiafundOutputs,
 		SiafundPool,
+		Forks,
+		StaleBlocks,
 	}
 	for _, bucket := range buckets {
-		_, err := tx.CreateBucket(bucket)
+		// The block map already exists if the database is being rebuilt.
+		_, err := tx.CreateBucketIfNotExists(bucket)
 		if err != nil {
 			return err
 		}
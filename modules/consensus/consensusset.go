@@ -24,6 +24,17 @@ var (
 	errNilGateway = errors.New("cannot have a nil gateway as input")
 )
 
+// Settings contains the optional settings of a ConsensusSet.
+type Settings struct {
+	// Checkpoints are used in addition to the default checkpoints.
+	Checkpoints map[types.BlockHeight]types.BlockID
+
+	// PruneDepth enables pruned mode if it is not 0. Blocks that are more
+	// than PruneDepth blocks deep are pruned. It must be at least
+	// MinPruneDepth.
+	PruneDepth types.BlockHeight
+}
+
 // The ConsensusSet is the object responsible for tracking the current status
 // of the blockchain. Broadly speaking, it is responsible for maintaining
 // consensus.  It accepts blocks and constructs a blockchain, forking when
@@ -59,6 +70,21 @@ type ConsensusSet struct {
 	// the genesis block, meaning the PoW is not very expensive.
 	dosBlocks map[types.BlockID]struct{}
 
+	// checkpoints map heights to the ids of the blocks that must appear at
+	// those heights. The map is not modified after the consensus set is
+	// created.
+	checkpoints map[types.BlockHeight]types.BlockID
+
+	// checkpointAncestors contains the ids of downloaded headers that are
+	// ancestors of a checkpointed header. The corresponding blocks are
+	// trusted during initial blockchain download. The map is cleared once the
+	// consensus set is synced.
+	checkpointAncestors map[types.BlockID]struct{}
+
+	// pruneDepth is the number of blocks that are kept in full when the
+	// consensus set is in pruned mode. It is 0 if pruning is disabled.
+	pruneDepth types.BlockHeight
+
 	// checkingConsistency is a bool indicating whether or not a consistency
 	// check is in progress. The consistency check logic call itself, resulting
 	// in infinite loops. This bool prevents that while still allowing for full
@@ -71,6 +97,10 @@ type ConsensusSet struct {
 	// whether the consensus set is synced with the network.
 	synced bool
 
+	// headerHeight is the height of the best header chain downloaded from
+	// peers during initial blockchain download.
+	headerHeight types.BlockHeight
+
 	// Interfaces to abstract the dependencies of the ConsensusSet.
 	marshaler       encoding.GenericMarshaler
 	blockRuleHelper blockRuleHelper
@@ -83,28 +113,59 @@ type ConsensusSet struct {
 	persistDir string
 }
 
+// newBlockRoot returns the processed genesis block, including the diffs for
+// the genesis siafund outputs.
+func newBlockRoot() processedBlock {
+	blockRoot := processedBlock{
+		Block:       types.GenesisBlock,
+		ChildTarget: types.RootTarget,
+		Depth:       types.RootDepth,
+
+		DiffsGenerated: true,
+	}
+	for i, siafundOutput := range types.GenesisBlock.Transactions[0].SiafundOutputs {
+		sfid := types.GenesisBlock.Transactions[0].SiafundOutputID(uint64(i))
+		sfod := modules.SiafundOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            sfid,
+			SiafundOutput: siafundOutput,
+		}
+		blockRoot.SiafundOutputDiffs = append(blockRoot.SiafundOutputDiffs, sfod)
+	}
+	return blockRoot
+}
+
 // New returns a new ConsensusSet, containing at least the genesis block. If
 // there is an existing block database present in the persist directory, it
 // will be loaded.
 func New(gateway modules.Gateway, persistDir string) (*ConsensusSet, error) {
+	return NewWithSettings(gateway, persistDir, Settings{})
+}
+
+// NewWithSettings returns a new ConsensusSet that uses the provided settings.
+func NewWithSettings(gateway modules.Gateway, persistDir string, settings Settings) (*ConsensusSet, error) {
 	// Check for nil dependencies.
 	if gateway == nil {
 		return nil, errNilGateway
 	}
+	checkpoints, err := mergeCheckpoints(settings.Checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	if settings.PruneDepth != 0 && settings.PruneDepth < MinPruneDepth {
+		return nil, errPruneDepth
+	}
 
 	// Create the ConsensusSet object.
 	cs := &ConsensusSet{
 		gateway: gateway,
 
-		blockRoot: processedBlock{
-			Block:       types.GenesisBlock,
-			ChildTarget: types.RootTarget,
-			Depth:       types.RootDepth,
-
-			DiffsGenerated: true,
-		},
+		blockRoot: newBlockRoot(),
 
-		dosBlocks: make(map[types.BlockID]struct{}),
+		dosBlocks:           make(map[types.BlockID]struct{}),
+		checkpoints:         checkpoints,
+		checkpointAncestors: make(map[types.BlockID]struct{}),
+		pruneDepth:          settings.PruneDepth,
 
 		marshaler:       encoding.StdGenericMarshaler{},
 		blockRuleHelper: stdBlockRuleHelper{},
@@ -113,19 +174,8 @@ func New(gateway modules.Gateway, persistDir string) (*ConsensusSet, error) {
 		persistDir: persistDir,
 	}
 
-	// Create the diffs for the genesis siafund outputs.
-	for i, siafundOutput := range types.GenesisBlock.Transactions[0].SiafundOutputs {
-		sfid := types.GenesisBlock.Transactions[0].SiafundOutputID(uint64(i))
-		sfod := modules.SiafundOutputDiff{
-			Direction:     modules.DiffApply,
-			ID:            sfid,
-			SiafundOutput: siafundOutput,
-		}
-		cs.blockRoot.SiafundOutputDiffs = append(cs.blockRoot.SiafundOutputDiffs, sfod)
-	}
-
 	// Initialize the consensus persistence structures.
-	err := cs.initPersist()
+	err = cs.initPersist()
 	if err != nil {
 		return nil, err
 	}
@@ -143,11 +193,15 @@ func New(gateway modules.Gateway, persistDir string) (*ConsensusSet, error) {
 		gateway.RegisterRPC("RelayBlock", cs.rpcRelayBlock) // COMPATv0.5.1
 		gateway.RegisterRPC("RelayHeader", cs.rpcRelayHeader)
 		gateway.RegisterRPC("SendBlk", cs.rpcSendBlk)
+		gateway.RegisterRPC("SendHeaders", cs.rpcSendHeaders)
+		gateway.RegisterRPC("SendWindow", cs.rpcSendWindow)
+		gateway.RegisterRPC("SendFilteredHeaders", cs.rpcSendFilteredHeaders)
 		gateway.RegisterConnectCall("SendBlocks", cs.threadedReceiveBlocks)
 
 		// Mark that we are synced with the network.
 		cs.mu.Lock()
 		cs.synced = true
+		cs.checkpointAncestors = make(map[types.BlockID]struct{})
 		cs.mu.Unlock()
 	}()
 
@@ -165,6 +219,9 @@ func (cs *ConsensusSet) BlockAtHeight(height types.BlockHeight) (block types.Blo
 		if err != nil {
 			return err
 		}
+		if blockPruned(tx, id, height) {
+			return errPrunedBlock
+		}
 		block = pb.Block
 		exists = true
 		return nil
@@ -77,7 +77,7 @@ func consensusChecksum(tx *bolt.Tx) crypto.Hash {
 
 // checkSiacoinCount checks that the number of siacoins countable within the
 // consensus set equal the expected number of siacoins for the block height.
-func checkSiacoinCount(tx *bolt.Tx) {
+func checkSiacoinCount(tx *bolt.Tx) error {
 	// Iterate through all the buckets looking for the delayed siacoin output
 	// buckets, and check that they are for the correct heights.
 	var dscoSiacoins types.Currency
@@ -88,22 +88,18 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		}
 
 		// Sum up the delayed outputs in this bucket.
-		err := b.ForEach(func(_, delayedOutput []byte) error {
+		return b.ForEach(func(_, delayedOutput []byte) error {
 			var sco types.SiacoinOutput
 			err := encoding.Unmarshal(delayedOutput, &sco)
 			if err != nil {
-				manageErr(tx, err)
+				return err
 			}
 			dscoSiacoins = dscoSiacoins.Add(sco.Value)
 			return nil
 		})
-		if err != nil {
-			return err
-		}
-		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the siacoin outputs.
@@ -112,13 +108,13 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var sco types.SiacoinOutput
 		err := encoding.Unmarshal(scoBytes, &sco)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		scoSiacoins = scoSiacoins.Add(sco.Value)
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the payouts from file contracts.
@@ -127,7 +123,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var fc types.FileContract
 		err := encoding.Unmarshal(fcBytes, &fc)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		var fcCoins types.Currency
 		for _, output := range fc.ValidProofOutputs {
@@ -137,7 +133,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Add all of the siafund claims.
@@ -146,7 +142,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		var sfo types.SiafundOutput
 		err := encoding.Unmarshal(sfoBytes, &sfo)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 
 		coinsPerFund := getSiafundPool(tx).Sub(sfo.ClaimStart)
@@ -155,7 +151,7 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	expectedSiacoins := types.CalculateNumSiacoins(blockHeight(tx))
@@ -167,34 +163,36 @@ func checkSiacoinCount(tx *bolt.Tx) {
 		} else {
 			diagnostics += fmt.Sprintf("total: %v\nexpected: %v\n expected is bigger: %v", totalSiacoins, expectedSiacoins, totalSiacoins.Sub(expectedSiacoins))
 		}
-		manageErr(tx, errors.New(diagnostics))
+		return errors.New(diagnostics)
 	}
+	return nil
 }
 
 // checkSiafundCount checks that the number of siafunds countable within the
 // consensus set equal the expected number of siafunds for the block height.
-func checkSiafundCount(tx *bolt.Tx) {
+func checkSiafundCount(tx *bolt.Tx) error {
 	var total types.Currency
 	err := tx.Bucket(SiafundOutputs).ForEach(func(_, siafundOutputBytes []byte) error {
 		var sfo types.SiafundOutput
 		err := encoding.Unmarshal(siafundOutputBytes, &sfo)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		total = total.Add(sfo.Value)
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 	if total.Cmp(types.SiafundCount) != 0 {
-		manageErr(tx, errors.New("wrong number if siafunds in the consensus set"))
+		return errors.New("wrong number if siafunds in the consensus set")
 	}
+	return nil
 }
 
 // checkDSCOs scans the sets of delayed siacoin outputs and checks for
 // consistency.
-func checkDSCOs(tx *bolt.Tx) {
+func checkDSCOs(tx *bolt.Tx) error {
 	// Create a map to track which delayed siacoin output maps exist, and
 	// another map to track which ids have appeared in the dsco set.
 	dscoTracker := make(map[types.BlockHeight]struct{})
@@ -213,7 +211,7 @@ func checkDSCOs(tx *bolt.Tx) {
 		var height types.BlockHeight
 		err := encoding.Unmarshal(name[len(prefixDSCO):], &height)
 		if err != nil {
-			manageErr(tx, err)
+			return err
 		}
 		_, exists := dscoTracker[height]
 		if exists {
@@ -236,7 +234,7 @@ func checkDSCOs(tx *bolt.Tx) {
 			var sco types.SiacoinOutput
 			err := encoding.Unmarshal(delayedOutput, &sco)
 			if err != nil {
-				manageErr(tx, err)
+				return err
 			}
 			total = total.Add(sco.Value)
 			return nil
@@ -254,7 +252,7 @@ func checkDSCOs(tx *bolt.Tx) {
 		return nil
 	})
 	if err != nil {
-		manageErr(tx, err)
+		return err
 	}
 
 	// Check that all of the correct heights are represented.
@@ -266,13 +264,55 @@ func checkDSCOs(tx *bolt.Tx) {
 		}
 		_, exists := dscoTracker[i]
 		if !exists {
-			manageErr(tx, errors.New("missing a dsco bucket"))
+			return errors.New("missing a dsco bucket")
 		}
 		expectedBuckets++
 	}
 	if len(dscoTracker) != expectedBuckets {
-		manageErr(tx, errors.New("too many dsco buckets"))
+		return errors.New("too many dsco buckets")
 	}
+	return nil
+}
+
+// checkFileContracts checks that every file contract has an expiration entry
+// at the end of its proof window, and that there are no expiration entries
+// without a matching file contract.
+func checkFileContracts(tx *bolt.Tx) error {
+	var contracts int
+	err := tx.Bucket(FileContracts).ForEach(func(id, fcBytes []byte) error {
+		var fc types.FileContract
+		err := encoding.Unmarshal(fcBytes, &fc)
+		if err != nil {
+			return err
+		}
+		expirationBucket := tx.Bucket(append(prefixFCEX, encoding.Marshal(fc.WindowEnd)...))
+		if expirationBucket == nil || expirationBucket.Get(id) == nil {
+			return errors.New("file contract has no expiration entry")
+		}
+		contracts++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var expirations int
+	err = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if !bytes.HasPrefix(name, prefixFCEX) {
+			return nil
+		}
+		return b.ForEach(func(_, _ []byte) error {
+			expirations++
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if contracts != expirations {
+		return errors.New("number of file contract expirations does not match the number of file contracts")
+	}
+	return nil
 }
 
 // checkRevertApply reverts the most recent block, checking to see that the
@@ -309,6 +349,18 @@ func (cs *ConsensusSet) checkRevertApply(tx *bolt.Tx) {
 	}
 }
 
+// consistencyChecks are the checks that are run by checkConsistency and by
+// VerifyDatabase, in order.
+var consistencyChecks = []struct {
+	name string
+	fn   func(*bolt.Tx) error
+}{
+	{"delayed siacoin outputs", checkDSCOs},
+	{"siacoin count", checkSiacoinCount},
+	{"siafund count", checkSiafundCount},
+	{"file contract expirations", checkFileContracts},
+}
+
 // checkConsistency runs a series of checks to make sure that the consensus set
 // is consistent with some rules that should always be true.
 func (cs *ConsensusSet) checkConsistency(tx *bolt.Tx) {
@@ -316,9 +368,11 @@ func (cs *ConsensusSet) checkConsistency(tx *bolt.Tx) {
 		return
 	}
 	cs.checkingConsistency = true
-	checkDSCOs(tx)
-	checkSiacoinCount(tx)
-	checkSiafundCount(tx)
+	for _, check := range consistencyChecks {
+		if err := check.fn(tx); err != nil {
+			manageErr(tx, err)
+		}
+	}
 	if build.DEBUG {
 		cs.checkRevertApply(tx)
 	}
@@ -338,6 +392,3 @@ func (cs *ConsensusSet) maybeCheckConsistency(tx *bolt.Tx) {
 		cs.checkConsistency(tx)
 	}
 }
-
-// TODO: Check that every file contract has an expiration too, and that the
-// number of file contracts + the number of expirations is equal.
@@ -200,8 +200,9 @@ func commitDiffSet(tx *bolt.Tx, pb *processedBlock, dir modules.DiffDirection) {
 // consensus state. These two actions must happen at the same time because
 // transactions are allowed to depend on each other. We can't be sure that a
 // transaction is valid unless we have applied all of the previous transactions
-// in the block, which means we need to apply while we verify.
-func generateAndApplyDiff(tx *bolt.Tx, pb *processedBlock) error {
+// in the block, which means we need to apply while we verify. If 'trusted'
+// is set, signatures and storage proofs are not verified.
+func generateAndApplyDiff(tx *bolt.Tx, pb *processedBlock, trusted bool) error {
 	// Sanity check - the block being applied should have the current block as
 	// a parent.
 	if build.DEBUG && pb.Block.ParentID != currentBlockID(tx) {
@@ -217,7 +218,12 @@ func generateAndApplyDiff(tx *bolt.Tx, pb *processedBlock) error {
 	// validated all at once because some transactions may not be valid until
 	// previous transactions have been applied.
 	for _, txn := range pb.Block.Transactions {
-		err := validTransaction(tx, txn)
+		var err error
+		if trusted {
+			err = validCheckpointedTransaction(tx, txn)
+		} else {
+			err = validTransaction(tx, txn)
+		}
 		if err != nil {
 			return err
 		}
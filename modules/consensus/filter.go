@@ -0,0 +1,184 @@
+package consensus
+
+// filter.go contains the serving end of the SendFilteredHeaders RPC, which is
+// used by light consensus sets. The caller provides its block history and a
+// set of addresses. The headers of the current path after the most recent
+// block known to the caller are sent, and the full block is sent only for the
+// blocks that involve one of the addresses.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// MaxFilterAddresses is the maximum number of addresses that can be sent
+	// in the filter of the SendFilteredHeaders RPC.
+	MaxFilterAddresses = 50e3
+)
+
+var (
+	errFilterTooLarge = errors.New("filter contains too many addresses")
+)
+
+// addressFilter is a set of addresses that a light consensus set is
+// interested in.
+type addressFilter map[types.UnlockHash]struct{}
+
+// newAddressFilter creates an addressFilter from a list of addresses.
+func newAddressFilter(addrs []types.UnlockHash) addressFilter {
+	f := make(addressFilter, len(addrs))
+	for _, addr := range addrs {
+		f[addr] = struct{}{}
+	}
+	return f
+}
+
+// contains returns true if the address is in the filter.
+func (f addressFilter) contains(addr types.UnlockHash) bool {
+	_, exists := f[addr]
+	return exists
+}
+
+// matchesBlock returns true if any of the miner payouts, inputs, outputs or
+// file contract payouts of the block involve an address in the filter.
+func (f addressFilter) matchesBlock(b types.Block) bool {
+	for _, mp := range b.MinerPayouts {
+		if f.contains(mp.UnlockHash) {
+			return true
+		}
+	}
+	for _, txn := range b.Transactions {
+		for _, sci := range txn.SiacoinInputs {
+			if f.contains(sci.UnlockConditions.UnlockHash()) {
+				return true
+			}
+		}
+		for _, sco := range txn.SiacoinOutputs {
+			if f.contains(sco.UnlockHash) {
+				return true
+			}
+		}
+		for _, fc := range txn.FileContracts {
+			for _, sco := range append(fc.ValidProofOutputs, fc.MissedProofOutputs...) {
+				if f.contains(sco.UnlockHash) {
+					return true
+				}
+			}
+		}
+		for _, sfi := range txn.SiafundInputs {
+			if f.contains(sfi.UnlockConditions.UnlockHash()) || f.contains(sfi.ClaimUnlockHash) {
+				return true
+			}
+		}
+		for _, sfo := range txn.SiafundOutputs {
+			if f.contains(sfo.UnlockHash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rpcSendFilteredHeaders is the receiving end of the SendFilteredHeaders RPC.
+// It reads the block history and the address filter of the caller, and then
+// sends the headers of the current path after the most recent block that the
+// caller knows about. Each batch of up to MaxCatchUpHeaders headers is
+// followed by the indices of the headers whose blocks match the filter, the
+// matching blocks, and a flag indicating whether more headers are available.
+func (cs *ConsensusSet) rpcSendFilteredHeaders(conn modules.PeerConn) error {
+	var knownBlocks [32]types.BlockID
+	err := encoding.ReadObject(conn, &knownBlocks, 32*crypto.HashSize)
+	if err != nil {
+		return err
+	}
+	var addrs []types.UnlockHash
+	err = encoding.ReadObject(conn, &addrs, MaxFilterAddresses*crypto.HashSize+8)
+	if err != nil {
+		return err
+	}
+	if len(addrs) > MaxFilterAddresses {
+		return errFilterTooLarge
+	}
+	filter := newAddressFilter(addrs)
+
+	var start, pruned types.BlockHeight
+	var found bool
+	cs.mu.RLock()
+	err = cs.db.View(func(tx *bolt.Tx) error {
+		start, found = findSyncStart(tx, knownBlocks)
+		pruned = prunedHeight(tx)
+		return nil
+	})
+	cs.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	// As in SendHeaders, a pruned node advertises that it cannot send the
+	// blocks by sending an empty batch and indicating that more are
+	// available.
+	if !found || start < pruned {
+		if err := encoding.WriteObject(conn, []types.BlockHeader{}); err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, []uint64{}); err != nil {
+			return err
+		}
+		return encoding.WriteObject(conn, found)
+	}
+
+	moreAvailable := true
+	for moreAvailable {
+		var headers []types.BlockHeader
+		var matches []uint64
+		var blocks []types.Block
+		cs.mu.RLock()
+		err = cs.db.View(func(tx *bolt.Tx) error {
+			height := blockHeight(tx)
+			for i := start; i <= height && i < start+MaxCatchUpHeaders; i++ {
+				id, err := getPath(tx, i)
+				if build.DEBUG && err != nil {
+					panic(err)
+				}
+				pb, err := getBlockMap(tx, id)
+				if build.DEBUG && err != nil {
+					panic(err)
+				}
+				if filter.matchesBlock(pb.Block) {
+					matches = append(matches, uint64(len(headers)))
+					blocks = append(blocks, pb.Block)
+				}
+				headers = append(headers, pb.Block.Header())
+			}
+			moreAvailable = start+MaxCatchUpHeaders <= height
+			start += MaxCatchUpHeaders
+			return nil
+		})
+		cs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, headers); err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, matches); err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := encoding.WriteObject(conn, b); err != nil {
+				return err
+			}
+		}
+		if err := encoding.WriteObject(conn, moreAvailable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -19,11 +19,14 @@ var (
 // the former.
 func backtrackToCurrentPath(tx *bolt.Tx, pb *processedBlock) []*processedBlock {
 	path := []*processedBlock{pb}
+	// The id of each block is tracked separately, because the id of a pruned
+	// block cannot be computed from the block.
+	id := pb.Block.ID()
 	for {
 		// Error is not checked in production code - an error can only indicate
 		// that pb.Height > blockHeight(tx).
 		currentPathID, err := getPath(tx, pb.Height)
-		if currentPathID == pb.Block.ID() {
+		if currentPathID == id {
 			break
 		}
 		// Sanity check - an error should only indicate that pb.Height >
@@ -34,7 +37,8 @@ func backtrackToCurrentPath(tx *bolt.Tx, pb *processedBlock) []*processedBlock {
 
 		// Prepend the next block to the list of blocks leading from the
 		// current path to the input block.
-		pb, err = getBlockMap(tx, pb.Block.ParentID)
+		id = pb.Block.ParentID
+		pb, err = getBlockMap(tx, id)
 		if build.DEBUG && err != nil {
 			panic(err)
 		}
@@ -75,13 +79,17 @@ func (cs *ConsensusSet) revertToBlock(tx *bolt.Tx, pb *processedBlock) (reverted
 func (cs *ConsensusSet) applyUntilBlock(tx *bolt.Tx, pb *processedBlock) (appliedBlocks []*processedBlock, err error) {
 	// Backtrack to the common parent of 'bn' and current path and then apply the new blocks.
 	newPath := backtrackToCurrentPath(tx, pb)
-	for _, block := range newPath[1:] {
+	checkpoint := cs.checkpointIndex(newPath)
+	for i := 1; i < len(newPath); i++ {
+		block := newPath[i]
 		// If the diffs for this block have already been generated, apply diffs
 		// directly instead of generating them. This is much faster.
 		if block.DiffsGenerated {
 			commitDiffSet(tx, block, modules.DiffApply)
 		} else {
-			err := generateAndApplyDiff(tx, block)
+			id := block.Block.ID()
+			err := generateAndApplyDiff(tx, block, cs.trustedBlock(id, i <= checkpoint))
+			delete(cs.checkpointAncestors, id)
 			if err != nil {
 				// Mark the block as invalid.
 				cs.dosBlocks[block.Block.ID()] = struct{}{}
@@ -107,6 +115,11 @@ func (cs *ConsensusSet) applyUntilBlock(tx *bolt.Tx, pb *processedBlock) (applie
 // updated if the function returns nil.
 func (cs *ConsensusSet) forkBlockchain(tx *bolt.Tx, newBlock *processedBlock) (revertedBlocks, appliedBlocks []*processedBlock, err error) {
 	commonParent := backtrackToCurrentPath(tx, newBlock)[0]
+	// Blocks below the pruning horizon cannot be reverted, and cannot be
+	// used as the common parent.
+	if commonParent.Height < prunedHeight(tx) {
+		return nil, nil, errPrunedReorg
+	}
 	revertedBlocks = cs.revertToBlock(tx, commonParent)
 	appliedBlocks, err = cs.applyUntilBlock(tx, newBlock)
 	if err != nil {
@@ -0,0 +1,150 @@
+package consensus
+
+// forks.go records the reorgs performed by the consensus set and the blocks
+// that did not extend the current path, so that competing chains can be
+// monitored. Both are stored in the consensus database, keyed by a big-endian
+// sequence number so that they are iterated in the order they were recorded.
+
+import (
+	"encoding/binary"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// maxStaleBlocks is the number of non-extending blocks that are kept.
+	// Older blocks are removed from the record, but remain in the block map.
+	maxStaleBlocks = 100
+)
+
+var (
+	// Forks is a database bucket that records every reorg performed by the
+	// consensus set.
+	Forks = []byte("Forks")
+
+	// StaleBlocks is a database bucket that records the most recently
+	// received blocks that did not extend the current path.
+	StaleBlocks = []byte("StaleBlocks")
+)
+
+// createForkBuckets creates the buckets that record forks and stale blocks.
+// Databases that were created before forks were recorded do not have them.
+func createForkBuckets(tx *bolt.Tx) error {
+	for _, bucket := range [][]byte{Forks, StaleBlocks} {
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearForkRecords removes all of the recorded forks and stale blocks.
+func clearForkRecords(tx *bolt.Tx) error {
+	for _, bucket := range [][]byte{Forks, StaleBlocks} {
+		if err := tx.DeleteBucket(bucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return createForkBuckets(tx)
+}
+
+// appendRecord adds a value to the end of a bucket that is keyed by sequence
+// number.
+func appendRecord(b *bolt.Bucket, v []byte) error {
+	var seq uint64
+	if k, _ := b.Cursor().Last(); k != nil {
+		seq = binary.BigEndian.Uint64(k) + 1
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return b.Put(key, v)
+}
+
+// recordFork records a reorg that reverted 'revertedBlocks' and applied
+// 'appliedBlocks'.
+func recordFork(tx *bolt.Tx, revertedBlocks, appliedBlocks []*processedBlock) error {
+	if len(revertedBlocks) == 0 {
+		return nil
+	}
+	fork := modules.ConsensusFork{
+		CommonParent:       appliedBlocks[0].Block.ParentID,
+		CommonParentHeight: appliedBlocks[0].Height - 1,
+		Depth:              types.BlockHeight(len(revertedBlocks)),
+		Timestamp:          types.CurrentTimestamp(),
+	}
+	for _, rb := range revertedBlocks {
+		fork.RevertedBlocks = append(fork.RevertedBlocks, rb.Block.ID())
+	}
+	for _, ab := range appliedBlocks {
+		fork.AppliedBlocks = append(fork.AppliedBlocks, ab.Block.ID())
+	}
+	return appendRecord(tx.Bucket(Forks), encoding.Marshal(fork))
+}
+
+// recordStaleBlock records a block that did not extend the current path,
+// removing the oldest stale blocks from the record if there are more than
+// maxStaleBlocks.
+func recordStaleBlock(tx *bolt.Tx, pb *processedBlock) error {
+	b := tx.Bucket(StaleBlocks)
+	err := appendRecord(b, encoding.Marshal(modules.StaleBlock{
+		ID:        pb.Block.ID(),
+		ParentID:  pb.Block.ParentID,
+		Height:    pb.Height,
+		Timestamp: types.CurrentTimestamp(),
+	}))
+	if err != nil {
+		return err
+	}
+	// The sequence numbers are contiguous, as records are only removed from
+	// the front. Bucket stats are not used, as they are not updated until
+	// the transaction is committed.
+	c := b.Cursor()
+	first, _ := c.First()
+	last, _ := c.Last()
+	for n := binary.BigEndian.Uint64(last) - binary.BigEndian.Uint64(first) + 1; n > maxStaleBlocks; n-- {
+		k, _ := b.Cursor().First()
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forks returns every reorg that the consensus set has performed, in the order
+// that they happened.
+func (cs *ConsensusSet) Forks() (forks []modules.ConsensusFork) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(Forks).ForEach(func(_, v []byte) error {
+			var fork modules.ConsensusFork
+			err := encoding.Unmarshal(v, &fork)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			forks = append(forks, fork)
+			return nil
+		})
+	})
+	return forks
+}
+
+// StaleBlocks returns the most recently received blocks that did not extend
+// the current path, oldest first.
+func (cs *ConsensusSet) StaleBlocks() (blocks []modules.StaleBlock) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(StaleBlocks).ForEach(func(_, v []byte) error {
+			var sb modules.StaleBlock
+			err := encoding.Unmarshal(v, &sb)
+			if build.DEBUG && err != nil {
+				panic(err)
+			}
+			blocks = append(blocks, sb)
+			return nil
+		})
+	})
+	return blocks
+}
@@ -0,0 +1,103 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestIntegrationForks checks that a reorg is recorded as a fork, and that the
+// blocks that did not extend the current path are recorded as stale blocks.
+func TestIntegrationForks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst1, err := createConsensusSetTester("TestIntegrationForks - 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst1.Close()
+	cst2, err := createConsensusSetTester("TestIntegrationForks - 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst2.Close()
+	if len(cst1.cs.Forks()) != 0 || len(cst1.cs.StaleBlocks()) != 0 {
+		t.Fatal("forks were recorded before any reorg")
+	}
+
+	// Make the chain of cst2 heavier, and then give its blocks to cst1. Every
+	// block up to the height of cst1 is stale, and the next block causes a
+	// reorg back to the genesis block.
+	oldHeight := cst1.cs.Height()
+	var oldPath []types.BlockID
+	for h := types.BlockHeight(1); h <= oldHeight; h++ {
+		b, _ := cst1.cs.BlockAtHeight(h)
+		oldPath = append(oldPath, b.ID())
+	}
+	for cst2.cs.Height() <= oldHeight {
+		if _, err := cst2.miner.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h := types.BlockHeight(1); h <= oldHeight+1; h++ {
+		b, _ := cst2.cs.BlockAtHeight(h)
+		cst1.cs.AcceptBlock(b)
+	}
+	if cst1.cs.CurrentBlock().ID() != cst2.cs.CurrentBlock().ID() {
+		t.Fatal("reorg did not happen")
+	}
+
+	forks := cst1.cs.Forks()
+	if len(forks) != 1 {
+		t.Fatal("expected 1 fork, got", len(forks))
+	}
+	fork := forks[0]
+	if fork.CommonParent != types.GenesisBlock.ID() || fork.CommonParentHeight != 0 {
+		t.Error("wrong common parent:", fork.CommonParent, fork.CommonParentHeight)
+	}
+	if fork.Depth != oldHeight || len(fork.RevertedBlocks) != int(oldHeight) || len(fork.AppliedBlocks) != int(oldHeight+1) {
+		t.Error("wrong fork depth:", fork.Depth, len(fork.RevertedBlocks), len(fork.AppliedBlocks))
+	}
+	// Blocks are reverted starting with the current block.
+	if fork.RevertedBlocks[0] != oldPath[len(oldPath)-1] {
+		t.Error("wrong reverted blocks")
+	}
+	if fork.AppliedBlocks[len(fork.AppliedBlocks)-1] != cst1.cs.CurrentBlock().ID() {
+		t.Error("wrong applied blocks")
+	}
+	if fork.Timestamp == 0 {
+		t.Error("fork timestamp was not set")
+	}
+
+	stale := cst1.cs.StaleBlocks()
+	if len(stale) != int(oldHeight) {
+		t.Fatal("wrong number of stale blocks:", len(stale))
+	}
+	for i, sb := range stale {
+		b, _ := cst2.cs.BlockAtHeight(types.BlockHeight(i + 1))
+		if sb.ID != b.ID() || sb.ParentID != b.ParentID || sb.Height != types.BlockHeight(i+1) {
+			t.Error("wrong stale block at index", i)
+		}
+	}
+
+	// Only the most recent stale blocks are kept.
+	err = cst1.cs.db.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < maxStaleBlocks; i++ {
+			pb := &processedBlock{Block: types.Block{Nonce: types.BlockNonce{byte(i)}}, Height: types.BlockHeight(i)}
+			if err := recordStaleBlock(tx, pb); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale = cst1.cs.StaleBlocks()
+	if len(stale) != maxStaleBlocks || stale[0].Height != 0 || stale[maxStaleBlocks-1].Height != maxStaleBlocks-1 {
+		t.Fatal("stale blocks were not trimmed")
+	}
+}
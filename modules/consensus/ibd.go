@@ -0,0 +1,564 @@
+package consensus
+
+// ibd.go contains the headers-first initial blockchain download. The headers
+// of the heaviest chain known to the outbound peers are downloaded first. The
+// proof of work, timestamps and target adjustments of the headers are checked
+// before any blocks are requested, so that a peer cannot make the consensus
+// set download a chain that it could not produce. The
+// corresponding blocks are then downloaded in parallel windows from several
+// peers, and applied in order. A window that a peer fails to deliver in time
+// is reassigned to another peer.
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// parallelDownloadVersion is the minimum version of a peer that supports
+	// the SendHeaders and SendWindow RPCs.
+	parallelDownloadVersion = "0.6.1"
+
+	// maxParallelPeers is the maximum number of peers that blocks are
+	// downloaded from at the same time.
+	maxParallelPeers = 8
+
+	// maxWindowsAhead is the maximum number of windows that may be downloaded
+	// ahead of the next window to be applied. It bounds the number of blocks
+	// held in memory.
+	maxWindowsAhead = 4 * maxParallelPeers
+
+	// maxHeaderBatches is the maximum number of batches of headers that are
+	// read in a single call to the SendHeaders RPC. It bounds the memory used
+	// by the header chain. Any remaining headers are downloaded the next time
+	// that the RPC is called.
+	maxHeaderBatches = 50
+)
+
+var (
+	// MaxCatchUpHeaders is the maximum number of headers that are sent in a
+	// single batch of the SendHeaders RPC.
+	MaxCatchUpHeaders = func() types.BlockHeight {
+		switch build.Release {
+		case "dev":
+			return 500
+		case "standard":
+			return 2000
+		case "testing":
+			return 10
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+	// windowTimeout is the time a peer is given to send a window of blocks
+	// before the window is reassigned to another peer.
+	windowTimeout = func() time.Duration {
+		switch build.Release {
+		case "dev":
+			return 20 * time.Second
+		case "standard":
+			return 2 * time.Minute
+		case "testing":
+			return 3 * time.Second
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+
+	errBadHeaderChain    = errors.New("peer sent headers that do not form a chain")
+	errDownloadStalled   = errors.New("no peers are left to download blocks from")
+	errOrphanHeaderChain = errors.New("peer sent headers that do not connect to the current path")
+	errWindowIncomplete  = errors.New("peer did not send the requested window of blocks")
+	errWindowTooLarge    = errors.New("requested window of blocks is too large")
+)
+
+// windowResult is the outcome of downloading a window of blocks from a peer.
+type windowResult struct {
+	index  int
+	peer   modules.NetAddress
+	blocks []types.Block
+	err    error
+}
+
+// setSyncDeadline sets a deadline on the conn. Errors are ignored if the conn
+// is a pipe in testing, as pipes do not support deadlines.
+func setSyncDeadline(conn modules.PeerConn, timeout time.Duration) error {
+	err := conn.SetDeadline(time.Now().Add(timeout))
+	if opErr, ok := err.(*net.OpError); ok && opErr.Op == "set" && opErr.Net == "pipe" && build.Release == "testing" {
+		err = nil
+	}
+	return err
+}
+
+// rpcSendHeaders is the receiving end of the SendHeaders RPC. It reads the
+// block history of the caller, and sends the headers of every block in the
+// current path after the most recent block that the caller knows about.
+// Headers are sent in batches of up to MaxCatchUpHeaders, each followed by a
+// flag indicating whether more headers are available.
+func (cs *ConsensusSet) rpcSendHeaders(conn modules.PeerConn) error {
+	var knownBlocks [32]types.BlockID
+	err := encoding.ReadObject(conn, &knownBlocks, 32*crypto.HashSize)
+	if err != nil {
+		return err
+	}
+
+	var start, pruned types.BlockHeight
+	var found bool
+	cs.mu.RLock()
+	err = cs.db.View(func(tx *bolt.Tx) error {
+		start, found = findSyncStart(tx, knownBlocks)
+		pruned = prunedHeight(tx)
+		return nil
+	})
+	cs.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !found {
+		if err := encoding.WriteObject(conn, []types.BlockHeader{}); err != nil {
+			return err
+		}
+		return encoding.WriteObject(conn, false)
+	}
+	// As in SendBlocks, a pruned node advertises that it cannot send the
+	// headers by sending an empty batch and indicating that more are
+	// available.
+	if start < pruned {
+		if err := encoding.WriteObject(conn, []types.BlockHeader{}); err != nil {
+			return err
+		}
+		return encoding.WriteObject(conn, true)
+	}
+
+	moreAvailable := true
+	for moreAvailable {
+		var headers []types.BlockHeader
+		cs.mu.RLock()
+		err = cs.db.View(func(tx *bolt.Tx) error {
+			height := blockHeight(tx)
+			for i := start; i <= height && i < start+MaxCatchUpHeaders; i++ {
+				id, err := getPath(tx, i)
+				if build.DEBUG && err != nil {
+					panic(err)
+				}
+				pb, err := getBlockMap(tx, id)
+				if build.DEBUG && err != nil {
+					panic(err)
+				}
+				headers = append(headers, pb.Block.Header())
+			}
+			moreAvailable = start+MaxCatchUpHeaders <= height
+			start += MaxCatchUpHeaders
+			return nil
+		})
+		cs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, headers); err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, moreAvailable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateHeaders checks the proof of work, timestamps and checkpoints of
+// 'headers', which must form a chain on top of 'parent', a block in the
+// current path. The targets are adjusted along the chain in the same way as
+// for full blocks. The depth of the last header, which reflects the total work
+// of the chain, is returned.
+func (cs *ConsensusSet) validateHeaders(tx *bolt.Tx, parent *processedBlock, headers []types.BlockHeader) (types.Target, error) {
+	// timestamp returns the timestamp of the block at the given height of the
+	// chain formed by the current path up to 'parent', followed by 'headers'.
+	timestamp := func(height types.BlockHeight) types.Timestamp {
+		if height > parent.Height {
+			return headers[height-parent.Height-1].Timestamp
+		}
+		id, err := getPath(tx, height)
+		if build.DEBUG && err != nil {
+			panic(err)
+		}
+		pb, err := getBlockMap(tx, id)
+		if build.DEBUG && err != nil {
+			panic(err)
+		}
+		return pb.Block.Timestamp
+	}
+
+	depth, target := parent.Depth, parent.ChildTarget
+	for i, h := range headers {
+		height := parent.Height + types.BlockHeight(i) + 1
+		if !checkHeaderTarget(h, target) {
+			return types.Target{}, modules.ErrBlockUnsolved
+		}
+		if id, exists := cs.checkpoints[height]; exists && id != h.ID() {
+			return types.Target{}, errCheckpointMismatch
+		}
+
+		// The timestamp must not be earlier than the median of the previous
+		// MedianTimestampWindow timestamps, using the genesis timestamp for
+		// any missing times.
+		windowTimes := make(types.TimestampSlice, types.MedianTimestampWindow)
+		ancestor := height - 1
+		for j := range windowTimes {
+			windowTimes[j] = timestamp(ancestor)
+			if ancestor > 0 {
+				ancestor--
+			}
+		}
+		sort.Sort(windowTimes)
+		if h.Timestamp < windowTimes[len(windowTimes)/2] {
+			return types.Target{}, errEarlyTimestamp
+		}
+		if h.Timestamp > types.CurrentTimestamp()+types.ExtremeFutureThreshold {
+			return types.Target{}, errExtremeFutureTimestamp
+		}
+
+		// Compute the depth of the header and the target of its child.
+		depth = depth.AddDifficulties(target)
+		if height%(types.TargetWindow/2) == 0 {
+			windowSize := types.TargetWindow
+			if height < windowSize {
+				windowSize = height
+			}
+			timePassed := h.Timestamp - timestamp(height-windowSize)
+			expectedTimePassed := types.BlockFrequency * windowSize
+			adjustment := clampTargetAdjustment(big.NewRat(int64(timePassed), int64(expectedTimePassed)))
+			target = types.RatToTarget(new(big.Rat).Mul(target.Rat(), adjustment))
+		}
+	}
+	return depth, nil
+}
+
+// isBadHeaderErr returns true if the error indicates that a peer sent headers
+// that no honest peer would send.
+func isBadHeaderErr(err error) bool {
+	switch err {
+	case errBadHeaderChain, modules.ErrBlockUnsolved, errEarlyTimestamp, errExtremeFutureTimestamp:
+		return true
+	}
+	return false
+}
+
+// managedReceiveHeaders returns an RPCFunc for the calling end of the
+// SendHeaders RPC. The received headers are checked to form a valid chain
+// starting from a block in the current path, and are stored in 'headers'. The
+// height of the parent of the first header is stored in 'base', and the depth
+// of the last header is stored in 'depth'.
+func (cs *ConsensusSet) managedReceiveHeaders(headers *[]types.BlockHeader, base *types.BlockHeight, depth *types.Target) modules.RPCFunc {
+	return func(conn modules.PeerConn) error {
+		if err := setSyncDeadline(conn, sendBlocksTimeout); err != nil {
+			return err
+		}
+
+		var history [32]types.BlockID
+		cs.mu.RLock()
+		err := cs.db.View(func(tx *bolt.Tx) error {
+			history = blockHistory(tx)
+			return nil
+		})
+		cs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, history); err != nil {
+			return err
+		}
+
+		var received []types.BlockHeader
+		moreAvailable := true
+		for i := 0; moreAvailable && i < maxHeaderBatches; i++ {
+			var batch []types.BlockHeader
+			if err := encoding.ReadObject(conn, &batch, uint64(MaxCatchUpHeaders)*types.BlockHeaderSize+8); err != nil {
+				return err
+			}
+			if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
+				return err
+			}
+			if len(batch) == 0 && moreAvailable {
+				return errPeerPruned
+			}
+			for _, h := range batch {
+				if len(received) > 0 && h.ParentID != received[len(received)-1].ID() {
+					return errBadHeaderChain
+				}
+				received = append(received, h)
+			}
+		}
+		if len(received) == 0 {
+			*headers = nil
+			return nil
+		}
+
+		// The first header must build on a block in the current path.
+		cs.mu.RLock()
+		err = cs.db.View(func(tx *bolt.Tx) error {
+			pb, err := getBlockMap(tx, received[0].ParentID)
+			if err != nil {
+				return errOrphanHeaderChain
+			}
+			pathID, err := getPath(tx, pb.Height)
+			if err != nil || pathID != received[0].ParentID {
+				return errOrphanHeaderChain
+			}
+			*depth, err = cs.validateHeaders(tx, pb, received)
+			if err != nil {
+				return err
+			}
+			*base = pb.Height
+			return nil
+		})
+		cs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		*headers = received
+		return nil
+	}
+}
+
+// rpcSendWindow is the receiving end of the SendWindow RPC. It reads a list of
+// up to MaxCatchUpBlocks block ids, and sends the corresponding blocks. Blocks
+// are sent in order up to the first block that is not known or is pruned.
+func (cs *ConsensusSet) rpcSendWindow(conn modules.PeerConn) error {
+	var ids []types.BlockID
+	err := encoding.ReadObject(conn, &ids, uint64(MaxCatchUpBlocks)*crypto.HashSize+8)
+	if err != nil {
+		return err
+	}
+	if types.BlockHeight(len(ids)) > MaxCatchUpBlocks {
+		return errWindowTooLarge
+	}
+
+	var blocks []types.Block
+	cs.mu.RLock()
+	err = cs.db.View(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			pb, err := getBlockMap(tx, id)
+			if err != nil || blockPruned(tx, id, pb.Height) {
+				break
+			}
+			blocks = append(blocks, pb.Block)
+		}
+		return nil
+	})
+	cs.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, blocks)
+}
+
+// receiveWindow returns an RPCFunc for the calling end of the SendWindow RPC.
+// The received blocks are stored in 'blocks', and must match the requested ids
+// exactly.
+func receiveWindow(ids []types.BlockID, blocks *[]types.Block) modules.RPCFunc {
+	return func(conn modules.PeerConn) error {
+		if err := setSyncDeadline(conn, windowTimeout); err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, ids); err != nil {
+			return err
+		}
+		var received []types.Block
+		if err := encoding.ReadObject(conn, &received, uint64(MaxCatchUpBlocks)*types.BlockSizeLimit); err != nil {
+			return err
+		}
+		if len(received) != len(ids) {
+			return errWindowIncomplete
+		}
+		for i := range received {
+			if received[i].ID() != ids[i] {
+				return errWindowIncomplete
+			}
+		}
+		*blocks = received
+		return nil
+	}
+}
+
+// managedBestHeaders downloads headers from each of the peers, and returns the
+// heaviest header chain along with the height of the block that it builds on.
+// Only chains that are heavier than the current path are returned. Peers that
+// have pruned the blocks are removed from the returned list of peers, and
+// peers that send invalid headers are penalized. The height of the best known
+// header is updated, and the headers that lead to a checkpoint are marked as
+// trusted.
+func (cs *ConsensusSet) managedBestHeaders(peers []modules.NetAddress) (best []types.BlockHeader, bestBase types.BlockHeight, unpruned []modules.NetAddress) {
+	var bestDepth types.Target
+	cs.mu.RLock()
+	err := cs.db.View(func(tx *bolt.Tx) error {
+		bestDepth = currentProcessedBlock(tx).Depth
+		return nil
+	})
+	cs.mu.RUnlock()
+	if err != nil {
+		cs.log.Println("WARN: failed to read the current block:", err)
+		return nil, 0, peers
+	}
+
+	for _, addr := range peers {
+		var headers []types.BlockHeader
+		var base types.BlockHeight
+		var depth types.Target
+		err := cs.gateway.RPC(addr, "SendHeaders", cs.managedReceiveHeaders(&headers, &base, &depth))
+		if err == errPeerPruned {
+			continue
+		}
+		unpruned = append(unpruned, addr)
+		if err != nil {
+			cs.log.Debugf("WARN: failed to download headers from %v: %v", addr, err)
+			if isBadHeaderErr(err) {
+				cs.gateway.Penalize(addr, "sent invalid headers: "+err.Error())
+			}
+			continue
+		}
+		// A smaller depth indicates a heavier chain.
+		if len(headers) > 0 && depth.Cmp(bestDepth) < 0 {
+			best, bestBase, bestDepth = headers, base, depth
+		}
+	}
+
+	if len(best) > 0 {
+		cs.mu.Lock()
+		if height := bestBase + types.BlockHeight(len(best)); height > cs.headerHeight {
+			cs.headerHeight = height
+		}
+		cs.addCheckpointAncestors(best, bestBase)
+		cs.mu.Unlock()
+	}
+	return best, bestBase, unpruned
+}
+
+// threadedDownloadWindows downloads the windows that are sent on 'work' from a
+// single peer, and sends the results on 'results'. The peer is dropped after
+// the first window that it fails to deliver, so that the window is reassigned
+// to a faster peer.
+func (cs *ConsensusSet) threadedDownloadWindows(addr modules.NetAddress, windows [][]types.BlockID, work <-chan int, results chan<- windowResult, stop <-chan struct{}) {
+	for {
+		var index int
+		select {
+		case index = <-work:
+		case <-stop:
+			return
+		}
+		var blocks []types.Block
+		err := cs.gateway.RPC(addr, "SendWindow", receiveWindow(windows[index], &blocks))
+		select {
+		case results <- windowResult{index: index, peer: addr, blocks: blocks, err: err}:
+		case <-stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// managedParallelDownload performs a headers-first download from the given
+// peers. The blocks of the heaviest header chain are downloaded in windows of
+// MaxCatchUpBlocks from up to maxParallelPeers peers at once, and are applied
+// in order.
+func (cs *ConsensusSet) managedParallelDownload(peers []modules.NetAddress) error {
+	headers, _, peers := cs.managedBestHeaders(peers)
+	if len(headers) == 0 {
+		return nil
+	}
+	var windows [][]types.BlockID
+	for i := 0; i < len(headers); i += int(MaxCatchUpBlocks) {
+		var window []types.BlockID
+		for j := i; j < len(headers) && j < i+int(MaxCatchUpBlocks); j++ {
+			window = append(window, headers[j].ID())
+		}
+		windows = append(windows, window)
+	}
+
+	// Start a downloader for each peer. Each window is in the work queue at
+	// most once, so sending on the queue never blocks.
+	if len(peers) > maxParallelPeers {
+		peers = peers[:maxParallelPeers]
+	}
+	work := make(chan int, len(windows))
+	results := make(chan windowResult)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, addr := range peers {
+		go cs.threadedDownloadWindows(addr, windows, work, results, stop)
+	}
+	downloaders := len(peers)
+
+	// Queue the first windows, and then queue another window each time a
+	// window is applied.
+	queued := 0
+	for ; queued < len(windows) && queued < maxWindowsAhead; queued++ {
+		work <- queued
+	}
+	downloaded := make(map[int]windowResult)
+	next := 0
+	for next < len(windows) {
+		if downloaders == 0 {
+			return errDownloadStalled
+		}
+		res := <-results
+		if res.err != nil {
+			cs.log.Debugf("WARN: failed to download blocks from %v, reassigning: %v", res.peer, res.err)
+			downloaders--
+			work <- res.index
+			continue
+		}
+		downloaded[res.index] = res
+
+		// Apply every window that is ready, in order.
+		for {
+			res, exists := downloaded[next]
+			if !exists {
+				break
+			}
+			for _, block := range res.blocks {
+				err := cs.managedAcceptBlock(block)
+				if err == modules.ErrNonExtendingBlock || err == modules.ErrBlockKnown {
+					err = nil
+				}
+				if err != nil {
+					if !isBenignBlockErr(err) {
+						cs.gateway.Penalize(res.peer, "sent invalid block: "+err.Error())
+					}
+					return err
+				}
+			}
+			delete(downloaded, next)
+			next++
+			if queued < len(windows) {
+				work <- queued
+				queued++
+			}
+		}
+	}
+	return nil
+}
+
+// HeaderHeight returns the height of the best header known to the consensus
+// set. It is never lower than the height of the consensus set.
+func (cs *ConsensusSet) HeaderHeight() types.BlockHeight {
+	height := cs.Height()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cs.headerHeight > height {
+		return cs.headerHeight
+	}
+	return height
+}
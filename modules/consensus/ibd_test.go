@@ -0,0 +1,165 @@
+package consensus
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReceiveHeadersBadChain checks that the calling end of the SendHeaders
+// RPC rejects headers that do not form a chain.
+func TestReceiveHeadersBadChain(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := blankConsensusSetTester("TestReceiveHeadersBadChain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	go func() {
+		var history [32]types.BlockID
+		encoding.ReadObject(p2, &history, 32*crypto.HashSize)
+		encoding.WriteObject(p2, []types.BlockHeader{
+			{ParentID: types.GenesisBlock.ID()},
+			{ParentID: types.BlockID{1}},
+		})
+		encoding.WriteObject(p2, false)
+	}()
+	var headers []types.BlockHeader
+	var base types.BlockHeight
+	var depth types.Target
+	err = cst.cs.managedReceiveHeaders(&headers, &base, &depth)(p1)
+	if err != errBadHeaderChain {
+		t.Fatal("expected errBadHeaderChain, got", err)
+	}
+}
+
+// TestReceiveHeadersUnsolved checks that the calling end of the SendHeaders
+// RPC rejects headers that do not meet the target of their parent, and
+// headers with a timestamp that is too early.
+func TestReceiveHeadersUnsolved(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := blankConsensusSetTester("TestReceiveHeadersUnsolved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Find a nonce that does not solve the header, and a nonce that does.
+	unsolved := types.BlockHeader{ParentID: types.GenesisBlock.ID(), Timestamp: types.GenesisTimestamp + 1}
+	for checkHeaderTarget(unsolved, types.RootTarget) {
+		unsolved.Nonce[0]++
+	}
+	early := types.BlockHeader{ParentID: types.GenesisBlock.ID(), Timestamp: types.GenesisTimestamp - 1}
+	for !checkHeaderTarget(early, types.RootTarget) {
+		early.Nonce[0]++
+	}
+
+	tests := []struct {
+		header  types.BlockHeader
+		errWant error
+	}{
+		{unsolved, modules.ErrBlockUnsolved},
+		{early, errEarlyTimestamp},
+	}
+	for _, test := range tests {
+		p1, p2 := net.Pipe()
+		go func(h types.BlockHeader) {
+			var history [32]types.BlockID
+			encoding.ReadObject(p2, &history, 32*crypto.HashSize)
+			encoding.WriteObject(p2, []types.BlockHeader{h})
+			encoding.WriteObject(p2, false)
+		}(test.header)
+		var headers []types.BlockHeader
+		var base types.BlockHeight
+		var depth types.Target
+		err = cst.cs.managedReceiveHeaders(&headers, &base, &depth)(p1)
+		p1.Close()
+		p2.Close()
+		if err != test.errWant {
+			t.Fatalf("expected %v, got %v", test.errWant, err)
+		}
+		if !isBadHeaderErr(err) {
+			t.Fatal("peer would not be penalized for", err)
+		}
+	}
+}
+
+// TestIntegrationParallelDownload checks that a consensus set can download
+// the blockchain in parallel from several peers, even if one of the peers is
+// unreachable.
+func TestIntegrationParallelDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// Create two remote peers with the same blockchain.
+	remote1, err := createConsensusSetTester("TestIntegrationParallelDownload - remote 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote1.Close()
+	remote2, err := blankConsensusSetTester("TestIntegrationParallelDownload - remote 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote2.Close()
+	for h := types.BlockHeight(1); h <= remote1.cs.Height(); h++ {
+		b, _ := remote1.cs.BlockAtHeight(h)
+		if err := remote2.cs.managedAcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create the local peer. The gateway is connected before the consensus
+	// set is created so that SendBlocks is not triggered on connect.
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationParallelDownload - local")
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	peers := []modules.NetAddress{remote1.gateway.Address(), remote2.gateway.Address()}
+	for _, addr := range peers {
+		if err := g.Connect(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cs, err := New(g, filepath.Join(testdir, modules.ConsensusDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	// Download from the remote peers and from a peer that is not connected.
+	// The windows assigned to the unconnected peer must be reassigned.
+	peers = append(peers, "127.0.0.1:1")
+	if err := cs.managedParallelDownload(peers); err != nil {
+		t.Fatal(err)
+	}
+	if cs.CurrentBlock().ID() != remote1.cs.CurrentBlock().ID() {
+		t.Fatal("consensus set did not download the blockchain")
+	}
+	if cs.HeaderHeight() != remote1.cs.Height() {
+		t.Fatal("wrong header height:", cs.HeaderHeight(), remote1.cs.Height())
+	}
+
+	// A second download should have nothing to do.
+	if err := cs.managedParallelDownload(peers); err != nil {
+		t.Fatal(err)
+	}
+}
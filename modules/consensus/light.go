@@ -0,0 +1,659 @@
+package consensus
+
+// light.go contains the LightConsensusSet, which follows the heaviest chain
+// by downloading only block headers. The proof of work, timestamps and target
+// adjustments of the headers are checked, but transactions are not validated.
+// The full block is only downloaded when it involves one of the addresses
+// watched by the filtered subscribers, such as the wallet, and only the
+// outputs sent to those addresses are tracked.
+//
+// A light consensus set trusts its peers not to omit blocks that match the
+// filter. It does not track file contracts, siafund claims or the siafund
+// pool, and it is not persisted, so the headers are downloaded again every
+// time it is started. Addresses that a subscriber starts watching after it has
+// subscribed are not watched until the light consensus set is restarted.
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/demotemutex"
+)
+
+const (
+	// lightLogFile is the name of the log file of a light consensus set.
+	lightLogFile = "light.log"
+)
+
+var (
+	errLightUnsupported = errors.New("not supported by a light consensus set")
+)
+
+// lightBlock is a block in the current path of a LightConsensusSet.
+type lightBlock struct {
+	id          types.BlockID
+	header      types.BlockHeader
+	height      types.BlockHeight
+	depth       types.Target
+	childTarget types.Target
+
+	// block is the full block if full is true. Otherwise, only the fields of
+	// the header are set, and the id of the block is not the id of the
+	// header.
+	block types.Block
+	full  bool
+
+	// The diffs of the tracked outputs that were caused by applying the
+	// block.
+	siacoinOutputDiffs        []modules.SiacoinOutputDiff
+	siafundOutputDiffs        []modules.SiafundOutputDiff
+	delayedSiacoinOutputDiffs []modules.DelayedSiacoinOutputDiff
+}
+
+// heavierThan returns true if the block is sufficiently heavier than 'cmp'
+// for a reorg to be performed, using the same threshold as the full
+// consensus set.
+func (lb *lightBlock) heavierThan(cmp *lightBlock) bool {
+	requirement := cmp.depth.AddDifficulties(cmp.childTarget.MulDifficulty(SurpassThreshold))
+	return requirement.Cmp(lb.depth) > 0 // Inversed, because the smaller target is actually heavier.
+}
+
+// The LightConsensusSet is a ConsensusSet that only downloads the headers of
+// the heaviest chain, and the blocks that involve the addresses watched by
+// its filtered subscribers.
+type LightConsensusSet struct {
+	gateway modules.Gateway
+
+	// path is the current path, starting with the genesis block. pathIDs
+	// maps the ids of the blocks in the path to their heights.
+	path    []*lightBlock
+	pathIDs map[types.BlockID]types.BlockHeight
+
+	// filter contains the addresses watched by the filtered subscribers, and
+	// watched holds the addresses of each filtered subscriber, so that the
+	// addresses of a subscriber can be removed when it unsubscribes.
+	// filterVersion is incremented whenever addresses are added to the
+	// filter, so that blocks that were selected with an outdated filter are
+	// discarded. Blocks selected before addresses were removed are a superset
+	// of the blocks matching the new filter, and remain valid.
+	filter        addressFilter
+	filterVersion int
+	watched       map[modules.ConsensusSetSubscriber][]types.UnlockHash
+
+	// The outputs sent to an address in the filter that have not been spent.
+	siacoinOutputs        map[types.SiacoinOutputID]types.SiacoinOutput
+	siafundOutputs        map[types.SiafundOutputID]types.SiafundOutput
+	delayedSiacoinOutputs map[types.BlockHeight]map[types.SiacoinOutputID]types.SiacoinOutput
+
+	checkpoints map[types.BlockHeight]types.BlockID
+	subscribers []modules.ConsensusSetSubscriber
+	synced      bool
+
+	log *persist.Logger
+	mu  demotemutex.DemoteMutex
+}
+
+// NewLight returns a new LightConsensusSet, containing only the genesis
+// block. The headers of the heaviest chain are downloaded from the peers of
+// the gateway in the background.
+func NewLight(gateway modules.Gateway, persistDir string) (*LightConsensusSet, error) {
+	if gateway == nil {
+		return nil, errNilGateway
+	}
+	checkpoints, err := mergeCheckpoints(nil)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(persistDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	log, err := persist.NewFileLogger(filepath.Join(persistDir, lightLogFile))
+	if err != nil {
+		return nil, err
+	}
+
+	lcs := &LightConsensusSet{
+		gateway: gateway,
+
+		filter:      make(addressFilter),
+		watched:     make(map[modules.ConsensusSetSubscriber][]types.UnlockHash),
+		checkpoints: checkpoints,
+
+		log: log,
+	}
+	lcs.resetPath()
+
+	gateway.RegisterRPC("RelayHeader", lcs.rpcRelayHeader)
+	gateway.RegisterConnectCall("SendFilteredHeaders", lcs.threadedReceiveFilteredHeaders)
+	go lcs.threadedSync()
+	return lcs, nil
+}
+
+// resetPath resets the current path to the genesis block, recomputing the
+// tracked outputs of the genesis block with the current filter.
+func (lcs *LightConsensusSet) resetPath() {
+	lcs.siacoinOutputs = make(map[types.SiacoinOutputID]types.SiacoinOutput)
+	lcs.siafundOutputs = make(map[types.SiafundOutputID]types.SiafundOutput)
+	lcs.delayedSiacoinOutputs = make(map[types.BlockHeight]map[types.SiacoinOutputID]types.SiacoinOutput)
+
+	genesis := &lightBlock{
+		id:          types.GenesisBlock.ID(),
+		header:      types.GenesisBlock.Header(),
+		depth:       types.RootDepth,
+		childTarget: types.RootTarget,
+		block:       types.GenesisBlock,
+		full:        true,
+	}
+	lcs.applyBlock(genesis)
+	lcs.path = []*lightBlock{genesis}
+	lcs.pathIDs = map[types.BlockID]types.BlockHeight{genesis.id: 0}
+}
+
+// height returns the height of the current path.
+func (lcs *LightConsensusSet) height() types.BlockHeight {
+	return types.BlockHeight(len(lcs.path) - 1)
+}
+
+// commitSiacoinOutputDiff applies a siacoin output diff to the tracked
+// outputs.
+func (lcs *LightConsensusSet) commitSiacoinOutputDiff(scod modules.SiacoinOutputDiff) {
+	if scod.Direction == modules.DiffApply {
+		lcs.siacoinOutputs[scod.ID] = scod.SiacoinOutput
+	} else {
+		delete(lcs.siacoinOutputs, scod.ID)
+	}
+}
+
+// commitSiafundOutputDiff applies a siafund output diff to the tracked
+// outputs.
+func (lcs *LightConsensusSet) commitSiafundOutputDiff(sfod modules.SiafundOutputDiff) {
+	if sfod.Direction == modules.DiffApply {
+		lcs.siafundOutputs[sfod.ID] = sfod.SiafundOutput
+	} else {
+		delete(lcs.siafundOutputs, sfod.ID)
+	}
+}
+
+// commitDelayedSiacoinOutputDiff applies a delayed siacoin output diff to the
+// tracked outputs.
+func (lcs *LightConsensusSet) commitDelayedSiacoinOutputDiff(dscod modules.DelayedSiacoinOutputDiff) {
+	outputs := lcs.delayedSiacoinOutputs[dscod.MaturityHeight]
+	if dscod.Direction == modules.DiffApply {
+		if outputs == nil {
+			outputs = make(map[types.SiacoinOutputID]types.SiacoinOutput)
+			lcs.delayedSiacoinOutputs[dscod.MaturityHeight] = outputs
+		}
+		outputs[dscod.ID] = dscod.SiacoinOutput
+	} else {
+		delete(outputs, dscod.ID)
+		if len(outputs) == 0 {
+			delete(lcs.delayedSiacoinOutputs, dscod.MaturityHeight)
+		}
+	}
+}
+
+// applyBlock computes the diffs of the tracked outputs that are caused by
+// applying the block, stores them in the block, and commits them.
+func (lcs *LightConsensusSet) applyBlock(lb *lightBlock) {
+	addSiacoinOutputDiff := func(scod modules.SiacoinOutputDiff) {
+		lb.siacoinOutputDiffs = append(lb.siacoinOutputDiffs, scod)
+		lcs.commitSiacoinOutputDiff(scod)
+	}
+	addSiafundOutputDiff := func(sfod modules.SiafundOutputDiff) {
+		lb.siafundOutputDiffs = append(lb.siafundOutputDiffs, sfod)
+		lcs.commitSiafundOutputDiff(sfod)
+	}
+	addDelayedSiacoinOutputDiff := func(dscod modules.DelayedSiacoinOutputDiff) {
+		lb.delayedSiacoinOutputDiffs = append(lb.delayedSiacoinOutputDiffs, dscod)
+		lcs.commitDelayedSiacoinOutputDiff(dscod)
+	}
+
+	// A block that only contains the fields of its header has no
+	// transactions or miner payouts, but delayed outputs can still mature.
+	for _, txn := range lb.block.Transactions {
+		for _, sci := range txn.SiacoinInputs {
+			if sco, exists := lcs.siacoinOutputs[sci.ParentID]; exists {
+				addSiacoinOutputDiff(modules.SiacoinOutputDiff{
+					Direction:     modules.DiffRevert,
+					ID:            sci.ParentID,
+					SiacoinOutput: sco,
+				})
+			}
+		}
+		for i, sco := range txn.SiacoinOutputs {
+			if lcs.filter.contains(sco.UnlockHash) {
+				addSiacoinOutputDiff(modules.SiacoinOutputDiff{
+					Direction:     modules.DiffApply,
+					ID:            txn.SiacoinOutputID(uint64(i)),
+					SiacoinOutput: sco,
+				})
+			}
+		}
+		for _, sfi := range txn.SiafundInputs {
+			if sfo, exists := lcs.siafundOutputs[sfi.ParentID]; exists {
+				addSiafundOutputDiff(modules.SiafundOutputDiff{
+					Direction:     modules.DiffRevert,
+					ID:            sfi.ParentID,
+					SiafundOutput: sfo,
+				})
+			}
+		}
+		for i, sfo := range txn.SiafundOutputs {
+			if lcs.filter.contains(sfo.UnlockHash) {
+				addSiafundOutputDiff(modules.SiafundOutputDiff{
+					Direction:     modules.DiffApply,
+					ID:            txn.SiafundOutputID(uint64(i)),
+					SiafundOutput: sfo,
+				})
+			}
+		}
+	}
+
+	// Delayed outputs that mature at this height become spendable.
+	for id, sco := range lcs.delayedSiacoinOutputs[lb.height] {
+		addDelayedSiacoinOutputDiff(modules.DelayedSiacoinOutputDiff{
+			Direction:      modules.DiffRevert,
+			ID:             id,
+			SiacoinOutput:  sco,
+			MaturityHeight: lb.height,
+		})
+		addSiacoinOutputDiff(modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            id,
+			SiacoinOutput: sco,
+		})
+	}
+
+	for i, mp := range lb.block.MinerPayouts {
+		if lcs.filter.contains(mp.UnlockHash) {
+			addDelayedSiacoinOutputDiff(modules.DelayedSiacoinOutputDiff{
+				Direction:      modules.DiffApply,
+				ID:             lb.block.MinerPayoutID(uint64(i)),
+				SiacoinOutput:  mp,
+				MaturityHeight: lb.height + types.MaturityDelay,
+			})
+		}
+	}
+}
+
+// revertBlock reverts the diffs of a block in the reverse order that they were
+// applied.
+func (lcs *LightConsensusSet) revertBlock(lb *lightBlock) {
+	for i := len(lb.delayedSiacoinOutputDiffs) - 1; i >= 0; i-- {
+		dscod := lb.delayedSiacoinOutputDiffs[i]
+		dscod.Direction = !dscod.Direction
+		lcs.commitDelayedSiacoinOutputDiff(dscod)
+	}
+	for i := len(lb.siafundOutputDiffs) - 1; i >= 0; i-- {
+		sfod := lb.siafundOutputDiffs[i]
+		sfod.Direction = !sfod.Direction
+		lcs.commitSiafundOutputDiff(sfod)
+	}
+	for i := len(lb.siacoinOutputDiffs) - 1; i >= 0; i-- {
+		scod := lb.siacoinOutputDiffs[i]
+		scod.Direction = !scod.Direction
+		lcs.commitSiacoinOutputDiff(scod)
+	}
+}
+
+// revertToHeight reverts the blocks of the current path above the given
+// height, and returns them in the order that they were reverted.
+func (lcs *LightConsensusSet) revertToHeight(height types.BlockHeight) (reverted []*lightBlock) {
+	for lcs.height() > height {
+		lb := lcs.path[len(lcs.path)-1]
+		lcs.revertBlock(lb)
+		delete(lcs.pathIDs, lb.id)
+		lcs.path = lcs.path[:len(lcs.path)-1]
+		reverted = append(reverted, lb)
+	}
+	return reverted
+}
+
+// lightConsensusChange returns the consensus change that reverts and applies
+// the given blocks.
+func lightConsensusChange(reverted, applied []*lightBlock) modules.ConsensusChange {
+	var ce changeEntry
+	var cc modules.ConsensusChange
+	for _, lb := range reverted {
+		ce.RevertedBlocks = append(ce.RevertedBlocks, lb.id)
+		cc.RevertedBlocks = append(cc.RevertedBlocks, lb.block)
+		for i := len(lb.siacoinOutputDiffs) - 1; i >= 0; i-- {
+			scod := lb.siacoinOutputDiffs[i]
+			scod.Direction = !scod.Direction
+			cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, scod)
+		}
+		for i := len(lb.siafundOutputDiffs) - 1; i >= 0; i-- {
+			sfod := lb.siafundOutputDiffs[i]
+			sfod.Direction = !sfod.Direction
+			cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, sfod)
+		}
+		for i := len(lb.delayedSiacoinOutputDiffs) - 1; i >= 0; i-- {
+			dscod := lb.delayedSiacoinOutputDiffs[i]
+			dscod.Direction = !dscod.Direction
+			cc.DelayedSiacoinOutputDiffs = append(cc.DelayedSiacoinOutputDiffs, dscod)
+		}
+	}
+	for _, lb := range applied {
+		ce.AppliedBlocks = append(ce.AppliedBlocks, lb.id)
+		cc.AppliedBlocks = append(cc.AppliedBlocks, lb.block)
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, lb.siacoinOutputDiffs...)
+		cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, lb.siafundOutputDiffs...)
+		cc.DelayedSiacoinOutputDiffs = append(cc.DelayedSiacoinOutputDiffs, lb.delayedSiacoinOutputDiffs...)
+	}
+	cc.ID = ce.ID()
+	return cc
+}
+
+// ConsensusSetSubscribe adds a subscriber to the list of subscribers. The
+// changes of a light consensus set are not persisted, so the subscriber must
+// start from the beginning or from the most recent change.
+//
+// If the subscriber is a FilteredConsensusSetSubscriber that watches new
+// addresses, the current path is reverted to the genesis block and downloaded
+// again with the new filter. The existing subscribers are sent a change that
+// only reverts blocks.
+func (lcs *LightConsensusSet) ConsensusSetSubscribe(subscriber modules.ConsensusSetSubscriber, start modules.ConsensusChangeID) error {
+	if start != modules.ConsensusChangeBeginning && start != modules.ConsensusChangeRecent {
+		return modules.ErrInvalidConsensusChangeID
+	}
+	var watched []types.UnlockHash
+	if fs, ok := subscriber.(modules.FilteredConsensusSetSubscriber); ok {
+		watched = fs.WatchedAddresses()
+	}
+
+	lcs.mu.Lock()
+	var added []types.UnlockHash
+	for _, addr := range watched {
+		if !lcs.filter.contains(addr) {
+			added = append(added, addr)
+		}
+	}
+	if len(lcs.filter)+len(added) > MaxFilterAddresses {
+		lcs.mu.Unlock()
+		return errFilterTooLarge
+	}
+	var reverted []*lightBlock
+	if len(added) > 0 {
+		for _, addr := range added {
+			lcs.filter[addr] = struct{}{}
+		}
+		lcs.filterVersion++
+		reverted = lcs.revertToHeight(0)
+		lcs.resetPath()
+		lcs.synced = false
+	}
+	if len(watched) > 0 {
+		lcs.watched[subscriber] = watched
+	}
+	existing := lcs.subscribers
+	lcs.subscribers = append(lcs.subscribers, subscriber)
+	lcs.mu.Demote()
+
+	if len(reverted) > 0 {
+		cc := lightConsensusChange(reverted, nil)
+		for _, s := range existing {
+			s.ProcessConsensusChange(cc)
+		}
+	}
+	if start == modules.ConsensusChangeBeginning {
+		for _, lb := range lcs.path {
+			subscriber.ProcessConsensusChange(lightConsensusChange(nil, []*lightBlock{lb}))
+		}
+	}
+	lcs.mu.DemotedUnlock()
+
+	if len(added) > 0 {
+		go lcs.threadedSync()
+	}
+	return nil
+}
+
+// Unsubscribe removes a subscriber from the list of subscribers. The
+// addresses that are no longer watched by any of the remaining subscribers are
+// removed from the filter, together with their tracked outputs. Removing
+// addresses does not require the path to be downloaded again.
+func (lcs *LightConsensusSet) Unsubscribe(subscriber modules.ConsensusSetSubscriber) {
+	lcs.mu.Lock()
+	defer lcs.mu.Unlock()
+	for i := range lcs.subscribers {
+		if lcs.subscribers[i] == subscriber {
+			lcs.subscribers = append(lcs.subscribers[0:i], lcs.subscribers[i+1:]...)
+			break
+		}
+	}
+	if _, exists := lcs.watched[subscriber]; !exists {
+		return
+	}
+	delete(lcs.watched, subscriber)
+	lcs.rebuildFilter()
+}
+
+// rebuildFilter recomputes the filter from the addresses of the filtered
+// subscribers, and stops tracking the outputs of the addresses that were
+// removed.
+func (lcs *LightConsensusSet) rebuildFilter() {
+	var addrs []types.UnlockHash
+	for _, watched := range lcs.watched {
+		addrs = append(addrs, watched...)
+	}
+	filter := newAddressFilter(addrs)
+	if len(filter) == len(lcs.filter) {
+		return
+	}
+	lcs.filter = filter
+	for id, sco := range lcs.siacoinOutputs {
+		if !filter.contains(sco.UnlockHash) {
+			delete(lcs.siacoinOutputs, id)
+		}
+	}
+	for id, sfo := range lcs.siafundOutputs {
+		if !filter.contains(sfo.UnlockHash) {
+			delete(lcs.siafundOutputs, id)
+		}
+	}
+	for _, dscos := range lcs.delayedSiacoinOutputs {
+		for id, dsco := range dscos {
+			if !filter.contains(dsco.UnlockHash) {
+				delete(dscos, id)
+			}
+		}
+	}
+}
+
+// AcceptBlock returns an error, as a light consensus set cannot validate
+// blocks.
+func (lcs *LightConsensusSet) AcceptBlock(types.Block) error {
+	return errLightUnsupported
+}
+
+// Block returns the block with the given id if it is in the current path and
+// was downloaded in full.
+func (lcs *LightConsensusSet) Block(id types.BlockID) (types.Block, types.BlockHeight, bool) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	height, exists := lcs.pathIDs[id]
+	if !exists || !lcs.path[height].full {
+		return types.Block{}, 0, false
+	}
+	return lcs.path[height].block, height, true
+}
+
+// BlockAtHeight returns the block at the given height in the current path if
+// it was downloaded in full.
+func (lcs *LightConsensusSet) BlockAtHeight(height types.BlockHeight) (types.Block, bool) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	if height > lcs.height() || !lcs.path[height].full {
+		return types.Block{}, false
+	}
+	return lcs.path[height].block, true
+}
+
+// ChildTarget returns the target of the children of the block with the given
+// id, if the block is in the current path.
+func (lcs *LightConsensusSet) ChildTarget(id types.BlockID) (types.Target, bool) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	height, exists := lcs.pathIDs[id]
+	if !exists {
+		return types.Target{}, false
+	}
+	return lcs.path[height].childTarget, true
+}
+
+// Close closes the log of the light consensus set.
+func (lcs *LightConsensusSet) Close() error {
+	lcs.mu.Lock()
+	defer lcs.mu.Unlock()
+	return lcs.log.Close()
+}
+
+// CurrentBlock returns the latest block in the current path. Unless it was
+// downloaded in full, only the fields of its header are set.
+func (lcs *LightConsensusSet) CurrentBlock() types.Block {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	return lcs.path[len(lcs.path)-1].block
+}
+
+// ExportSnapshot returns an error, as a light consensus set does not have a
+// consensus database.
+func (lcs *LightConsensusSet) ExportSnapshot(types.BlockHeight, string) (modules.ConsensusSnapshot, error) {
+	return modules.ConsensusSnapshot{}, errLightUnsupported
+}
+
+// FileContract always returns false, as file contracts are not tracked.
+func (lcs *LightConsensusSet) FileContract(types.FileContractID) (types.FileContract, bool) {
+	return types.FileContract{}, false
+}
+
+// Forks returns nil, as forks are not recorded.
+func (lcs *LightConsensusSet) Forks() []modules.ConsensusFork {
+	return nil
+}
+
+// HeaderHeight returns the height of the current path, which is made of
+// headers.
+func (lcs *LightConsensusSet) HeaderHeight() types.BlockHeight {
+	return lcs.Height()
+}
+
+// Height returns the height of the current path.
+func (lcs *LightConsensusSet) Height() types.BlockHeight {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	return lcs.height()
+}
+
+// Inconsistent always returns false, as there is no database.
+func (lcs *LightConsensusSet) Inconsistent() bool {
+	return false
+}
+
+// InCurrentPath returns true if the block with the given id is in the current
+// path.
+func (lcs *LightConsensusSet) InCurrentPath(id types.BlockID) bool {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	_, exists := lcs.pathIDs[id]
+	return exists
+}
+
+// MinimumValidChildTimestamp returns the earliest timestamp that a child of
+// the block with the given id can have, if the block is in the current path.
+func (lcs *LightConsensusSet) MinimumValidChildTimestamp(id types.BlockID) (types.Timestamp, bool) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	height, exists := lcs.pathIDs[id]
+	if !exists {
+		return 0, false
+	}
+	return lcs.minimumValidChildTimestamp(lcs.path[height], nil), true
+}
+
+// SiacoinOutput returns the siacoin output with the given id, if it was sent
+// to an address in the filter and has not been spent.
+func (lcs *LightConsensusSet) SiacoinOutput(id types.SiacoinOutputID) (types.SiacoinOutput, bool) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	sco, exists := lcs.siacoinOutputs[id]
+	return sco, exists
+}
+
+// SiafundPool returns zero, as the siafund pool is not tracked.
+func (lcs *LightConsensusSet) SiafundPool() types.Currency {
+	return types.ZeroCurrency
+}
+
+// StaleBlocks returns nil, as stale blocks are not recorded.
+func (lcs *LightConsensusSet) StaleBlocks() []modules.StaleBlock {
+	return nil
+}
+
+// StorageProofSegment returns an error, as file contracts are not tracked.
+func (lcs *LightConsensusSet) StorageProofSegment(types.FileContractID) (uint64, error) {
+	return 0, errLightUnsupported
+}
+
+// Synced returns true if the light consensus set has downloaded the headers
+// of at least one peer.
+func (lcs *LightConsensusSet) Synced() bool {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	return lcs.synced
+}
+
+// TryTransactionSet checks that each transaction is valid on its own, and
+// returns the output diffs that the transactions would cause. The inputs
+// cannot be checked, as most outputs are not known to a light consensus set.
+func (lcs *LightConsensusSet) TryTransactionSet(txns []types.Transaction) (modules.ConsensusChange, error) {
+	lcs.mu.RLock()
+	defer lcs.mu.RUnlock()
+	var cc modules.ConsensusChange
+	for _, txn := range txns {
+		if err := txn.StandaloneValid(lcs.height() + 1); err != nil {
+			return modules.ConsensusChange{}, err
+		}
+		for _, sci := range txn.SiacoinInputs {
+			if sco, exists := lcs.siacoinOutputs[sci.ParentID]; exists {
+				cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+					Direction:     modules.DiffRevert,
+					ID:            sci.ParentID,
+					SiacoinOutput: sco,
+				})
+			}
+		}
+		for i, sco := range txn.SiacoinOutputs {
+			cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+				Direction:     modules.DiffApply,
+				ID:            txn.SiacoinOutputID(uint64(i)),
+				SiacoinOutput: sco,
+			})
+		}
+		for _, sfi := range txn.SiafundInputs {
+			if sfo, exists := lcs.siafundOutputs[sfi.ParentID]; exists {
+				cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, modules.SiafundOutputDiff{
+					Direction:     modules.DiffRevert,
+					ID:            sfi.ParentID,
+					SiafundOutput: sfo,
+				})
+			}
+		}
+		for i, sfo := range txn.SiafundOutputs {
+			cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, modules.SiafundOutputDiff{
+				Direction:     modules.DiffApply,
+				ID:            txn.SiafundOutputID(uint64(i)),
+				SiafundOutput: sfo,
+			})
+		}
+	}
+	return cc, nil
+}
+
+var _ modules.ConsensusSet = (*LightConsensusSet)(nil)
@@ -0,0 +1,207 @@
+package consensus
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// lightSubscriber is a FilteredConsensusSetSubscriber that counts the blocks
+// it is sent.
+type lightSubscriber struct {
+	addrs    []types.UnlockHash
+	applied  int
+	reverted int
+	mu       sync.Mutex
+}
+
+func (ls *lightSubscriber) ProcessConsensusChange(cc modules.ConsensusChange) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.applied += len(cc.AppliedBlocks)
+	ls.reverted += len(cc.RevertedBlocks)
+}
+
+func (ls *lightSubscriber) WatchedAddresses() []types.UnlockHash {
+	return ls.addrs
+}
+
+// TestIntegrationLightConsensusSet checks that a light consensus set follows
+// the chain of a full consensus set, and tracks the outputs of the watched
+// addresses.
+func TestIntegrationLightConsensusSet(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationLightConsensusSet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationLightConsensusSet - light")
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	lcs, err := NewLight(g, filepath.Join(testdir, modules.ConsensusDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lcs.Close()
+	ls := &lightSubscriber{addrs: cst.wallet.AllAddresses()}
+	if err := lcs.ConsensusSetSubscribe(ls, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Connect(cst.gateway.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcs.managedSync(cst.gateway.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The light consensus set should have the same path and targets as the
+	// full consensus set.
+	current := cst.cs.CurrentBlock()
+	if lcs.Height() != cst.cs.Height() || !lcs.InCurrentPath(current.ID()) {
+		t.Fatal("light consensus set did not sync:", lcs.Height(), cst.cs.Height())
+	}
+	fullTarget, _ := cst.cs.ChildTarget(current.ID())
+	lightTarget, _ := lcs.ChildTarget(current.ID())
+	if fullTarget != lightTarget {
+		t.Error("light consensus set has the wrong child target")
+	}
+	fullTimestamp, _ := cst.cs.MinimumValidChildTimestamp(current.ID())
+	lightTimestamp, _ := lcs.MinimumValidChildTimestamp(current.ID())
+	if fullTimestamp != lightTimestamp {
+		t.Error("light consensus set has the wrong minimum child timestamp")
+	}
+	if !lcs.Synced() {
+		t.Error("light consensus set is not synced")
+	}
+
+	// Every block pays the wallet, so every block should have been downloaded
+	// in full, and the miner payouts should be tracked.
+	for h := types.BlockHeight(1); h <= cst.cs.Height(); h++ {
+		b, _ := cst.cs.BlockAtHeight(h)
+		if lb, _, exists := lcs.Block(b.ID()); !exists || lb.ID() != b.ID() {
+			t.Fatal("block was not downloaded at height", h)
+		}
+		id := b.MinerPayoutID(0)
+		fullOutput, fullExists := cst.cs.SiacoinOutput(id)
+		lightOutput, lightExists := lcs.SiacoinOutput(id)
+		if fullExists != lightExists || fullOutput.Value.Cmp(lightOutput.Value) != 0 {
+			t.Fatal("light consensus set has the wrong miner payout at height", h)
+		}
+	}
+	if len(lcs.siafundOutputs) == 0 {
+		t.Error("siafunds sent to the wallet were not tracked")
+	}
+	ls.mu.Lock()
+	if types.BlockHeight(ls.applied-ls.reverted) != lcs.Height()+1 {
+		t.Error("subscriber was sent the wrong number of blocks:", ls.applied, ls.reverted)
+	}
+	ls.mu.Unlock()
+
+	// A new block is relayed to the light consensus set as a header.
+	if _, err := cst.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && lcs.Height() != cst.cs.Height(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !lcs.InCurrentPath(cst.cs.CurrentBlock().ID()) {
+		t.Fatal("light consensus set did not receive the relayed header")
+	}
+
+	// A subscriber that watches a new address causes the path to be
+	// downloaded again, reverting the blocks of the existing subscribers.
+	ls2 := &lightSubscriber{addrs: []types.UnlockHash{{1}}}
+	if err := lcs.ConsensusSetSubscribe(ls2, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcs.managedSync(cst.gateway.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if lcs.Height() != cst.cs.Height() {
+		t.Fatal("light consensus set did not sync after the filter changed")
+	}
+	ls.mu.Lock()
+	if ls.reverted == 0 || types.BlockHeight(ls.applied-ls.reverted) != lcs.Height()+1 {
+		t.Error("subscriber was not rescanned:", ls.applied, ls.reverted)
+	}
+	ls.mu.Unlock()
+}
+
+// TestIntegrationLightUnsubscribe checks that the addresses of a subscriber
+// are removed from the filter when it unsubscribes, unless another subscriber
+// still watches them.
+func TestIntegrationLightUnsubscribe(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationLightUnsubscribe")
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	lcs, err := NewLight(g, filepath.Join(testdir, modules.ConsensusDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lcs.Close()
+
+	ls1 := &lightSubscriber{addrs: []types.UnlockHash{{1}, {2}}}
+	ls2 := &lightSubscriber{addrs: []types.UnlockHash{{2}, {3}}}
+	if err := lcs.ConsensusSetSubscribe(ls1, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcs.ConsensusSetSubscribe(ls2, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	lcs.mu.Lock()
+	if len(lcs.filter) != 3 {
+		t.Error("filter has the wrong size:", len(lcs.filter))
+	}
+	lcs.siacoinOutputs[types.SiacoinOutputID{1}] = types.SiacoinOutput{UnlockHash: types.UnlockHash{1}}
+	lcs.siacoinOutputs[types.SiacoinOutputID{2}] = types.SiacoinOutput{UnlockHash: types.UnlockHash{2}}
+	lcs.mu.Unlock()
+
+	// Only the address that is not watched by ls2 is removed, together with
+	// its tracked outputs.
+	lcs.Unsubscribe(ls1)
+	lcs.mu.Lock()
+	if len(lcs.filter) != 2 || lcs.filter.contains(types.UnlockHash{1}) || !lcs.filter.contains(types.UnlockHash{2}) {
+		t.Error("filter was not updated after unsubscribing:", lcs.filter)
+	}
+	if _, exists := lcs.siacoinOutputs[types.SiacoinOutputID{1}]; exists {
+		t.Error("output of a removed address is still tracked")
+	}
+	if _, exists := lcs.siacoinOutputs[types.SiacoinOutputID{2}]; !exists {
+		t.Error("output of a watched address is no longer tracked")
+	}
+	lcs.mu.Unlock()
+
+	// Subscribing and unsubscribing repeatedly should not grow the filter.
+	for i := 0; i < 3; i++ {
+		ls := &lightSubscriber{addrs: []types.UnlockHash{{4}, {5}}}
+		if err := lcs.ConsensusSetSubscribe(ls, modules.ConsensusChangeBeginning); err != nil {
+			t.Fatal(err)
+		}
+		lcs.Unsubscribe(ls)
+	}
+	lcs.Unsubscribe(ls2)
+	lcs.mu.Lock()
+	if len(lcs.filter) != 0 || len(lcs.watched) != 0 {
+		t.Error("filter was not emptied after all subscribers unsubscribed:", lcs.filter)
+	}
+	lcs.mu.Unlock()
+}
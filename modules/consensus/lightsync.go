@@ -0,0 +1,332 @@
+package consensus
+
+// lightsync.go contains the calling end of the SendFilteredHeaders RPC and the
+// validation of the headers downloaded by a LightConsensusSet.
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// filteredHeadersVersion is the minimum version of a peer that supports
+	// the SendFilteredHeaders RPC.
+	filteredHeadersVersion = "0.6.1"
+)
+
+var (
+	errBadFilteredBlock = errors.New("peer sent a block that does not match its header or the filter")
+)
+
+// blockHistory returns the ids of the blocks of the current path in the same
+// format as the blockHistory of the full consensus set.
+func (lcs *LightConsensusSet) blockHistory() (blockIDs [32]types.BlockID) {
+	height := lcs.height()
+	step := types.BlockHeight(1)
+	for i := 0; i < 31; i++ {
+		blockIDs[i] = lcs.path[height].id
+		if i >= 9 {
+			step *= 2
+		}
+		if height <= step {
+			break
+		}
+		height -= step
+	}
+	blockIDs[31] = lcs.path[0].id
+	return blockIDs
+}
+
+// ancestor returns the block at the given height of the chain formed by the
+// current path up to the parent of chain[0], followed by 'chain'.
+func (lcs *LightConsensusSet) ancestor(chain []*lightBlock, height types.BlockHeight) *lightBlock {
+	if len(chain) > 0 && height >= chain[0].height {
+		return chain[height-chain[0].height]
+	}
+	return lcs.path[height]
+}
+
+// minimumValidChildTimestamp returns the earliest timestamp that a child of
+// 'parent' can have. It is the median of the timestamps of the previous
+// MedianTimestampWindow blocks, as in the full consensus set.
+func (lcs *LightConsensusSet) minimumValidChildTimestamp(parent *lightBlock, chain []*lightBlock) types.Timestamp {
+	windowTimes := make(types.TimestampSlice, types.MedianTimestampWindow)
+	height := parent.height
+	for i := range windowTimes {
+		windowTimes[i] = lcs.ancestor(chain, height).header.Timestamp
+		// The genesis timestamp is used for all remaining times.
+		if height > 0 {
+			height--
+		}
+	}
+	sort.Sort(windowTimes)
+	return windowTimes[len(windowTimes)/2]
+}
+
+// childTarget returns the target of the children of 'lb', adjusting the target
+// of its parent every TargetWindow/2 blocks, as in the full consensus set.
+func (lcs *LightConsensusSet) childTarget(parent, lb *lightBlock, chain []*lightBlock) types.Target {
+	if lb.height%(types.TargetWindow/2) != 0 {
+		return parent.childTarget
+	}
+	windowSize := types.TargetWindow
+	if lb.height < windowSize {
+		windowSize = lb.height
+	}
+	timestamp := lcs.ancestor(chain, lb.height-windowSize).header.Timestamp
+	timePassed := lb.header.Timestamp - timestamp
+	expectedTimePassed := types.BlockFrequency * windowSize
+	adjustment := clampTargetAdjustment(big.NewRat(int64(timePassed), int64(expectedTimePassed)))
+	return types.RatToTarget(new(big.Rat).Mul(parent.childTarget.Rat(), adjustment))
+}
+
+// validateHeaders checks that the headers form a valid chain on top of the
+// block at height 'base' in the current path, and returns the chain. The
+// blocks that matched the filter are taken from 'blocks'.
+func (lcs *LightConsensusSet) validateHeaders(base types.BlockHeight, headers []types.BlockHeader, blocks map[types.BlockID]types.Block) ([]*lightBlock, error) {
+	var chain []*lightBlock
+	parent := lcs.path[base]
+	for _, h := range headers {
+		lb := &lightBlock{
+			id:     h.ID(),
+			header: h,
+			height: parent.height + 1,
+			depth:  parent.depth.AddDifficulties(parent.childTarget),
+			block: types.Block{
+				ParentID:  h.ParentID,
+				Nonce:     h.Nonce,
+				Timestamp: h.Timestamp,
+			},
+		}
+		if !checkHeaderTarget(h, parent.childTarget) {
+			return nil, modules.ErrBlockUnsolved
+		}
+		if id, exists := lcs.checkpoints[lb.height]; exists && id != lb.id {
+			return nil, errCheckpointMismatch
+		}
+		if h.Timestamp < lcs.minimumValidChildTimestamp(parent, chain) {
+			return nil, errEarlyTimestamp
+		}
+		if h.Timestamp > types.CurrentTimestamp()+types.ExtremeFutureThreshold {
+			return nil, errExtremeFutureTimestamp
+		}
+		if b, exists := blocks[lb.id]; exists {
+			lb.block = b
+			lb.full = true
+		}
+		lb.childTarget = lcs.childTarget(parent, lb, chain)
+		chain = append(chain, lb)
+		parent = lb
+	}
+	return chain, nil
+}
+
+// managedAcceptHeaders validates the downloaded headers, and switches the
+// current path to them if the resulting chain is heavier. The subscribers are
+// then sent the consensus change. Headers that were downloaded with an
+// outdated filter are ignored, as the blocks matching the new filter will be
+// downloaded again.
+func (lcs *LightConsensusSet) managedAcceptHeaders(headers []types.BlockHeader, blocks map[types.BlockID]types.Block, filterVersion int) error {
+	lcs.mu.Lock()
+	if filterVersion != lcs.filterVersion {
+		lcs.mu.Unlock()
+		return nil
+	}
+	base, exists := lcs.pathIDs[headers[0].ParentID]
+	if !exists {
+		lcs.mu.Unlock()
+		return errOrphanHeaderChain
+	}
+	// Skip the headers that are already in the current path.
+	for len(headers) > 0 && base < lcs.height() && lcs.path[base+1].id == headers[0].ID() {
+		base++
+		headers = headers[1:]
+	}
+	if len(headers) == 0 {
+		lcs.mu.Unlock()
+		return nil
+	}
+	chain, err := lcs.validateHeaders(base, headers, blocks)
+	if err != nil {
+		lcs.mu.Unlock()
+		return err
+	}
+	if !chain[len(chain)-1].heavierThan(lcs.path[len(lcs.path)-1]) {
+		lcs.mu.Unlock()
+		return nil
+	}
+
+	reverted := lcs.revertToHeight(base)
+	for _, lb := range chain {
+		lcs.applyBlock(lb)
+		lcs.path = append(lcs.path, lb)
+		lcs.pathIDs[lb.id] = lb.height
+	}
+	if len(reverted) > 0 {
+		lcs.log.Printf("INFO: reorg at height %v reverted %v headers and applied %v headers", base, len(reverted), len(chain))
+	}
+	cc := lightConsensusChange(reverted, chain)
+	lcs.mu.Demote()
+	defer lcs.mu.DemotedUnlock()
+	for _, subscriber := range lcs.subscribers {
+		subscriber.ProcessConsensusChange(cc)
+	}
+	return nil
+}
+
+// managedReceiveFilteredHeaders returns an RPCFunc for the calling end of the
+// SendFilteredHeaders RPC. The received headers and matching blocks are
+// checked and accepted. 'more' is set if the peer has more headers to send.
+func (lcs *LightConsensusSet) managedReceiveFilteredHeaders(more *bool) modules.RPCFunc {
+	return func(conn modules.PeerConn) error {
+		if err := setSyncDeadline(conn, sendBlocksTimeout); err != nil {
+			return err
+		}
+
+		lcs.mu.RLock()
+		history := lcs.blockHistory()
+		filter := make(addressFilter, len(lcs.filter))
+		addrs := make([]types.UnlockHash, 0, len(lcs.filter))
+		for addr := range lcs.filter {
+			filter[addr] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+		filterVersion := lcs.filterVersion
+		lcs.mu.RUnlock()
+		if err := encoding.WriteObject(conn, history); err != nil {
+			return err
+		}
+		if err := encoding.WriteObject(conn, addrs); err != nil {
+			return err
+		}
+
+		var headers []types.BlockHeader
+		blocks := make(map[types.BlockID]types.Block)
+		moreAvailable := true
+		for i := 0; moreAvailable && i < maxHeaderBatches; i++ {
+			var batch []types.BlockHeader
+			if err := encoding.ReadObject(conn, &batch, uint64(MaxCatchUpHeaders)*types.BlockHeaderSize+8); err != nil {
+				return err
+			}
+			var matches []uint64
+			if err := encoding.ReadObject(conn, &matches, uint64(MaxCatchUpHeaders)*8+8); err != nil {
+				return err
+			}
+			for j, index := range matches {
+				if index >= uint64(len(batch)) || (j > 0 && index <= matches[j-1]) {
+					return errBadFilteredBlock
+				}
+				var b types.Block
+				if err := encoding.ReadObject(conn, &b, types.BlockSizeLimit); err != nil {
+					return err
+				}
+				if b.ID() != batch[index].ID() || !filter.matchesBlock(b) {
+					return errBadFilteredBlock
+				}
+				blocks[b.ID()] = b
+			}
+			if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
+				return err
+			}
+			if len(batch) == 0 && moreAvailable {
+				return errPeerPruned
+			}
+			for _, h := range batch {
+				if len(headers) > 0 && h.ParentID != headers[len(headers)-1].ID() {
+					return errBadHeaderChain
+				}
+				headers = append(headers, h)
+			}
+		}
+		*more = moreAvailable
+		if len(headers) == 0 {
+			return nil
+		}
+		return lcs.managedAcceptHeaders(headers, blocks, filterVersion)
+	}
+}
+
+// managedSync downloads headers from the peer until it has no more headers to
+// send. Peers that send invalid headers are penalized.
+func (lcs *LightConsensusSet) managedSync(addr modules.NetAddress) error {
+	for {
+		var more bool
+		err := lcs.gateway.RPC(addr, "SendFilteredHeaders", lcs.managedReceiveFilteredHeaders(&more))
+		if err != nil {
+			lcs.log.Debugf("WARN: failed to download headers from %v: %v", addr, err)
+			switch err {
+			case errBadHeaderChain, errBadFilteredBlock, modules.ErrBlockUnsolved, errEarlyTimestamp:
+				lcs.gateway.Penalize(addr, "sent invalid headers: "+err.Error())
+			}
+			return err
+		}
+		if !more {
+			lcs.mu.Lock()
+			lcs.synced = true
+			lcs.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// threadedSync downloads headers from each of the peers that support the
+// SendFilteredHeaders RPC.
+func (lcs *LightConsensusSet) threadedSync() {
+	for _, p := range lcs.gateway.Peers() {
+		if build.VersionCmp(p.Version, filteredHeadersVersion) >= 0 {
+			lcs.managedSync(p.NetAddress)
+		}
+	}
+}
+
+// threadedReceiveFilteredHeaders is called when connecting to a new peer. It
+// downloads headers from the peer, continuing in the background if the peer
+// has more headers to send.
+func (lcs *LightConsensusSet) threadedReceiveFilteredHeaders(conn modules.PeerConn) error {
+	var more bool
+	err := lcs.managedReceiveFilteredHeaders(&more)(conn)
+	if err != nil {
+		return err
+	}
+	if more {
+		go lcs.managedSync(modules.NetAddress(conn.RemoteAddr().String()))
+	} else {
+		lcs.mu.Lock()
+		lcs.synced = true
+		lcs.mu.Unlock()
+	}
+	return nil
+}
+
+// rpcRelayHeader is the receiving end of the RelayHeader RPC for a light
+// consensus set. Unknown headers are downloaded from the peer along with any
+// missing parents.
+func (lcs *LightConsensusSet) rpcRelayHeader(conn modules.PeerConn) error {
+	var h types.BlockHeader
+	err := encoding.ReadObject(conn, &h, types.BlockHeaderSize)
+	if err != nil {
+		return err
+	}
+	addr := modules.NetAddress(conn.RemoteAddr().String())
+
+	lcs.mu.RLock()
+	_, known := lcs.pathIDs[h.ID()]
+	parentHeight, parentKnown := lcs.pathIDs[h.ParentID]
+	unsolved := parentKnown && !checkHeaderTarget(h, lcs.path[parentHeight].childTarget)
+	lcs.mu.RUnlock()
+	if known {
+		return nil
+	}
+	if unsolved {
+		lcs.gateway.Penalize(addr, "relayed invalid header: "+modules.ErrBlockUnsolved.Error())
+		return modules.ErrBlockUnsolved
+	}
+	go lcs.managedSync(addr)
+	return nil
+}
@@ -49,7 +49,13 @@ func (cs *ConsensusSet) loadDB() error {
 		if genesisID != cs.blockRoot.Block.ID() {
 			return errors.New("Blockchain has wrong genesis block, exiting.")
 		}
-		return nil
+
+		// Check that the current path agrees with the checkpoints.
+		err = cs.checkCurrentPath(tx)
+		if err != nil {
+			return err
+		}
+		return createForkBuckets(tx)
 	})
 }
 
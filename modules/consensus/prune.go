@@ -0,0 +1,145 @@
+package consensus
+
+// prune.go contains the logic for the pruned mode of the consensus set. In
+// pruned mode, the transactions and diffs of blocks in the current path that
+// are more than 'pruneDepth' blocks deep are removed from the block map. The
+// block headers, the block path, and the current set of outputs and contracts
+// are kept, so the consensus set can still validate new blocks. Pruned blocks
+// cannot be reverted, so the consensus set will not reorganize below the
+// pruning horizon, and pruned blocks cannot be sent to peers or subscribers.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	// PrunedHeight is the key in the BlockHeight bucket that stores the
+	// pruning horizon, which is the lowest height in the current path whose
+	// block has not been pruned. The genesis block is never pruned.
+	PrunedHeight = []byte("PrunedHeight")
+
+	// MinPruneDepth is the minimum number of blocks that a pruned consensus
+	// set keeps in full. It is also the deepest reorg that a pruned consensus
+	// set can perform.
+	MinPruneDepth = func() types.BlockHeight {
+		switch build.Release {
+		case "dev":
+			return 144
+		case "standard":
+			return 1008
+		case "testing":
+			return 5
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+
+	errPeerPruned  = errors.New("peer has pruned the blocks that are needed")
+	errPruneDepth  = errors.New("prune depth is below the minimum prune depth")
+	errPrunedBlock = errors.New("block has been pruned")
+	errPrunedReorg = errors.New("block would cause a reorg below the pruning horizon")
+)
+
+// prunedHeight returns the pruning horizon of the database. Blocks in the
+// current path between the genesis block and the pruning horizon have been
+// pruned.
+func prunedHeight(tx *bolt.Tx) types.BlockHeight {
+	heightBytes := tx.Bucket(BlockHeight).Get(PrunedHeight)
+	if heightBytes == nil {
+		return 0
+	}
+	var height types.BlockHeight
+	err := encoding.Unmarshal(heightBytes, &height)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	return height
+}
+
+// blockPruned returns true if the block with the given id has been pruned.
+// Only blocks in the current path are pruned.
+func blockPruned(tx *bolt.Tx, id types.BlockID, height types.BlockHeight) bool {
+	if height == 0 || height >= prunedHeight(tx) {
+		return false
+	}
+	pathID, err := getPath(tx, height)
+	return err == nil && pathID == id
+}
+
+// entryPruned returns true if any of the blocks in the change entry have been
+// pruned, in which case the consensus change cannot be computed.
+func entryPruned(tx *bolt.Tx, ce changeEntry) bool {
+	for _, ids := range [][]types.BlockID{ce.RevertedBlocks, ce.AppliedBlocks} {
+		for _, id := range ids {
+			pb, err := getBlockMap(tx, id)
+			if err != nil || blockPruned(tx, id, pb.Height) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneBlocks removes the transactions and diffs of every block in the current
+// path that is more than pruneDepth blocks below the current block, and
+// advances the pruning horizon.
+func pruneBlocks(tx *bolt.Tx, pruneDepth types.BlockHeight) error {
+	height := blockHeight(tx)
+	if pruneDepth == 0 || height <= pruneDepth {
+		return nil
+	}
+	horizon := height - pruneDepth
+	start := prunedHeight(tx)
+	if start == 0 {
+		start = 1
+	}
+	for h := start; h < horizon; h++ {
+		id, err := getPath(tx, h)
+		if err != nil {
+			return err
+		}
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		// The first fields of the block are kept, as the timestamps of
+		// previous blocks are needed to validate new blocks.
+		pb.Block.MinerPayouts = nil
+		pb.Block.Transactions = nil
+		pb.DiffsGenerated = false
+		pb.SiacoinOutputDiffs = nil
+		pb.FileContractDiffs = nil
+		pb.SiafundOutputDiffs = nil
+		pb.DelayedSiacoinOutputDiffs = nil
+		pb.SiafundPoolDiffs = nil
+		// The id of a pruned block can no longer be computed from the block,
+		// so the block is stored under its original id.
+		err = tx.Bucket(BlockMap).Put(id[:], encoding.Marshal(*pb))
+		if err != nil {
+			return err
+		}
+	}
+	if horizon > start {
+		return tx.Bucket(BlockHeight).Put(PrunedHeight, encoding.Marshal(horizon))
+	}
+	return nil
+}
+
+// checkPrunedSubscribe returns an error if any of the consensus changes after
+// the change with the provided id involve a pruned block.
+func checkPrunedSubscribe(tx *bolt.Tx, entry changeEntry, exists bool) error {
+	for exists {
+		if entryPruned(tx, entry) {
+			return modules.ErrPrunedConsensusChangeID
+		}
+		entry, exists = entry.NextEntry(tx)
+	}
+	return nil
+}
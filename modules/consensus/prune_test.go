@@ -0,0 +1,114 @@
+package consensus
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestIntegrationPrune checks that a pruned consensus set prunes old blocks,
+// keeps accepting new blocks, and refuses to serve the pruned blocks to
+// subscribers and peers.
+func TestIntegrationPrune(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationPrune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationPrune - pruned")
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if _, err := NewWithSettings(g, filepath.Join(testdir, "invalid"), Settings{PruneDepth: MinPruneDepth - 1}); err != errPruneDepth {
+		t.Fatal("expected errPruneDepth, got", err)
+	}
+	cs, err := NewWithSettings(g, filepath.Join(testdir, modules.ConsensusDir), Settings{PruneDepth: MinPruneDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	// Synchronize the pruned consensus set, and then mine a few more blocks.
+	for h := types.BlockHeight(1); h <= cst.cs.Height(); h++ {
+		b, _ := cst.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		b, err := cst.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cs.CurrentBlock().ID() != cst.cs.CurrentBlock().ID() {
+		t.Fatal("pruned consensus set did not stay synchronized")
+	}
+
+	// Blocks below the pruning horizon should be pruned.
+	var horizon types.BlockHeight
+	cs.db.View(func(tx *bolt.Tx) error {
+		horizon = prunedHeight(tx)
+		return nil
+	})
+	if horizon < 2 || horizon != cs.Height()-MinPruneDepth {
+		t.Fatal("wrong pruning horizon:", horizon)
+	}
+	if _, exists := cs.BlockAtHeight(horizon - 1); exists {
+		t.Error("pruned block was returned")
+	}
+	if _, exists := cs.BlockAtHeight(horizon); !exists {
+		t.Error("block at the pruning horizon was not returned")
+	}
+	if _, exists := cs.BlockAtHeight(0); !exists {
+		t.Error("genesis block was not returned")
+	}
+	if _, err := cs.ExportSnapshot(cs.Height(), "snapshot.db"); err != errSnapshotPruned {
+		t.Error("expected errSnapshotPruned, got", err)
+	}
+
+	// Subscribers that need pruned blocks should get a clear error.
+	ms := newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeBeginning); err != modules.ErrPrunedConsensusChangeID {
+		t.Error("expected ErrPrunedConsensusChangeID, got", err)
+	}
+	if len(ms.updates) != 0 {
+		t.Error("subscriber received changes from a pruned consensus set")
+	}
+	cs.Unsubscribe(&ms)
+	ms = newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeRecent); err != nil {
+		t.Error(err)
+	}
+
+	// A peer that is missing pruned blocks should be told that the consensus
+	// set is pruned.
+	blank, err := blankConsensusSetTester("TestIntegrationPrune - blank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blank.Close()
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	go cs.rpcSendBlocks(p2)
+	if err := blank.cs.threadedReceiveBlocks(p1); err != errPeerPruned {
+		t.Fatal("expected errPeerPruned, got", err)
+	}
+}
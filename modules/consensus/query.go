@@ -0,0 +1,58 @@
+package consensus
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// Block returns the block with the given id, along with its height. The block
+// may be on a fork other than the current path. Pruned blocks are not
+// returned.
+func (cs *ConsensusSet) Block(id types.BlockID) (block types.Block, height types.BlockHeight, exists bool) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		if blockPruned(tx, id, pb.Height) {
+			return errPrunedBlock
+		}
+		block = pb.Block
+		height = pb.Height
+		exists = true
+		return nil
+	})
+	return block, height, exists
+}
+
+// SiacoinOutput returns the unspent siacoin output with the given id.
+func (cs *ConsensusSet) SiacoinOutput(id types.SiacoinOutputID) (sco types.SiacoinOutput, exists bool) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		sco, err = getSiacoinOutput(tx, id)
+		exists = err == nil
+		return nil
+	})
+	return sco, exists
+}
+
+// FileContract returns the open file contract with the given id.
+func (cs *ConsensusSet) FileContract(id types.FileContractID) (fc types.FileContract, exists bool) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		fc, err = getFileContract(tx, id)
+		exists = err == nil
+		return nil
+	})
+	return fc, exists
+}
+
+// SiafundPool returns the current value of the siafund pool.
+func (cs *ConsensusSet) SiafundPool() (pool types.Currency) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		pool = getSiafundPool(tx)
+		return nil
+	})
+	return pool
+}
@@ -0,0 +1,376 @@
+package consensus
+
+// snapshot.go contains functions for exporting and importing snapshots of the
+// consensus database. A snapshot is a copy of the consensus database with the
+// current path reverted to a chosen height, and with all blocks outside of the
+// current path removed. Importing a snapshot allows a new node to skip the
+// initial blockchain download up to that height, so the checksum of an
+// imported snapshot must match a value that the user trusts. The checksum
+// covers the current path, and every block in the snapshot is checked against
+// the path when the snapshot is imported. Snapshots therefore cannot contain
+// pruned blocks, whose ids can no longer be computed. The checksum does not
+// cover the diffs of the blocks, which are sent to subscribers and used to
+// revert blocks, so the diffs and the consensus state are regenerated from the
+// verified blocks before a snapshot is installed.
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// snapshotDir is the folder within the consensus directory that snapshots
+	// are exported to.
+	snapshotDir = "snapshots"
+)
+
+var (
+	errSnapshotBlocks        = errors.New("snapshot contains blocks that do not match its block path")
+	errSnapshotChecksum      = errors.New("snapshot checksum does not match the trusted checksum")
+	errSnapshotExists        = errors.New("a snapshot with that name already exists")
+	errSnapshotGenesis       = errors.New("snapshot has the wrong genesis block")
+	errSnapshotHeight        = errors.New("snapshot height is greater than the current height")
+	errSnapshotInconsistent  = errors.New("snapshot contains inconsistencies")
+	errSnapshotName          = errors.New("snapshot name must be a file name without a directory")
+	errSnapshotPruned        = errors.New("snapshots cannot contain pruned blocks")
+	errSnapshotUninitialized = errors.New("snapshot is not a consensus database")
+)
+
+// snapshotInfo returns the description of the consensus database as a
+// snapshot.
+func snapshotInfo(tx *bolt.Tx) modules.ConsensusSnapshot {
+	var changeID modules.ConsensusChangeID
+	copy(changeID[:], tx.Bucket(ChangeLog).Get(ChangeLogTailID))
+	return modules.ConsensusSnapshot{
+		Height:   blockHeight(tx),
+		BlockID:  currentBlockID(tx),
+		ChangeID: changeID,
+		Checksum: consensusChecksum(tx),
+	}
+}
+
+// revertToHeight reverts blocks from the current path until the current block
+// is at the given height. The changelog is not updated.
+func revertToHeight(tx *bolt.Tx, height types.BlockHeight) {
+	for blockHeight(tx) > height {
+		commitDiffSet(tx, currentProcessedBlock(tx), modules.DiffRevert)
+	}
+}
+
+// pruneBlockMap removes every block that is not in the current path from the
+// block map. Otherwise, a node that imported the snapshot would treat the
+// blocks after the snapshot as already known, and would not apply them when
+// they are downloaded.
+func pruneBlockMap(tx *bolt.Tx) error {
+	var prune [][]byte
+	err := tx.Bucket(BlockMap).ForEach(func(k, _ []byte) error {
+		var id types.BlockID
+		copy(id[:], k)
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		if pathID, err := getPath(tx, pb.Height); err != nil || pathID != id {
+			prune = append(prune, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range prune {
+		if err := tx.Bucket(BlockMap).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildChangeLog replaces the changelog with one that applies each block of
+// the current path in order. The old changelog may refer to pruned blocks.
+func (cs *ConsensusSet) rebuildChangeLog(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket(ChangeLog); err != nil {
+		return err
+	}
+	if err := cs.createChangeLog(tx); err != nil {
+		return err
+	}
+	for height := types.BlockHeight(1); height <= blockHeight(tx); height++ {
+		id, err := getPath(tx, height)
+		if err != nil {
+			return err
+		}
+		if err := appendChangeLog(tx, changeEntry{AppliedBlocks: []types.BlockID{id}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifySnapshotBlocks checks the block map of a snapshot against its current
+// path, which is covered by the snapshot checksum. Every block must hash to
+// the id at its height in the path, and the block map must not contain any
+// other blocks. The depth and child target of each block are recomputed
+// rather than trusted, because they are used to validate future blocks.
+func verifySnapshotBlocks(tx *bolt.Tx) error {
+	if prunedHeight(tx) != 0 {
+		return errSnapshotPruned
+	}
+	height := blockHeight(tx)
+	blockMap := tx.Bucket(BlockMap)
+	var numBlocks types.BlockHeight
+	err := blockMap.ForEach(func(_, _ []byte) error {
+		numBlocks++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if numBlocks != height+1 {
+		return errSnapshotBlocks
+	}
+
+	// setChildTarget only reads the block map, so a blank consensus set can
+	// be used to recompute the child targets.
+	var cs ConsensusSet
+	var parent *processedBlock
+	for h := types.BlockHeight(0); h <= height; h++ {
+		id, err := getPath(tx, h)
+		if err != nil {
+			return err
+		}
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return errSnapshotBlocks
+		}
+		if pb.Block.ID() != id || pb.Height != h {
+			return errSnapshotBlocks
+		}
+		if h == 0 {
+			if pb.Depth != types.RootDepth || pb.ChildTarget != types.RootTarget {
+				return errSnapshotBlocks
+			}
+		} else {
+			if pb.Block.ParentID != parent.Block.ID() || pb.Depth != parent.childDepth() {
+				return errSnapshotBlocks
+			}
+			expected := &processedBlock{Block: pb.Block, Height: h}
+			cs.setChildTarget(blockMap, expected)
+			if pb.ChildTarget != expected.ChildTarget {
+				return errSnapshotBlocks
+			}
+		}
+		parent = pb
+	}
+	return nil
+}
+
+// ExportSnapshot writes a snapshot of the consensus database, as it was at the
+// given height in the current path, to a new file with the given name in the
+// snapshots folder of the consensus directory.
+func (cs *ConsensusSet) ExportSnapshot(height types.BlockHeight, name string) (modules.ConsensusSnapshot, error) {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return modules.ConsensusSnapshot{}, errSnapshotName
+	}
+	err := os.MkdirAll(filepath.Join(cs.persistDir, snapshotDir), 0700)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	filename := filepath.Join(cs.persistDir, snapshotDir, name)
+	if _, err := os.Stat(filename); err == nil {
+		return modules.ConsensusSnapshot{}, errSnapshotExists
+	}
+
+	// Copy the database. The copy is made in a single read transaction, and
+	// is therefore consistent even if blocks are accepted in the meantime.
+	err = cs.db.View(func(tx *bolt.Tx) error {
+		if height > blockHeight(tx) {
+			return errSnapshotHeight
+		}
+		if prunedHeight(tx) != 0 {
+			return errSnapshotPruned
+		}
+		return tx.CopyFile(filename, 0600)
+	})
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+
+	// Revert the copy to the requested height.
+	db, err := persist.OpenDatabase(dbMetadata, filename)
+	if err != nil {
+		os.Remove(filename)
+		return modules.ConsensusSnapshot{}, err
+	}
+	var snapshot modules.ConsensusSnapshot
+	err = db.Update(func(tx *bolt.Tx) error {
+		revertToHeight(tx, height)
+		if err := pruneBlockMap(tx); err != nil {
+			return err
+		}
+		// The fork records of this node would not apply to the node that
+		// imports the snapshot.
+		if err := clearForkRecords(tx); err != nil {
+			return err
+		}
+		if err := cs.rebuildChangeLog(tx); err != nil {
+			return err
+		}
+		snapshot = snapshotInfo(tx)
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return modules.ConsensusSnapshot{}, err
+	}
+	snapshot.Filename = filename
+	cs.log.Printf("INFO: exported snapshot at height %v to %v", snapshot.Height, filename)
+	return snapshot, nil
+}
+
+// ImportSnapshot checks that the snapshot in filename has the trusted
+// checksum and that its blocks match its block path, regenerates the diffs and
+// the consensus state of a copy of the snapshot from its blocks, and then
+// installs the copy as the consensus database in persistDir. An existing
+// consensus database is backed up. ImportSnapshot must not be called while a
+// ConsensusSet is using persistDir.
+func ImportSnapshot(filename string, persistDir string, checksum crypto.Hash) (modules.ConsensusSnapshot, error) {
+	// Verify the snapshot.
+	db, err := persist.OpenDatabase(dbMetadata, filename)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	var snapshot modules.ConsensusSnapshot
+	err = db.View(func(tx *bolt.Tx) error {
+		if !dbInitialized(tx) {
+			return errSnapshotUninitialized
+		}
+		if inconsistencyDetected(tx) {
+			return errSnapshotInconsistent
+		}
+		genesisID, err := getPath(tx, 0)
+		if err != nil || genesisID != types.GenesisBlock.ID() {
+			return errSnapshotGenesis
+		}
+		snapshot = snapshotInfo(tx)
+		if snapshot.Checksum != checksum {
+			return errSnapshotChecksum
+		}
+		return verifySnapshotBlocks(tx)
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+
+	// Regenerate the diffs in a copy of the snapshot.
+	err = os.MkdirAll(persistDir, 0700)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	dbFilename := filepath.Join(persistDir, DatabaseFilename)
+	importFilename := dbFilename + ".import"
+	os.Remove(importFilename)
+	err = copyFile(filename, importFilename)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	snapshot, err = regenerateSnapshot(importFilename, checksum)
+	if err != nil {
+		os.Remove(importFilename)
+		return modules.ConsensusSnapshot{}, err
+	}
+	snapshot.Filename = filename
+
+	// Back up the existing database and move the copy into its place.
+	if _, err := os.Stat(dbFilename); err == nil {
+		err = os.Rename(dbFilename, dbFilename+".bck")
+		if err != nil {
+			os.Remove(importFilename)
+			return modules.ConsensusSnapshot{}, errors.New("error while backing up consensus database: " + err.Error())
+		}
+	}
+	err = os.Rename(importFilename, dbFilename)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// regenerateSnapshot discards the diffs and the consensus state of the
+// snapshot in filename, which has already been verified, and regenerates them
+// by applying the blocks of its path. The blocks are covered by the trusted
+// checksum, so their signatures are not checked again, but the regenerated
+// consensus state must still match the checksum.
+func regenerateSnapshot(filename string, checksum crypto.Hash) (modules.ConsensusSnapshot, error) {
+	db, err := persist.OpenDatabase(dbMetadata, filename)
+	if err != nil {
+		return modules.ConsensusSnapshot{}, err
+	}
+	cs := &ConsensusSet{
+		blockRoot: newBlockRoot(),
+	}
+	var snapshot modules.ConsensusSnapshot
+	err = db.Update(func(tx *bolt.Tx) error {
+		chain := make([]types.BlockID, blockHeight(tx)+1)
+		for h := range chain {
+			id, err := getPath(tx, types.BlockHeight(h))
+			if err != nil {
+				return err
+			}
+			chain[h] = id
+		}
+		if err := cs.rebuildDerivedBuckets(tx, chain, true, ioutil.Discard); err != nil {
+			return err
+		}
+		if consensusChecksum(tx) != checksum {
+			return errSnapshotChecksum
+		}
+		if err := cs.rebuildChangeLog(tx); err != nil {
+			return err
+		}
+		snapshot = snapshotInfo(tx)
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return snapshot, err
+}
+
+// copyFile copies the file at src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
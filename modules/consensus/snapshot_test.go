@@ -0,0 +1,257 @@
+package consensus
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestIntegrationSnapshot exports a snapshot below the current height, imports
+// it into a new consensus set, and checks that the new consensus set can
+// apply the blocks after the snapshot.
+func TestIntegrationSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationSnapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Export a snapshot a few blocks below the current height.
+	tip := cst.cs.Height()
+	height := tip - 3
+	if _, err := cst.cs.ExportSnapshot(tip+1, "snapshot.db"); err != errSnapshotHeight {
+		t.Fatal("expected errSnapshotHeight, got", err)
+	}
+	for _, name := range []string{"", "..", "../snapshot.db", filepath.Join(cst.persistDir, "snapshot.db")} {
+		if _, err := cst.cs.ExportSnapshot(height, name); err != errSnapshotName {
+			t.Fatalf("expected errSnapshotName for %q, got %v", name, err)
+		}
+	}
+	snapshot, err := cst.cs.ExportSnapshot(height, "snapshot.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := snapshot.Filename
+	if filename != filepath.Join(cst.cs.persistDir, snapshotDir, "snapshot.db") {
+		t.Fatal("snapshot was written to the wrong file:", filename)
+	}
+	if _, err := cst.cs.ExportSnapshot(height, "snapshot.db"); err != errSnapshotExists {
+		t.Fatal("expected errSnapshotExists, got", err)
+	}
+	block, _ := cst.cs.BlockAtHeight(height)
+	if snapshot.Height != height || snapshot.BlockID != block.ID() {
+		t.Fatal("snapshot was taken at the wrong block:", snapshot)
+	}
+	if cst.cs.Height() != tip {
+		t.Fatal("exporting a snapshot changed the consensus set")
+	}
+
+	// Import the snapshot, first with the wrong checksum.
+	persistDir := filepath.Join(cst.persistDir, "imported", modules.ConsensusDir)
+	if _, err := ImportSnapshot(filename, persistDir, crypto.Hash{}); err != errSnapshotChecksum {
+		t.Fatal("expected errSnapshotChecksum, got", err)
+	}
+	if _, err := ImportSnapshot(filename, persistDir, snapshot.Checksum); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gateway.New("localhost:0", filepath.Join(cst.persistDir, "imported", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cs, err := New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if cs.Height() != height || cs.CurrentBlock().ID() != block.ID() {
+		t.Fatal("imported consensus set is at the wrong block")
+	}
+
+	// The blocks after the snapshot should be accepted.
+	for h := height + 1; h <= tip; h++ {
+		b, _ := cst.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cs.CurrentBlock().ID() != cst.cs.CurrentBlock().ID() {
+		t.Fatal("imported consensus set did not catch up")
+	}
+
+	// Subscribers of the imported consensus set should see every block in
+	// the current path.
+	ms := newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	if types.BlockHeight(len(ms.updates)) != tip+1 {
+		t.Fatal("subscriber received the wrong number of changes:", len(ms.updates))
+	}
+}
+
+// TestIntegrationSnapshotTampered checks that a snapshot whose blocks do not
+// match its block path is rejected, even though the snapshot checksum does
+// not cover the blocks themselves.
+func TestIntegrationSnapshotTampered(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationSnapshotTampered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	tests := []struct {
+		name   string
+		tamper func(tx *bolt.Tx) error
+	}{
+		{
+			name: "childtarget.db",
+			tamper: func(tx *bolt.Tx) error {
+				id, err := getPath(tx, 1)
+				if err != nil {
+					return err
+				}
+				pb, err := getBlockMap(tx, id)
+				if err != nil {
+					return err
+				}
+				pb.ChildTarget = types.RootDepth
+				return tx.Bucket(BlockMap).Put(id[:], encoding.Marshal(*pb))
+			},
+		},
+		{
+			name: "timestamp.db",
+			tamper: func(tx *bolt.Tx) error {
+				id, err := getPath(tx, 1)
+				if err != nil {
+					return err
+				}
+				pb, err := getBlockMap(tx, id)
+				if err != nil {
+					return err
+				}
+				pb.Block.Timestamp++
+				return tx.Bucket(BlockMap).Put(id[:], encoding.Marshal(*pb))
+			},
+		},
+		{
+			name: "extrablock.db",
+			tamper: func(tx *bolt.Tx) error {
+				pb := processedBlock{Block: types.Block{ParentID: types.GenesisBlock.ID()}, Height: 1}
+				id := pb.Block.ID()
+				return tx.Bucket(BlockMap).Put(id[:], encoding.Marshal(pb))
+			},
+		},
+	}
+	for _, test := range tests {
+		snapshot, err := cst.cs.ExportSnapshot(cst.cs.Height(), test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := persist.OpenDatabase(dbMetadata, snapshot.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Update(test.tamper)
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		persistDir := filepath.Join(cst.persistDir, "imported-"+test.name)
+		if _, err := ImportSnapshot(snapshot.Filename, persistDir, snapshot.Checksum); err != errSnapshotBlocks {
+			t.Errorf("%v: expected errSnapshotBlocks, got %v", test.name, err)
+		}
+	}
+}
+
+// TestIntegrationSnapshotForgedDiffs checks that the diffs stored in a
+// snapshot, which are not covered by the snapshot checksum, are regenerated
+// when the snapshot is imported instead of being sent to subscribers.
+func TestIntegrationSnapshotForgedDiffs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationSnapshotForgedDiffs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	snapshot, err := cst.cs.ExportSnapshot(cst.cs.Height(), "forged.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedID := types.SiacoinOutputID{1}
+	db, err := persist.OpenDatabase(dbMetadata, snapshot.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		id, err := getPath(tx, 1)
+		if err != nil {
+			return err
+		}
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		pb.SiacoinOutputDiffs = append(pb.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            forgedID,
+			SiacoinOutput: types.SiacoinOutput{Value: types.SiacoinPrecision},
+		})
+		return tx.Bucket(BlockMap).Put(id[:], encoding.Marshal(*pb))
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	persistDir := filepath.Join(cst.persistDir, "imported", modules.ConsensusDir)
+	imported, err := ImportSnapshot(snapshot.Filename, persistDir, snapshot.Checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.ChangeID != snapshot.ChangeID {
+		t.Error("imported snapshot has a different change id")
+	}
+	g, err := gateway.New("localhost:0", filepath.Join(cst.persistDir, "imported", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cs, err := New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	ms := newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	for _, cc := range ms.updates {
+		for _, diff := range cc.SiacoinOutputDiffs {
+			if diff.ID == forgedID {
+				t.Fatal("forged diff was sent to a subscriber")
+			}
+		}
+	}
+}
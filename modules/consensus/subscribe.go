@@ -139,6 +139,13 @@ func (cs *ConsensusSet) initializeSubscribe(subscriber modules.ConsensusSetSubsc
 			entry, exists = entry.NextEntry(tx)
 		}
 
+		// Check that none of the remaining consensus changes involve pruned
+		// blocks before sending any of them.
+		err := checkPrunedSubscribe(tx, entry, exists)
+		if err != nil {
+			return err
+		}
+
 		// Send all remaining consensus changes to the subscriber.
 		for exists {
 			cc, err := cs.computeConsensusChange(tx, entry)
@@ -85,6 +85,22 @@ var (
 	errSendBlocksStalled = errors.New("SendBlocks RPC timed and never received any blocks")
 )
 
+// isBenignBlockErr returns true if err is an error that may be returned when
+// accepting a block that was relayed by an honest peer, such as a block that
+// is already known or a block whose parent has not yet been received. Blocks
+// that conflict with a checkpoint are also benign, because the checkpoints may
+// have been supplied by the user and honest peers do not know about them.
+// Peers that relay blocks which fail for any other reason are penalized.
+func isBenignBlockErr(err error) bool {
+	switch err {
+	case nil, modules.ErrBlockKnown, modules.ErrNonExtendingBlock, errOrphan,
+		errFutureTimestamp, errInconsistentSet, errNoBlockMap,
+		errCheckpointMismatch, errCheckpointReorg:
+		return true
+	}
+	return false
+}
+
 // blockHistory returns up to 32 block ids, starting with recent blocks and
 // then proving exponentially increasingly less recent blocks. The genesis
 // block is always included as the last block. This block history can be used
@@ -127,6 +143,33 @@ func blockHistory(tx *bolt.Tx) (blockIDs [32]types.BlockID) {
 	return blockIDs
 }
 
+// findSyncStart finds the most recent of the known blocks in the current path,
+// and returns the height of its child. found is false if none of the known
+// blocks are in the current path, or if the most recent one is the current
+// block.
+func findSyncStart(tx *bolt.Tx, knownBlocks [32]types.BlockID) (start types.BlockHeight, found bool) {
+	csHeight := blockHeight(tx)
+	for _, id := range knownBlocks {
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			continue
+		}
+		pathID, err := getPath(tx, pb.Height)
+		if err != nil {
+			continue
+		}
+		if pathID != id {
+			continue
+		}
+		if pb.Height == csHeight {
+			break
+		}
+		// Start from the child of the common block.
+		return pb.Height + 1, true
+	}
+	return 0, false
+}
+
 // threadedReceiveBlocks is the calling end of the SendBlocks RPC.
 func (cs *ConsensusSet) threadedReceiveBlocks(conn modules.PeerConn) (returnErr error) {
 	// Set a deadline after which SendBlocks will timeout. During IBD, esepcially,
@@ -206,6 +249,9 @@ func (cs *ConsensusSet) threadedReceiveBlocks(conn modules.PeerConn) (returnErr
 		if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
 			return err
 		}
+		if len(newBlocks) == 0 && moreAvailable {
+			return errPeerPruned
+		}
 
 		// Integrate the blocks into the consensus set.
 		for _, block := range newBlocks {
@@ -224,6 +270,9 @@ func (cs *ConsensusSet) threadedReceiveBlocks(conn modules.PeerConn) (returnErr
 				acceptErr = nil
 			}
 			if acceptErr != nil {
+				if !isBenignBlockErr(acceptErr) {
+					cs.gateway.Penalize(modules.NetAddress(conn.RemoteAddr().String()), "sent invalid block: "+acceptErr.Error())
+				}
 				return acceptErr
 			}
 		}
@@ -235,7 +284,8 @@ func (cs *ConsensusSet) threadedReceiveBlocks(conn modules.PeerConn) (returnErr
 // sequential set of blocks based on the 32 input block IDs. The most recent
 // known ID is used as the starting point, and up to 'MaxCatchUpBlocks' from
 // that BlockHeight onwards are returned. It also sends a boolean indicating
-// whether more blocks are available.
+// whether more blocks are available. A pruned node that cannot send the
+// blocks sends an empty set of blocks and indicates that more are available.
 func (cs *ConsensusSet) rpcSendBlocks(conn modules.PeerConn) error {
 	// Read a list of blocks known to the requester and find the most recent
 	// block from the current path.
@@ -247,31 +297,11 @@ func (cs *ConsensusSet) rpcSendBlocks(conn modules.PeerConn) error {
 
 	// Find the most recent block from knownBlocks in the current path.
 	found := false
-	var start types.BlockHeight
-	var csHeight types.BlockHeight
+	var start, pruned types.BlockHeight
 	cs.mu.RLock()
 	err = cs.db.View(func(tx *bolt.Tx) error {
-		csHeight = blockHeight(tx)
-		for _, id := range knownBlocks {
-			pb, err := getBlockMap(tx, id)
-			if err != nil {
-				continue
-			}
-			pathID, err := getPath(tx, pb.Height)
-			if err != nil {
-				continue
-			}
-			if pathID != pb.Block.ID() {
-				continue
-			}
-			if pb.Height == csHeight {
-				break
-			}
-			found = true
-			// Start from the child of the common block.
-			start = pb.Height + 1
-			break
-		}
+		start, found = findSyncStart(tx, knownBlocks)
+		pruned = prunedHeight(tx)
 		return nil
 	})
 	cs.mu.RUnlock()
@@ -279,6 +309,16 @@ func (cs *ConsensusSet) rpcSendBlocks(conn modules.PeerConn) error {
 		return err
 	}
 
+	// If the caller is missing blocks that have been pruned, advertise that
+	// this node is pruned by sending 0 blocks while indicating that more
+	// blocks are available.
+	if found && start < pruned {
+		if err := encoding.WriteObject(conn, []types.Block{}); err != nil {
+			return err
+		}
+		return encoding.WriteObject(conn, true)
+	}
+
 	// If no matching blocks are found, or if the caller has all known blocks,
 	// don't send any blocks.
 	if !found {
@@ -344,6 +384,9 @@ func (cs *ConsensusSet) rpcRelayBlock(conn modules.PeerConn) error {
 
 	// Submit the block to the consensus set and broadcast it.
 	err = cs.AcceptBlock(b)
+	if !isBenignBlockErr(err) {
+		cs.gateway.Penalize(modules.NetAddress(conn.RemoteAddr().String()), "relayed invalid block: "+err.Error())
+	}
 	if err == errOrphan {
 		// If the block is an orphan, try to find the parents. The block
 		// received from the peer is discarded and will be downloaded again if
@@ -387,6 +430,9 @@ func (cs *ConsensusSet) rpcRelayHeader(conn modules.PeerConn) error {
 		}()
 		return nil
 	} else if err != nil {
+		if !isBenignBlockErr(err) {
+			cs.gateway.Penalize(modules.NetAddress(conn.RemoteAddr().String()), "relayed invalid header: "+err.Error())
+		}
 		return err
 	}
 	// If the header is valid and extends the heaviest chain, fetch, accept it,
@@ -416,6 +462,9 @@ func (cs *ConsensusSet) rpcSendBlk(conn modules.PeerConn) error {
 		if err != nil {
 			return err
 		}
+		if blockPruned(tx, id, pb.Height) {
+			return errPrunedBlock
+		}
 		b = pb.Block
 		return nil
 	})
@@ -454,8 +503,10 @@ func (cs *ConsensusSet) threadedReceiveBlock(id types.BlockID) modules.RPCFunc {
 }
 
 // threadedInitialBlockchainDownload performs the IBD on outbound peers. Blocks
-// are downloaded from one peer at a time in 5 minute intervals, so as to
-// prevent any one peer from significantly slowing down IBD.
+// are first downloaded in parallel from the peers that support it. Then, to
+// confirm that the consensus set is synced, blocks are downloaded from one
+// peer at a time in 5 minute intervals, so as to prevent any one peer from
+// significantly slowing down IBD.
 //
 // NOTE: IBD will succeed right now when each peer has a different blockchain.
 // The height and the block id of the remote peers' current blocks are not
@@ -467,6 +518,21 @@ func (cs *ConsensusSet) threadedInitialBlockchainDownload() {
 	deadline := time.Now().Add(minIBDWaitTime)
 	numOutboundSynced := 0
 	for {
+		// Download as much of the blockchain as possible from the outbound
+		// peers that support parallel downloads.
+		var parallelPeers []modules.NetAddress
+		for _, p := range cs.gateway.Peers() {
+			if !p.Inbound && build.VersionCmp(p.Version, parallelDownloadVersion) >= 0 {
+				parallelPeers = append(parallelPeers, p.NetAddress)
+			}
+		}
+		if len(parallelPeers) > 0 {
+			err := cs.managedParallelDownload(parallelPeers)
+			if err != nil {
+				cs.log.Println("WARN: parallel block download failed:", err)
+			}
+		}
+
 		numOutboundSynced = 0
 		for _, p := range cs.gateway.Peers() {
 			// We only sync on outbound peers at first to make IBD less susceptible to
@@ -481,6 +547,11 @@ func (cs *ConsensusSet) threadedInitialBlockchainDownload() {
 				numOutboundSynced++
 				continue
 			}
+			// A pruned peer cannot help with IBD, but there is no reason to
+			// disconnect from it.
+			if err == errPeerPruned {
+				continue
+			}
 			// TODO: Timeout errors returned by muxado do not conform to the net.Error
 			// interface and therefore we cannot check if the error is a timeout using
 			// the Timeout() method. Once muxado issue #14 is resolved change the below
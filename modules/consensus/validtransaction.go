@@ -141,6 +141,19 @@ func validStorageProofs(tx *bolt.Tx, t types.Transaction) error {
 	return nil
 }
 
+// validCheckpointedStorageProofs checks that the storage proofs are for file
+// contracts whose proof windows are open, without verifying the proofs
+// themselves. It should only be used on blocks below a checkpoint.
+func validCheckpointedStorageProofs(tx *bolt.Tx, t types.Transaction) error {
+	for _, sp := range t.StorageProofs {
+		_, err := storageProofSegment(tx, sp.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // validFileContractRevision checks that each file contract revision is valid
 // in the context of the current consensus set.
 func validFileContractRevisions(tx *bolt.Tx, t types.Transaction) error {
@@ -249,6 +262,33 @@ func validTransaction(tx *bolt.Tx, t types.Transaction) error {
 	return nil
 }
 
+// validCheckpointedTransaction is a cheaper version of validTransaction for
+// blocks below a checkpoint. Signatures and storage proofs are not verified,
+// but every check that keeps the consensus set consistent is still performed.
+func validCheckpointedTransaction(tx *bolt.Tx, t types.Transaction) error {
+	err := t.StandaloneValidWithoutSignatures(blockHeight(tx))
+	if err != nil {
+		return err
+	}
+	err = validSiacoins(tx, t)
+	if err != nil {
+		return err
+	}
+	err = validCheckpointedStorageProofs(tx, t)
+	if err != nil {
+		return err
+	}
+	err = validFileContractRevisions(tx, t)
+	if err != nil {
+		return err
+	}
+	err = validSiafunds(tx, t)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // TryTransactionSet applies the input transactions to the consensus set to
 // determine if they are valid. An error is returned IFF they are not a valid
 // set in the current consensus set. The size of the transactions and the set
@@ -0,0 +1,363 @@
+package consensus
+
+// verify.go contains the offline tools for checking and repairing a consensus
+// database. VerifyDatabase runs the full set of consistency checks, which are
+// otherwise only run occasionally. RebuildDatabase discards every bucket that
+// is derived from the blocks, such as the block path and the unspent outputs,
+// and regenerates them by applying the stored blocks of the heaviest chain
+// from the genesis block.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// verifyProgressInterval is the number of blocks that are checked or
+	// applied between progress messages.
+	verifyProgressInterval = 5000
+)
+
+var (
+	errBrokenChain         = errors.New("stored blocks do not form a chain back to the genesis block")
+	errNoDatabase          = errors.New("no consensus database found")
+	errRebuildPruned       = errors.New("cannot rebuild a pruned consensus database")
+	errUninitializedDB     = errors.New("consensus database has not been initialized")
+	errVerificationFailure = errors.New("consensus database failed verification")
+)
+
+// openExistingDatabase opens the consensus database in persistDir, returning
+// an error instead of creating a new database if none exists.
+func openExistingDatabase(persistDir string) (*persist.BoltDatabase, error) {
+	filename := filepath.Join(persistDir, DatabaseFilename)
+	if _, err := os.Stat(filename); err != nil {
+		return nil, errNoDatabase
+	}
+	return persist.OpenDatabase(dbMetadata, filename)
+}
+
+// checkBuckets checks that all of the buckets of the consensus database
+// exist.
+func checkBuckets(tx *bolt.Tx) error {
+	buckets := [][]byte{
+		BlockHeight,
+		BlockMap,
+		BlockPath,
+		ChangeLog,
+		Consistency,
+		SiacoinOutputs,
+		FileContracts,
+		SiafundOutputs,
+		SiafundPool,
+	}
+	for _, bucket := range buckets {
+		if tx.Bucket(bucket) == nil {
+			return fmt.Errorf("bucket %s is missing", bucket)
+		}
+	}
+	return nil
+}
+
+// checkBlockPath checks that every block in the current path is in the block
+// map at the right height, that each block is the child of the previous
+// block, and that the diffs of every unpruned block have been generated.
+func checkBlockPath(tx *bolt.Tx, progress io.Writer) error {
+	height := blockHeight(tx)
+	horizon := prunedHeight(tx)
+	var parentID types.BlockID
+	for h := types.BlockHeight(0); h <= height; h++ {
+		id, err := getPath(tx, h)
+		if err != nil {
+			return fmt.Errorf("block path is missing height %v", h)
+		}
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return fmt.Errorf("block %v at height %v is not in the block map", id, h)
+		}
+		if pb.Height != h {
+			return fmt.Errorf("block %v is in the block path at height %v, but has height %v", id, h, pb.Height)
+		}
+		if h > 0 && pb.Block.ParentID != parentID {
+			return fmt.Errorf("block %v at height %v is not the child of the previous block", id, h)
+		}
+		if (h == 0 || h >= horizon) && !pb.DiffsGenerated {
+			return fmt.Errorf("block %v at height %v is in the block path without diffs", id, h)
+		}
+		parentID = id
+		if h > 0 && h%verifyProgressInterval == 0 {
+			fmt.Fprintf(progress, "Checked %v of %v blocks\n", h, height)
+		}
+	}
+	return nil
+}
+
+// VerifyDatabase runs the full set of consistency checks on the consensus
+// database in persistDir, writing progress to 'progress'. The database is not
+// modified. VerifyDatabase must not be called while a ConsensusSet is using
+// persistDir.
+func VerifyDatabase(persistDir string, progress io.Writer) error {
+	db, err := openExistingDatabase(persistDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(BlockMap) == nil {
+			return errUninitializedDB
+		}
+		// The remaining checks cannot be run without all of the buckets.
+		fmt.Fprintln(progress, "Checking buckets...")
+		if err := checkBuckets(tx); err != nil {
+			fmt.Fprintln(progress, "FAILED:", err)
+			return errVerificationFailure
+		}
+		if inconsistencyDetected(tx) {
+			fmt.Fprintln(progress, "Database has been marked as inconsistent.")
+		}
+		fmt.Fprintf(progress, "Verifying consensus database at height %v\n", blockHeight(tx))
+
+		failed := false
+		fmt.Fprintln(progress, "Checking block path...")
+		if err := checkBlockPath(tx, progress); err != nil {
+			fmt.Fprintln(progress, "FAILED:", err)
+			failed = true
+		}
+		for _, check := range consistencyChecks {
+			fmt.Fprintf(progress, "Checking %v...\n", check.name)
+			if err := check.fn(tx); err != nil {
+				fmt.Fprintln(progress, "FAILED:", err)
+				failed = true
+			}
+		}
+		if failed || inconsistencyDetected(tx) {
+			return errVerificationFailure
+		}
+		fmt.Fprintln(progress, "No inconsistencies found.")
+		return nil
+	})
+}
+
+// heaviestChain returns the ids of the blocks in the heaviest chain in the
+// block map, starting with the genesis block.
+func heaviestChain(tx *bolt.Tx) ([]types.BlockID, error) {
+	// Blocks only replace the current block if they are strictly heavier, so
+	// that the current block is kept when there is a tie.
+	var tip *processedBlock
+	var tipID types.BlockID
+	if tx.Bucket(BlockHeight) != nil && tx.Bucket(BlockPath) != nil {
+		if id, err := getPath(tx, blockHeight(tx)); err == nil {
+			if pb, err := getBlockMap(tx, id); err == nil {
+				tip, tipID = pb, id
+			}
+		}
+	}
+	err := tx.Bucket(BlockMap).ForEach(func(k, v []byte) error {
+		var pb processedBlock
+		if err := encoding.Unmarshal(v, &pb); err != nil {
+			return err
+		}
+		// A smaller depth is a heavier chain.
+		if tip == nil || pb.Depth.Cmp(tip.Depth) < 0 {
+			tip = &pb
+			copy(tipID[:], k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, errBrokenChain
+	}
+
+	chain := make([]types.BlockID, tip.Height+1)
+	chain[tip.Height] = tipID
+	for h := tip.Height; h > 0; h-- {
+		pb, err := getBlockMap(tx, chain[h])
+		if err != nil || pb.Height != h {
+			return nil, errBrokenChain
+		}
+		chain[h-1] = pb.Block.ParentID
+	}
+	if chain[0] != types.GenesisBlock.ID() {
+		return nil, errBrokenChain
+	}
+	return chain, nil
+}
+
+// changeLogAtTip returns true if the last entry of the changelog applies the
+// current block.
+func changeLogAtTip(tx *bolt.Tx) bool {
+	var tailID modules.ConsensusChangeID
+	copy(tailID[:], tx.Bucket(ChangeLog).Get(ChangeLogTailID))
+	entry, exists := getEntry(tx, tailID)
+	if !exists || len(entry.AppliedBlocks) == 0 {
+		return false
+	}
+	return entry.AppliedBlocks[len(entry.AppliedBlocks)-1] == currentBlockID(tx)
+}
+
+// rebuildDerivedBuckets deletes the block path and all of the buckets that
+// hold the consensus state, clears the diffs of every stored block, and then
+// regenerates the state by validating and applying each block in 'chain'. If
+// 'trusted' is set, signatures and storage proofs are not verified.
+func (cs *ConsensusSet) rebuildDerivedBuckets(tx *bolt.Tx, chain []types.BlockID, trusted bool, progress io.Writer) error {
+	var buckets [][]byte
+	err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		switch string(name) {
+		case string(BlockMap), string(ChangeLog), string(Forks), string(StaleBlocks), "Metadata":
+			return nil
+		}
+		buckets = append(buckets, append([]byte(nil), name...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range buckets {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+
+	// Clear the diffs of every block so that they are regenerated.
+	var ids [][]byte
+	err = tx.Bucket(BlockMap).ForEach(func(k, _ []byte) error {
+		ids = append(ids, append([]byte(nil), k...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range ids {
+		var id types.BlockID
+		copy(id[:], k)
+		pb, err := getBlockMap(tx, id)
+		if err != nil {
+			return err
+		}
+		*pb = processedBlock{
+			Block:       pb.Block,
+			Height:      pb.Height,
+			Depth:       pb.Depth,
+			ChildTarget: pb.ChildTarget,
+		}
+		if err := tx.Bucket(BlockMap).Put(k, encoding.Marshal(*pb)); err != nil {
+			return err
+		}
+	}
+
+	// Recreate the consensus state at the genesis block, and then apply the
+	// rest of the chain.
+	if err := cs.createConsensusDB(tx); err != nil {
+		return err
+	}
+	if err := tx.Bucket(Consistency).Put(Consistency, encoding.Marshal(false)); err != nil {
+		return err
+	}
+	height := types.BlockHeight(len(chain) - 1)
+	for h := types.BlockHeight(1); h <= height; h++ {
+		pb, err := getBlockMap(tx, chain[h])
+		if err != nil {
+			return err
+		}
+		if err := generateAndApplyDiff(tx, pb, trusted); err != nil {
+			return fmt.Errorf("block %v at height %v is invalid: %v", chain[h], h, err)
+		}
+		if h%verifyProgressInterval == 0 {
+			fmt.Fprintf(progress, "Applied %v of %v blocks\n", h, height)
+		}
+	}
+	return nil
+}
+
+// RebuildDatabase rebuilds the block path and the consensus state of the
+// consensus database in persistDir from the stored blocks, writing progress
+// to 'progress'. The heaviest chain of stored blocks becomes the current
+// path, and every block in it is validated again. If the current block
+// changes, the changelog is rebuilt to apply the new path, and subscribers
+// have to rescan the consensus set. The existing database is backed up first,
+// and the inconsistency flag is cleared if the rebuilt database passes the
+// consistency checks. RebuildDatabase must not be called while a
+// ConsensusSet is using persistDir.
+func RebuildDatabase(persistDir string, progress io.Writer) error {
+	filename := filepath.Join(persistDir, DatabaseFilename)
+	if _, err := os.Stat(filename); err != nil {
+		return errNoDatabase
+	}
+	os.Remove(filename + ".bck")
+	if err := copyFile(filename, filename+".bck"); err != nil {
+		return errors.New("error while backing up consensus database: " + err.Error())
+	}
+	fmt.Fprintln(progress, "Backed up consensus database to", filename+".bck")
+
+	db, err := openExistingDatabase(persistDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cs := &ConsensusSet{
+		blockRoot: newBlockRoot(),
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		// Only the block map, the changelog and the fork records are kept,
+		// as everything else is rebuilt.
+		if tx.Bucket(BlockMap) == nil || tx.Bucket(ChangeLog) == nil {
+			return errUninitializedDB
+		}
+		if bh := tx.Bucket(BlockHeight); bh != nil && bh.Get(PrunedHeight) != nil {
+			return errRebuildPruned
+		}
+		chain, err := heaviestChain(tx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(progress, "Rebuilding consensus database from %v blocks\n", len(chain))
+		if err := cs.rebuildDerivedBuckets(tx, chain, false, progress); err != nil {
+			return err
+		}
+		if err := checkBlockPath(tx, progress); err != nil {
+			return err
+		}
+		// Subscribers resume from the changelog, so it must end at the new
+		// current block. If the heaviest chain is not the path that the
+		// changelog led to, the changelog is replaced, and subscribers have
+		// to rescan.
+		if !changeLogAtTip(tx) {
+			fmt.Fprintln(progress, "Current block has changed, rebuilding the changelog")
+			if err := cs.rebuildChangeLog(tx); err != nil {
+				return err
+			}
+		}
+		for _, check := range consistencyChecks {
+			if err := check.fn(tx); err != nil {
+				return fmt.Errorf("rebuilt database failed the %v check: %v", check.name, err)
+			}
+		}
+		fmt.Fprintf(progress, "Rebuilt consensus database at height %v\n", blockHeight(tx))
+		return nil
+	})
+}
+
+// Inconsistent returns true if the consensus database has been marked as
+// inconsistent. A database is marked inconsistent when a consistency check
+// fails, and will not be loaded again until it has been rebuilt.
+func (cs *ConsensusSet) Inconsistent() (inconsistent bool) {
+	_ = cs.db.View(func(tx *bolt.Tx) error {
+		inconsistent = inconsistencyDetected(tx)
+		return nil
+	})
+	return inconsistent
+}
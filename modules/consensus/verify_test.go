@@ -0,0 +1,198 @@
+package consensus
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestIntegrationVerifyRebuild checks that VerifyDatabase detects a corrupted
+// consensus database, and that RebuildDatabase repairs it.
+func TestIntegrationVerifyRebuild(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationVerifyRebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	// Copy the blockchain into a second consensus set, which can be closed
+	// and reopened.
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationVerifyRebuild - copy")
+	persistDir := filepath.Join(testdir, modules.ConsensusDir)
+	if err := VerifyDatabase(persistDir, ioutil.Discard); err != errNoDatabase {
+		t.Fatal("expected errNoDatabase, got", err)
+	}
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cs, err := New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := types.BlockHeight(1); h <= cst.cs.Height(); h++ {
+		b, _ := cst.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cs.Inconsistent() {
+		t.Fatal("new consensus set is marked inconsistent")
+	}
+	currentID := cs.CurrentBlock().ID()
+	cs.Close()
+	if err := VerifyDatabase(persistDir, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the database by removing a siacoin output and the block path.
+	db, err := persist.OpenDatabase(dbMetadata, filepath.Join(persistDir, DatabaseFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(SiacoinOutputs).Cursor()
+		k, _ := c.First()
+		if err := c.Delete(); err != nil || k == nil {
+			t.Fatal("could not delete a siacoin output:", err)
+		}
+		markInconsistency(tx)
+		return tx.DeleteBucket(BlockPath)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDatabase(persistDir, ioutil.Discard); err != errVerificationFailure {
+		t.Fatal("expected errVerificationFailure, got", err)
+	}
+
+	// Rebuild the database and check that it can be used again.
+	if err := RebuildDatabase(persistDir, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDatabase(persistDir, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	cs, err = New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if cs.CurrentBlock().ID() != currentID {
+		t.Fatal("rebuilt database has the wrong current block")
+	}
+	if cs.Inconsistent() {
+		t.Fatal("rebuilt database is marked inconsistent")
+	}
+	b, err := cst.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.AcceptBlock(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIntegrationRebuildFork checks that RebuildDatabase rebuilds the
+// changelog when the heaviest chain of stored blocks is not the stored path,
+// so that subscribers receive the blocks of the new path.
+func TestIntegrationRebuildFork(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestIntegrationRebuildFork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cst.Close()
+
+	testdir := build.TempDir(modules.ConsensusDir, "TestIntegrationRebuildFork - copy")
+	persistDir := filepath.Join(testdir, modules.ConsensusDir)
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cs, err := New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := types.BlockHeight(1); h <= cst.cs.Height(); h++ {
+		b, _ := cst.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	height := cs.Height()
+	cs.Close()
+
+	// Store a sibling of the current block that is heavier than the current
+	// block, without changing the path or the changelog.
+	var forkID types.BlockID
+	var oldTail modules.ConsensusChangeID
+	db, err := persist.OpenDatabase(dbMetadata, filepath.Join(persistDir, DatabaseFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		copy(oldTail[:], tx.Bucket(ChangeLog).Get(ChangeLogTailID))
+		tip := currentProcessedBlock(tx)
+		fork := processedBlock{
+			Block:       tip.Block,
+			Height:      tip.Height,
+			Depth:       tip.childDepth(),
+			ChildTarget: tip.ChildTarget,
+		}
+		fork.Block.Timestamp++
+		forkID = fork.Block.ID()
+		return tx.Bucket(BlockMap).Put(forkID[:], encoding.Marshal(fork))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RebuildDatabase(persistDir, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	cs, err = New(g, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+	if cs.CurrentBlock().ID() != forkID {
+		t.Fatal("rebuilt database did not switch to the heavier fork")
+	}
+
+	// A subscriber should receive every block of the new path, ending with
+	// the fork, and the old tail of the changelog should no longer exist.
+	ms := newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	}
+	if types.BlockHeight(len(ms.updates)) != height+1 {
+		t.Fatal("subscriber received the wrong number of changes:", len(ms.updates))
+	}
+	last := ms.updates[len(ms.updates)-1]
+	if len(last.AppliedBlocks) != 1 || last.AppliedBlocks[0].ID() != forkID {
+		t.Fatal("last change does not apply the fork")
+	}
+	ms2 := newMockSubscriber()
+	if err := cs.ConsensusSetSubscribe(&ms2, oldTail); err != modules.ErrInvalidConsensusChangeID {
+		t.Fatal("expected ErrInvalidConsensusChangeID when resuming from the old tail, got", err)
+	}
+}
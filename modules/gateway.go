@@ -2,6 +2,8 @@ package modules
 
 import (
 	"net"
+
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
@@ -38,10 +40,40 @@ type (
 		NetAddress NetAddress `json:"netaddress"`
 		Version    string     `json:"version"`
 		Inbound    bool       `json:"inbound"`
+		Encrypted  bool       `json:"encrypted"`
+	}
+
+	// A BannedPeer is a host that the Gateway refuses to connect to or accept
+	// connections from. Peers are banned by host rather than by NetAddress,
+	// so that a banned peer cannot return by connecting from a different
+	// port. An Expiry of 0 indicates a ban that does not expire.
+	BannedPeer struct {
+		Host   string          `json:"host"`
+		Reason string          `json:"reason"`
+		Expiry types.Timestamp `json:"expiry"`
+	}
+
+	// A Node is an address on the network that the Gateway knows about, along
+	// with the Gateway's history of connecting to it. Source is the address of
+	// the peer that shared the node, or a description such as "bootstrap" if
+	// the node was not learned from a peer. LastSeen is the last time that the
+	// node was shared with the Gateway or connected to, and LastConnect is the
+	// last time that the Gateway successfully connected to the node. Failures
+	// is the number of consecutive failed attempts to connect to the node.
+	Node struct {
+		NetAddress  NetAddress      `json:"netaddress"`
+		Source      string          `json:"source"`
+		LastSeen    types.Timestamp `json:"lastseen"`
+		LastConnect types.Timestamp `json:"lastconnect"`
+		Failures    int             `json:"failures"`
 	}
 
 	// A PeerConn is the connection type used when communicating with peers during
-	// an RPC. For now it is identical to a net.Conn.
+	// an RPC. Each PeerConn is a logical stream multiplexed over the single
+	// long-lived connection that the Gateway keeps with each peer, so opening a
+	// PeerConn does not dial the peer, and RPCs can be called on peers that
+	// connected to the Gateway as well as on peers that the Gateway connected
+	// to.
 	PeerConn interface {
 		net.Conn
 	}
@@ -70,6 +102,26 @@ type (
 		// Peers returns the addresses that the Gateway is currently connected to.
 		Peers() []Peer
 
+		// Nodes returns the addresses that the Gateway knows about, along with
+		// the Gateway's history of connecting to each.
+		Nodes() []Node
+
+		// Penalize lowers the score of the peer at the given address, noting
+		// the reason. Peers whose score falls too low are disconnected and
+		// temporarily banned.
+		Penalize(NetAddress, string)
+
+		// Ban disconnects from the host of the given address and refuses all
+		// future connections to and from it until it is unbanned.
+		Ban(NetAddress) error
+
+		// Unban removes the host of the given address from the blocklist.
+		Unban(NetAddress) error
+
+		// Blocklist returns the hosts that the Gateway is currently refusing
+		// to connect to.
+		Blocklist() []BannedPeer
+
 		// RegisterRPC registers a function to handle incoming connections that
 		// supply the given RPC ID.
 		RegisterRPC(string, RPCFunc)
@@ -78,8 +130,9 @@ type (
 		// upon connecting to a peer.
 		RegisterConnectCall(string, RPCFunc)
 
-		// RPC calls an RPC on the given address. RPC cannot be called on an
-		// address that the Gateway is not connected to.
+		// RPC calls an RPC on the given address by opening a new stream on the
+		// existing connection to that peer. RPC cannot be called on an address
+		// that the Gateway is not connected to.
 		RPC(NetAddress, string, RPCFunc) error
 
 		// Broadcast transmits obj, prefaced by the RPC name, to all of the
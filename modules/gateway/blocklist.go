@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// initialPeerScore is the score that a host starts with the first time
+	// that it is penalized.
+	initialPeerScore = 100
+
+	// misbehaviorPenalty is the amount that a host's score is reduced by each
+	// time that it is penalized.
+	misbehaviorPenalty = 25
+
+	// banThreshold is the score at or below which a host is banned.
+	banThreshold = 0
+)
+
+var (
+	// banDuration is the amount of time that a host is banned for after its
+	// score has fallen to banThreshold.
+	banDuration = func() time.Duration {
+		switch build.Release {
+		case "dev":
+			return 10 * time.Minute
+		case "standard":
+			return 24 * time.Hour
+		case "testing":
+			return 3 * time.Second
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+
+	errBannedPeer = errors.New("peer is banned")
+	errNotBanned  = errors.New("peer is not banned")
+)
+
+// banKey returns the key under which addr is scored and banned. Peers are
+// tracked by host instead of by full address because the port of an inbound
+// connection is chosen by the remote peer.
+func banKey(addr modules.NetAddress) string {
+	if host := addr.Host(); host != "" {
+		return host
+	}
+	return string(addr)
+}
+
+// isBanned returns true if the host of addr is on the blocklist and its ban
+// has not yet expired.
+func (g *Gateway) isBanned(addr modules.NetAddress) bool {
+	bp, exists := g.blocklist[banKey(addr)]
+	if !exists {
+		return false
+	}
+	return bp.Expiry == 0 || bp.Expiry > types.CurrentTimestamp()
+}
+
+// pruneBlocklist removes all expired bans from the blocklist.
+func (g *Gateway) pruneBlocklist() {
+	now := types.CurrentTimestamp()
+	for host, bp := range g.blocklist {
+		if bp.Expiry != 0 && bp.Expiry <= now {
+			delete(g.blocklist, host)
+		}
+	}
+}
+
+// banHost adds a host to the blocklist and returns the addresses of all
+// connected peers that share the host. The caller is responsible for
+// disconnecting from the returned peers once the lock has been released.
+func (g *Gateway) banHost(host string, reason string, expiry types.Timestamp) (kick []modules.NetAddress) {
+	g.blocklist[host] = modules.BannedPeer{
+		Host:   host,
+		Reason: reason,
+		Expiry: expiry,
+	}
+	delete(g.scores, host)
+	for addr := range g.peers {
+		if banKey(addr) == host {
+			kick = append(kick, addr)
+		}
+	}
+	return kick
+}
+
+// kickPeers disconnects from each of the given peers. It must not be called
+// while holding the lock.
+func (g *Gateway) kickPeers(addrs []modules.NetAddress) {
+	for _, addr := range addrs {
+		if err := g.Disconnect(addr); err != nil {
+			g.log.Printf("WARN: could not disconnect from banned peer %v: %v", addr, err)
+		}
+	}
+}
+
+// Penalize lowers the score of the host of addr. Once the score of a host
+// falls to banThreshold, the host is disconnected and banned for
+// banDuration. Modules should penalize peers that relay data which no honest
+// peer would relay, such as blocks with invalid proof of work or transaction
+// sets that cannot be decoded.
+func (g *Gateway) Penalize(addr modules.NetAddress, reason string) {
+	host := banKey(addr)
+	id := g.mu.Lock()
+	score, exists := g.scores[host]
+	if !exists {
+		score = initialPeerScore
+	}
+	score -= misbehaviorPenalty
+	g.log.Printf("INFO: penalized peer %v (score %v): %v", addr, score, reason)
+	if score > banThreshold {
+		g.scores[host] = score
+		g.mu.Unlock(id)
+		return
+	}
+	kick := g.banHost(host, reason, types.CurrentTimestamp()+types.Timestamp(banDuration.Seconds()))
+	if err := g.saveBlocklist(); err != nil {
+		g.log.Println("WARN: could not save blocklist:", err)
+	}
+	g.mu.Unlock(id)
+
+	g.log.Printf("INFO: banned %v for %v: %v", host, banDuration, reason)
+	g.kickPeers(kick)
+}
+
+// Ban disconnects from the host of addr and adds it to the blocklist. Bans
+// made through Ban do not expire.
+func (g *Gateway) Ban(addr modules.NetAddress) error {
+	host := banKey(addr)
+	if host == "" {
+		return errors.New("can't ban empty address")
+	}
+	id := g.mu.Lock()
+	kick := g.banHost(host, "banned by user", 0)
+	err := g.saveBlocklist()
+	g.mu.Unlock(id)
+	if err != nil {
+		return err
+	}
+
+	g.log.Println("INFO: banned", host)
+	g.kickPeers(kick)
+	return nil
+}
+
+// Unban removes the host of addr from the blocklist.
+func (g *Gateway) Unban(addr modules.NetAddress) error {
+	host := banKey(addr)
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+	if _, exists := g.blocklist[host]; !exists {
+		return errNotBanned
+	}
+	delete(g.blocklist, host)
+	g.log.Println("INFO: unbanned", host)
+	return g.saveBlocklist()
+}
+
+// Blocklist returns the hosts that are currently banned.
+func (g *Gateway) Blocklist() []modules.BannedPeer {
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+	g.pruneBlocklist()
+	var bps []modules.BannedPeer
+	for _, bp := range g.blocklist {
+		bps = append(bps, bp)
+	}
+	return bps
+}
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPenalize tests that a peer is disconnected and banned once it has been
+// penalized enough times, and that the ban expires.
+func TestPenalize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g1 := newTestingGateway("TestPenalize1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestPenalize2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Penalize g2 until just before the ban threshold.
+	for i := 0; i < (initialPeerScore-banThreshold)/misbehaviorPenalty-1; i++ {
+		g1.Penalize(g2.Address(), "test")
+	}
+	if len(g1.Peers()) != 1 {
+		t.Fatal("peer was disconnected before reaching the ban threshold")
+	}
+	if len(g1.Blocklist()) != 0 {
+		t.Fatal("peer was banned before reaching the ban threshold")
+	}
+
+	// One more penalty should result in a ban.
+	g1.Penalize(g2.Address(), "test")
+	if len(g1.Peers()) != 0 {
+		t.Fatal("banned peer was not disconnected")
+	}
+	bl := g1.Blocklist()
+	if len(bl) != 1 || bl[0].Host != g2.Address().Host() || bl[0].Expiry == 0 {
+		t.Fatal("blocklist is incorrect:", bl)
+	}
+	if err := g1.Connect(g2.Address()); err != errBannedPeer {
+		t.Fatal("expected errBannedPeer, got", err)
+	}
+	time.Sleep(100 * time.Millisecond) // wait for g2 to notice the disconnect
+	if err := g2.Connect(g1.Address()); err != errPeerRejectedConn {
+		t.Fatal("expected errPeerRejectedConn, got", err)
+	}
+
+	// Wait for the ban to expire.
+	time.Sleep(banDuration + time.Second)
+	if len(g1.Blocklist()) != 0 {
+		t.Fatal("ban did not expire")
+	}
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBanUnban tests that manually banned hosts are refused until they are
+// unbanned, and that the blocklist persists across restarts.
+func TestBanUnban(t *testing.T) {
+	g1 := newTestingGateway("TestBanUnban1", t)
+	g2 := newTestingGateway("TestBanUnban2", t)
+	defer g2.Close()
+
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g1.Ban(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Peers()) != 0 {
+		t.Fatal("banned peer was not disconnected")
+	}
+	if err := g1.Connect(g2.Address()); err != errBannedPeer {
+		t.Fatal("expected errBannedPeer, got", err)
+	}
+
+	// Restart g1 and check that the ban is still in place.
+	g1.Close()
+	g1, err := New("localhost:0", g1.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g1.Close()
+	bl := g1.Blocklist()
+	if len(bl) != 1 || bl[0].Host != g2.Address().Host() || bl[0].Expiry != 0 {
+		t.Fatal("blocklist was not persisted:", bl)
+	}
+
+	if err := g1.Unban(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g1.Unban(g2.Address()); err != errNotBanned {
+		t.Fatal("expected errNotBanned, got", err)
+	}
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
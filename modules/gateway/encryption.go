@@ -0,0 +1,77 @@
+package gateway
+
+// encryption.go decides whether a peer connection is encrypted after the
+// version handshake. Gateway peers do not have long-term identities, so the
+// key exchange protects against eavesdropping and tampering, but does not
+// prove who the remote peer is. The version strings that the peers exchanged
+// are bound into the key exchange, so an attacker that rewrites them causes
+// the key exchange to fail. An attacker can still make a peer appear to be
+// running a version that predates encryption; gateways that require
+// encryption refuse such peers.
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+const (
+	// encryptionUpgradeVersion is the first version that supports encrypted
+	// peer connections. Connections to peers running an older version are
+	// not encrypted.
+	encryptionUpgradeVersion = "0.6.1"
+)
+
+var (
+	// handshakeTimeout is the amount of time that a peer has to complete the
+	// key exchange.
+	handshakeTimeout = func() time.Duration {
+		switch build.Release {
+		case "dev":
+			return 30 * time.Second
+		case "standard":
+			return 1 * time.Minute
+		case "testing":
+			return 5 * time.Second
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+
+	errPlaintextPeer = errors.New("peer does not support encrypted connections")
+)
+
+// supportsEncryption returns true if a peer running the given version
+// supports encrypted connections.
+func supportsEncryption(version string) bool {
+	return build.VersionCmp(version, encryptionUpgradeVersion) >= 0
+}
+
+// upgradeConn encrypts conn if the remote peer's version supports encrypted
+// connections. initiatorVersion and responderVersion are the versions that
+// the peers exchanged during the version handshake. The returned bool
+// indicates whether the connection was encrypted. The key exchange must
+// complete within handshakeTimeout.
+func upgradeConn(conn net.Conn, initiatorVersion, responderVersion string, initiator bool) (net.Conn, bool, error) {
+	remoteVersion := responderVersion
+	if !initiator {
+		remoteVersion = initiatorVersion
+	}
+	if !supportsEncryption(remoteVersion) {
+		return conn, false, nil
+	}
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, false, err
+	}
+	ec, _, err := crypto.EncryptConn(conn, initiator, initiatorVersion, responderVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, false, err
+	}
+	return ec, true, nil
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestConnectEncrypted tests that two gateways encrypt the connection between
+// them.
+func TestConnectEncrypted(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g1 := newTestingGateway("TestConnectEncrypted1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestConnectEncrypted2", t)
+	defer g2.Close()
+
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	peers := g1.Peers()
+	if len(peers) != 1 || !peers[0].Encrypted {
+		t.Fatal("connection was not encrypted:", peers)
+	}
+
+	// Check that RPCs work over the encrypted connection.
+	g2.RegisterRPC("Foo", func(conn modules.PeerConn) error {
+		return encoding.WriteObject(conn, "bar")
+	})
+	var resp string
+	err := g1.RPC(g2.Address(), "Foo", func(conn modules.PeerConn) error {
+		return encoding.ReadObject(conn, &resp, 100)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "bar" {
+		t.Fatal("RPC returned wrong response:", resp)
+	}
+}
+
+// TestRequireEncryption tests that a gateway that requires encryption refuses
+// inbound and outbound connections with peers that do not support it.
+func TestRequireEncryption(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g, err := NewWithSettings("localhost:0", build.TempDir("gateway", "TestRequireEncryption"), Settings{
+		RequireEncryption: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// An inbound peer that does not support encryption should be rejected.
+	conn, err := net.Dial("tcp", string(g.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := encoding.WriteObject(conn, "0.6.0"); err != nil {
+		t.Fatal(err)
+	}
+	var ack string
+	if err := encoding.ReadObject(conn, &ack, maxAddrLength); err != nil {
+		t.Fatal(err)
+	}
+	if ack != "reject" {
+		t.Fatal("gateway accepted a peer that does not support encryption")
+	}
+
+	// An outbound peer that does not support encryption should be refused.
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var remoteVersion string
+		encoding.ReadObject(conn, &remoteVersion, maxAddrLength)
+		encoding.WriteObject(conn, "0.6.0")
+	}()
+	if err := g.Connect(modules.NetAddress(listener.Addr().String())); err != errPlaintextPeer {
+		t.Fatal("expected errPlaintextPeer, got", err)
+	}
+
+	// Peers that support encryption are still accepted.
+	g2 := newTestingGateway("TestRequireEncryption2", t)
+	defer g2.Close()
+	if err := g2.Connect(g.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
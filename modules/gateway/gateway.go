@@ -33,8 +33,22 @@ type Gateway struct {
 	peers map[modules.NetAddress]*peer
 
 	// nodes is the set of all known nodes (i.e. potential peers) on the
-	// network.
-	nodes map[modules.NetAddress]struct{}
+	// network, along with the gateway's history of connecting to each.
+	nodes map[modules.NetAddress]*modules.Node
+
+	// scores tracks the misbehavior of hosts that have been penalized, and
+	// blocklist contains the hosts that have been banned. Both are keyed by
+	// host rather than by NetAddress.
+	scores    map[string]int
+	blocklist map[string]modules.BannedPeer
+
+	// bootstrapPeers, private, whitelist and requireEncryption hold the
+	// network settings that the Gateway was created with. whitelist is keyed
+	// by host.
+	bootstrapPeers    []modules.NetAddress
+	private           bool
+	whitelist         map[string]struct{}
+	requireEncryption bool
 
 	// closeChan is used to shut down the Gateway's goroutines.
 	closeChan chan struct{}
@@ -45,6 +59,32 @@ type Gateway struct {
 	mu  *sync.RWMutex
 }
 
+// Settings control how a Gateway discovers and accepts peers. The zero value
+// gives the default behavior of joining the public Sia network.
+type Settings struct {
+	// BootstrapPeers replaces modules.BootstrapPeers as the set of nodes that
+	// are added to the node list on startup. Unlike the default bootstrap
+	// peers, custom bootstrap peers are added in every build.
+	BootstrapPeers []modules.NetAddress
+
+	// Private disables node discovery. A private Gateway does not request,
+	// share, or relay node addresses, and does not advertise its own address,
+	// so it only ever connects to its bootstrap peers and the peers that
+	// connect to it. The default bootstrap peers are not used, and the node
+	// list saved by a previous run is neither loaded nor overwritten.
+	Private bool
+
+	// Whitelist, if non-empty, is the set of hosts that are allowed to form
+	// inbound connections with the Gateway. Outbound connections are not
+	// restricted.
+	Whitelist []string
+
+	// RequireEncryption refuses connections to and from peers that do not
+	// support encrypted connections, so that an attacker cannot force a
+	// connection to fall back to plaintext.
+	RequireEncryption bool
+}
+
 // Address returns the NetAddress of the Gateway.
 func (g *Gateway) Address() modules.NetAddress {
 	id := g.mu.RLock()
@@ -93,7 +133,13 @@ func (g *Gateway) Close() error {
 }
 
 // New returns an initialized Gateway.
-func New(addr string, persistDir string) (g *Gateway, err error) {
+func New(addr string, persistDir string) (*Gateway, error) {
+	return NewWithSettings(addr, persistDir, Settings{})
+}
+
+// NewWithSettings returns an initialized Gateway that uses the provided
+// network settings.
+func NewWithSettings(addr string, persistDir string, settings Settings) (g *Gateway, err error) {
 	// Create the directory if it doesn't exist.
 	err = os.MkdirAll(persistDir, 0700)
 	if err != nil {
@@ -104,10 +150,20 @@ func New(addr string, persistDir string) (g *Gateway, err error) {
 		handlers:   make(map[rpcID]modules.RPCFunc),
 		initRPCs:   make(map[string]modules.RPCFunc),
 		peers:      make(map[modules.NetAddress]*peer),
-		nodes:      make(map[modules.NetAddress]struct{}),
+		nodes:      make(map[modules.NetAddress]*modules.Node),
+		scores:     make(map[string]int),
+		blocklist:  make(map[string]modules.BannedPeer),
 		closeChan:  make(chan struct{}),
 		persistDir: persistDir,
 		mu:         sync.New(modules.SafeMutexDelay, 2),
+
+		bootstrapPeers:    settings.BootstrapPeers,
+		private:           settings.Private,
+		whitelist:         make(map[string]struct{}),
+		requireEncryption: settings.RequireEncryption,
+	}
+	for _, host := range settings.Whitelist {
+		g.whitelist[host] = struct{}{}
 	}
 
 	// Create the logger.
@@ -116,25 +172,38 @@ func New(addr string, persistDir string) (g *Gateway, err error) {
 		return nil, err
 	}
 
-	// Register RPCs.
-	g.RegisterRPC("ShareNodes", g.shareNodes)
-	g.RegisterRPC("RelayNode", g.relayNode)
-	g.RegisterConnectCall("ShareNodes", g.requestNodes)
+	// Register RPCs. Private gateways do not take part in node discovery.
+	if !g.private {
+		g.RegisterRPC("ShareNodes", g.shareNodes)
+		g.RegisterRPC("RelayNode", g.relayNode)
+		g.RegisterConnectCall("ShareNodes", g.requestNodes)
+	}
 
 	// Load the old node list. If it doesn't exist, no problem, but if it does,
-	// we want to know about any errors preventing us from loading it.
-	if loadErr := g.load(); loadErr != nil && !os.IsNotExist(loadErr) {
+	// we want to know about any errors preventing us from loading it. Private
+	// gateways ignore the old node list, which may contain public nodes.
+	if !g.private {
+		if loadErr := g.load(); loadErr != nil && !os.IsNotExist(loadErr) {
+			return nil, loadErr
+		}
+	}
+
+	// Load the blocklist.
+	if loadErr := g.loadBlocklist(); loadErr != nil && !os.IsNotExist(loadErr) {
 		return nil, loadErr
 	}
 
 	// Add the bootstrap peers to the node list.
-	if build.Release == "standard" {
-		for _, addr := range modules.BootstrapPeers {
-			err := g.addNode(addr)
-			if err != nil {
-				g.log.Printf("WARN: failed to add the bootstrap node '%v': %v", addr, err)
-			}
+	if len(g.bootstrapPeers) == 0 && !g.private && build.Release == "standard" {
+		g.bootstrapPeers = modules.BootstrapPeers
+	}
+	for _, addr := range g.bootstrapPeers {
+		err := g.addNode(addr, nodeSourceBootstrap)
+		if err != nil && err != errNodeExists {
+			g.log.Printf("WARN: failed to add the bootstrap node '%v': %v", addr, err)
 		}
+	}
+	if len(g.bootstrapPeers) > 0 {
 		g.save()
 	}
 
@@ -86,3 +86,62 @@ func TestNew(t *testing.T) {
 		t.Fatal("expected load error, got nil")
 	}
 }
+
+// TestNewWithSettingsPrivate tests that a private Gateway adds its custom
+// bootstrap peers to the node list and does not take part in node discovery.
+func TestNewWithSettingsPrivate(t *testing.T) {
+	bootstrap := modules.NetAddress("127.0.0.1:9981")
+	g, err := NewWithSettings("localhost:0", build.TempDir("gateway", "TestNewWithSettingsPrivate"), Settings{
+		BootstrapPeers: []modules.NetAddress{bootstrap},
+		Private:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	nodes := g.Nodes()
+	if len(nodes) != 1 || nodes[0].NetAddress != bootstrap || nodes[0].Source != nodeSourceBootstrap {
+		t.Fatal("bootstrap peer was not added to the node list:", nodes)
+	}
+	for _, name := range []string{"ShareNodes", "RelayNode"} {
+		if _, exists := g.handlers[handlerName(name)]; exists {
+			t.Fatal("private gateway registered the", name, "RPC")
+		}
+	}
+	if len(g.initRPCs) != 0 {
+		t.Fatal("private gateway registered connect calls:", g.initRPCs)
+	}
+}
+
+// TestWhitelist tests that a Gateway with a whitelist only accepts inbound
+// connections from whitelisted hosts.
+func TestWhitelist(t *testing.T) {
+	g1, err := NewWithSettings("localhost:0", build.TempDir("gateway", "TestWhitelist1"), Settings{
+		Whitelist: []string{"10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g1.Close()
+	g2, err := NewWithSettings("localhost:0", build.TempDir("gateway", "TestWhitelist2"), Settings{
+		Whitelist: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	g3 := newTestingGateway("TestWhitelist3", t)
+	defer g3.Close()
+
+	if err := g3.Connect(g1.Address()); err != errPeerRejectedConn {
+		t.Fatal("expected errPeerRejectedConn, got", err)
+	}
+	if err := g3.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	// The whitelist does not restrict outbound connections.
+	if err := g1.Connect(g3.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
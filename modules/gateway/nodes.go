@@ -8,24 +8,61 @@ import (
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
 	maxSharedNodes = 10
 	maxAddrLength  = 100
 	minPeers       = 3
+
+	// maxNodeListLen is the maximum number of nodes that the gateway will
+	// keep in its node list.
+	maxNodeListLen = 1000
+
+	// maxNodeFailures is the number of consecutive failed connection attempts
+	// after which a node is removed from the node list.
+	maxNodeFailures = 3
+)
+
+// The following strings are used as the Source of nodes that were not
+// learned from a peer. Nodes learned from a peer use the address of that peer
+// as their Source.
+const (
+	nodeSourceBootstrap = "bootstrap"
+	nodeSourceOutbound  = "outbound"
+)
+
+var (
+	errNodeExists   = errors.New("node already added")
+	errNodeListFull = errors.New("node list is full of reliable nodes")
 )
 
-// addNode adds an address to the set of nodes on the network.
-func (g *Gateway) addNode(addr modules.NetAddress) error {
-	if _, exists := g.nodes[addr]; exists {
-		return errors.New("node already added")
+// addNode adds an address to the set of nodes on the network. source
+// describes where the address was learned from. If the node is already
+// known, its LastSeen time is refreshed and errNodeExists is returned. If the
+// node list is full, the least reliable node is evicted to make room.
+func (g *Gateway) addNode(addr modules.NetAddress, source string) error {
+	if n, exists := g.nodes[addr]; exists {
+		n.LastSeen = types.CurrentTimestamp()
+		return errNodeExists
 	} else if net.ParseIP(addr.Host()) == nil {
 		return errors.New("address is not routable: " + string(addr))
 	} else if addr.IsValid() != nil {
 		return errors.New("address is not valid: " + string(addr))
 	}
-	g.nodes[addr] = struct{}{}
+	if len(g.nodes) >= maxNodeListLen {
+		evict, err := g.leastReliableNode()
+		if err != nil {
+			return err
+		}
+		delete(g.nodes, evict)
+	}
+	g.nodes[addr] = &modules.Node{
+		NetAddress: addr,
+		Source:     source,
+		LastSeen:   types.CurrentTimestamp(),
+	}
 	return nil
 }
 
@@ -38,6 +75,78 @@ func (g *Gateway) removeNode(addr modules.NetAddress) error {
 	return nil
 }
 
+// isReliable returns true if the gateway has connected to the node before,
+// and the most recent attempt to connect to the node did not fail.
+func isReliable(n *modules.Node) bool {
+	return n.LastConnect != 0 && n.Failures == 0
+}
+
+// leastReliableNode returns the node that should be evicted first when the
+// node list is full. Nodes that have never been connected to are evicted
+// before nodes that have, nodes with more failures are evicted first, and
+// ties are broken by evicting the node that was seen least recently.
+// Reliable nodes are never evicted.
+func (g *Gateway) leastReliableNode() (modules.NetAddress, error) {
+	var worst *modules.Node
+	for _, n := range g.nodes {
+		if isReliable(n) {
+			continue
+		}
+		if worst == nil {
+			worst = n
+			continue
+		}
+		nTried, worstTried := n.LastConnect != 0, worst.LastConnect != 0
+		switch {
+		case nTried != worstTried:
+			if !nTried {
+				worst = n
+			}
+		case n.Failures != worst.Failures:
+			if n.Failures > worst.Failures {
+				worst = n
+			}
+		case n.LastSeen < worst.LastSeen:
+			worst = n
+		}
+	}
+	if worst == nil {
+		return "", errNodeListFull
+	}
+	return worst.NetAddress, nil
+}
+
+// recordNodeSuccess notes that the gateway successfully connected to addr.
+// Nodes that are not in the node list are added.
+func (g *Gateway) recordNodeSuccess(addr modules.NetAddress) {
+	n, exists := g.nodes[addr]
+	if !exists {
+		if g.addNode(addr, nodeSourceOutbound) != nil {
+			return
+		}
+		n = g.nodes[addr]
+	}
+	now := types.CurrentTimestamp()
+	n.LastSeen = now
+	n.LastConnect = now
+	n.Failures = 0
+}
+
+// recordNodeFailure notes that the gateway failed to connect to addr. Nodes
+// that have failed maxNodeFailures times in a row are removed from the node
+// list.
+func (g *Gateway) recordNodeFailure(addr modules.NetAddress) {
+	n, exists := g.nodes[addr]
+	if !exists {
+		return
+	}
+	n.Failures++
+	if n.Failures >= maxNodeFailures {
+		g.removeNode(addr)
+	}
+}
+
+// randomNode returns a random node from the gateway's node list.
 func (g *Gateway) randomNode() (modules.NetAddress, error) {
 	if len(g.nodes) > 0 {
 		r, _ := crypto.RandIntn(len(g.nodes))
@@ -52,6 +161,40 @@ func (g *Gateway) randomNode() (modules.NetAddress, error) {
 	return "", errNoPeers
 }
 
+// randomOutboundNode returns a random node to form an outbound connection
+// with. Half of the time, the node is chosen from the nodes that the gateway
+// has reliably connected to in the past, so that a node list polluted with
+// bad addresses does not prevent the gateway from finding peers. The other
+// half of the time, any node may be chosen, so that new nodes are still
+// tried.
+func (g *Gateway) randomOutboundNode() (modules.NetAddress, error) {
+	if r, _ := crypto.RandIntn(2); r == 0 {
+		var reliable []modules.NetAddress
+		for addr, n := range g.nodes {
+			if isReliable(n) {
+				reliable = append(reliable, addr)
+			}
+		}
+		if len(reliable) > 0 {
+			r, _ := crypto.RandIntn(len(reliable))
+			return reliable[r], nil
+		}
+	}
+	return g.randomNode()
+}
+
+// Nodes returns the gateway's node list, along with the connection history
+// of each node.
+func (g *Gateway) Nodes() []modules.Node {
+	id := g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	var nodes []modules.Node
+	for _, n := range g.nodes {
+		nodes = append(nodes, *n)
+	}
+	return nodes
+}
+
 // shareNodes is the receiving end of the ShareNodes RPC. It writes up to 10
 // randomly selected nodes to the caller.
 func (g *Gateway) shareNodes(conn modules.PeerConn) error {
@@ -75,8 +218,8 @@ func (g *Gateway) requestNodes(conn modules.PeerConn) error {
 	}
 	id := g.mu.Lock()
 	for _, node := range nodes {
-		err := g.addNode(node)
-		if err != nil {
+		err := g.addNode(node, conn.RemoteAddr().String())
+		if err != nil && err != errNodeExists {
 			g.log.Printf("WARN: peer '%v' send the invalid addr '%v'", conn.RemoteAddr(), node)
 		}
 	}
@@ -100,7 +243,7 @@ func (g *Gateway) relayNode(conn modules.PeerConn) error {
 		// avoid managing locks across branching.
 		id := g.mu.Lock()
 		defer g.mu.Unlock(id)
-		if err := g.addNode(addr); err != nil {
+		if err := g.addNode(addr, conn.RemoteAddr().String()); err != nil {
 			return err
 		}
 		if err := g.save(); err != nil {
@@ -129,7 +272,8 @@ func (g *Gateway) sendAddress(conn modules.PeerConn) error {
 // threadedNodeManager tries to keep the Gateway's node list healthy. As long
 // as the Gateway has fewer than minNodeListSize nodes, it asks a random peer
 // for more nodes. It also continually pings nodes in order to establish their
-// connectivity. Unresponsive nodes are aggressively removed.
+// connectivity. Nodes that are unresponsive maxNodeFailures times in a row are
+// removed.
 func (g *Gateway) threadedNodeManager() {
 	for {
 		select {
@@ -147,7 +291,7 @@ func (g *Gateway) threadedNodeManager() {
 			continue
 		}
 
-		if numNodes < minNodeListLen {
+		if numNodes < minNodeListLen && !g.private {
 			g.RPC(peer, "ShareNodes", g.requestNodes)
 		}
 
@@ -163,7 +307,7 @@ func (g *Gateway) threadedNodeManager() {
 		conn, err := net.DialTimeout("tcp", string(node), dialTimeout)
 		if err != nil {
 			id = g.mu.Lock()
-			g.removeNode(node)
+			g.recordNodeFailure(node)
 			g.save()
 			g.mu.Unlock(id)
 			continue
@@ -172,6 +316,10 @@ func (g *Gateway) threadedNodeManager() {
 		// they won't try to add us as a peer
 		encoding.WriteObject(conn, "0.0.0")
 		conn.Close()
+		id = g.mu.Lock()
+		g.recordNodeSuccess(node)
+		g.save()
+		g.mu.Unlock(id)
 		// sleep for an extra 10 minutes after success; we don't want to spam
 		// connectable nodes
 		select {
@@ -16,19 +16,19 @@ func TestAddNode(t *testing.T) {
 	defer g.Close()
 	id := g.mu.Lock()
 	defer g.mu.Unlock(id)
-	if err := g.addNode(dummyNode); err != nil {
+	if err := g.addNode(dummyNode, ""); err != nil {
 		t.Fatal("addNode failed:", err)
 	}
-	if err := g.addNode(dummyNode); err == nil {
+	if err := g.addNode(dummyNode, ""); err == nil {
 		t.Error("addNode added duplicate node")
 	}
-	if err := g.addNode("foo"); err == nil {
+	if err := g.addNode("foo", ""); err == nil {
 		t.Error("addNode added unroutable address")
 	}
-	if err := g.addNode("foo:9981"); err == nil {
+	if err := g.addNode("foo:9981", ""); err == nil {
 		t.Error("addNode added a non-IP address")
 	}
-	if err := g.addNode("[::]:9981"); err == nil {
+	if err := g.addNode("[::]:9981", ""); err == nil {
 		t.Error("addNode added unspecified address")
 	}
 }
@@ -38,7 +38,7 @@ func TestRemoveNode(t *testing.T) {
 	defer g.Close()
 	id := g.mu.Lock()
 	defer g.mu.Unlock(id)
-	if err := g.addNode(dummyNode); err != nil {
+	if err := g.addNode(dummyNode, ""); err != nil {
 		t.Fatal("addNode failed:", err)
 	}
 	if err := g.removeNode(dummyNode); err != nil {
@@ -63,7 +63,7 @@ func TestRandomNode(t *testing.T) {
 
 	// Test with 1 node.
 	id = g.mu.Lock()
-	if err = g.addNode(dummyNode); err != nil {
+	if err = g.addNode(dummyNode, ""); err != nil {
 		t.Fatal(err)
 	}
 	g.mu.Unlock(id)
@@ -98,7 +98,7 @@ func TestRandomNode(t *testing.T) {
 	}
 	id = g.mu.Lock()
 	for addr := range nodes {
-		err := g.addNode(addr)
+		err := g.addNode(addr, "")
 		if err != nil {
 			t.Error(err)
 		}
@@ -132,7 +132,7 @@ func TestShareNodes(t *testing.T) {
 
 	// add a node to g2
 	id := g2.mu.Lock()
-	err := g2.addNode(dummyNode)
+	err := g2.addNode(dummyNode, "")
 	g2.mu.Unlock(id)
 	if err != nil {
 		t.Fatal(err)
@@ -147,7 +147,7 @@ func TestShareNodes(t *testing.T) {
 	// g1 should have received the node
 	time.Sleep(100 * time.Millisecond)
 	id = g1.mu.Lock()
-	err = g1.addNode(dummyNode)
+	err = g1.addNode(dummyNode, "")
 	g1.mu.Unlock(id)
 	if err == nil {
 		t.Fatal("gateway did not receive nodes during Connect:", g1.nodes)
@@ -155,10 +155,10 @@ func TestShareNodes(t *testing.T) {
 
 	// remove all nodes from both peers
 	id = g1.mu.Lock()
-	g1.nodes = map[modules.NetAddress]struct{}{}
+	g1.nodes = make(map[modules.NetAddress]*modules.Node)
 	g1.mu.Unlock(id)
 	id = g2.mu.Lock()
-	g2.nodes = map[modules.NetAddress]struct{}{}
+	g2.nodes = make(map[modules.NetAddress]*modules.Node)
 	g2.mu.Unlock(id)
 
 	// SharePeers should now return no peers
@@ -176,7 +176,7 @@ func TestShareNodes(t *testing.T) {
 	// sharing should be capped at maxSharedNodes
 	for i := 1; i < maxSharedNodes+11; i++ {
 		id := g2.mu.Lock()
-		err := g2.addNode(modules.NetAddress("111.111.111.111:" + strconv.Itoa(i)))
+		err := g2.addNode(modules.NetAddress("111.111.111.111:"+strconv.Itoa(i)), "")
 		g2.mu.Unlock(id)
 		if err != nil {
 			t.Fatal(err)
@@ -228,3 +228,109 @@ func TestRelayNodes(t *testing.T) {
 		t.Fatal("node was not relayed:", g2.nodes)
 	}
 }
+
+// TestRecordNodeFailure tests that nodes are only removed after failing
+// maxNodeFailures times in a row.
+func TestRecordNodeFailure(t *testing.T) {
+	g := newTestingGateway("TestRecordNodeFailure", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	if err := g.addNode(dummyNode, ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxNodeFailures-1; i++ {
+		g.recordNodeFailure(dummyNode)
+	}
+	if n, ok := g.nodes[dummyNode]; !ok || n.Failures != maxNodeFailures-1 {
+		t.Fatal("node was removed too early or has the wrong number of failures:", n)
+	}
+
+	// A success should reset the failure count.
+	g.recordNodeSuccess(dummyNode)
+	if n := g.nodes[dummyNode]; n.Failures != 0 || n.LastConnect == 0 {
+		t.Fatal("success was not recorded:", n)
+	}
+
+	for i := 0; i < maxNodeFailures; i++ {
+		g.recordNodeFailure(dummyNode)
+	}
+	if _, ok := g.nodes[dummyNode]; ok {
+		t.Fatal("node was not removed after failing maxNodeFailures times")
+	}
+}
+
+// TestNodeListCap tests that the node list does not grow beyond
+// maxNodeListLen, and that reliable nodes are not evicted to make room.
+func TestNodeListCap(t *testing.T) {
+	g := newTestingGateway("TestNodeListCap", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	// Fill the node list, marking the first node as reliable and the second
+	// node as having failed.
+	for i := 0; i < maxNodeListLen; i++ {
+		addr := modules.NetAddress("111.111." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256) + ":1111")
+		if err := g.addNode(addr, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reliable := modules.NetAddress("111.111.0.0:1111")
+	failed := modules.NetAddress("111.111.0.1:1111")
+	g.recordNodeSuccess(reliable)
+	g.recordNodeFailure(failed)
+
+	// Adding another node should evict the failed node.
+	if err := g.addNode(dummyNode, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.nodes) != maxNodeListLen {
+		t.Fatal("node list exceeded maxNodeListLen:", len(g.nodes))
+	}
+	if _, ok := g.nodes[failed]; ok {
+		t.Fatal("failed node was not evicted")
+	}
+	if _, ok := g.nodes[reliable]; !ok {
+		t.Fatal("reliable node was evicted")
+	}
+
+	// If every node is reliable, new nodes should be rejected.
+	for _, n := range g.nodes {
+		g.recordNodeSuccess(n.NetAddress)
+	}
+	if err := g.addNode("111.111.111.111:2222", ""); err != errNodeListFull {
+		t.Fatal("expected errNodeListFull, got", err)
+	}
+}
+
+// TestRandomOutboundNode tests that randomOutboundNode prefers reliable nodes.
+func TestRandomOutboundNode(t *testing.T) {
+	g := newTestingGateway("TestRandomOutboundNode", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	for i := 0; i < 100; i++ {
+		if err := g.addNode(modules.NetAddress("111.111.111.111:"+strconv.Itoa(i+1)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.recordNodeSuccess(dummyNode)
+
+	// dummyNode should be selected roughly half of the time.
+	var selected int
+	for i := 0; i < 100; i++ {
+		addr, err := g.randomOutboundNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == dummyNode {
+			selected++
+		}
+	}
+	if selected < 25 {
+		t.Fatal("reliable node was not preferred; selected", selected, "times out of 100")
+	}
+}
@@ -109,6 +109,18 @@ func (g *Gateway) randomInboundPeer() (modules.NetAddress, error) {
 	return "", errNoPeers
 }
 
+// isWhitelisted returns true if the host of addr may form an inbound
+// connection with the Gateway. All hosts are allowed if the whitelist is
+// empty. The whitelist is not modified after the Gateway is created, so no
+// lock is required.
+func (g *Gateway) isWhitelisted(addr modules.NetAddress) bool {
+	if len(g.whitelist) == 0 {
+		return true
+	}
+	_, exists := g.whitelist[banKey(addr)]
+	return exists
+}
+
 // listen handles incoming connection requests. If the connection is accepted,
 // the peer will be added to the Gateway's peer list.
 func (g *Gateway) listen() {
@@ -155,6 +167,34 @@ func (g *Gateway) acceptConn(conn net.Conn) {
 		return
 	}
 
+	// Reject peers that have been banned.
+	id := g.mu.RLock()
+	banned := g.isBanned(addr)
+	g.mu.RUnlock(id)
+	if banned {
+		encoding.WriteObject(conn, "reject")
+		conn.Close()
+		g.log.Printf("INFO: %v wanted to connect, but is banned", addr)
+		return
+	}
+
+	// Reject peers that are not on the whitelist, if there is one.
+	if !g.isWhitelisted(addr) {
+		encoding.WriteObject(conn, "reject")
+		conn.Close()
+		g.log.Printf("INFO: %v wanted to connect, but is not whitelisted", addr)
+		return
+	}
+
+	// Reject peers that cannot encrypt the connection, if encryption is
+	// required.
+	if g.requireEncryption && !supportsEncryption(remoteVersion) {
+		encoding.WriteObject(conn, "reject")
+		conn.Close()
+		g.log.Printf("INFO: %v wanted to connect, but does not support encryption", addr)
+		return
+	}
+
 	// respond with our version
 	if err := encoding.WriteObject(conn, build.Version); err != nil {
 		conn.Close()
@@ -162,10 +202,18 @@ func (g *Gateway) acceptConn(conn net.Conn) {
 		return
 	}
 
+	// Encrypt the connection if the peer supports it.
+	upgraded, encrypted, err := upgradeConn(conn, remoteVersion, build.Version, false)
+	if err != nil {
+		conn.Close()
+		g.log.Printf("INFO: %v wanted to connect, but the key exchange failed: %v", addr, err)
+		return
+	}
+
 	// If we are already fully connected, kick out an old peer to make room
 	// for the new one. Importantly, prioritize kicking a peer with the same
 	// IP as the connecting peer. This protects against Sybil attacks.
-	id := g.mu.Lock()
+	id = g.mu.Lock()
 	if len(g.peers) >= fullyConnectedThreshold {
 		// first choose a random peer, preferably inbound. If have only
 		// outbound peers, we'll wind up kicking an outbound peer; but
@@ -192,8 +240,9 @@ func (g *Gateway) acceptConn(conn net.Conn) {
 			NetAddress: addr,
 			Inbound:    true,
 			Version:    remoteVersion,
+			Encrypted:  encrypted,
 		},
-		sess: muxado.Server(conn),
+		sess: muxado.Server(upgraded),
 	})
 	g.mu.Unlock(id)
 
@@ -212,13 +261,19 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 
 	id := g.mu.RLock()
 	_, exists := g.peers[addr]
+	banned := g.isBanned(addr)
 	g.mu.RUnlock(id)
 	if exists {
 		return errors.New("peer already added")
+	} else if banned {
+		return errBannedPeer
 	}
 
 	conn, err := net.DialTimeout("tcp", string(addr), dialTimeout)
 	if err != nil {
+		id = g.mu.Lock()
+		g.recordNodeFailure(addr)
+		g.mu.Unlock(id)
 		return err
 	}
 	// send our version
@@ -245,17 +300,30 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 		conn.Close()
 		return insufficientVersionError(remoteVersion)
 	}
+	if g.requireEncryption && !supportsEncryption(remoteVersion) {
+		conn.Close()
+		return errPlaintextPeer
+	}
+
+	// Encrypt the connection if the peer supports it.
+	upgraded, encrypted, err := upgradeConn(conn, build.Version, remoteVersion, true)
+	if err != nil {
+		conn.Close()
+		return err
+	}
 
 	g.log.Println("INFO: connected to new peer", addr)
 
 	id = g.mu.Lock()
+	g.recordNodeSuccess(addr)
 	g.addPeer(&peer{
 		Peer: modules.Peer{
 			NetAddress: addr,
 			Inbound:    false,
 			Version:    remoteVersion,
+			Encrypted:  encrypted,
 		},
-		sess: muxado.Client(conn),
+		sess: muxado.Client(upgraded),
 	})
 	g.mu.Unlock(id)
 
@@ -300,7 +368,7 @@ func (g *Gateway) threadedPeerManager() {
 				numOutboundPeers++
 			}
 		}
-		addr, err := g.randomNode()
+		addr, err := g.randomOutboundNode()
 		g.mu.RUnlock(id)
 		if numOutboundPeers >= modules.WellConnectedThreshold {
 			select {
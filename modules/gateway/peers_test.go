@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/muxado"
@@ -111,6 +112,11 @@ func TestListen(t *testing.T) {
 	} else if ack == "reject" {
 		t.Fatal("gateway should have given ack")
 	}
+	// perform the key exchange
+	conn, _, err = crypto.EncryptConn(conn, true, build.Version, ack)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// g should add the peer
 	var ok bool
@@ -153,7 +159,7 @@ func TestConnect(t *testing.T) {
 
 	// give it a node
 	id := bootstrap.mu.Lock()
-	bootstrap.addNode(dummyNode)
+	bootstrap.addNode(dummyNode, "")
 	bootstrap.mu.Unlock(id)
 
 	// create peer who will connect to bootstrap
@@ -223,6 +229,12 @@ func TestConnectRejects(t *testing.T) {
 			if err := encoding.WriteObject(conn, mockVersion); err != nil {
 				t.Fatal(err)
 			}
+			// Perform the key exchange if the mock version supports it.
+			if supportsEncryption(mockVersion) {
+				if _, _, err := crypto.EncryptConn(conn, false, remoteVersion, mockVersion); err != nil {
+					t.Fatal(err)
+				}
+			}
 		}
 	}()
 
@@ -345,6 +357,13 @@ func (g mockGatewayWithVersion) Connect(addr modules.NetAddress) error {
 		return err
 	}
 	g.versionACK <- remoteVersion
+	// perform the key exchange if both versions support it, so that the
+	// remote peer does not wait for it
+	if remoteVersion != "reject" && supportsEncryption(g.version) {
+		if _, _, err := crypto.EncryptConn(conn, true, g.version, remoteVersion); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -509,8 +528,8 @@ func TestPeerManager(t *testing.T) {
 
 	// g1's node list should only contain g2
 	id := g1.mu.Lock()
-	g1.nodes = map[modules.NetAddress]struct{}{}
-	g1.nodes[g2.Address()] = struct{}{}
+	g1.nodes = make(map[modules.NetAddress]*modules.Node)
+	g1.addNode(g2.Address(), "")
 	g1.mu.Unlock(id)
 
 	// when peerManager wakes up, it should connect to g2.
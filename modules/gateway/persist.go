@@ -11,6 +11,9 @@ const (
 	// nodesFile is the name of the file that contains all seen nodes.
 	nodesFile = "nodes.json"
 
+	// blocklistFile is the name of the file that contains all banned hosts.
+	blocklistFile = "blocklist.json"
+
 	// logFile is the name of the log file.
 	logFile = modules.GatewayDir + ".log"
 )
@@ -18,27 +21,66 @@ const (
 // persistMetadata contains the header and version strings that identify the
 // gateway persist file.
 var persistMetadata = persist.Metadata{
+	Header:  "Sia Node List",
+	Version: "1.0",
+}
+
+// compatPersistMetadata identifies node lists saved by versions of the gateway
+// that did not record any information about each node.
+//
+// COMPATv0.6.0
+var compatPersistMetadata = persist.Metadata{
 	Header:  "Sia Node List",
 	Version: "0.3.3",
 }
 
+// blocklistMetadata contains the header and version strings that identify
+// the gateway blocklist file.
+var blocklistMetadata = persist.Metadata{
+	Header:  "Sia Gateway Blocklist",
+	Version: "1.0",
+}
+
 // persistData returns the data in the Gateway that will be saved to disk.
-func (g *Gateway) persistData() (nodes []modules.NetAddress) {
-	for node := range g.nodes {
-		nodes = append(nodes, node)
+func (g *Gateway) persistData() (nodes []modules.Node) {
+	for _, node := range g.nodes {
+		nodes = append(nodes, *node)
 	}
 	return
 }
 
 // load loads the Gateway's persistent data from disk.
 func (g *Gateway) load() error {
-	var nodes []modules.NetAddress
+	var nodes []modules.Node
 	err := persist.LoadFile(persistMetadata, &nodes, filepath.Join(g.persistDir, nodesFile))
+	if err == persist.ErrBadVersion {
+		return g.loadCompat()
+	} else if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		err := g.addNode(node.NetAddress, node.Source)
+		if err != nil {
+			g.log.Printf("WARN: error loading node '%v' from persist: %v", node.NetAddress, err)
+			continue
+		}
+		*g.nodes[node.NetAddress] = node
+	}
+	return nil
+}
+
+// loadCompat loads a node list that was saved without any information about
+// each node.
+//
+// COMPATv0.6.0
+func (g *Gateway) loadCompat() error {
+	var nodes []modules.NetAddress
+	err := persist.LoadFile(compatPersistMetadata, &nodes, filepath.Join(g.persistDir, nodesFile))
 	if err != nil {
 		return err
 	}
 	for _, node := range nodes {
-		err := g.addNode(node)
+		err := g.addNode(node, "")
 		if err != nil {
 			g.log.Printf("WARN: error loading node '%v' from persist: %v", node, err)
 		}
@@ -46,13 +88,46 @@ func (g *Gateway) load() error {
 	return nil
 }
 
-// save stores the Gateway's persistent data on disk.
+// save stores the Gateway's persistent data on disk. Private gateways do not
+// save their node list, so that the node list of a gateway that used to be
+// public is preserved.
 func (g *Gateway) save() error {
+	if g.private {
+		return nil
+	}
 	return persist.SaveFile(persistMetadata, g.persistData(), filepath.Join(g.persistDir, nodesFile))
 }
 
 // saveSync stores the Gateway's persistent data on disk, and then syncs to
 // disk to minimize the possibility of data loss.
 func (g *Gateway) saveSync() error {
+	if g.private {
+		return nil
+	}
 	return persist.SaveFileSync(persistMetadata, g.persistData(), filepath.Join(g.persistDir, nodesFile))
 }
+
+// loadBlocklist loads the Gateway's blocklist from disk.
+func (g *Gateway) loadBlocklist() error {
+	var bps []modules.BannedPeer
+	err := persist.LoadFile(blocklistMetadata, &bps, filepath.Join(g.persistDir, blocklistFile))
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		g.blocklist[bp.Host] = bp
+	}
+	g.pruneBlocklist()
+	return nil
+}
+
+// saveBlocklist stores the Gateway's blocklist on disk. Expired bans are
+// dropped before saving.
+func (g *Gateway) saveBlocklist() error {
+	g.pruneBlocklist()
+	bps := make([]modules.BannedPeer, 0, len(g.blocklist))
+	for _, bp := range g.blocklist {
+		bps = append(bps, bp)
+	}
+	return persist.SaveFileSync(blocklistMetadata, bps, filepath.Join(g.persistDir, blocklistFile))
+}
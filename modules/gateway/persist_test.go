@@ -1,13 +1,19 @@
 package gateway
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 )
 
 func TestLoad(t *testing.T) {
 	g := newTestingGateway("TestLoad", t)
 	id := g.mu.Lock()
-	g.addNode(dummyNode)
+	g.addNode(dummyNode, "")
 	g.save()
 	g.mu.Unlock(id)
 	g.Close()
@@ -20,3 +26,83 @@ func TestLoad(t *testing.T) {
 		t.Fatal("gateway did not load old peer list:", g2.nodes)
 	}
 }
+
+// TestLoadNodeStats tests that the connection history of each node is
+// persisted.
+func TestLoadNodeStats(t *testing.T) {
+	g := newTestingGateway("TestLoadNodeStats", t)
+	id := g.mu.Lock()
+	g.addNode(dummyNode, "foo")
+	g.recordNodeSuccess(dummyNode)
+	g.recordNodeFailure(dummyNode)
+	expected := *g.nodes[dummyNode]
+	g.save()
+	g.mu.Unlock(id)
+	g.Close()
+
+	g2, err := New("localhost:0", g.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	if n, ok := g2.nodes[dummyNode]; !ok || *n != expected {
+		t.Fatalf("node stats were not persisted: expected %v, got %v", expected, n)
+	}
+}
+
+// TestLoadCompat tests that node lists saved without node stats can be
+// loaded.
+func TestLoadCompat(t *testing.T) {
+	dir := build.TempDir("gateway", "TestLoadCompat")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	err := persist.SaveFile(compatPersistMetadata, []modules.NetAddress{dummyNode}, filepath.Join(dir, nodesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New("localhost:0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if _, ok := g.nodes[dummyNode]; !ok {
+		t.Fatal("gateway did not load old node list:", g.nodes)
+	}
+}
+
+// TestLoadPrivate tests that a private gateway neither loads nor overwrites
+// the node list saved by a public gateway.
+func TestLoadPrivate(t *testing.T) {
+	g := newTestingGateway("TestLoadPrivate", t)
+	id := g.mu.Lock()
+	g.addNode(dummyNode, "")
+	g.save()
+	g.mu.Unlock(id)
+	g.Close()
+
+	bootstrap := modules.NetAddress("127.0.0.1:9981")
+	g2, err := NewWithSettings("localhost:0", g.persistDir, Settings{
+		BootstrapPeers: []modules.NetAddress{bootstrap},
+		Private:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g2.nodes[dummyNode]; ok {
+		t.Fatal("private gateway loaded the public node list")
+	}
+	g2.Close()
+
+	g3, err := New("localhost:0", g.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close()
+	if _, ok := g3.nodes[dummyNode]; !ok {
+		t.Fatal("private gateway overwrote the public node list:", g3.nodes)
+	}
+	if _, ok := g3.nodes[bootstrap]; ok {
+		t.Fatal("private gateway saved its bootstrap peers to the public node list")
+	}
+}
@@ -30,7 +30,9 @@ func handlerName(name string) (id rpcID) {
 }
 
 // RPC calls an RPC on the given address. RPC cannot be called on an address
-// that the Gateway is not connected to.
+// that the Gateway is not connected to. Each call opens a new stream on the
+// peer's muxado session rather than a new TCP connection, so it makes no
+// difference whether the peer is inbound or outbound.
 func (g *Gateway) RPC(addr modules.NetAddress, name string, fn modules.RPCFunc) error {
 	id := g.mu.RLock()
 	peer, ok := g.peers[addr]
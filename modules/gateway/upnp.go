@@ -73,8 +73,11 @@ func (g *Gateway) learnHostname(port string) {
 
 	g.log.Println("INFO: our address is", g.myAddr)
 
-	// now that we know our address, we can start advertising it
-	g.RegisterConnectCall("RelayNode", g.sendAddress)
+	// now that we know our address, we can start advertising it, unless we
+	// are on a private network
+	if !g.private {
+		g.RegisterConnectCall("RelayNode", g.sendAddress)
+	}
 }
 
 // forwardPort adds a port mapping to the router.
@@ -106,6 +106,27 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 		return
 	}
 
+	// If the renter asked for an encrypted connection, perform the key
+	// exchange and read the specifier of the actual RPC over the encrypted
+	// connection.
+	if id == modules.RPCEncrypt {
+		h.mu.RLock()
+		secretKey := h.secretKey
+		h.mu.RUnlock()
+		ec, err := modules.NegotiateHostEncryption(conn, secretKey)
+		if err != nil {
+			atomic.AddUint64(&h.atomicErroredCalls, 1)
+			h.log.Debugf("WARN: incoming conn %v failed to encrypt: %v", conn.RemoteAddr(), err)
+			return
+		}
+		conn = ec
+		if err := encoding.ReadObject(conn, &id, 16); err != nil {
+			atomic.AddUint64(&h.atomicUnrecognizedCalls, 1)
+			h.log.Debugf("WARN: incoming conn %v was malformed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
 	switch id {
 	case modules.RPCDownload:
 		atomic.AddUint64(&h.atomicDownloadCalls, 1)
@@ -1,5 +1,15 @@
 package host
 
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
 /*
 import (
 	"path/filepath"
@@ -54,3 +64,60 @@ func TestRPCMetrics(t *testing.T) {
 	}
 }
 */
+
+// TestEncryptedRPC checks that the host performs RPCs over an encrypted
+// connection, and that the renter detects a host that cannot sign with the
+// expected public key.
+func TestEncryptedRPC(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := blankHostTester("TestEncryptedRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.host.Close()
+
+	// Request the host's settings over an encrypted connection.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ec, err := modules.NegotiateRenterEncryption(conn, ht.host.publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encoding.WriteObject(ec, modules.RPCSettings); err != nil {
+		t.Fatal(err)
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], ht.host.publicKey.Key)
+	var settings modules.HostExternalSettings
+	err = crypto.ReadSignedObject(ec, &settings, modules.NegotiateMaxHostExternalSettingsLen, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.NetAddress != ht.host.NetAddress() {
+		t.Error("host sent the wrong settings over the encrypted connection")
+	}
+
+	// A renter that expects a different host key should reject the
+	// connection.
+	conn2, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	_, wrongKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       wrongKey[:],
+	}
+	if _, err := modules.NegotiateRenterEncryption(conn2, spk); err == nil {
+		t.Fatal("renter accepted a connection signed by the wrong host key")
+	}
+}
@@ -45,6 +45,39 @@ type CPUMiner interface {
 	StopCPUMining()
 }
 
+// A PoolWorker contains the share statistics of a worker that has connected
+// to the pool server. Workers are identified by the name that they authorize
+// with, so the statistics of a worker are kept when it reconnects.
+type PoolWorker struct {
+	Name           string          `json:"name"`
+	Connected      bool            `json:"connected"`
+	SharesAccepted uint64          `json:"sharesaccepted"`
+	SharesRejected uint64          `json:"sharesrejected"`
+	SharesStale    uint64          `json:"sharesstale"`
+	BlocksFound    uint64          `json:"blocksfound"`
+	LastShare      types.Timestamp `json:"lastshare"`
+}
+
+// PoolServer provides a mining pool server, which hands out work to external
+// miners over a stratum-like line-based JSON protocol and tracks the shares
+// that they submit.
+type PoolServer interface {
+	// PoolAddress returns the address that the pool server is listening on,
+	// or an empty string if the pool server is not running.
+	PoolAddress() string
+
+	// PoolWorkers returns the share statistics of the workers that have
+	// authorized since the pool server was started. The statistics of
+	// workers that have been disconnected for a long time may be dropped.
+	PoolWorkers() []PoolWorker
+
+	// StartPool starts the pool server, listening on the given address.
+	StartPool(addr string) error
+
+	// StopPool stops the pool server and disconnects all workers.
+	StopPool() error
+}
+
 // TestMiner provides direct acesss to block fetching, solving, and
 // manipulation. The primary use of this interface is integration testing.
 type TestMiner interface {
@@ -73,5 +106,6 @@ type TestMiner interface {
 type Miner interface {
 	BlockManager
 	CPUMiner
+	PoolServer
 	io.Closer
 }
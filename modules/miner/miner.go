@@ -99,6 +99,10 @@ type Miner struct {
 	mining   bool  // indicates if the miner is actually running
 	hashRate int64 // indicates hashes per second
 
+	// pool is the running pool server, or nil if the pool server is not
+	// running.
+	pool *pool
+
 	// Utils
 	log        *persist.Logger
 	mu         sync.RWMutex
@@ -200,6 +204,12 @@ func (m *Miner) Close() error {
 	m.cs.Unsubscribe(m)
 
 	var errs []error
+	if m.pool != nil {
+		if err := m.pool.close(); err != nil {
+			errs = append(errs, fmt.Errorf("pool.close failed: %v", err))
+		}
+		m.pool = nil
+	}
 	if err := m.saveSync(); err != nil {
 		errs = append(errs, fmt.Errorf("save failed: %v", err))
 	}
@@ -0,0 +1,589 @@
+package miner
+
+// pool.go contains a mining pool server that speaks a stratum-like protocol.
+// Each message is a JSON object on its own line. Workers call
+// "mining.subscribe" to receive their extranonce, and "mining.authorize" with
+// a worker name to start receiving work. The server sends "mining.set_target"
+// with the share target and "mining.notify" with a job id, the encoded block
+// header, and a flag indicating whether previous jobs are stale. Workers grind
+// the nonce of the header and call "mining.submit" with their name, the job
+// id and the nonce.
+//
+// Every job of a worker contains the worker's extranonce and the job id in the
+// arbitrary data of the block, so no two workers grind the same header.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// poolJobMemory is the number of recent jobs of a worker that shares can
+	// be submitted for.
+	poolJobMemory = 8
+
+	// poolWorkerQueue is the number of messages that can be queued for a
+	// worker. Workers that do not read their messages are disconnected.
+	poolWorkerQueue = 32
+
+	// maxWorkerNameLen is the maximum length of a worker name.
+	maxWorkerNameLen = 64
+)
+
+var (
+	// PoolShareTarget is the target that a share must meet to be accepted.
+	// If the block target is easier, the block target is used instead.
+	PoolShareTarget = func() types.Target {
+		if build.Release == "dev" {
+			return types.Target{0, 0, 255}
+		}
+		if build.Release == "standard" {
+			return types.Target{0, 0, 0, 0, 255}
+		}
+		if build.Release == "testing" {
+			return types.Target{255}
+		}
+		panic("unrecognized build.Release")
+	}()
+
+	// poolJobInterval is the minimum amount of time between two rounds of
+	// jobs that are sent because the unconfirmed transactions changed. Jobs
+	// for a new parent block are always sent immediately.
+	poolJobInterval = func() time.Duration {
+		if build.Release == "dev" {
+			return 5 * time.Second
+		}
+		if build.Release == "standard" {
+			return 30 * time.Second
+		}
+		if build.Release == "testing" {
+			return time.Second
+		}
+		panic("unrecognized build.Release")
+	}()
+
+	// maxPoolWorkerNames is the maximum number of worker names that the pool
+	// server keeps statistics for. When a new name authorizes and the limit
+	// has been reached, the statistics of a disconnected worker are dropped.
+	maxPoolWorkerNames = func() int {
+		if build.Release == "dev" {
+			return 1000
+		}
+		if build.Release == "standard" {
+			return 1000
+		}
+		if build.Release == "testing" {
+			return 8
+		}
+		panic("unrecognized build.Release")
+	}()
+
+	// poolWorkerTimeout is the amount of time that a worker may stay silent
+	// before it is disconnected.
+	poolWorkerTimeout = func() time.Duration {
+		if build.Release == "dev" {
+			return 2 * time.Minute
+		}
+		if build.Release == "standard" {
+			return 10 * time.Minute
+		}
+		if build.Release == "testing" {
+			return 10 * time.Second
+		}
+		panic("unrecognized build.Release")
+	}()
+
+	errDuplicateShare    = errors.New("share has already been submitted")
+	errLowTargetShare    = errors.New("share does not meet the share target")
+	errPoolNotRunning    = errors.New("pool server is not running")
+	errPoolRunning       = errors.New("pool server is already running")
+	errStaleShare        = errors.New("share is for a stale job")
+	errTooManyWorkers    = errors.New("too many workers are connected")
+	errUnauthorized      = errors.New("worker is not authorized")
+	errUnknownJob        = errors.New("share is for an unknown job")
+	errUnknownMethod     = errors.New("unknown method")
+	errInvalidParams     = errors.New("invalid params")
+	errInvalidWorkerName = errors.New("invalid worker name")
+)
+
+type (
+	// stratumRequest is a request sent by a worker.
+	stratumRequest struct {
+		ID     interface{} `json:"id"`
+		Method string      `json:"method"`
+		Params []string    `json:"params"`
+	}
+
+	// stratumResponse is the response to a stratumRequest.
+	stratumResponse struct {
+		ID     interface{} `json:"id"`
+		Result interface{} `json:"result"`
+		Error  interface{} `json:"error"`
+	}
+
+	// stratumNotification is a message sent by the server that does not
+	// respond to a request.
+	stratumNotification struct {
+		ID     interface{}   `json:"id"`
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+	}
+
+	// poolJob is a block that has been handed out to a worker.
+	poolJob struct {
+		block       types.Block
+		target      types.Target
+		shareTarget types.Target
+		stale       bool
+		nonces      map[types.BlockNonce]struct{}
+	}
+
+	// poolWorker is a connection to a worker.
+	poolWorker struct {
+		conn       net.Conn
+		extranonce [8]byte
+		stats      *modules.PoolWorker // nil until the worker is authorized
+		jobs       map[uint64]*poolJob
+		jobIDs     []uint64
+		outgoing   chan []byte
+	}
+
+	// pool is a running pool server.
+	pool struct {
+		listener       net.Listener
+		workers        map[*poolWorker]struct{}
+		stats          map[string]*modules.PoolWorker
+		nextExtranonce uint64
+		nextJob        uint64
+
+		// lastJobs is the time that jobs were last sent to the workers.
+		// jobsPending is true if jobs are scheduled to be sent once
+		// poolJobInterval has passed.
+		lastJobs    time.Time
+		jobsPending bool
+	}
+)
+
+// meetsTarget returns true if the id meets the target.
+func meetsTarget(id types.BlockID, target types.Target) bool {
+	return bytes.Compare(target[:], id[:]) >= 0
+}
+
+// send queues a message for the worker. The worker is disconnected if its
+// queue is full.
+func (w *poolWorker) send(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case w.outgoing <- append(b, '\n'):
+	default:
+		w.conn.Close()
+	}
+}
+
+// threadedWrite writes the queued messages to the worker.
+func (w *poolWorker) threadedWrite() {
+	for b := range w.outgoing {
+		if _, err := w.conn.Write(b); err != nil {
+			w.conn.Close()
+			return
+		}
+	}
+}
+
+// close stops the listener of the pool and disconnects all workers.
+func (p *pool) close() error {
+	err := p.listener.Close()
+	for w := range p.workers {
+		w.conn.Close()
+	}
+	return err
+}
+
+// connected returns true if a worker is connected with the given statistics.
+func (p *pool) connected(stats *modules.PoolWorker) bool {
+	for w := range p.workers {
+		if w.stats == stats {
+			return true
+		}
+	}
+	return false
+}
+
+// evictWorkerStats drops the statistics of the disconnected worker that
+// submitted a share least recently. false is returned if every worker is
+// connected.
+func (p *pool) evictWorkerStats() bool {
+	var oldest *modules.PoolWorker
+	for _, stats := range p.stats {
+		if !stats.Connected && (oldest == nil || stats.LastShare < oldest.LastShare) {
+			oldest = stats
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(p.stats, oldest.Name)
+	return true
+}
+
+// sendPoolJob creates a new job for the worker and sends it. If clean is true,
+// the previous jobs of the worker are marked as stale.
+func (m *Miner) sendPoolJob(w *poolWorker, clean bool) {
+	if clean {
+		for _, job := range w.jobs {
+			job.stale = true
+		}
+	}
+
+	p := m.pool
+	jobID := p.nextJob
+	p.nextJob++
+	b := m.blockForWork()
+	arbData := append(modules.PrefixNonSia[:], w.extranonce[:]...)
+	arbData = append(arbData, encoding.EncUint64(jobID)...)
+	b.Transactions[0].ArbitraryData = [][]byte{arbData}
+
+	job := &poolJob{
+		block:       b,
+		target:      m.persist.Target,
+		shareTarget: PoolShareTarget,
+		nonces:      make(map[types.BlockNonce]struct{}),
+	}
+	if job.target.Cmp(job.shareTarget) > 0 {
+		job.shareTarget = job.target
+	}
+	w.jobs[jobID] = job
+	w.jobIDs = append(w.jobIDs, jobID)
+	if len(w.jobIDs) > poolJobMemory {
+		delete(w.jobs, w.jobIDs[0])
+		w.jobIDs = w.jobIDs[1:]
+	}
+
+	w.send(stratumNotification{
+		Method: "mining.set_target",
+		Params: []interface{}{hex.EncodeToString(job.shareTarget[:])},
+	})
+	w.send(stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{strconv.FormatUint(jobID, 10), hex.EncodeToString(encoding.Marshal(b.Header())), clean},
+	})
+}
+
+// notifyPoolWorkers sends new work to every authorized worker. If clean is
+// true, the previous jobs are stale because the parent block has changed, and
+// the work is sent immediately. Otherwise, only the unconfirmed transactions
+// have changed, and work is sent at most once every poolJobInterval so that
+// frequent transaction pool updates do not fill the queues of the workers.
+func (m *Miner) notifyPoolWorkers(clean bool) {
+	p := m.pool
+	if p == nil {
+		return
+	}
+	if !clean {
+		if p.jobsPending {
+			return
+		}
+		if wait := poolJobInterval - time.Since(p.lastJobs); wait > 0 {
+			p.jobsPending = true
+			time.AfterFunc(wait, func() { m.managedSendPendingJobs(p) })
+			return
+		}
+	}
+	p.jobsPending = false
+	p.lastJobs = time.Now()
+	if !m.wallet.Unlocked() || m.checkAddress() != nil {
+		return
+	}
+	for w := range p.workers {
+		if w.stats != nil {
+			m.sendPoolJob(w, clean)
+		}
+	}
+}
+
+// managedSendPendingJobs sends the jobs that were delayed by
+// notifyPoolWorkers, unless they have been sent in the meantime.
+func (m *Miner) managedSendPendingJobs(p *pool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pool != p || !p.jobsPending {
+		return
+	}
+	p.jobsPending = false
+	m.notifyPoolWorkers(false)
+}
+
+// managedSubmitShare checks a share submitted by the worker. If the share
+// also meets the block target, the block is submitted to the consensus set.
+func (m *Miner) managedSubmitShare(p *pool, w *poolWorker, params []string) error {
+	if len(params) != 3 {
+		return errInvalidParams
+	}
+	jobID, err := strconv.ParseUint(params[1], 10, 64)
+	if err != nil {
+		return errInvalidParams
+	}
+	nonceBytes, err := hex.DecodeString(params[2])
+	if err != nil || len(nonceBytes) != len(types.BlockNonce{}) {
+		return errInvalidParams
+	}
+	var nonce types.BlockNonce
+	copy(nonce[:], nonceBytes)
+
+	m.mu.Lock()
+	if w.stats == nil || params[0] != w.stats.Name {
+		m.mu.Unlock()
+		return errUnauthorized
+	}
+	stats := w.stats
+	job, exists := w.jobs[jobID]
+	switch {
+	case !exists:
+		err = errUnknownJob
+	case job.stale:
+		err = errStaleShare
+	default:
+		if _, exists := job.nonces[nonce]; exists {
+			err = errDuplicateShare
+		}
+	}
+	var b types.Block
+	var id types.BlockID
+	if err == nil {
+		b = job.block
+		b.Nonce = nonce
+		id = b.ID()
+		if !meetsTarget(id, job.shareTarget) {
+			err = errLowTargetShare
+		}
+	}
+	switch err {
+	case nil:
+		job.nonces[nonce] = struct{}{}
+		stats.SharesAccepted++
+		stats.LastShare = types.CurrentTimestamp()
+	case errStaleShare:
+		stats.SharesStale++
+	default:
+		stats.SharesRejected++
+	}
+	m.mu.Unlock()
+	if err != nil || !meetsTarget(id, job.target) {
+		return err
+	}
+
+	// The share solves the block.
+	if err := m.managedSubmitBlock(b); err != nil {
+		m.log.Println("ERROR: a block found by pool worker", stats.Name, "was not accepted:", err)
+		return nil
+	}
+	m.log.Println("Pool worker", stats.Name, "found a block")
+	m.mu.Lock()
+	stats.BlocksFound++
+	m.mu.Unlock()
+	return nil
+}
+
+// handleStratumRequest handles a single request from the worker, returning
+// the result of the request.
+func (m *Miner) handleStratumRequest(p *pool, w *poolWorker, req stratumRequest) (interface{}, error) {
+	switch req.Method {
+	case "mining.subscribe":
+		return []interface{}{hex.EncodeToString(w.extranonce[:])}, nil
+
+	case "mining.authorize":
+		if len(req.Params) == 0 || req.Params[0] == "" || len(req.Params[0]) > maxWorkerNameLen {
+			return nil, errInvalidWorkerName
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.pool != p {
+			return nil, errPoolNotRunning
+		}
+		if !m.wallet.Unlocked() {
+			return nil, modules.ErrLockedWallet
+		}
+		if err := m.checkAddress(); err != nil {
+			return nil, err
+		}
+		name := req.Params[0]
+		stats, exists := p.stats[name]
+		if !exists {
+			if len(p.stats) >= maxPoolWorkerNames && !p.evictWorkerStats() {
+				return nil, errTooManyWorkers
+			}
+			stats = &modules.PoolWorker{Name: name}
+			p.stats[name] = stats
+		}
+		prev := w.stats
+		w.stats = stats
+		stats.Connected = true
+		if prev != nil && prev != stats {
+			prev.Connected = p.connected(prev)
+		}
+		// The response is queued before the first job.
+		w.send(stratumResponse{ID: req.ID, Result: true})
+		m.sendPoolJob(w, true)
+		return nil, nil
+
+	case "mining.submit":
+		return true, m.managedSubmitShare(p, w, req.Params)
+	}
+	return nil, errUnknownMethod
+}
+
+// threadedHandleWorker reads and handles the requests of a worker until it
+// disconnects.
+func (m *Miner) threadedHandleWorker(p *pool, conn net.Conn) {
+	w := &poolWorker{
+		conn:     conn,
+		jobs:     make(map[uint64]*poolJob),
+		outgoing: make(chan []byte, poolWorkerQueue),
+	}
+	m.mu.Lock()
+	if m.pool != p {
+		m.mu.Unlock()
+		conn.Close()
+		return
+	}
+	binary.LittleEndian.PutUint64(w.extranonce[:], p.nextExtranonce)
+	p.nextExtranonce++
+	p.workers[w] = struct{}{}
+	m.mu.Unlock()
+	go w.threadedWrite()
+
+	defer func() {
+		m.mu.Lock()
+		delete(p.workers, w)
+		if w.stats != nil {
+			w.stats.Connected = p.connected(w.stats)
+		}
+		// Messages are only queued by this thread, or while holding the lock
+		// by threads that found the worker in p.workers.
+		close(w.outgoing)
+		m.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(poolWorkerTimeout))
+		if !scanner.Scan() {
+			return
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			m.log.Debugln("WARN: pool worker sent an invalid request:", err)
+			return
+		}
+		result, err := m.handleStratumRequest(p, w, req)
+		if result == nil && err == nil {
+			// The response has already been sent.
+			continue
+		}
+		resp := stratumResponse{ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result = nil
+			resp.Error = err.Error()
+		}
+		m.mu.Lock()
+		w.send(resp)
+		m.mu.Unlock()
+	}
+}
+
+// threadedAcceptWorkers accepts connections to the pool server until the
+// listener is closed.
+func (m *Miner) threadedAcceptWorkers(p *pool) {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go m.threadedHandleWorker(p, conn)
+	}
+}
+
+// PoolAddress returns the address that the pool server is listening on, or an
+// empty string if the pool server is not running.
+func (m *Miner) PoolAddress() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.pool == nil {
+		return ""
+	}
+	return m.pool.listener.Addr().String()
+}
+
+// PoolWorkers returns the share statistics of every worker that has authorized
+// since the pool server was started, sorted by name. At most
+// maxPoolWorkerNames workers are returned.
+func (m *Miner) PoolWorkers() []modules.PoolWorker {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.pool == nil {
+		return nil
+	}
+	var workers []modules.PoolWorker
+	for _, stats := range m.pool.stats {
+		workers = append(workers, *stats)
+	}
+	sort.Sort(poolWorkersByName(workers))
+	return workers
+}
+
+// poolWorkersByName sorts pool workers by name.
+type poolWorkersByName []modules.PoolWorker
+
+func (s poolWorkersByName) Len() int           { return len(s) }
+func (s poolWorkersByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s poolWorkersByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// StartPool starts the pool server, listening on the given address.
+func (m *Miner) StartPool(addr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pool != nil {
+		return errPoolRunning
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	m.pool = &pool{
+		listener: l,
+		workers:  make(map[*poolWorker]struct{}),
+		stats:    make(map[string]*modules.PoolWorker),
+	}
+	go m.threadedAcceptWorkers(m.pool)
+	m.log.Println("Pool server started on", l.Addr())
+	return nil
+}
+
+// StopPool stops the pool server and disconnects all workers.
+func (m *Miner) StopPool() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pool == nil {
+		return errPoolNotRunning
+	}
+	err := m.pool.close()
+	m.pool = nil
+	return err
+}
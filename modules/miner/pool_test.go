@@ -0,0 +1,289 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// poolMessage is any message sent by the pool server.
+type poolMessage struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	Result interface{}   `json:"result"`
+	Error  interface{}   `json:"error"`
+}
+
+// poolClient is a minimal pool worker.
+type poolClient struct {
+	conn          net.Conn
+	scanner       *bufio.Scanner
+	nextID        int
+	notifications []poolMessage
+}
+
+// call sends a request and returns the response, storing any notifications
+// that arrive first.
+func (pc *poolClient) call(t *testing.T, method string, params ...string) poolMessage {
+	pc.nextID++
+	b, _ := json.Marshal(stratumRequest{ID: pc.nextID, Method: method, Params: params})
+	if _, err := pc.conn.Write(append(b, '\n')); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg := pc.read(t)
+		if msg.Method == "" {
+			return msg
+		}
+		pc.notifications = append(pc.notifications, msg)
+	}
+}
+
+// read reads the next message from the pool server.
+func (pc *poolClient) read(t *testing.T) poolMessage {
+	pc.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if !pc.scanner.Scan() {
+		t.Fatal("could not read from the pool server:", pc.scanner.Err())
+	}
+	var msg poolMessage
+	if err := json.Unmarshal(pc.scanner.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// nextJob returns the id and header of the next job sent by the pool server,
+// along with the share target.
+func (pc *poolClient) nextJob(t *testing.T) (string, []byte, types.Target) {
+	var target types.Target
+	for {
+		var msg poolMessage
+		if len(pc.notifications) > 0 {
+			msg, pc.notifications = pc.notifications[0], pc.notifications[1:]
+		} else {
+			msg = pc.read(t)
+		}
+		switch msg.Method {
+		case "mining.set_target":
+			b, _ := hex.DecodeString(msg.Params[0].(string))
+			copy(target[:], b)
+		case "mining.notify":
+			header, _ := hex.DecodeString(msg.Params[1].(string))
+			return msg.Params[0].(string), header, target
+		}
+	}
+}
+
+// grind returns a nonce for which meets(id) returns true.
+func grind(header []byte, meets func(types.BlockID) bool) string {
+	for i := uint64(0); ; i++ {
+		binary.LittleEndian.PutUint64(header[32:40], i)
+		if meets(types.BlockID(crypto.HashBytes(header))) {
+			return hex.EncodeToString(header[32:40])
+		}
+	}
+}
+
+// TestIntegrationPool checks that the pool server hands out work, accepts
+// shares, and submits the blocks found by its workers.
+func TestIntegrationPool(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	mt, err := createMinerTester("TestIntegrationPool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.miner.StartPool("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.miner.StartPool("localhost:0"); err != errPoolRunning {
+		t.Fatal("expected errPoolRunning, got", err)
+	}
+	conn, err := net.Dial("tcp", mt.miner.PoolAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	pc := &poolClient{conn: conn, scanner: bufio.NewScanner(conn)}
+
+	if resp := pc.call(t, "mining.subscribe"); resp.Error != nil || len(resp.Result.([]interface{})[0].(string)) != 16 {
+		t.Fatal("bad subscribe response:", resp)
+	}
+	if resp := pc.call(t, "mining.submit", "worker", "0", "0000000000000000"); resp.Error != errUnauthorized.Error() {
+		t.Fatal("unauthorized worker could submit a share:", resp)
+	}
+	if resp := pc.call(t, "mining.authorize", "worker"); resp.Result != true {
+		t.Fatal("bad authorize response:", resp)
+	}
+	jobID, header, shareTarget := pc.nextJob(t)
+	blockTarget, _ := mt.cs.ChildTarget(mt.cs.CurrentBlock().ID())
+
+	// Submit a share that does not meet the share target, a share that
+	// meets only the share target, and the same share again.
+	nonce := grind(header, func(id types.BlockID) bool { return !meetsTarget(id, shareTarget) })
+	if resp := pc.call(t, "mining.submit", "worker", jobID, nonce); resp.Error != errLowTargetShare.Error() {
+		t.Fatal("low target share was not rejected:", resp)
+	}
+	nonce = grind(header, func(id types.BlockID) bool { return meetsTarget(id, shareTarget) && !meetsTarget(id, blockTarget) })
+	if resp := pc.call(t, "mining.submit", "worker", jobID, nonce); resp.Result != true {
+		t.Fatal("share was not accepted:", resp)
+	}
+	if resp := pc.call(t, "mining.submit", "worker", jobID, nonce); resp.Error != errDuplicateShare.Error() {
+		t.Fatal("duplicate share was not rejected:", resp)
+	}
+
+	// Submit a share that solves the block. The worker should be sent a new
+	// job, and the old job should be stale.
+	height := mt.cs.Height()
+	nonce = grind(header, func(id types.BlockID) bool { return meetsTarget(id, blockTarget) })
+	if resp := pc.call(t, "mining.submit", "worker", jobID, nonce); resp.Result != true {
+		t.Fatal("block share was not accepted:", resp)
+	}
+	if mt.cs.Height() != height+1 {
+		t.Fatal("block found by the worker was not accepted")
+	}
+	newJobID, _, _ := pc.nextJob(t)
+	if newJobID == jobID {
+		t.Fatal("worker was not sent a new job")
+	}
+	nonce = grind(header, func(id types.BlockID) bool { return meetsTarget(id, shareTarget) })
+	if resp := pc.call(t, "mining.submit", "worker", jobID, nonce); resp.Error != errStaleShare.Error() {
+		t.Fatal("stale share was not rejected:", resp)
+	}
+
+	workers := mt.miner.PoolWorkers()
+	if len(workers) != 1 {
+		t.Fatal("expected 1 worker, got", len(workers))
+	}
+	w := workers[0]
+	if w.Name != "worker" || !w.Connected || w.SharesAccepted != 2 || w.SharesRejected != 2 || w.SharesStale != 1 || w.BlocksFound != 1 {
+		t.Error("wrong worker statistics:", w)
+	}
+
+	if err := mt.miner.StopPool(); err != nil {
+		t.Fatal(err)
+	}
+	if mt.miner.PoolAddress() != "" || mt.miner.PoolWorkers() != nil {
+		t.Error("pool server is still running")
+	}
+}
+
+// newPoolClient connects to the pool server of the miner tester and
+// authorizes a worker with the given name.
+func newPoolClient(t *testing.T, mt *minerTester, name string) *poolClient {
+	conn, err := net.Dial("tcp", mt.miner.PoolAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := &poolClient{conn: conn, scanner: bufio.NewScanner(conn)}
+	if resp := pc.call(t, "mining.authorize", name); resp.Result != true {
+		t.Fatal("bad authorize response:", resp)
+	}
+	return pc
+}
+
+// TestIntegrationPoolTransactionUpdates checks that frequent transaction pool
+// updates do not overflow the queues of the workers.
+func TestIntegrationPoolTransactionUpdates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	mt, err := createMinerTester("TestIntegrationPoolTransactionUpdates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.miner.StartPool("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer mt.miner.StopPool()
+	pc := newPoolClient(t, mt, "worker")
+	defer pc.conn.Close()
+	pc.nextJob(t)
+
+	// Send many more updates than fit in the queue of the worker without
+	// reading any messages.
+	for i := 0; i < 4*poolWorkerQueue; i++ {
+		mt.miner.ReceiveUpdatedUnconfirmedTransactions(nil, modules.ConsensusChange{})
+	}
+	if workers := mt.miner.PoolWorkers(); len(workers) != 1 || !workers[0].Connected {
+		t.Fatal("worker was disconnected by transaction pool updates:", workers)
+	}
+
+	// The first update is sent immediately, and the remaining updates should
+	// result in a single new job after poolJobInterval.
+	pc.nextJob(t)
+	pc.nextJob(t)
+	if resp := pc.call(t, "mining.subscribe"); resp.Error != nil {
+		t.Fatal("bad subscribe response:", resp)
+	}
+	for _, msg := range pc.notifications {
+		if msg.Method == "mining.notify" {
+			t.Fatal("worker was sent too many jobs for the updates")
+		}
+	}
+}
+
+// TestIntegrationPoolWorkerNames checks that the pool server keeps the
+// statistics of a limited number of worker names.
+func TestIntegrationPoolWorkerNames(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	mt, err := createMinerTester("TestIntegrationPoolWorkerNames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.miner.StartPool("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer mt.miner.StopPool()
+
+	// A single connection that authorizes many names only keeps the most
+	// recent name connected, so the other names are dropped.
+	pc := newPoolClient(t, mt, "first")
+	defer pc.conn.Close()
+	for i := 0; i < 2*maxPoolWorkerNames; i++ {
+		if resp := pc.call(t, "mining.authorize", "worker"+strconv.Itoa(i)); resp.Result != true {
+			t.Fatal("bad authorize response:", resp)
+		}
+	}
+	workers := mt.miner.PoolWorkers()
+	if len(workers) != maxPoolWorkerNames {
+		t.Fatal("wrong number of workers:", len(workers))
+	}
+	connected := 0
+	for _, w := range workers {
+		if w.Connected {
+			connected++
+		}
+	}
+	if connected != 1 {
+		t.Fatal("expected 1 connected worker, got", connected)
+	}
+
+	// Once every name belongs to a connected worker, new names are refused.
+	for i := 1; i < maxPoolWorkerNames; i++ {
+		pc := newPoolClient(t, mt, "connected"+strconv.Itoa(i))
+		defer pc.conn.Close()
+	}
+	conn, err := net.Dial("tcp", mt.miner.PoolAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	pc = &poolClient{conn: conn, scanner: bufio.NewScanner(conn)}
+	if resp := pc.call(t, "mining.authorize", "refused"); resp.Error != errTooManyWorkers.Error() {
+		t.Fatal("expected errTooManyWorkers, got", resp)
+	}
+}
@@ -61,6 +61,7 @@ func (m *Miner) ProcessConsensusChange(cc modules.ConsensusChange) {
 	// There is a new parent block, the source block should be updated to keep
 	// the stale rate as low as possible.
 	m.newSourceBlock()
+	m.notifyPoolWorkers(true)
 	m.persist.RecentChange = cc.ID
 	err := m.save()
 	if err != nil {
@@ -78,6 +79,7 @@ func (m *Miner) ReceiveUpdatedUnconfirmedTransactions(unconfirmedTransactions []
 	// to nil and return.
 	if len(unconfirmedTransactions) == 0 {
 		m.persist.UnsolvedBlock.Transactions = nil
+		m.notifyPoolWorkers(false)
 		return
 	}
 
@@ -92,4 +94,5 @@ func (m *Miner) ReceiveUpdatedUnconfirmedTransactions(unconfirmedTransactions []
 		}
 	}
 	m.persist.UnsolvedBlock.Transactions = unconfirmedTransactions[:i+1]
+	m.notifyPoolWorkers(false)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"net"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -93,6 +94,11 @@ const (
 	// transaction signature slice is allowed to be when being sent over the
 	// wire during negoitation.
 	NegotiateMaxTransactionSignaturesSize = 5e3
+
+	// EncryptedRPCVersion is the first version of the host that accepts
+	// RPCEncrypt. Renters only encrypt connections to hosts that report this
+	// version or later in their signed settings.
+	EncryptedRPCVersion = "0.6.1"
 )
 
 var (
@@ -127,6 +133,11 @@ var (
 	// wrong number of transaction signatures.
 	ErrRevisionSigCount = errors.New("file contract revision has the wrong number of transaction signatures")
 
+	// ErrHostKeyUnsupported is returned when a renter tries to encrypt a
+	// connection to a host whose public key cannot verify the host's
+	// signature on the key exchange.
+	ErrHostKeyUnsupported = errors.New("host public key cannot be used to authenticate the connection")
+
 	// ErrStopResponse is the error returned by ReadNegotiationAcceptance when
 	// it reads the StopResponse string.
 	ErrStopResponse = errors.New("sender wishes to stop communicating")
@@ -139,6 +150,12 @@ var (
 	// RPCDownload is the specifier for downloading a file from a host.
 	RPCDownload = types.Specifier{'D', 'o', 'w', 'n', 'l', 'o', 'a', 'd', 2}
 
+	// RPCEncrypt is the specifier for upgrading a connection to the host to an
+	// encrypted connection. It is followed by a key exchange, after which the
+	// host signs the transcript of the key exchange and the renter sends the
+	// specifier of the actual RPC over the encrypted connection.
+	RPCEncrypt = types.Specifier{'E', 'n', 'c', 'r', 'y', 'p', 't', 2}
+
 	// RPCFormContract is the specifier for forming a contract with a host.
 	RPCFormContract = types.Specifier{'F', 'o', 'r', 'm', 'C', 'o', 'n', 't', 'r', 'a', 'c', 't', 2}
 
@@ -336,6 +353,59 @@ func WriteNegotiationStop(w io.Writer) error {
 	return encoding.WriteObject(w, StopResponse)
 }
 
+// SupportsEncryptedRPC returns true if a host running the given version
+// accepts RPCEncrypt.
+func SupportsEncryptedRPC(version string) bool {
+	return build.VersionCmp(version, EncryptedRPCVersion) >= 0
+}
+
+// NegotiateHostEncryption is called by the host after reading RPCEncrypt. It
+// performs the key exchange and signs the transcript with the host's secret
+// key, so that the renter knows that it is talking to the host that it
+// intended to. The returned connection should be used for the rest of the
+// RPC.
+func NegotiateHostEncryption(conn net.Conn, sk crypto.SecretKey) (net.Conn, error) {
+	ec, transcript, err := crypto.EncryptConn(conn, false, RPCEncrypt)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.SignHash(transcript, sk)
+	if err != nil {
+		return nil, err
+	}
+	if err := encoding.WriteObject(ec, sig); err != nil {
+		return nil, err
+	}
+	return ec, nil
+}
+
+// NegotiateRenterEncryption sends RPCEncrypt to the host, performs the key
+// exchange, and checks that the transcript was signed by the host's public
+// key. The returned connection should be used for the rest of the RPC.
+func NegotiateRenterEncryption(conn net.Conn, hostKey types.SiaPublicKey) (net.Conn, error) {
+	if hostKey.Algorithm != types.SignatureEd25519 || len(hostKey.Key) != crypto.PublicKeySize {
+		return nil, ErrHostKeyUnsupported
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], hostKey.Key)
+
+	if err := encoding.WriteObject(conn, RPCEncrypt); err != nil {
+		return nil, err
+	}
+	ec, transcript, err := crypto.EncryptConn(conn, true, RPCEncrypt)
+	if err != nil {
+		return nil, err
+	}
+	var sig crypto.Signature
+	if err := encoding.ReadObject(ec, &sig, crypto.SignatureSize); err != nil {
+		return nil, err
+	}
+	if err := crypto.VerifyHash(transcript, pk, sig); err != nil {
+		return nil, err
+	}
+	return ec, nil
+}
+
 // CreateAnnouncement will take a host announcement and encode it, returning
 // the exact []byte that should be added to the arbitrary data of a
 // transaction.
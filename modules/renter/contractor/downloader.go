@@ -153,9 +153,12 @@ func (c *Contractor) Downloader(contract Contract) (Downloader, error) {
 	// allot 2 minutes for RPC request + revision exchange
 	conn.SetDeadline(time.Now().Add(120 * time.Second))
 	defer conn.SetDeadline(time.Now().Add(time.Hour))
-	if err := encoding.WriteObject(conn, modules.RPCDownload); err != nil {
-		return nil, errors.New("couldn't initiate RPC: " + err.Error())
+	ec, err := initiateRPC(conn, host, modules.RPCDownload)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
+	conn = ec
 	if err := verifyRecentRevision(conn, contract); err != nil {
 		return nil, errors.New("revision exchange failed: " + err.Error())
 	}
@@ -318,9 +318,12 @@ func (c *Contractor) Editor(contract Contract) (Editor, error) {
 	// allot 2 minutes for RPC request + revision exchange
 	conn.SetDeadline(time.Now().Add(120 * time.Second))
 	defer conn.SetDeadline(time.Now().Add(time.Hour))
-	if err := encoding.WriteObject(conn, modules.RPCReviseContract); err != nil {
-		return nil, errors.New("couldn't initiate RPC: " + err.Error())
+	ec, err := initiateRPC(conn, host, modules.RPCReviseContract)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
+	conn = ec
 	if err := verifyRecentRevision(conn, contract); err != nil {
 		return nil, errors.New("revision exchange failed: " + err.Error())
 	}
@@ -283,7 +283,8 @@ func (c *Contractor) newContract(host modules.HostDBEntry, filesize uint64, endH
 		return Contract{}, err
 	}
 	defer conn.Close()
-	if err := encoding.WriteObject(conn, modules.RPCFormContract); err != nil {
+	conn, err = initiateRPC(conn, host, modules.RPCFormContract)
+	if err != nil {
 		return Contract{}, err
 	}
 
@@ -11,6 +11,24 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// initiateRPC writes the specifier of an RPC to the host. If the host's
+// signed settings report a version that supports encrypted RPCs, the
+// connection is first encrypted and authenticated with the host's public key.
+// The returned connection should be used for the rest of the RPC.
+func initiateRPC(conn net.Conn, host modules.HostDBEntry, rpcID types.Specifier) (net.Conn, error) {
+	if modules.SupportsEncryptedRPC(host.Version) {
+		ec, err := modules.NegotiateRenterEncryption(conn, host.PublicKey)
+		if err != nil {
+			return nil, errors.New("couldn't encrypt connection: " + err.Error())
+		}
+		conn = ec
+	}
+	if err := encoding.WriteObject(conn, rpcID); err != nil {
+		return nil, errors.New("couldn't initiate RPC: " + err.Error())
+	}
+	return conn, nil
+}
+
 // verifySettings reads a signed HostSettings object from conn, validates the
 // signature, and checks for discrepancies between the known settings and the
 // received settings. If there is a discrepancy, the hostDB is notified. The
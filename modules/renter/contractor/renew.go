@@ -78,8 +78,9 @@ func (c *Contractor) managedRenew(contract Contract, filesize uint64, newEndHeig
 		return types.FileContractID{}, err
 	}
 	defer conn.Close()
-	if err := encoding.WriteObject(conn, modules.RPCRenew); err != nil {
-		return types.FileContractID{}, errors.New("couldn't initiate RPC: " + err.Error())
+	conn, err = initiateRPC(conn, host, modules.RPCRenew)
+	if err != nil {
+		return types.FileContractID{}, err
 	}
 
 	// verify the host's settings and confirm its identity
@@ -310,10 +310,22 @@ func (tp *TransactionPool) AcceptTransactionSet(ts []types.Transaction) error {
 // the accept is successful, the transaction will be relayed to the gateway's
 // other peers.
 func (tp *TransactionPool) relayTransactionSet(conn modules.PeerConn) error {
+	// The prefix and the object are read separately so that only peers which
+	// send undecodable data are penalized, and not peers with a bad
+	// connection.
+	data, err := encoding.ReadPrefix(conn, types.BlockSizeLimit)
+	if err != nil {
+		return err
+	}
 	var ts []types.Transaction
-	err := encoding.ReadObject(conn, &ts, types.BlockSizeLimit)
+	err = encoding.Unmarshal(data, &ts)
 	if err != nil {
+		tp.gateway.Penalize(modules.NetAddress(conn.RemoteAddr().String()), "sent malformed transaction set: "+err.Error())
 		return err
 	}
-	return tp.AcceptTransactionSet(ts)
+	err = tp.AcceptTransactionSet(ts)
+	if err == errEmptySet {
+		tp.gateway.Penalize(modules.NetAddress(conn.RemoteAddr().String()), "sent empty transaction set")
+	}
+	return err
 }
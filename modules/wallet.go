@@ -25,6 +25,14 @@ const (
 	// WalletSeedPreloadDepth is the number of addresses that get automatically
 	// loaded by the wallet at startup.
 	WalletSeedPreloadDepth = 25
+
+	// TransactionDirectionIncoming selects the transactions that increase
+	// the balance of the wallet when used in a TransactionFilter.
+	TransactionDirectionIncoming = "incoming"
+
+	// TransactionDirectionOutgoing selects the transactions that decrease
+	// the balance of the wallet when used in a TransactionFilter.
+	TransactionDirectionOutgoing = "outgoing"
 )
 
 var (
@@ -59,6 +67,7 @@ type (
 	ProcessedInput struct {
 		FundType       types.Specifier  `json:"fundtype"`
 		WalletAddress  bool             `json:"walletaddress"`
+		WatchOnly      bool             `json:"watchonly"`
 		RelatedAddress types.UnlockHash `json:"relatedaddress"`
 		Value          types.Currency   `json:"value"`
 	}
@@ -75,10 +84,14 @@ type (
 	// MaturityHeight indicates at what block height the output becomes
 	// available. SiacoinInputs and SiafundInputs become available immediately.
 	// ClaimInputs and MinerPayouts become available after 144 confirmations.
+	//
+	// WatchOnly indicates that the related address is watched by the wallet,
+	// but that the wallet does not hold its secret keys.
 	ProcessedOutput struct {
 		FundType       types.Specifier   `json:"fundtype"`
 		MaturityHeight types.BlockHeight `json:"maturityheight"`
 		WalletAddress  bool              `json:"walletaddress"`
+		WatchOnly      bool              `json:"watchonly"`
 		RelatedAddress types.UnlockHash  `json:"relatedaddress"`
 		Value          types.Currency    `json:"value"`
 	}
@@ -100,6 +113,26 @@ type (
 		Outputs []ProcessedOutput `json:"outputs"`
 	}
 
+	// A TransactionFilter selects the confirmed transactions returned by
+	// TransactionHistory. Fields that are left empty do not filter.
+	//
+	// Direction is either TransactionDirectionIncoming or
+	// TransactionDirectionOutgoing, and is determined by the net flow of
+	// siacoins into the wallet, or by the net flow of siafunds if FundType is
+	// a siafund specifier. FundType selects the transactions that have an
+	// input or output of that fund type belonging to the wallet or to a
+	// watched address. Address selects the transactions with an input or
+	// output related to the address. MinAmount and MaxAmount bound the
+	// absolute net flow of the transaction, and a MaxAmount of zero is
+	// unbounded.
+	TransactionFilter struct {
+		Direction string           `json:"direction"`
+		FundType  types.Specifier  `json:"fundtype"`
+		Address   types.UnlockHash `json:"address"`
+		MinAmount types.Currency   `json:"minamount"`
+		MaxAmount types.Currency   `json:"maxamount"`
+	}
+
 	// TransactionBuilder is used to construct custom transactions. A transaction
 	// builder is intialized via 'RegisterTransaction' and then can be modified by
 	// adding funds or other fields. The transaction is completed by calling
@@ -120,6 +153,14 @@ type (
 		// transaction failed.
 		FundSiacoins(amount types.Currency) error
 
+		// FundSiacoinsWithOutputs will add each of the given wallet outputs
+		// as a siacoin input of the transaction, without creating a parent
+		// transaction. If the outputs are worth more than 'amount', a refund
+		// output paying the difference to the wallet is added to the
+		// transaction. The siacoin inputs will not be signed until 'Sign' is
+		// called on the transaction builder.
+		FundSiacoinsWithOutputs(amount types.Currency, ids []types.SiacoinOutputID) error
+
 		// FundSiafunds will add a siafund input of exaclty 'amount' to the
 		// transaction. A parent transaction may be needed to achieve an input
 		// with the correct value. The siafund input will not be signed until
@@ -227,6 +268,11 @@ type (
 		// a different directory or deleted.
 		Encrypt(masterKey crypto.TwofishKey) (Seed, error)
 
+		// ChangeKey re-encrypts the wallet using a new master key. The old
+		// master key is required, and is no longer valid after the change.
+		// The wallet does not need to be unlocked.
+		ChangeKey(oldKey, newKey crypto.TwofishKey) error
+
 		// Encrypted returns whether or not the wallet has been encrypted yet.
 		// After being encrypted for the first time, the wallet can only be
 		// unlocked using the encryption password.
@@ -293,12 +339,90 @@ type (
 		// recovery seed before saving it to disk.
 		LoadSeed(crypto.TwofishKey, Seed) error
 
+		// SweepSeed moves the siacoins and siafunds held by the addresses of
+		// a seed to a new address of the wallet, without adding the seed to
+		// the wallet. The amounts that were swept are returned.
+		SweepSeed(seed Seed) (coins, funds types.Currency, err error)
+
 		// LoadSiagKeys will take a set of filepaths that point to a siag key
 		// and will have the siag keys loaded into the wallet so that they will
 		// become spendable.
 		LoadSiagKeys(crypto.TwofishKey, []string) error
 	}
 
+	// An UnspentOutput is a siacoin or siafund output that is spendable by
+	// the wallet. The fund type is either 'SiacoinOutput' or 'SiafundOutput'.
+	//
+	// Outputs created by unconfirmed transactions have a confirmation height
+	// of math.MaxUint64. SpentUnconfirmed indicates that the output is spent
+	// by a transaction in the transaction pool.
+	UnspentOutput struct {
+		ID                 types.OutputID    `json:"id"`
+		FundType           types.Specifier   `json:"fundtype"`
+		UnlockHash         types.UnlockHash  `json:"unlockhash"`
+		Value              types.Currency    `json:"value"`
+		ConfirmationHeight types.BlockHeight `json:"confirmationheight"`
+		SpentUnconfirmed   bool              `json:"spentunconfirmed"`
+	}
+
+	// A SiafundClaim describes the siacoins that a confirmed siafund output of
+	// the wallet can claim. ClaimStart is the value of the siafund pool when
+	// the output was created, and ClaimValue is the number of siacoins that
+	// the output has accrued since, computed from the current siafund pool.
+	SiafundClaim struct {
+		ID                 types.SiafundOutputID `json:"id"`
+		UnlockHash         types.UnlockHash      `json:"unlockhash"`
+		Value              types.Currency        `json:"value"`
+		ClaimStart         types.Currency        `json:"claimstart"`
+		ClaimValue         types.Currency        `json:"claimvalue"`
+		ConfirmationHeight types.BlockHeight     `json:"confirmationheight"`
+	}
+
+	// A ClaimPayout is a siacoin claim that was paid out when a siafund output
+	// of the wallet was spent. The siacoins are paid to ClaimUnlockHash, and
+	// can be spent once MaturityHeight has been reached.
+	ClaimPayout struct {
+		SiafundOutputID    types.SiafundOutputID `json:"siafundoutputid"`
+		TransactionID      types.TransactionID   `json:"transactionid"`
+		Siafunds           types.Currency        `json:"siafunds"`
+		ClaimStart         types.Currency        `json:"claimstart"`
+		ClaimUnlockHash    types.UnlockHash      `json:"claimunlockhash"`
+		Value              types.Currency        `json:"value"`
+		ConfirmationHeight types.BlockHeight     `json:"confirmationheight"`
+		MaturityHeight     types.BlockHeight     `json:"maturityheight"`
+	}
+
+	// A WatchedAddress is an address that the wallet tracks without holding
+	// its secret keys, such as an address in cold storage. UnlockConditions
+	// is only set if the unlock conditions of the address are known, which
+	// allows the wallet to build unsigned transactions that spend from it.
+	WatchedAddress struct {
+		UnlockHash       types.UnlockHash        `json:"unlockhash"`
+		UnlockConditions *types.UnlockConditions `json:"unlockconditions,omitempty"`
+	}
+
+	// A RequiredSignature describes a signature that is missing from an
+	// UnsignedTransaction. The signature is made by the keys of
+	// UnlockConditions, for the input or revision whose id is ParentID, and
+	// covers the fields in CoveredFields.
+	RequiredSignature struct {
+		ParentID         crypto.Hash            `json:"parentid"`
+		UnlockConditions types.UnlockConditions `json:"unlockconditions"`
+		CoveredFields    types.CoveredFields    `json:"coveredfields"`
+	}
+
+	// An UnsignedTransaction is a transaction that is exported to be signed
+	// elsewhere, such as on an offline machine holding the seed of a watched
+	// address. Parents are the unconfirmed transactions that the transaction
+	// depends on, and RequiredSignatures lists the signatures that still need
+	// to be added. The transaction is complete once RequiredSignatures is
+	// empty.
+	UnsignedTransaction struct {
+		Parents            []types.Transaction `json:"parents"`
+		Transaction        types.Transaction   `json:"transaction"`
+		RequiredSignatures []RequiredSignature `json:"requiredsignatures"`
+	}
+
 	// Wallet stores and manages siacoins and siafunds. The wallet file is
 	// encrypted using a user-specified password. Common addresses are all
 	// dervied from a single address seed.
@@ -306,6 +430,10 @@ type (
 		EncryptionManager
 		KeyManager
 
+		// Close unsubscribes the wallet from the consensus set, locks the
+		// wallet, and closes the wallet database.
+		Close() error
+
 		// ConfirmedBalance returns the confirmed balance of the wallet, minus
 		// any outgoing transactions. ConfirmedBalance will include unconfirmed
 		// refund transacitons.
@@ -336,6 +464,13 @@ type (
 		// included.
 		Transactions(startHeight types.BlockHeight, endHeight types.BlockHeight) ([]ProcessedTransaction, error)
 
+		// TransactionHistory returns up to 'limit' confirmed transactions
+		// that match the filter, in the order that they were confirmed,
+		// starting at 'cursor'. A cursor of zero starts at the oldest
+		// transaction. The cursor of the next page is returned, and is zero
+		// once the end of the history has been reached.
+		TransactionHistory(cursor uint64, limit int, filter TransactionFilter) (pts []ProcessedTransaction, next uint64, err error)
+
 		// UnconfirmedTransactions returns all unconfirmed transactions
 		// relative to the wallet.
 		UnconfirmedTransactions() []ProcessedTransaction
@@ -354,11 +489,88 @@ type (
 		// are also returned to the caller.
 		SendSiacoins(amount types.Currency, dest types.UnlockHash) ([]types.Transaction, error)
 
+		// SendSiacoinsMulti sends siacoins to multiple addresses in a single
+		// transaction. The miner fee is sized using the fee estimation of
+		// the transaction pool. The transactions are automatically given to
+		// the transaction pool, and are also returned to the caller.
+		SendSiacoinsMulti(outputs []types.SiacoinOutput) ([]types.Transaction, error)
+
+		// UnspentOutputs returns the siacoin and siafund outputs that are
+		// spendable by the wallet, including the outputs created by
+		// unconfirmed transactions.
+		UnspentOutputs() []UnspentOutput
+
+		// Defrag creates a transaction that merges the smallest confirmed
+		// siacoin outputs of the wallet into a single output. The
+		// transaction is automatically given to the transaction pool, and is
+		// also returned to the caller.
+		Defrag() ([]types.Transaction, error)
+
+		// AddWatchAddress adds an address to the set of addresses that are
+		// watched by the wallet. The wallet rescans the blockchain to find
+		// the outputs and history of the address.
+		AddWatchAddress(WatchedAddress) error
+
+		// RemoveWatchAddress removes an address from the set of addresses
+		// that are watched by the wallet.
+		RemoveWatchAddress(types.UnlockHash) error
+
+		// WatchAddresses returns the addresses that are watched by the
+		// wallet.
+		WatchAddresses() []WatchedAddress
+
+		// WatchOnlyBalance returns the confirmed balance of the watched
+		// addresses.
+		WatchOnlyBalance() (siacoinBalance types.Currency, siafundBalance types.Currency)
+
+		// UnsignedWatchOnlyTransaction builds a transaction paying 'outputs'
+		// from the watched addresses whose unlock conditions are known. The
+		// transaction is returned unsigned, and is not given to the
+		// transaction pool.
+		UnsignedWatchOnlyTransaction(outputs []types.SiacoinOutput) (UnsignedTransaction, error)
+
+		// SignTransaction adds the required signatures of an unsigned
+		// transaction that can be made with the keys of the wallet. The
+		// signed transaction is returned, along with the signatures that
+		// are still missing.
+		SignTransaction(UnsignedTransaction) (UnsignedTransaction, error)
+
+		// CreateMultisigAddress creates and watches an address that
+		// requires 'required' signatures from a new key of the wallet and
+		// the public keys of the cosigners.
+		CreateMultisigAddress(required uint64, cosigners []types.SiaPublicKey) (types.UnlockConditions, error)
+
+		// UnsignedMultisigTransaction builds a transaction paying 'outputs'
+		// from a single watched address, such as a multisig address. The
+		// transaction is returned unsigned, and is not given to the
+		// transaction pool.
+		UnsignedMultisigTransaction(uh types.UnlockHash, outputs []types.SiacoinOutput) (UnsignedTransaction, error)
+
+		// MergeSignatures combines the signatures of several copies of the
+		// same unsigned transaction, each signed by a different cosigner.
+		MergeSignatures([]UnsignedTransaction) (UnsignedTransaction, error)
+
 		// SendSiafunds is a tool for sending siafunds from the wallet to an
 		// address. Sending money usually results in multiple transactions. The
 		// transactions are automatically given to the transaction pool, and
 		// are also returned to the caller.
 		SendSiafunds(amount types.Currency, dest types.UnlockHash) ([]types.Transaction, error)
+
+		// SiafundClaims returns the siacoin claim of each confirmed siafund
+		// output of the wallet.
+		SiafundClaims() []SiafundClaim
+
+		// ClaimHistory returns the siacoin claims that were paid out when
+		// siafund outputs of the wallet were spent, in the order that they
+		// were confirmed.
+		ClaimHistory() ([]ClaimPayout, error)
+
+		// ClaimSiafunds sends all of the siafunds of the wallet to a new
+		// address of the wallet, paying out their siacoin claims to addresses
+		// of the wallet without moving the siafunds to another owner. The
+		// transactions are automatically given to the transaction pool, and
+		// are also returned to the caller.
+		ClaimSiafunds() ([]types.Transaction, error)
 	}
 )
 
@@ -368,6 +580,35 @@ func CalculateWalletTransactionID(tid types.TransactionID, oid types.OutputID) W
 	return WalletTransactionID(crypto.HashAll(tid, oid))
 }
 
+// WalletFlows returns the siacoins and siafunds that a processed transaction
+// moves into and out of the addresses that are spendable by the wallet. Miner
+// payouts count as incoming siacoins.
+func WalletFlows(pt ProcessedTransaction) (incomingSiacoins, outgoingSiacoins, incomingSiafunds, outgoingSiafunds types.Currency) {
+	for _, input := range pt.Inputs {
+		if !input.WalletAddress {
+			continue
+		}
+		switch input.FundType {
+		case types.SpecifierSiacoinInput:
+			outgoingSiacoins = outgoingSiacoins.Add(input.Value)
+		case types.SpecifierSiafundInput:
+			outgoingSiafunds = outgoingSiafunds.Add(input.Value)
+		}
+	}
+	for _, output := range pt.Outputs {
+		if !output.WalletAddress {
+			continue
+		}
+		switch output.FundType {
+		case types.SpecifierSiacoinOutput, types.SpecifierMinerPayout:
+			incomingSiacoins = incomingSiacoins.Add(output.Value)
+		case types.SpecifierSiafundOutput:
+			incomingSiafunds = incomingSiafunds.Add(output.Value)
+		}
+	}
+	return incomingSiacoins, outgoingSiacoins, incomingSiafunds, outgoingSiafunds
+}
+
 // SeedToString converts a wallet seed to a human friendly string.
 func SeedToString(seed Seed, did mnemonics.DictionaryID) (string, error) {
 	fullChecksum := crypto.HashObject(seed)
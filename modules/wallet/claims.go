@@ -0,0 +1,161 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	errNoSiafunds = errors.New("wallet does not have any siafunds to claim with")
+)
+
+// siafundClaimsByHeight sorts siafund claims by confirmation height, then by
+// id.
+type siafundClaimsByHeight []modules.SiafundClaim
+
+func (sc siafundClaimsByHeight) Len() int      { return len(sc) }
+func (sc siafundClaimsByHeight) Swap(i, j int) { sc[i], sc[j] = sc[j], sc[i] }
+func (sc siafundClaimsByHeight) Less(i, j int) bool {
+	if sc[i].ConfirmationHeight != sc[j].ConfirmationHeight {
+		return sc[i].ConfirmationHeight < sc[j].ConfirmationHeight
+	}
+	return bytes.Compare(sc[i].ID[:], sc[j].ID[:]) < 0
+}
+
+// claimValue returns the number of siacoins that a siafund output can claim
+// from a siafund pool. The value is computed in the same way as the consensus
+// set computes the value of a claim output.
+func claimValue(pool types.Currency, sfo types.SiafundOutput) types.Currency {
+	return pool.Sub(sfo.ClaimStart).Div(types.SiafundCount).Mul(sfo.Value)
+}
+
+// SiafundClaims returns the siacoin claim of each confirmed siafund output of
+// the wallet, computed from the current siafund pool. The claims are sorted by
+// confirmation height.
+func (w *Wallet) SiafundClaims() []modules.SiafundClaim {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var claims []modules.SiafundClaim
+	err := w.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachSiafundOutput(tx.Bucket(bucketSiafundOutputs), func(sfoid types.SiafundOutputID, sfo types.SiafundOutput) {
+			claims = append(claims, modules.SiafundClaim{
+				ID:         sfoid,
+				UnlockHash: sfo.UnlockHash,
+				Value:      sfo.Value,
+				ClaimStart: sfo.ClaimStart,
+				ClaimValue: claimValue(w.siafundPool, sfo),
+			})
+		})
+		if err != nil {
+			return err
+		}
+		for i := range claims {
+			claims[i].ConfirmationHeight, err = dbGetConfirmationHeight(tx, types.OutputID(claims[i].ID))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the siafund outputs of the wallet:", err)
+	}
+	sort.Sort(siafundClaimsByHeight(claims))
+	return claims
+}
+
+// historyBlockHeight converts a height recorded in the transaction history,
+// which uses the wallet's consensusSetHeight and is therefore one greater than
+// the height of the block, to the height of the block.
+func historyBlockHeight(height types.BlockHeight) types.BlockHeight {
+	if height == 0 {
+		return 0
+	}
+	return height - 1
+}
+
+// ClaimHistory returns the siacoin claims that were paid out when siafund
+// outputs of the wallet were spent, in the order that they were confirmed.
+// The claims are found in the transaction history, where each siafund input
+// of a transaction is followed by the claim output that it created. The
+// heights are block heights, like the confirmation heights of SiafundClaims.
+func (w *Wallet) ClaimHistory() ([]modules.ClaimPayout, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var payouts []modules.ClaimPayout
+	err := w.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachProcessedTransaction(tx, 0, func(_ uint64, pt modules.ProcessedTransaction) bool {
+			var inputs []modules.ProcessedInput
+			for _, input := range pt.Inputs {
+				if input.FundType == types.SpecifierSiafundInput {
+					inputs = append(inputs, input)
+				}
+			}
+			var claims []modules.ProcessedOutput
+			for _, output := range pt.Outputs {
+				if output.FundType == types.SpecifierClaimOutput {
+					claims = append(claims, output)
+				}
+			}
+			sfis := pt.Transaction.SiafundInputs
+			if len(inputs) != len(sfis) || len(claims) != len(sfis) {
+				return true
+			}
+			for i, sfi := range sfis {
+				if !inputs[i].WalletAddress {
+					continue
+				}
+				payouts = append(payouts, modules.ClaimPayout{
+					SiafundOutputID:    sfi.ParentID,
+					TransactionID:      pt.TransactionID,
+					Siafunds:           inputs[i].Value,
+					ClaimUnlockHash:    sfi.ClaimUnlockHash,
+					Value:              claims[i].Value,
+					ConfirmationHeight: historyBlockHeight(pt.ConfirmationHeight),
+					MaturityHeight:     historyBlockHeight(claims[i].MaturityHeight),
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for i := range payouts {
+			payouts[i].ClaimStart, err = dbGetHistoricClaimStart(tx, payouts[i].SiafundOutputID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
+
+// ClaimSiafunds sends all of the siafunds of the wallet to a new address of
+// the wallet. Spending the siafund outputs pays out their siacoin claims, and
+// the transaction builder sets the claim address of each siafund input to an
+// address of the wallet, so the claims are realized without moving the
+// siafunds to another owner. The transactions are submitted to the
+// transaction pool and are also returned.
+func (w *Wallet) ClaimSiafunds() ([]types.Transaction, error) {
+	_, siafundBal, _ := w.ConfirmedBalance()
+	if siafundBal.IsZero() {
+		return nil, errNoSiafunds
+	}
+	uc, err := w.NextAddress()
+	if err != nil {
+		return nil, err
+	}
+	return w.SendSiafunds(siafundBal, uc.UnlockHash())
+}
@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationSiafundClaims checks that the wallet reports the claims of
+// its siafund outputs, and that ClaimSiafunds pays out the claims to the
+// wallet without moving the siafunds to another owner.
+func TestIntegrationSiafundClaims(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSiafundClaims")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	err = wt.wallet.LoadSiagKeys(wt.walletMasterKey, []string{"../../types/siag0of1of1.siakey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := wt.wallet.SiafundClaims()
+	var siafunds types.Currency
+	for _, claim := range claims {
+		siafunds = siafunds.Add(claim.Value)
+		if !claim.ClaimValue.IsZero() {
+			t.Error("siafund output has a claim before any contracts were formed:", claim.ClaimValue)
+		}
+	}
+	if siafunds.Cmp(types.NewCurrency64(2000)) != 0 {
+		t.Fatal("expecting claims for 2000 siafunds, got", siafunds)
+	}
+
+	// Form a file contract, which adds its tax to the siafund pool.
+	builder := wt.wallet.StartTransaction()
+	err = builder.FundSiacoins(types.NewCurrency64(5e9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcOutputs := []types.SiacoinOutput{{Value: types.NewCurrency64(4805e6)}}
+	builder.AddFileContract(types.FileContract{
+		FileSize:           5e3,
+		WindowStart:        wt.cs.Height() + 2,
+		WindowEnd:          wt.cs.Height() + 3,
+		Payout:             types.NewCurrency64(5e9),
+		ValidProofOutputs:  fcOutputs,
+		MissedProofOutputs: fcOutputs,
+	})
+	txns, err := builder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.tpool.AcceptTransactionSet(txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claimed types.Currency
+	for _, claim := range wt.wallet.SiafundClaims() {
+		claimed = claimed.Add(claim.ClaimValue)
+	}
+	_, _, claimBalance := wt.wallet.ConfirmedBalance()
+	if claimed.IsZero() || claimed.Cmp(claimBalance) != 0 {
+		t.Fatal("claims do not match the claim balance:", claimed, claimBalance)
+	}
+
+	// Claim the siacoins. The claims should be paid out to the wallet, and
+	// the siafunds should remain in the wallet.
+	_, err = wt.wallet.ClaimSiafunds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payouts, err := wt.wallet.ClaimHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts) == 0 {
+		t.Fatal("no claim payouts were recorded")
+	}
+	addrs := make(map[types.UnlockHash]struct{})
+	for _, addr := range wt.wallet.AllAddresses() {
+		addrs[addr] = struct{}{}
+	}
+	var paid types.Currency
+	for _, payout := range payouts {
+		if _, exists := addrs[payout.ClaimUnlockHash]; !exists {
+			t.Error("claim was paid to an address outside of the wallet")
+		}
+		paid = paid.Add(payout.Value)
+	}
+	if paid.Cmp(claimed) != 0 {
+		t.Error("claim payouts do not match the claims:", paid, claimed)
+	}
+	_, siafundBal, claimBalance := wt.wallet.ConfirmedBalance()
+	if siafundBal.Cmp(types.NewCurrency64(2000)) != 0 {
+		t.Error("siafunds left the wallet while claiming:", siafundBal)
+	}
+	if !claimBalance.IsZero() {
+		t.Error("claim balance should be zero after claiming:", claimBalance)
+	}
+
+	// The siafund outputs created by the claim were confirmed in the same
+	// block as the payouts, so both endpoints should report the height of
+	// that block.
+	height := wt.cs.Height()
+	for _, payout := range payouts {
+		if payout.ConfirmationHeight != height {
+			t.Error("payout has the wrong confirmation height:", payout.ConfirmationHeight, height)
+		}
+		if payout.MaturityHeight != height+types.MaturityDelay {
+			t.Error("payout has the wrong maturity height:", payout.MaturityHeight, height+types.MaturityDelay)
+		}
+	}
+	for _, claim := range wt.wallet.SiafundClaims() {
+		if claim.ConfirmationHeight != height {
+			t.Error("claim has the wrong confirmation height:", claim.ConfirmationHeight, height)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	errNoHistory = errors.New("wallet has no transaction history")
+	errNoKey     = errors.New("key does not exist in the database")
+
+	// bucketProcessedTransactions maps the index of a processed transaction
+	// to the processed transaction. Indices start at 1 and are assigned in
+	// the order that the transactions were confirmed, so that iterating over
+	// the bucket returns the history in chronological order.
+	bucketProcessedTransactions = []byte("ProcessedTransactions")
+
+	// bucketHistoryIndex holds the index that is assigned to the next
+	// processed transaction. It is not cleared when the wallet rescans the
+	// blockchain, so indices are never reused: a transaction that is
+	// reverted and confirmed again gets a new index, and a cursor into the
+	// history never points at a different transaction than it did before.
+	bucketHistoryIndex = []byte("HistoryIndex")
+
+	// bucketProcessedTxnIndex maps the id of a processed transaction to its
+	// index.
+	bucketProcessedTxnIndex = []byte("ProcessedTxnIndex")
+
+	// bucketAddrTransactions contains a key for each address and index of a
+	// processed transaction that has an input or output related to the
+	// address. The keys are the address followed by the index, so that the
+	// history of an address can be found by seeking to the address.
+	bucketAddrTransactions = []byte("AddrTransactions")
+
+	// bucketSiacoinOutputs and bucketSiafundOutputs map the ids of the
+	// unspent outputs of the wallet's spendable addresses to the outputs.
+	bucketSiacoinOutputs = []byte("SiacoinOutputs")
+	bucketSiafundOutputs = []byte("SiafundOutputs")
+
+	// bucketWatchedSiacoinOutputs and bucketWatchedSiafundOutputs map the ids
+	// of the unspent outputs of the watched addresses to the outputs.
+	bucketWatchedSiacoinOutputs = []byte("WatchedSiacoinOutputs")
+	bucketWatchedSiafundOutputs = []byte("WatchedSiafundOutputs")
+
+	// bucketHistoricOutputs maps the id of every output created in the
+	// blockchain to its value, so that the values of transaction inputs can
+	// be determined. bucketHistoricClaimStarts maps the id of every siafund
+	// output to its claim start.
+	bucketHistoricOutputs     = []byte("HistoricOutputs")
+	bucketHistoricClaimStarts = []byte("HistoricClaimStarts")
+
+	// bucketConfirmationHeights maps the id of each of the wallet's outputs to
+	// the wallet's consensusSetHeight when it was confirmed.
+	bucketConfirmationHeights = []byte("ConfirmationHeights")
+
+	// bucketSpentOutputs maps the id of each output spent by a transaction
+	// that the wallet built to the height at which it was spent. It is not
+	// derived from the blockchain, and is kept across rescans.
+	bucketSpentOutputs = []byte("SpentOutputs")
+
+	// bucketWallet holds the state of the wallet's consensus subscription: the
+	// id of the last consensus change processed, the consensus set height,
+	// and the siafund pool.
+	bucketWallet = []byte("Wallet")
+
+	keyConsensusChange = []byte("ConsensusChange")
+	keyConsensusHeight = []byte("ConsensusHeight")
+	keySiafundPool     = []byte("SiafundPool")
+
+	keyNextHistoryIndex = []byte("NextHistoryIndex")
+
+	// consensusBuckets are the buckets that are built from the consensus
+	// changes sent to the wallet, and are cleared when the wallet rescans the
+	// blockchain.
+	consensusBuckets = [][]byte{
+		bucketProcessedTransactions,
+		bucketProcessedTxnIndex,
+		bucketAddrTransactions,
+		bucketSiacoinOutputs,
+		bucketSiafundOutputs,
+		bucketWatchedSiacoinOutputs,
+		bucketWatchedSiafundOutputs,
+		bucketHistoricOutputs,
+		bucketHistoricClaimStarts,
+		bucketConfirmationHeights,
+		bucketWallet,
+	}
+)
+
+// encodeIndex encodes the index of a processed transaction as a big-endian
+// key, so that the keys of the history are sorted by index.
+func encodeIndex(index uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, index)
+	return b
+}
+
+// decodeIndex decodes a key created by encodeIndex.
+func decodeIndex(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// addrTransactionKey returns the key of bucketAddrTransactions that relates
+// an address to the processed transaction at 'index'.
+func addrTransactionKey(uh types.UnlockHash, index uint64) []byte {
+	return append(uh[:], encodeIndex(index)...)
+}
+
+// relatedAddresses returns the set of addresses related to the inputs and
+// outputs of a processed transaction.
+func relatedAddresses(pt modules.ProcessedTransaction) map[types.UnlockHash]struct{} {
+	addrs := make(map[types.UnlockHash]struct{})
+	for _, input := range pt.Inputs {
+		addrs[input.RelatedAddress] = struct{}{}
+	}
+	for _, output := range pt.Outputs {
+		if output.FundType == types.SpecifierMinerFee {
+			continue
+		}
+		addrs[output.RelatedAddress] = struct{}{}
+	}
+	return addrs
+}
+
+// dbPut encodes a key and a value and stores them in a bucket.
+func dbPut(b *bolt.Bucket, key, val interface{}) error {
+	return b.Put(encoding.Marshal(key), encoding.Marshal(val))
+}
+
+// dbGet decodes the value of a key of a bucket into 'val'. errNoKey is
+// returned if the key does not exist.
+func dbGet(b *bolt.Bucket, key, val interface{}) error {
+	v := b.Get(encoding.Marshal(key))
+	if v == nil {
+		return errNoKey
+	}
+	return encoding.Unmarshal(v, val)
+}
+
+// dbDelete removes a key from a bucket.
+func dbDelete(b *bolt.Bucket, key interface{}) error {
+	return b.Delete(encoding.Marshal(key))
+}
+
+// dbExists returns whether a key exists in a bucket.
+func dbExists(b *bolt.Bucket, key interface{}) bool {
+	return b.Get(encoding.Marshal(key)) != nil
+}
+
+// dbInit creates the buckets of the wallet's database if they do not exist.
+func dbInit(tx *bolt.Tx) error {
+	for _, b := range append(consensusBuckets, bucketSpentOutputs, bucketHistoryIndex) {
+		_, err := tx.CreateBucketIfNotExists(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbReset deletes everything that the wallet learned from the consensus set,
+// including the id of the last consensus change, and creates empty buckets in
+// its place.
+func dbReset(tx *bolt.Tx) error {
+	for _, b := range consensusBuckets {
+		if tx.Bucket(b) != nil {
+			err := tx.DeleteBucket(b)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.CreateBucket(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbAppendProcessedTransaction adds a processed transaction to the end of the
+// transaction history, under an index that has not been used before.
+func dbAppendProcessedTransaction(tx *bolt.Tx, pt modules.ProcessedTransaction) error {
+	// Databases created before the next index was stored continue after the
+	// last transaction of the history.
+	index := uint64(1)
+	if k, _ := tx.Bucket(bucketProcessedTransactions).Cursor().Last(); k != nil {
+		index = decodeIndex(k) + 1
+	}
+	if v := tx.Bucket(bucketHistoryIndex).Get(keyNextHistoryIndex); v != nil && decodeIndex(v) > index {
+		index = decodeIndex(v)
+	}
+	err := tx.Bucket(bucketHistoryIndex).Put(keyNextHistoryIndex, encodeIndex(index+1))
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(bucketProcessedTransactions).Put(encodeIndex(index), encoding.Marshal(pt))
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(bucketProcessedTxnIndex).Put(pt.TransactionID[:], encodeIndex(index))
+	if err != nil {
+		return err
+	}
+	for uh := range relatedAddresses(pt) {
+		err = tx.Bucket(bucketAddrTransactions).Put(addrTransactionKey(uh, index), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbGetLastProcessedTransaction returns the most recent processed transaction
+// of the transaction history.
+func dbGetLastProcessedTransaction(tx *bolt.Tx) (pt modules.ProcessedTransaction, err error) {
+	k, v := tx.Bucket(bucketProcessedTransactions).Cursor().Last()
+	if k == nil {
+		return modules.ProcessedTransaction{}, errNoHistory
+	}
+	err = encoding.Unmarshal(v, &pt)
+	return pt, err
+}
+
+// dbDeleteLastProcessedTransaction removes the most recent processed
+// transaction from the transaction history.
+func dbDeleteLastProcessedTransaction(tx *bolt.Tx) error {
+	pt, err := dbGetLastProcessedTransaction(tx)
+	if err != nil {
+		return err
+	}
+	k, _ := tx.Bucket(bucketProcessedTransactions).Cursor().Last()
+	index := decodeIndex(k)
+	for uh := range relatedAddresses(pt) {
+		err = tx.Bucket(bucketAddrTransactions).Delete(addrTransactionKey(uh, index))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Bucket(bucketProcessedTxnIndex).Delete(pt.TransactionID[:])
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketProcessedTransactions).Delete(encodeIndex(index))
+}
+
+// dbGetProcessedTransaction returns the processed transaction at 'index'.
+func dbGetProcessedTransaction(tx *bolt.Tx, index uint64) (pt modules.ProcessedTransaction, err error) {
+	v := tx.Bucket(bucketProcessedTransactions).Get(encodeIndex(index))
+	if v == nil {
+		return modules.ProcessedTransaction{}, errNoHistory
+	}
+	err = encoding.Unmarshal(v, &pt)
+	return pt, err
+}
+
+// dbGetProcessedTransactionIndex returns the index of the processed
+// transaction with id 'txid'.
+func dbGetProcessedTransactionIndex(tx *bolt.Tx, txid types.TransactionID) (uint64, bool) {
+	v := tx.Bucket(bucketProcessedTxnIndex).Get(txid[:])
+	if v == nil {
+		return 0, false
+	}
+	return decodeIndex(v), true
+}
+
+// dbForEachProcessedTransaction calls fn on each processed transaction with an
+// index of at least 'start', in chronological order, until fn returns false.
+func dbForEachProcessedTransaction(tx *bolt.Tx, start uint64, fn func(index uint64, pt modules.ProcessedTransaction) bool) error {
+	c := tx.Bucket(bucketProcessedTransactions).Cursor()
+	for k, v := c.Seek(encodeIndex(start)); k != nil; k, v = c.Next() {
+		var pt modules.ProcessedTransaction
+		err := encoding.Unmarshal(v, &pt)
+		if err != nil {
+			return err
+		}
+		if !fn(decodeIndex(k), pt) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// dbForEachAddrTransaction calls fn on each processed transaction related to
+// 'uh' with an index of at least 'start', in chronological order, until fn
+// returns false.
+func dbForEachAddrTransaction(tx *bolt.Tx, uh types.UnlockHash, start uint64, fn func(index uint64, pt modules.ProcessedTransaction) bool) error {
+	c := tx.Bucket(bucketAddrTransactions).Cursor()
+	for k, _ := c.Seek(addrTransactionKey(uh, start)); k != nil && len(k) == len(uh)+8; k, _ = c.Next() {
+		var addr types.UnlockHash
+		copy(addr[:], k)
+		if addr != uh {
+			break
+		}
+		index := decodeIndex(k[len(uh):])
+		pt, err := dbGetProcessedTransaction(tx, index)
+		if err != nil {
+			return err
+		}
+		if !fn(index, pt) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// dbGetConsensusState returns the id of the last consensus change processed
+// by the wallet, along with the consensus set height and siafund pool after
+// the change. modules.ConsensusChangeBeginning is returned if the wallet has
+// not processed any consensus changes.
+func dbGetConsensusState(tx *bolt.Tx) (ccid modules.ConsensusChangeID, height types.BlockHeight, pool types.Currency, err error) {
+	b := tx.Bucket(bucketWallet)
+	v := b.Get(keyConsensusChange)
+	if v == nil {
+		return modules.ConsensusChangeBeginning, 0, types.ZeroCurrency, nil
+	}
+	copy(ccid[:], v)
+	err = encoding.Unmarshal(b.Get(keyConsensusHeight), &height)
+	if err != nil {
+		return modules.ConsensusChangeID{}, 0, types.Currency{}, err
+	}
+	err = encoding.Unmarshal(b.Get(keySiafundPool), &pool)
+	if err != nil {
+		return modules.ConsensusChangeID{}, 0, types.Currency{}, err
+	}
+	return ccid, height, pool, nil
+}
+
+// dbPutConsensusState records the id of the last consensus change processed by
+// the wallet, along with the consensus set height and siafund pool after the
+// change.
+func dbPutConsensusState(tx *bolt.Tx, ccid modules.ConsensusChangeID, height types.BlockHeight, pool types.Currency) error {
+	b := tx.Bucket(bucketWallet)
+	err := b.Put(keyConsensusChange, ccid[:])
+	if err != nil {
+		return err
+	}
+	err = b.Put(keyConsensusHeight, encoding.Marshal(height))
+	if err != nil {
+		return err
+	}
+	return b.Put(keySiafundPool, encoding.Marshal(pool))
+}
+
+// dbForEachSiacoinOutput calls fn on each siacoin output of a bucket.
+func dbForEachSiacoinOutput(b *bolt.Bucket, fn func(types.SiacoinOutputID, types.SiacoinOutput)) error {
+	return b.ForEach(func(k, v []byte) error {
+		var id types.SiacoinOutputID
+		var sco types.SiacoinOutput
+		copy(id[:], k)
+		err := encoding.Unmarshal(v, &sco)
+		if err != nil {
+			return err
+		}
+		fn(id, sco)
+		return nil
+	})
+}
+
+// dbForEachSiafundOutput calls fn on each siafund output of a bucket.
+func dbForEachSiafundOutput(b *bolt.Bucket, fn func(types.SiafundOutputID, types.SiafundOutput)) error {
+	return b.ForEach(func(k, v []byte) error {
+		var id types.SiafundOutputID
+		var sfo types.SiafundOutput
+		copy(id[:], k)
+		err := encoding.Unmarshal(v, &sfo)
+		if err != nil {
+			return err
+		}
+		fn(id, sfo)
+		return nil
+	})
+}
+
+// dbGetHistoricOutput returns the value of an output created in the
+// blockchain. Zero is returned if the output is unknown.
+func dbGetHistoricOutput(tx *bolt.Tx, oid types.OutputID) (types.Currency, error) {
+	var value types.Currency
+	err := dbGet(tx.Bucket(bucketHistoricOutputs), oid, &value)
+	if err == errNoKey {
+		return types.ZeroCurrency, nil
+	}
+	return value, err
+}
+
+// dbGetHistoricClaimStart returns the claim start of a siafund output created
+// in the blockchain. Zero is returned if the output is unknown.
+func dbGetHistoricClaimStart(tx *bolt.Tx, sfoid types.SiafundOutputID) (types.Currency, error) {
+	var claimStart types.Currency
+	err := dbGet(tx.Bucket(bucketHistoricClaimStarts), sfoid, &claimStart)
+	if err == errNoKey {
+		return types.ZeroCurrency, nil
+	}
+	return claimStart, err
+}
+
+// dbGetConfirmationHeight returns the height of the block that confirmed an
+// output of the wallet, or zero if it is unknown. The heights are recorded
+// using the wallet's consensusSetHeight, which counts the genesis block and is
+// therefore one greater than the height of the block.
+func dbGetConfirmationHeight(tx *bolt.Tx, oid types.OutputID) (types.BlockHeight, error) {
+	var height types.BlockHeight
+	err := dbGet(tx.Bucket(bucketConfirmationHeights), oid, &height)
+	if err == errNoKey || height == 0 {
+		return 0, nil
+	}
+	return height - 1, err
+}
+
+// dbPruneSpentOutputs removes the outputs that were spent by the wallet more
+// than RespendTimeout blocks before 'height', as they can be spent again.
+func dbPruneSpentOutputs(tx *bolt.Tx, height types.BlockHeight) error {
+	if height < RespendTimeout {
+		return nil
+	}
+	b := tx.Bucket(bucketSpentOutputs)
+	var expired [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var spendHeight types.BlockHeight
+		err := encoding.Unmarshal(v, &spendHeight)
+		if err != nil {
+			return err
+		}
+		if spendHeight <= height-RespendTimeout {
+			expired = append(expired, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		err = b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/miner"
+	"github.com/NebulousLabs/Sia/modules/transactionpool"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+// TestIntegrationResumeSubscription checks that a reopened wallet loads its
+// outputs and history from the database, and resumes its consensus
+// subscription from the last consensus change that it processed.
+func TestIntegrationResumeSubscription(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationResumeSubscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	siacoinBal, siafundBal, _ := wt.wallet.ConfirmedBalance()
+	outputs := wt.wallet.UnspentOutputs()
+	history, err := wt.wallet.Transactions(0, wt.cs.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The outputs and history should be available before the wallet is
+	// unlocked and subscribed to the consensus set.
+	w, err := New(wt.cs, wt.tpool, filepath.Join(wt.persistDir, modules.WalletDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	siacoinBal2, siafundBal2, _ := w.ConfirmedBalance()
+	if siacoinBal2.Cmp(siacoinBal) != 0 || siafundBal2.Cmp(siafundBal) != 0 {
+		t.Fatal("reopened wallet has a different balance:", siacoinBal2, siacoinBal)
+	}
+	if len(w.UnspentOutputs()) != len(outputs) {
+		t.Fatal("reopened wallet has a different number of outputs:", len(w.UnspentOutputs()), len(outputs))
+	}
+	history2, err := w.Transactions(0, wt.cs.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history2) != len(history) {
+		t.Fatal("reopened wallet has a different history:", len(history2), len(history))
+	}
+	err = w.db.View(func(tx *bolt.Tx) error {
+		ccid, height, _, err := dbGetConsensusState(tx)
+		if err != nil {
+			return err
+		}
+		if ccid == modules.ConsensusChangeBeginning {
+			t.Error("wallet did not record the last consensus change")
+		}
+		if height != wt.cs.Height()+1 {
+			t.Error("wallet recorded the wrong consensus height:", height, wt.cs.Height()+1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlock the wallet and mine a block. Only the new block should be added
+	// to the history.
+	err = w.Unlock(wt.walletMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := miner.New(wt.cs, wt.tpool, w, filepath.Join(wt.persistDir, modules.MinerDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history2, err = w.Transactions(0, wt.cs.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history2) != len(history)+1 {
+		t.Error("resumed wallet has the wrong history length:", len(history2), len(history)+1)
+	}
+	siacoinBal2, _, _ = w.ConfirmedBalance()
+	if siacoinBal2.Cmp(siacoinBal) <= 0 {
+		t.Error("resumed wallet did not receive a matured miner payout")
+	}
+}
+
+// TestIntegrationResumeUnknownChange checks that the wallet rescans the
+// blockchain if the consensus set does not know the last consensus change
+// recorded by the wallet.
+func TestIntegrationResumeUnknownChange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationResumeUnknownChange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	siacoinBal, _, _ := wt.wallet.ConfirmedBalance()
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the recorded consensus change and clear the outputs, so that
+	// the wallet can only recover its balance through a rescan.
+	w, err := New(wt.cs, wt.tpool, filepath.Join(wt.persistDir, modules.WalletDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		err := dbReset(tx)
+		if err != nil {
+			return err
+		}
+		return dbPutConsensusState(tx, modules.ConsensusChangeID{1}, 0, types.ZeroCurrency)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Unlock(wt.walletMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoinBal2, _, _ := w.ConfirmedBalance()
+	if siacoinBal2.Cmp(siacoinBal) != 0 {
+		t.Error("wallet did not rescan after an unknown consensus change:", siacoinBal2, siacoinBal)
+	}
+}
+
+// TestIntegrationHistoryIndexNotReused checks that a processed transaction
+// that is reverted and confirmed again does not reuse its old index.
+func TestIntegrationHistoryIndexNotReused(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationHistoryIndexNotReused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	wt.wallet.mu.Lock()
+	defer wt.wallet.mu.Unlock()
+	err = wt.wallet.db.Update(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(bucketProcessedTransactions).Cursor().Last()
+		if k == nil {
+			return errNoHistory
+		}
+		last := decodeIndex(k)
+		pt, err := dbGetLastProcessedTransaction(tx)
+		if err != nil {
+			return err
+		}
+		if err := dbDeleteLastProcessedTransaction(tx); err != nil {
+			return err
+		}
+		if err := dbAppendProcessedTransaction(tx, pt); err != nil {
+			return err
+		}
+		index, exists := dbGetProcessedTransactionIndex(tx, pt.TransactionID)
+		if !exists || index != last+1 {
+			t.Errorf("expected the transaction to be appended at index %v, got %v", last+1, index)
+		}
+		if _, err := dbGetProcessedTransaction(tx, last); err != errNoHistory {
+			t.Error("reverted index is still in use")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newPrunedWallet creates a consensus set that prunes blocks, along with a
+// new encrypted wallet that uses it. The consensus set is at the genesis
+// block, and can be brought up to date with syncPrunedConsensusSet.
+func newPrunedWallet(name string) (modules.ConsensusSet, *Wallet, crypto.TwofishKey, func(), error) {
+	testdir := build.TempDir(modules.WalletDir, name+" - pruned")
+	g, err := gateway.New("localhost:0", filepath.Join(testdir, modules.GatewayDir))
+	if err != nil {
+		return nil, nil, crypto.TwofishKey{}, nil, err
+	}
+	cs, err := consensus.NewWithSettings(g, filepath.Join(testdir, modules.ConsensusDir), consensus.Settings{PruneDepth: consensus.MinPruneDepth})
+	if err != nil {
+		g.Close()
+		return nil, nil, crypto.TwofishKey{}, nil, err
+	}
+	closeAll := func() {
+		cs.Close()
+		g.Close()
+	}
+	tp, err := transactionpool.New(cs, g)
+	if err != nil {
+		closeAll()
+		return nil, nil, crypto.TwofishKey{}, nil, err
+	}
+	w, err := New(cs, tp, filepath.Join(testdir, modules.WalletDir))
+	if err != nil {
+		closeAll()
+		return nil, nil, crypto.TwofishKey{}, nil, err
+	}
+	var masterKey crypto.TwofishKey
+	_, err = rand.Read(masterKey[:])
+	if err == nil {
+		_, err = w.Encrypt(masterKey)
+	}
+	if err != nil {
+		w.Close()
+		closeAll()
+		return nil, nil, crypto.TwofishKey{}, nil, err
+	}
+	return cs, w, masterKey, func() {
+		w.Close()
+		closeAll()
+	}, nil
+}
+
+// syncPrunedConsensusSet mines enough blocks for a pruning consensus set to
+// prune some of them, and then gives it every block of the wallet tester.
+func syncPrunedConsensusSet(wt *walletTester, cs modules.ConsensusSet) error {
+	for i := types.BlockHeight(0); i < consensus.MinPruneDepth; i++ {
+		_, err := wt.miner.AddBlock()
+		if err != nil {
+			return err
+		}
+	}
+	for h := cs.Height() + 1; h <= wt.cs.Height(); h++ {
+		b, _ := wt.cs.BlockAtHeight(h)
+		if err := cs.AcceptBlock(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestIntegrationUnlockPruned checks that unlocking a new wallet on a pruned
+// consensus set fails with a clear error, as the blockchain cannot be scanned.
+func TestIntegrationUnlockPruned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationUnlockPruned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	cs, w, masterKey, closeFn, err := newPrunedWallet("TestIntegrationUnlockPruned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFn()
+	if err := syncPrunedConsensusSet(wt, cs); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new wallet needs to scan the whole blockchain.
+	err = w.Unlock(masterKey)
+	if err == nil || !strings.Contains(err.Error(), errPrunedBlockchain.Error()) {
+		t.Fatal("expected errPrunedBlockchain, got", err)
+	}
+}
+
+// TestIntegrationRescanPruned checks that a rescan on a pruned consensus set,
+// such as the one started by adding a watched address, fails with a clear
+// error and leaves the wallet unsubscribed, so that later rescans fail as
+// well instead of silently leaving the wallet without updates.
+func TestIntegrationRescanPruned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationRescanPruned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Subscribe the wallet before any blocks have been pruned.
+	cs, w, masterKey, closeFn, err := newPrunedWallet("TestIntegrationRescanPruned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFn()
+	if err := w.Unlock(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncPrunedConsensusSet(wt, cs); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := byte(1); i <= 2; i++ {
+		err = w.AddWatchAddress(modules.WatchedAddress{UnlockHash: types.UnlockHash{i}})
+		if err != errPrunedBlockchain {
+			t.Fatal("expected errPrunedBlockchain, got", err)
+		}
+		w.mu.RLock()
+		subscribed := w.subscribed
+		w.mu.RUnlock()
+		if subscribed {
+			t.Fatal("wallet is marked as subscribed after a failed rescan")
+		}
+	}
+}
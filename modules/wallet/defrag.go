@@ -0,0 +1,91 @@
+package wallet
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// defragBatchSize is the maximum number of outputs that are merged by a
+	// single defrag transaction.
+	defragBatchSize = 35
+
+	// estimatedInputSize is the encoded size of a siacoin input and its
+	// signature, used when estimating the fee of a defrag transaction.
+	estimatedInputSize = 250
+)
+
+var (
+	errDefragNotNeeded = errors.New("wallet does not have enough spendable outputs to defrag")
+)
+
+// Defrag creates a transaction that merges the smallest spendable confirmed
+// siacoin outputs of the wallet into a single output, paying a miner fee sized
+// from the fee estimation of the transaction pool. The transaction is
+// submitted to the transaction pool and is also returned.
+func (w *Wallet) Defrag() ([]types.Transaction, error) {
+	// Collect the spendable outputs, smallest first.
+	w.mu.Lock()
+	var so sortedOutputs
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return dbForEachSiacoinOutput(tx.Bucket(bucketSiacoinOutputs), func(scoid types.SiacoinOutputID, sco types.SiacoinOutput) {
+			if w.recentlySpent(tx, types.OutputID(scoid)) || w.consensusSetHeight < w.keys[sco.UnlockHash].UnlockConditions.Timelock {
+				return
+			}
+			so.ids = append(so.ids, scoid)
+			so.outputs = append(so.outputs, sco)
+		})
+	})
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(so.ids) < 2 {
+		return nil, errDefragNotNeeded
+	}
+	sort.Sort(so)
+	if len(so.ids) > defragBatchSize {
+		so.ids = so.ids[:defragBatchSize]
+		so.outputs = so.outputs[:defragBatchSize]
+	}
+
+	var fund types.Currency
+	for _, sco := range so.outputs {
+		fund = fund.Add(sco.Value)
+	}
+	_, maxFee := w.tpool.FeeEstimation()
+	fee := maxFee.Mul(types.NewCurrency64(uint64(len(so.ids)) * estimatedInputSize))
+	if fund.Cmp(fee) <= 0 {
+		return nil, modules.ErrLowBalance
+	}
+
+	txnBuilder := w.StartTransaction()
+	err = txnBuilder.FundSiacoinsWithOutputs(fund, so.ids)
+	if err != nil {
+		return nil, err
+	}
+	uc, err := w.NextAddress()
+	if err != nil {
+		txnBuilder.Drop()
+		return nil, err
+	}
+	txnBuilder.AddMinerFee(fee)
+	txnBuilder.AddSiacoinOutput(types.SiacoinOutput{
+		Value:      fund.Sub(fee),
+		UnlockHash: uc.UnlockHash(),
+	})
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		return nil, err
+	}
+	err = w.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		return nil, err
+	}
+	return txnSet, nil
+}
@@ -0,0 +1,64 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationDefrag checks that Defrag merges the outputs of the wallet
+// into a single output.
+func TestIntegrationDefrag(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationDefrag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// The wallet only has one output.
+	_, err = wt.wallet.Defrag()
+	if err != errDefragNotNeeded {
+		t.Fatal("expected errDefragNotNeeded, got", err)
+	}
+
+	// Split the output into several outputs.
+	var outputs []types.SiacoinOutput
+	for i := 0; i < 5; i++ {
+		uc, err := wt.wallet.NextAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, types.SiacoinOutput{Value: types.SiacoinPrecision, UnlockHash: uc.UnlockHash()})
+	}
+	_, err = wt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(wt.wallet.UnspentOutputs())
+	if before < len(outputs) {
+		t.Fatal("outputs were not created:", before)
+	}
+
+	txnSet, err := wt.wallet.Defrag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := txnSet[len(txnSet)-1]
+	if len(txnSet) != 1 || len(txn.SiacoinInputs) != before || len(txn.SiacoinOutputs) != 1 || len(txn.MinerFees) != 1 {
+		t.Fatal("defrag transaction does not merge every output:", len(txn.SiacoinInputs), len(txn.SiacoinOutputs))
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := len(wt.wallet.UnspentOutputs()); after >= before {
+		t.Error("defrag did not reduce the number of outputs:", before, after)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"crypto/rand"
 	"errors"
+	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -123,6 +125,97 @@ func (w *Wallet) unlock(masterKey crypto.TwofishKey) error {
 	return nil
 }
 
+// ChangeKey re-encrypts the wallet using a new master key. The primary seed,
+// the auxiliary seeds, the unseeded keys and the encryption verification are
+// re-encrypted in memory, and then written to the settings file in a single
+// atomic save, so that an interrupted change leaves the old key valid. A
+// backup of each seed encrypted with the new key is written to the wallet
+// directory, and the seed backups encrypted with the old key are deleted once
+// the change has been saved. The wallet does not need to be unlocked.
+func (w *Wallet) ChangeKey(oldKey, newKey crypto.TwofishKey) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.persist.EncryptionVerification) == 0 {
+		return errUnencryptedWallet
+	}
+	err := w.checkMasterKey(oldKey)
+	if err != nil {
+		return err
+	}
+
+	// Re-encrypt each seed and key into a copy of the persist structure, so
+	// that the wallet is unchanged if any step fails.
+	newPersist := w.persist
+	seed, err := decryptSeedFile(oldKey, w.persist.PrimarySeedFile)
+	if err != nil {
+		return err
+	}
+	newPersist.PrimarySeedFile, err = w.encryptAndSaveSeedFile(newKey, seed)
+	crypto.SecureWipe(seed[:])
+	if err != nil {
+		return err
+	}
+	newPersist.AuxiliarySeedFiles = nil
+	for _, sf := range w.persist.AuxiliarySeedFiles {
+		seed, err := decryptSeedFile(oldKey, sf)
+		if err != nil {
+			return err
+		}
+		newSF, err := w.encryptAndSaveSeedFile(newKey, seed)
+		crypto.SecureWipe(seed[:])
+		if err != nil {
+			return err
+		}
+		newPersist.AuxiliarySeedFiles = append(newPersist.AuxiliarySeedFiles, newSF)
+	}
+	newPersist.UnseededKeys = nil
+	for _, uk := range w.persist.UnseededKeys {
+		sk, err := decryptSpendableKeyFile(oldKey, uk)
+		if err != nil {
+			return err
+		}
+		skf, err := encryptSpendableKey(newKey, sk)
+		if err != nil {
+			return err
+		}
+		newPersist.UnseededKeys = append(newPersist.UnseededKeys, skf)
+	}
+	uk := uidEncryptionKey(newKey, newPersist.UID)
+	newPersist.EncryptionVerification, err = uk.EncryptBytes(make([]byte, encryptionVerificationLen))
+	if err != nil {
+		return err
+	}
+
+	// Replace the settings file atomically.
+	err = persist.SaveFileSync(settingsMetadata, newPersist, filepath.Join(w.persistDir, settingsFile))
+	if err != nil {
+		return err
+	}
+	w.persist = newPersist
+	w.log.Println("INFO: Changed the wallet encryption key.")
+
+	// The old key is no longer valid, so the seed backups and the settings
+	// backups that it can decrypt are deleted. The settings backups hold the
+	// unseeded keys, so they are replaced by a backup encrypted with the new
+	// key. The change itself has already succeeded.
+	err = w.removeSeedBackups(oldKey)
+	if err != nil {
+		w.log.Println("WARN: unable to delete the seed backups encrypted with the old key:", err)
+	}
+	removed, err := w.removeSettingsBackups(oldKey)
+	if err != nil {
+		w.log.Println("WARN: unable to delete the settings backups encrypted with the old key:", err)
+	}
+	if removed > 0 {
+		err = w.createSettingsBackup()
+		if err != nil {
+			w.log.Println("WARN: unable to back up the settings encrypted with the new key:", err)
+		}
+	}
+	return nil
+}
+
 // wipeSecrets erases all of the seeds and secret keys in the wallet.
 func (w *Wallet) wipeSecrets() {
 	// 'for i := range' must be used to prevent copies of secret data from
@@ -204,16 +297,22 @@ func (w *Wallet) Unlock(masterKey crypto.TwofishKey) error {
 	}
 
 	// Subscribe to the consensus set if this is the first unlock for the
-	// wallet object.
+	// wallet object, or if a rescan has lost the subscription. The
+	// subscription resumes from the last consensus change recorded in the
+	// wallet's database.
 	if !subscribed {
-		err = w.cs.ConsensusSetSubscribe(w, modules.ConsensusChangeBeginning)
+		err = w.managedSubscribe()
 		if err != nil {
 			return errors.New("wallet subscription failed: " + err.Error())
 		}
-		w.tpool.TransactionPoolSubscribe(w)
 		w.mu.Lock()
+		tpoolSubscribed := w.tpoolSubscribed
 		w.subscribed = true
+		w.tpoolSubscribed = true
 		w.mu.Unlock()
+		if !tpoolSubscribed {
+			w.tpool.TransactionPoolSubscribe(w)
+		}
 	}
 	return nil
 }
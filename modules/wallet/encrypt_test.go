@@ -8,6 +8,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -108,6 +109,10 @@ func TestIntegrationPreEncryption(t *testing.T) {
 
 	// Create a second wallet using the same directory - make sure that if any
 	// files have been created, the wallet is still being treated as new.
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
 	w1, err := New(wt.cs, wt.tpool, filepath.Join(wt.persistDir, modules.WalletDir))
 	if err != nil {
 		t.Fatal(err)
@@ -243,3 +248,119 @@ func TestLock(t *testing.T) {
 		t.Error("balance should increase after a block was mined")
 	}
 }
+
+// TestIntegrationChangeKey checks that the seeds and unseeded keys of the
+// wallet are re-encrypted when the master key is changed.
+func TestIntegrationChangeKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationChangeKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Give the wallet an auxiliary seed and an unseeded key.
+	var auxSeed modules.Seed
+	_, err = rand.Read(auxSeed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.wallet.LoadSeed(wt.walletMasterKey, auxSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.wallet.LoadSiagKeys(wt.walletMasterKey, []string{"../../types/siag0of1of1.siakey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Change the key.
+	var newKey crypto.TwofishKey
+	_, err = rand.Read(newKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.wallet.ChangeKey(newKey, newKey)
+	if err != modules.ErrBadEncryptionKey {
+		t.Fatal("expected ErrBadEncryptionKey, got", err)
+	}
+	err = wt.wallet.ChangeKey(wt.walletMasterKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only seed backups encrypted with the new key should remain.
+	backups, err := filepath.Glob(filepath.Join(wt.wallet.persistDir, seedFilePrefix+"*"+seedFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatal("expected 2 seed backups, got", len(backups))
+	}
+	for _, backup := range backups {
+		var sf SeedFile
+		err = persist.LoadFile(seedMetadata, &sf, backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decryptSeedFile(wt.walletMasterKey, sf); err == nil {
+			t.Error("seed backup can still be decrypted with the old key")
+		}
+		if _, err := decryptSeedFile(newKey, sf); err != nil {
+			t.Error("seed backup cannot be decrypted with the new key:", err)
+		}
+	}
+
+	// The settings backup created when the unseeded key was loaded should
+	// have been replaced by one encrypted with the new key.
+	backups, err = filepath.Glob(filepath.Join(wt.wallet.persistDir, settingsBackupPrefix+"*"+settingsFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatal("expected 1 settings backup, got", len(backups))
+	}
+	var wp WalletPersist
+	err = persist.LoadFile(settingsMetadata, &wp, backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uidEncryptionKey(wt.walletMasterKey, wp.UID).DecryptBytes(wp.EncryptionVerification); err == nil {
+		t.Error("settings backup can still be decrypted with the old key")
+	}
+	if _, err := uidEncryptionKey(newKey, wp.UID).DecryptBytes(wp.EncryptionVerification); err != nil {
+		t.Error("settings backup cannot be decrypted with the new key:", err)
+	}
+
+	// Load the wallet from disk. Only the new key should unlock it, and all
+	// of the seeds and keys should be restored.
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(wt.cs, wt.tpool, wt.wallet.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Unlock(wt.walletMasterKey)
+	if err != modules.ErrBadEncryptionKey {
+		t.Fatal("expected ErrBadEncryptionKey, got", err)
+	}
+	err = w.Unlock(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := w.AllSeeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) != 2 || seeds[1] != auxSeed {
+		t.Error("auxiliary seed was not re-encrypted")
+	}
+	_, siafundBal, _ := w.ConfirmedBalance()
+	if siafundBal.Cmp(types.NewCurrency64(2000)) != 0 {
+		t.Error("unseeded key was not re-encrypted:", siafundBal)
+	}
+}
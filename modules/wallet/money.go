@@ -1,10 +1,82 @@
 package wallet
 
 import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// estimatedTransactionOverhead is added to the encoded size of the outputs
+	// of a transaction for the initial estimate of its fee. It covers the
+	// inputs, signatures, and refund output of the transaction, as well as the
+	// parent transaction that the transaction builder creates to fund it. The
+	// fee is topped up if the built transaction turns out to be larger.
+	estimatedTransactionOverhead = 2e3
+)
+
+var (
+	errNoOutputs = errors.New("at least one output must be specified")
+
+	// signatureSize is the encoded size of a signature covering the whole
+	// transaction, which is the kind of signature that the wallet adds for
+	// each required signature of an input.
+	signatureSize = len(encoding.Marshal(types.TransactionSignature{
+		CoveredFields: types.CoveredFields{WholeTransaction: true},
+		Signature:     make([]byte, crypto.SignatureSize),
+	}))
 )
 
+// signedSize returns the encoded size of 'txn' and its parents once every
+// input of 'txn' that is not signed yet has been signed.
+func signedSize(txn types.Transaction, parents []types.Transaction) uint64 {
+	signed := make(map[crypto.Hash]struct{})
+	for _, sig := range txn.TransactionSignatures {
+		signed[sig.ParentID] = struct{}{}
+	}
+	var sigs uint64
+	for _, sci := range txn.SiacoinInputs {
+		if _, exists := signed[crypto.Hash(sci.ParentID)]; !exists {
+			sigs += sci.UnlockConditions.SignaturesRequired
+		}
+	}
+	for _, sfi := range txn.SiafundInputs {
+		if _, exists := signed[crypto.Hash(sfi.ParentID)]; !exists {
+			sigs += sfi.UnlockConditions.SignaturesRequired
+		}
+	}
+	return uint64(len(encoding.Marshal(parents))+len(encoding.Marshal(txn))) + sigs*uint64(signatureSize)
+}
+
+// topUpMinerFee increases the miner fee of the transaction being built until
+// it pays 'feePerByte' for the signed size of the transaction and its
+// parents. 'fee' is the miner fee that has already been funded and added.
+func topUpMinerFee(txnBuilder modules.TransactionBuilder, fee, feePerByte types.Currency) error {
+	for {
+		txn, parents := txnBuilder.View()
+		required := feePerByte.Mul(types.NewCurrency64(signedSize(txn, parents)))
+		if fee.Cmp(required) >= 0 {
+			return nil
+		}
+		topUp := required.Sub(fee)
+		err := txnBuilder.FundSiacoins(topUp)
+		if err != nil {
+			return err
+		}
+		txnBuilder.AddMinerFee(topUp)
+		fee = required
+	}
+}
+
 // sortedOutputs is a struct containing a slice of siacoin outputs and their
 // corresponding ids. sortedOutputs can be sorted using the sort package.
 type sortedOutputs struct {
@@ -12,20 +84,186 @@ type sortedOutputs struct {
 	outputs []types.SiacoinOutput
 }
 
+// unspentOutputsByHeight sorts unspent outputs by confirmation height, then
+// by id.
+type unspentOutputsByHeight []modules.UnspentOutput
+
+func (uo unspentOutputsByHeight) Len() int      { return len(uo) }
+func (uo unspentOutputsByHeight) Swap(i, j int) { uo[i], uo[j] = uo[j], uo[i] }
+func (uo unspentOutputsByHeight) Less(i, j int) bool {
+	if uo[i].ConfirmationHeight != uo[j].ConfirmationHeight {
+		return uo[i].ConfirmationHeight < uo[j].ConfirmationHeight
+	}
+	return bytes.Compare(uo[i].ID[:], uo[j].ID[:]) < 0
+}
+
+// recentlySpent returns true if the wallet has spent the output within the
+// last RespendTimeout blocks.
+func (w *Wallet) recentlySpent(tx *bolt.Tx, oid types.OutputID) bool {
+	var spendHeight types.BlockHeight
+	if dbGet(tx.Bucket(bucketSpentOutputs), oid, &spendHeight) != nil {
+		return false
+	}
+	// Prevent an underflow error.
+	allowedHeight := w.consensusSetHeight - RespendTimeout
+	if w.consensusSetHeight < RespendTimeout {
+		allowedHeight = 0
+	}
+	return spendHeight > allowedHeight
+}
+
+// markSpent records that the wallet spent the outputs at the current height,
+// so that they are not spent again within RespendTimeout blocks.
+func (w *Wallet) markSpent(oids []types.OutputID) error {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		for _, oid := range oids {
+			err := dbPut(tx.Bucket(bucketSpentOutputs), oid, w.consensusSetHeight)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unmarkSpent makes outputs that were marked as spent available to be spent
+// again.
+func (w *Wallet) unmarkSpent(oids []types.OutputID) error {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		for _, oid := range oids {
+			err := dbDelete(tx.Bucket(bucketSpentOutputs), oid)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// findSiacoinOutput returns the siacoin output of the wallet with the given
+// id, checking both the confirmed outputs and the outputs created by
+// unconfirmed transactions.
+func (w *Wallet) findSiacoinOutput(tx *bolt.Tx, scoid types.SiacoinOutputID) (types.SiacoinOutput, bool) {
+	var sco types.SiacoinOutput
+	if dbGet(tx.Bucket(bucketSiacoinOutputs), scoid, &sco) == nil {
+		return sco, true
+	}
+	for _, upt := range w.unconfirmedProcessedTransactions {
+		for i, sco := range upt.Transaction.SiacoinOutputs {
+			if upt.Transaction.SiacoinOutputID(uint64(i)) != scoid {
+				continue
+			}
+			_, exists := w.keys[sco.UnlockHash]
+			return sco, exists
+		}
+	}
+	return types.SiacoinOutput{}, false
+}
+
+// unconfirmedSpentOutputs returns the set of outputs that are spent by the
+// wallet's unconfirmed transactions.
+func (w *Wallet) unconfirmedSpentOutputs() map[types.OutputID]struct{} {
+	spent := make(map[types.OutputID]struct{})
+	for _, upt := range w.unconfirmedProcessedTransactions {
+		for _, sci := range upt.Transaction.SiacoinInputs {
+			spent[types.OutputID(sci.ParentID)] = struct{}{}
+		}
+		for _, sfi := range upt.Transaction.SiafundInputs {
+			spent[types.OutputID(sfi.ParentID)] = struct{}{}
+		}
+	}
+	return spent
+}
+
+// UnspentOutputs returns the siacoin and siafund outputs of the wallet,
+// including the siacoin outputs created by unconfirmed transactions.
+func (w *Wallet) UnspentOutputs() []modules.UnspentOutput {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	spent := w.unconfirmedSpentOutputs()
+	var outputs []modules.UnspentOutput
+	err := w.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachSiacoinOutput(tx.Bucket(bucketSiacoinOutputs), func(scoid types.SiacoinOutputID, sco types.SiacoinOutput) {
+			_, isSpent := spent[types.OutputID(scoid)]
+			outputs = append(outputs, modules.UnspentOutput{
+				ID:               types.OutputID(scoid),
+				FundType:         types.SpecifierSiacoinOutput,
+				UnlockHash:       sco.UnlockHash,
+				Value:            sco.Value,
+				SpentUnconfirmed: isSpent,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		err = dbForEachSiafundOutput(tx.Bucket(bucketSiafundOutputs), func(sfoid types.SiafundOutputID, sfo types.SiafundOutput) {
+			_, isSpent := spent[types.OutputID(sfoid)]
+			outputs = append(outputs, modules.UnspentOutput{
+				ID:               types.OutputID(sfoid),
+				FundType:         types.SpecifierSiafundOutput,
+				UnlockHash:       sfo.UnlockHash,
+				Value:            sfo.Value,
+				SpentUnconfirmed: isSpent,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		for i := range outputs {
+			outputs[i].ConfirmationHeight, err = dbGetConfirmationHeight(tx, outputs[i].ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the outputs of the wallet:", err)
+	}
+	for _, upt := range w.unconfirmedProcessedTransactions {
+		for i, sco := range upt.Transaction.SiacoinOutputs {
+			if _, exists := w.keys[sco.UnlockHash]; !exists {
+				continue
+			}
+			oid := types.OutputID(upt.Transaction.SiacoinOutputID(uint64(i)))
+			_, isSpent := spent[oid]
+			outputs = append(outputs, modules.UnspentOutput{
+				ID:                 oid,
+				FundType:           types.SpecifierSiacoinOutput,
+				UnlockHash:         sco.UnlockHash,
+				Value:              sco.Value,
+				ConfirmationHeight: types.BlockHeight(math.MaxUint64),
+				SpentUnconfirmed:   isSpent,
+			})
+		}
+	}
+	sort.Sort(unspentOutputsByHeight(outputs))
+	return outputs
+}
+
 // ConfirmedBalance returns the balance of the wallet according to all of the
 // confirmed transactions.
 func (w *Wallet) ConfirmedBalance() (siacoinBalance types.Currency, siafundBalance types.Currency, siafundClaimBalance types.Currency) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	for _, sco := range w.siacoinOutputs {
-		siacoinBalance = siacoinBalance.Add(sco.Value)
-	}
-	for _, sfo := range w.siafundOutputs {
-		siafundBalance = siafundBalance.Add(sfo.Value)
-		siafundClaimBalance = siafundClaimBalance.Add(w.siafundPool.Sub(sfo.ClaimStart).Mul(sfo.Value).Div(types.SiafundCount))
+	err := w.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachSiacoinOutput(tx.Bucket(bucketSiacoinOutputs), func(_ types.SiacoinOutputID, sco types.SiacoinOutput) {
+			siacoinBalance = siacoinBalance.Add(sco.Value)
+		})
+		if err != nil {
+			return err
+		}
+		return dbForEachSiafundOutput(tx.Bucket(bucketSiafundOutputs), func(_ types.SiafundOutputID, sfo types.SiafundOutput) {
+			siafundBalance = siafundBalance.Add(sfo.Value)
+			siafundClaimBalance = siafundClaimBalance.Add(claimValue(w.siafundPool, sfo))
+		})
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the outputs of the wallet:", err)
 	}
-	return
+	return siacoinBalance, siafundBalance, siafundClaimBalance
 }
 
 // UnconfirmedBalance returns the number of outgoing and incoming siacoins in
@@ -77,6 +315,47 @@ func (w *Wallet) SendSiacoins(amount types.Currency, dest types.UnlockHash) ([]t
 	return txnSet, nil
 }
 
+// SendSiacoinsMulti creates a single transaction paying each of 'outputs'.
+// The miner fee is sized from the size of the transaction and the fee
+// estimation of the transaction pool. The transaction is submitted to the
+// transaction pool and is also returned.
+func (w *Wallet) SendSiacoinsMulti(outputs []types.SiacoinOutput) ([]types.Transaction, error) {
+	if len(outputs) == 0 {
+		return nil, errNoOutputs
+	}
+	_, maxFee := w.tpool.FeeEstimation()
+	txnSize := uint64(len(encoding.Marshal(outputs)) + estimatedTransactionOverhead)
+	tpoolFee := maxFee.Mul(types.NewCurrency64(txnSize))
+	total := tpoolFee
+	for _, sco := range outputs {
+		total = total.Add(sco.Value)
+	}
+
+	txnBuilder := w.StartTransaction()
+	err := txnBuilder.FundSiacoins(total)
+	if err != nil {
+		return nil, err
+	}
+	txnBuilder.AddMinerFee(tpoolFee)
+	for _, sco := range outputs {
+		txnBuilder.AddSiacoinOutput(sco)
+	}
+	err = topUpMinerFee(txnBuilder, tpoolFee, maxFee)
+	if err != nil {
+		txnBuilder.Drop()
+		return nil, err
+	}
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		return nil, err
+	}
+	err = w.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		return nil, err
+	}
+	return txnSet, nil
+}
+
 // SendSiafunds creates a transaction sending 'amount' to 'dest'. The transaction
 // is submitted to the transaction pool and is also returned.
 func (w *Wallet) SendSiafunds(amount types.Currency, dest types.UnlockHash) ([]types.Transaction, error) {
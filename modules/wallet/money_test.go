@@ -1,9 +1,11 @@
 package wallet
 
 import (
+	"math"
 	"sort"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -69,6 +71,164 @@ func TestSendSiacoins(t *testing.T) {
 	}
 }
 
+// TestIntegrationSendSiacoinsMulti probes the SendSiacoinsMulti method of the
+// wallet.
+func TestIntegrationSendSiacoinsMulti(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSendSiacoinsMulti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	_, err = wt.wallet.SendSiacoinsMulti(nil)
+	if err != errNoOutputs {
+		t.Error("expected errNoOutputs, got", err)
+	}
+
+	// Pay three addresses in one transaction. The fee should be sized from
+	// the fee estimation of the transaction pool.
+	outputs := []types.SiacoinOutput{
+		{Value: types.NewCurrency64(1000), UnlockHash: types.UnlockHash{1}},
+		{Value: types.NewCurrency64(2000), UnlockHash: types.UnlockHash{2}},
+		{Value: types.NewCurrency64(3000), UnlockHash: types.UnlockHash{3}},
+	}
+	txns, err := wt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := txns[len(txns)-1]
+	for _, sco := range outputs {
+		found := false
+		for _, txnOutput := range txn.SiacoinOutputs {
+			found = found || (txnOutput.UnlockHash == sco.UnlockHash && txnOutput.Value.Cmp(sco.Value) == 0)
+		}
+		if !found {
+			t.Error("transaction is missing an output to", sco.UnlockHash)
+		}
+	}
+	var fee types.Currency
+	for _, mf := range txn.MinerFees {
+		fee = fee.Add(mf)
+	}
+	_, maxFee := wt.tpool.FeeEstimation()
+	if fee.Cmp(maxFee.Mul(types.NewCurrency64(uint64(len(encoding.Marshal(txns)))))) < 0 {
+		t.Error("miner fee does not cover the size of the transaction:", txn.MinerFees)
+	}
+	unconfirmedOut, unconfirmedIn := wt.wallet.UnconfirmedBalance()
+	if unconfirmedOut.Cmp(unconfirmedIn.Add(types.NewCurrency64(6000)).Add(fee)) != 0 {
+		t.Error("sending siacoins appears to be ineffective")
+	}
+}
+
+// TestIntegrationSignedSize checks that signedSize predicts the size of a
+// transaction after it has been signed.
+func TestIntegrationSignedSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSignedSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	txnBuilder := wt.wallet.StartTransaction()
+	err = txnBuilder.FundSiacoins(types.NewCurrency64(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txnBuilder.AddSiacoinOutput(types.SiacoinOutput{Value: types.NewCurrency64(1000)})
+	txn, parents := txnBuilder.View()
+	size := signedSize(txn, parents)
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := uint64(len(encoding.Marshal(txnSet[:len(txnSet)-1])) + len(encoding.Marshal(txnSet[len(txnSet)-1]))); size != actual {
+		t.Fatalf("signedSize returned %v, but the signed transaction has size %v", size, actual)
+	}
+}
+
+// TestIntegrationUnspentOutputs checks that UnspentOutputs reports the
+// outputs of the wallet, and that FundSiacoinsWithOutputs spends exactly the
+// listed outputs.
+func TestIntegrationUnspentOutputs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationUnspentOutputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// The wallet should have a single output, the first miner payout, which
+	// was confirmed by the block at height 1.
+	outputs := wt.wallet.UnspentOutputs()
+	if len(outputs) != 1 {
+		t.Fatal("expected 1 unspent output, got", len(outputs))
+	}
+	uo := outputs[0]
+	if uo.FundType != types.SpecifierSiacoinOutput || uo.Value.Cmp(types.CalculateCoinbase(1)) != 0 || uo.ConfirmationHeight != 1 || uo.SpentUnconfirmed {
+		t.Fatal("unexpected unspent output:", uo)
+	}
+
+	// Listing an output twice, or an unknown output, should fail.
+	scoid := types.SiacoinOutputID(uo.ID)
+	if err := wt.wallet.StartTransaction().FundSiacoinsWithOutputs(types.NewCurrency64(1), []types.SiacoinOutputID{scoid, scoid}); err != errDuplicateOutput {
+		t.Error("expected errDuplicateOutput, got", err)
+	}
+	if err := wt.wallet.StartTransaction().FundSiacoinsWithOutputs(types.NewCurrency64(1), []types.SiacoinOutputID{{}}); err != errUnknownOutput {
+		t.Error("expected errUnknownOutput, got", err)
+	}
+	if err := wt.wallet.StartTransaction().FundSiacoinsWithOutputs(uo.Value.Add(types.NewCurrency64(1)), []types.SiacoinOutputID{scoid}); err != modules.ErrLowBalance {
+		t.Error("expected ErrLowBalance, got", err)
+	}
+
+	// Spend the output directly. The transaction should have no parents, and
+	// should refund the remainder to the wallet.
+	fee := types.SiacoinPrecision
+	amount := types.NewCurrency64(1000)
+	txnBuilder := wt.wallet.StartTransaction()
+	err = txnBuilder.FundSiacoinsWithOutputs(amount.Add(fee), []types.SiacoinOutputID{scoid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txnBuilder.AddMinerFee(fee)
+	txnBuilder.AddSiacoinOutput(types.SiacoinOutput{Value: amount})
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txnSet) != 1 || len(txnSet[0].SiacoinInputs) != 1 || len(txnSet[0].SiacoinOutputs) != 2 {
+		t.Fatal("transaction does not spend exactly the listed output")
+	}
+	err = wt.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.wallet.StartTransaction().FundSiacoinsWithOutputs(amount, []types.SiacoinOutputID{scoid}); err != modules.ErrPotentialDoubleSpend {
+		t.Error("expected ErrPotentialDoubleSpend, got", err)
+	}
+
+	// The output should be marked as spent, and the refund output should be
+	// reported as unconfirmed.
+	outputs = wt.wallet.UnspentOutputs()
+	if len(outputs) != 2 {
+		t.Fatal("expected 2 unspent outputs, got", len(outputs))
+	}
+	if outputs[0].ID != uo.ID || !outputs[0].SpentUnconfirmed {
+		t.Error("spent output is not marked as spent:", outputs[0])
+	}
+	refund := uo.Value.Sub(amount).Sub(fee)
+	if outputs[1].ConfirmationHeight != types.BlockHeight(math.MaxUint64) || outputs[1].Value.Cmp(refund) != 0 {
+		t.Error("refund output is not reported as unconfirmed:", outputs[1])
+	}
+}
+
 // TestIntegrationSendOverUnder sends too many siacoins, resulting in an error,
 // followed by sending few enough siacoins that the send should complete.
 //
@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errDuplicateCosigner   = errors.New("public key is listed more than once")
+	errInvalidCosigner     = errors.New("cosigner public keys must be 32 byte ed25519 keys")
+	errInvalidThreshold    = errors.New("required signatures must be between 1 and the number of public keys")
+	errNoCosigners         = errors.New("at least one cosigner public key is required")
+	errNoTransactions      = errors.New("no transactions were provided")
+	errNoUnlockConditions  = errors.New("unlock conditions of the address are not known")
+	errTransactionMismatch = errors.New("transactions have different contents and cannot be merged")
+)
+
+// CreateMultisigAddress creates an address that requires 'required'
+// signatures from a new key of the wallet and the public keys of the
+// cosigners. The wallet's key is the first public key of the unlock
+// conditions. The address is watched by the wallet, and its unlock conditions
+// should be given to the cosigners so that they can watch it too.
+func (w *Wallet) CreateMultisigAddress(required uint64, cosigners []types.SiaPublicKey) (types.UnlockConditions, error) {
+	if len(cosigners) == 0 {
+		return types.UnlockConditions{}, errNoCosigners
+	}
+	if required == 0 || required > uint64(len(cosigners)+1) {
+		return types.UnlockConditions{}, errInvalidThreshold
+	}
+	seen := make(map[string]struct{})
+	for _, spk := range cosigners {
+		if spk.Algorithm != types.SignatureEd25519 || len(spk.Key) != crypto.PublicKeySize {
+			return types.UnlockConditions{}, errInvalidCosigner
+		}
+		if _, exists := seen[string(spk.Key)]; exists {
+			return types.UnlockConditions{}, errDuplicateCosigner
+		}
+		seen[string(spk.Key)] = struct{}{}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	own, err := w.nextPrimarySeedAddress()
+	if err != nil {
+		return types.UnlockConditions{}, err
+	}
+	uc := types.UnlockConditions{
+		PublicKeys:         append([]types.SiaPublicKey{own.PublicKeys[0]}, cosigners...),
+		SignaturesRequired: required,
+	}
+
+	// The address contains a key that was just generated, so it cannot
+	// appear in the blockchain yet and no rescan is needed.
+	wa := modules.WatchedAddress{UnlockHash: uc.UnlockHash(), UnlockConditions: &uc}
+	w.watchedAddrs[wa.UnlockHash] = wa
+	w.persist.WatchedAddresses = append(w.persist.WatchedAddresses, wa)
+	err = w.saveSettingsSync()
+	if err != nil {
+		return types.UnlockConditions{}, err
+	}
+	return uc, nil
+}
+
+// UnsignedMultisigTransaction builds a transaction paying 'outputs' from a
+// watched address, such as a multisig address. The transaction is returned
+// unsigned along with a required signature for each input, and is not given
+// to the transaction pool.
+func (w *Wallet) UnsignedMultisigTransaction(uh types.UnlockHash, outputs []types.SiacoinOutput) (modules.UnsignedTransaction, error) {
+	w.mu.RLock()
+	wa, exists := w.watchedAddrs[uh]
+	w.mu.RUnlock()
+	if !exists {
+		return modules.UnsignedTransaction{}, errUnknownWatchAddress
+	}
+	if wa.UnlockConditions == nil {
+		return modules.UnsignedTransaction{}, errNoUnlockConditions
+	}
+	return w.managedUnsignedTransaction(outputs, func(addr types.UnlockHash) bool { return addr == uh })
+}
+
+// MergeSignatures combines the signatures of several copies of the same
+// unsigned transaction, each signed by a different cosigner. Signatures beyond
+// the number required by an input are dropped, as the transaction would
+// otherwise be rejected as having frivolous signatures. The merged
+// transaction is complete once RequiredSignatures is empty.
+func (w *Wallet) MergeSignatures(uts []modules.UnsignedTransaction) (modules.UnsignedTransaction, error) {
+	if len(uts) == 0 {
+		return modules.UnsignedTransaction{}, errNoTransactions
+	}
+	id := uts[0].Transaction.ID()
+	for _, ut := range uts[1:] {
+		if ut.Transaction.ID() != id {
+			return modules.UnsignedTransaction{}, errTransactionMismatch
+		}
+	}
+
+	// Collect the required signatures of all copies, as a copy drops the
+	// inputs that it has fully signed.
+	var required []modules.RequiredSignature
+	thresholds := make(map[crypto.Hash]uint64)
+	for _, ut := range uts {
+		for _, rs := range ut.RequiredSignatures {
+			if _, exists := thresholds[rs.ParentID]; exists {
+				continue
+			}
+			thresholds[rs.ParentID] = rs.UnlockConditions.SignaturesRequired
+			required = append(required, rs)
+		}
+	}
+
+	txn := uts[0].Transaction
+	txn.TransactionSignatures = nil
+	signed := make(map[crypto.Hash]map[uint64]struct{})
+	for _, ut := range uts {
+		for _, sig := range ut.Transaction.TransactionSignatures {
+			if signed[sig.ParentID] == nil {
+				signed[sig.ParentID] = make(map[uint64]struct{})
+			}
+			if _, exists := signed[sig.ParentID][sig.PublicKeyIndex]; exists {
+				continue
+			}
+			if threshold, exists := thresholds[sig.ParentID]; exists && uint64(len(signed[sig.ParentID])) >= threshold {
+				continue
+			}
+			signed[sig.ParentID][sig.PublicKeyIndex] = struct{}{}
+			txn.TransactionSignatures = append(txn.TransactionSignatures, sig)
+		}
+	}
+
+	var remaining []modules.RequiredSignature
+	for _, rs := range required {
+		if uint64(len(signed[rs.ParentID])) < rs.UnlockConditions.SignaturesRequired {
+			remaining = append(remaining, rs)
+		}
+	}
+	return modules.UnsignedTransaction{
+		Parents:            uts[0].Parents,
+		Transaction:        txn,
+		RequiredSignatures: remaining,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCreateMultisigAddressInvalid checks that invalid cosigners and
+// thresholds are rejected.
+func TestCreateMultisigAddressInvalid(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestCreateMultisigAddressInvalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	_, pk := crypto.GenerateKeyPairDeterministic(crypto.Hash{1})
+	spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	tests := []struct {
+		required  uint64
+		cosigners []types.SiaPublicKey
+		err       error
+	}{
+		{1, nil, errNoCosigners},
+		{0, []types.SiaPublicKey{spk}, errInvalidThreshold},
+		{3, []types.SiaPublicKey{spk}, errInvalidThreshold},
+		{1, []types.SiaPublicKey{{Algorithm: types.SignatureEntropy, Key: pk[:]}}, errInvalidCosigner},
+		{1, []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: pk[:5]}}, errInvalidCosigner},
+		{2, []types.SiaPublicKey{spk, spk}, errDuplicateCosigner},
+	}
+	for _, test := range tests {
+		if _, err := wt.wallet.CreateMultisigAddress(test.required, test.cosigners); err != test.err {
+			t.Errorf("expected %v, got %v", test.err, err)
+		}
+	}
+}
+
+// TestIntegrationMultisig creates a 2-of-2 address between two wallets, funds
+// it, and spends from it with signatures from both wallets.
+func TestIntegrationMultisig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationMultisig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+	cosigner, err := createWalletTester("TestIntegrationMultisig - cosigner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cosigner.closeWt()
+
+	// Create the address from a key of the cosigner, and fund it.
+	cosignerUC, err := cosigner.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc, err := wt.wallet.CreateMultisigAddress(2, cosignerUC.PublicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uc.PublicKeys) != 2 || uc.SignaturesRequired != 2 {
+		t.Fatal("unexpected unlock conditions:", uc)
+	}
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(100))
+	_, err = wt.wallet.SendSiacoins(amount, uc.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoins, _ := wt.wallet.WatchOnlyBalance()
+	if siacoins.Cmp(amount) != 0 {
+		t.Fatal("multisig outputs are not tracked:", siacoins)
+	}
+
+	// Build the transaction, and have each wallet add its signature.
+	payment := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul(types.NewCurrency64(10)), UnlockHash: types.UnlockHash{1}}
+	if _, err := wt.wallet.UnsignedMultisigTransaction(types.UnlockHash{1}, []types.SiacoinOutput{payment}); err != errUnknownWatchAddress {
+		t.Error("expected errUnknownWatchAddress, got", err)
+	}
+	ut, err := wt.wallet.UnsignedMultisigTransaction(uc.UnlockHash(), []types.SiacoinOutput{payment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownSigned, err := wt.wallet.SignTransaction(ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ownSigned.RequiredSignatures) != 1 || len(ownSigned.Transaction.TransactionSignatures) != 1 {
+		t.Fatal("expected a partially signed transaction:", ownSigned)
+	}
+	if err := wt.tpool.AcceptTransactionSet([]types.Transaction{ownSigned.Transaction}); err == nil {
+		t.Error("partially signed transaction was accepted")
+	}
+	if _, err := wt.wallet.SignTransaction(ownSigned); err != errNoSignableInputs {
+		t.Error("expected errNoSignableInputs when signing twice, got", err)
+	}
+	cosignerSigned, err := cosigner.wallet.SignTransaction(ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Merging the signatures should complete the transaction. Merging a
+	// copy twice should not duplicate signatures.
+	if _, err := wt.wallet.MergeSignatures([]modules.UnsignedTransaction{ut, {Transaction: types.Transaction{}}}); err != errTransactionMismatch {
+		t.Error("expected errTransactionMismatch, got", err)
+	}
+	merged, err := wt.wallet.MergeSignatures([]modules.UnsignedTransaction{ownSigned, cosignerSigned, ownSigned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.RequiredSignatures) != 0 || len(merged.Transaction.TransactionSignatures) != 2 {
+		t.Fatal("merged transaction is not complete:", merged)
+	}
+	err = wt.tpool.AcceptTransactionSet(append(merged.Parents, merged.Transaction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoins, _ = wt.wallet.WatchOnlyBalance()
+	if siacoins.Cmp(amount.Sub(payment.Value).Sub(merged.Transaction.MinerFees[0])) != 0 {
+		t.Error("multisig balance did not decrease:", siacoins)
+	}
+}
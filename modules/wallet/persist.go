@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/rand"
 	"os"
 	"path/filepath"
@@ -8,17 +9,28 @@ import (
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
+
+	"github.com/NebulousLabs/bolt"
 )
 
 const (
+	dbFile             = modules.WalletDir + ".db"
 	logFile            = modules.WalletDir + ".log"
 	settingsFileSuffix = ".json"
 	settingsFile       = modules.WalletDir + settingsFileSuffix
 
+	// settingsBackupPrefix is the prefix of the backups of the settings file
+	// that are created whenever unseeded keys are loaded.
+	settingsBackupPrefix = "Sia Wallet Encrypted Backup - "
+
 	encryptionVerificationLen = 32
 )
 
 var (
+	dbMetadata = persist.Metadata{
+		Header:  "Wallet Database",
+		Version: "0.6.1",
+	}
 	settingsMetadata = persist.Metadata{
 		Header:  "Wallet Settings",
 		Version: "0.4.0",
@@ -61,6 +73,10 @@ type WalletPersist struct {
 	// UnseededKeys are list of spendable keys that were not generated by a
 	// random seed.
 	UnseededKeys []SpendableKeyFile
+
+	// WatchedAddresses are addresses that the wallet tracks without holding
+	// their secret keys.
+	WatchedAddresses []modules.WatchedAddress
 }
 
 // loadSettings reads the wallet's settings from the wallet's settings file,
@@ -124,7 +140,21 @@ func (w *Wallet) initPersist() error {
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Open the database and load the consensus set height and siafund pool
+	// that were recorded with the last consensus change processed.
+	w.db, err = persist.OpenDatabase(dbMetadata, filepath.Join(w.persistDir, dbFile))
+	if err != nil {
+		return err
+	}
+	return w.db.Update(func(tx *bolt.Tx) error {
+		err := dbInit(tx)
+		if err != nil {
+			return err
+		}
+		_, w.consensusSetHeight, w.siafundPool, err = dbGetConsensusState(tx)
+		return err
+	})
 }
 
 // createBackup creates a backup file at the desired filepath.
@@ -132,6 +162,39 @@ func (w *Wallet) createBackup(backupFilepath string) error {
 	return persist.SaveFileSync(settingsMetadata, w.persist, backupFilepath)
 }
 
+// createSettingsBackup creates a backup of the settings file in the wallet
+// directory.
+func (w *Wallet) createSettingsBackup() error {
+	return w.createBackup(filepath.Join(w.persistDir, settingsBackupPrefix+persist.RandomSuffix()+settingsFileSuffix))
+}
+
+// removeSettingsBackups deletes the settings backups in the wallet directory
+// that can be decrypted with 'masterKey', returning the number of backups
+// that were deleted. Files that cannot be read or decrypted are left in place.
+func (w *Wallet) removeSettingsBackups(masterKey crypto.TwofishKey) (int, error) {
+	filenames, err := filepath.Glob(filepath.Join(w.persistDir, settingsBackupPrefix+"*"+settingsFileSuffix))
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, filename := range filenames {
+		var wp WalletPersist
+		if persist.LoadFile(settingsMetadata, &wp, filename) != nil {
+			continue
+		}
+		verification, err := uidEncryptionKey(masterKey, wp.UID).DecryptBytes(wp.EncryptionVerification)
+		if err != nil || !bytes.Equal(verification, make([]byte, encryptionVerificationLen)) {
+			continue
+		}
+		err = os.Remove(filename)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
 // CreateBackup creates a backup file at the desired filepath.
 func (w *Wallet) CreateBackup(backupFilepath string) error {
 	w.mu.Lock()
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"errors"
+	"os"
 	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -86,6 +87,32 @@ func (w *Wallet) encryptAndSaveSeedFile(masterKey crypto.TwofishKey, seed module
 	return sf, nil
 }
 
+// removeSeedBackups deletes the seed backups in the wallet directory that can
+// be decrypted with 'masterKey'. Files that cannot be read or decrypted are
+// left in place.
+func (w *Wallet) removeSeedBackups(masterKey crypto.TwofishKey) error {
+	filenames, err := filepath.Glob(filepath.Join(w.persistDir, seedFilePrefix+"*"+seedFileSuffix))
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		var sf SeedFile
+		if persist.LoadFile(seedMetadata, &sf, filename) != nil {
+			continue
+		}
+		seed, err := decryptSeedFile(masterKey, sf)
+		if err != nil {
+			continue
+		}
+		crypto.SecureWipe(seed[:])
+		err = os.Remove(filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // decryptSeedFile decrypts a seed file using the encryption key.
 func decryptSeedFile(masterKey crypto.TwofishKey, sf SeedFile) (seed modules.Seed, err error) {
 	// Verify that the provided master key is the correct key.
@@ -259,13 +286,20 @@ func (w *Wallet) NextAddress() (types.UnlockConditions, error) {
 // LoadSeed will track all of the addresses generated by the input seed,
 // reclaiming any funds that were lost due to a deleted file or lost encryption
 // key. An error will be returned if the seed has already been integrated with
-// the wallet.
+// the wallet. The blockchain is rescanned to find the outputs and history of
+// the seed's addresses.
 func (w *Wallet) LoadSeed(masterKey crypto.TwofishKey, seed modules.Seed) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	err := w.checkMasterKey(masterKey)
+	err := func() error {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		err := w.checkMasterKey(masterKey)
+		if err != nil {
+			return err
+		}
+		return w.recoverSeed(masterKey, seed)
+	}()
 	if err != nil {
 		return err
 	}
-	return w.recoverSeed(masterKey, seed)
+	return w.managedRescan()
 }
@@ -142,9 +142,17 @@ func TestLoadSeed(t *testing.T) {
 		t.Error("AllSeeds returned the wrong seed")
 	}
 
-	// Rather than worry about a rescan, which isn't implemented and has
-	// synchronization difficulties, just load a new wallet from the same
-	// settings file - the same effect is achieved without the difficulties.
+	// The seed's outputs are found by the rescan that follows LoadSeed, and
+	// are persisted so that a new wallet loaded from the same directory also
+	// has them.
+	siacoinBal, _, _ = w.ConfirmedBalance()
+	if siacoinBal.Cmp(types.NewCurrency64(0)) <= 0 {
+		t.Error("wallet failed to rescan after loading a seed with money in it")
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
 	w2, err := New(wt.cs, wt.tpool, dir)
 	if err != nil {
 		t.Fatal(err)
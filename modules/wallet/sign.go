@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errNoRequiredSignatures = errors.New("transaction does not require any signatures")
+	errNoSignableInputs     = errors.New("wallet does not hold the keys for any of the required signatures")
+)
+
+// signingKey returns the secret key of the wallet that matches a public key
+// of the unlock conditions. The key is either part of the spendable key of the
+// unlock conditions, such as a siag key, or the key of a 1-of-1 address that
+// was generated from a seed, which is how the wallet takes part in multisig
+// addresses.
+func (w *Wallet) signingKey(uc types.UnlockConditions, spk types.SiaPublicKey) (crypto.SecretKey, bool) {
+	if key, exists := w.keys[uc.UnlockHash()]; exists {
+		for _, sk := range key.SecretKeys {
+			pk := sk.PublicKey()
+			if bytes.Equal(spk.Key, pk[:]) {
+				return sk, true
+			}
+		}
+	}
+	if spk.Algorithm != types.SignatureEd25519 || len(spk.Key) != crypto.PublicKeySize {
+		return crypto.SecretKey{}, false
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], spk.Key)
+	key, exists := w.keys[generateUnlockConditions(pk).UnlockHash()]
+	if !exists {
+		return crypto.SecretKey{}, false
+	}
+	return key.SecretKeys[0], true
+}
+
+// signedKeys returns the indices of the public keys that have signed the input
+// or revision with id 'parentID'.
+func signedKeys(txn types.Transaction, parentID crypto.Hash) map[uint64]struct{} {
+	signed := make(map[uint64]struct{})
+	for _, sig := range txn.TransactionSignatures {
+		if sig.ParentID == parentID {
+			signed[sig.PublicKeyIndex] = struct{}{}
+		}
+	}
+	return signed
+}
+
+// SignTransaction adds the required signatures of an unsigned transaction that
+// can be made with the keys of the wallet, which allows transactions built by
+// a watch-only wallet to be signed by an offline wallet holding the seed. For
+// multisig addresses, the wallet adds the signatures of the keys it holds
+// until the number of required signatures is reached. The signed transaction
+// is returned, and RequiredSignatures is reduced to the signatures that are
+// still missing. The wallet does not need to be synced, and the transaction
+// is not given to the transaction pool.
+func (w *Wallet) SignTransaction(ut modules.UnsignedTransaction) (modules.UnsignedTransaction, error) {
+	if len(ut.RequiredSignatures) == 0 {
+		return modules.UnsignedTransaction{}, errNoRequiredSignatures
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if !w.unlocked {
+		return modules.UnsignedTransaction{}, modules.ErrLockedWallet
+	}
+
+	// Copy the signatures of the transaction, so that signing does not modify
+	// the caller's transaction.
+	txn := ut.Transaction
+	txn.TransactionSignatures = append([]types.TransactionSignature(nil), ut.Transaction.TransactionSignatures...)
+
+	var remaining []modules.RequiredSignature
+	added := false
+	for _, rs := range ut.RequiredSignatures {
+		uc := rs.UnlockConditions
+		signed := signedKeys(txn, rs.ParentID)
+		for i, spk := range uc.PublicKeys {
+			if uint64(len(signed)) >= uc.SignaturesRequired {
+				break
+			}
+			if _, exists := signed[uint64(i)]; exists {
+				continue
+			}
+			sk, exists := w.signingKey(uc, spk)
+			if !exists {
+				continue
+			}
+			txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+				ParentID:       rs.ParentID,
+				CoveredFields:  rs.CoveredFields,
+				PublicKeyIndex: uint64(i),
+			})
+			sigIndex := len(txn.TransactionSignatures) - 1
+			encodedSig, err := crypto.SignHash(txn.SigHash(sigIndex), sk)
+			if err != nil {
+				return modules.UnsignedTransaction{}, err
+			}
+			txn.TransactionSignatures[sigIndex].Signature = encodedSig[:]
+			signed[uint64(i)] = struct{}{}
+			added = true
+		}
+		if uint64(len(signed)) < uc.SignaturesRequired {
+			remaining = append(remaining, rs)
+		}
+	}
+	if !added {
+		return modules.UnsignedTransaction{}, errNoSignableInputs
+	}
+	return modules.UnsignedTransaction{
+		Parents:            ut.Parents,
+		Transaction:        txn,
+		RequiredSignatures: remaining,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationSignTransaction checks that a transaction built by a
+// watch-only wallet can be signed by another wallet holding the keys, and then
+// submitted by the watch-only wallet.
+func TestIntegrationSignTransaction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	online, err := createWalletTester("TestIntegrationSignTransaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer online.closeWt()
+	offline, err := createWalletTester("TestIntegrationSignTransaction - offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer offline.closeWt()
+
+	// Watch an address of the offline wallet, and fund it.
+	uc, err := offline.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = online.wallet.AddWatchAddress(modules.WatchedAddress{UnlockConditions: &uc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(100))
+	_, err = online.wallet.SendSiacoins(amount, uc.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = online.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the unsigned transaction on the online wallet, which does not
+	// hold any of the required keys.
+	payment := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul(types.NewCurrency64(10)), UnlockHash: types.UnlockHash{1}}
+	ut, err := online.wallet.UnsignedWatchOnlyTransaction([]types.SiacoinOutput{payment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := online.wallet.SignTransaction(ut); err != errNoSignableInputs {
+		t.Error("expected errNoSignableInputs, got", err)
+	}
+	if _, err := offline.wallet.SignTransaction(modules.UnsignedTransaction{Transaction: ut.Transaction}); err != errNoRequiredSignatures {
+		t.Error("expected errNoRequiredSignatures, got", err)
+	}
+
+	// Sign the transaction on the offline wallet. The unsigned transaction
+	// should not be modified.
+	signed, err := offline.wallet.SignTransaction(ut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.RequiredSignatures) != 0 || len(signed.Transaction.TransactionSignatures) != 1 {
+		t.Fatal("transaction was not fully signed:", signed)
+	}
+	if len(ut.Transaction.TransactionSignatures) != 0 || len(ut.RequiredSignatures) != 1 {
+		t.Error("signing modified the unsigned transaction")
+	}
+
+	// Submit the signed transaction from the online wallet.
+	err = online.tpool.AcceptTransactionSet(append(signed.Parents, signed.Transaction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = online.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoins, _ := online.wallet.WatchOnlyBalance()
+	if siacoins.Cmp(amount.Sub(payment.Value).Sub(signed.Transaction.MinerFees[0])) != 0 {
+		t.Error("watch-only balance did not decrease:", siacoins)
+	}
+
+	// A locked wallet cannot sign.
+	err = offline.wallet.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offline.wallet.SignTransaction(ut); err != modules.ErrLockedWallet {
+		t.Error("expected ErrLockedWallet, got", err)
+	}
+}
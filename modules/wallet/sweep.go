@@ -0,0 +1,361 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// sweepBatchSize is the maximum number of outputs of a seed that are
+	// spent by a single sweep transaction, so that each transaction stays
+	// well below the transaction size limit.
+	sweepBatchSize = defragBatchSize
+
+	// sweepSyncInterval is how often SweepSeed checks whether the consensus
+	// set has finished syncing.
+	sweepSyncInterval = 100 * time.Millisecond
+)
+
+var (
+	// sweepSyncTimeout is how long SweepSeed waits for the consensus set to
+	// sync before giving up. A light consensus set downloads the blocks again
+	// when the addresses of the seed are added to its filter.
+	sweepSyncTimeout = func() time.Duration {
+		switch build.Release {
+		case "dev":
+			return 2 * time.Minute
+		case "standard":
+			return 10 * time.Minute
+		case "testing":
+			return 5 * time.Second
+		default:
+			panic("unrecognized build.Release")
+		}
+	}()
+
+	errNothingToSweep = errors.New("seed does not have any outputs to sweep")
+	errSweepFee       = errors.New("seed does not have enough siacoins to pay the miner fee")
+	errSweepNotSynced = errors.New("consensus set did not sync in time, so the outputs of the seed may be missing; try again once it is synced")
+)
+
+// A seedScanner subscribes to the consensus set to find the outputs that
+// belong to the addresses of a seed. It is only subscribed while scanning, and
+// keeps its own state so that the wallet does not track the seed.
+type seedScanner struct {
+	keys           map[types.UnlockHash]spendableKey
+	siacoinOutputs map[types.SiacoinOutputID]types.SiacoinOutput
+	siafundOutputs map[types.SiafundOutputID]types.SiafundOutput
+}
+
+// newSeedScanner creates a scanner for the first modules.PublicKeysPerSeed
+// addresses of a seed.
+func newSeedScanner(seed modules.Seed) *seedScanner {
+	s := &seedScanner{
+		keys:           make(map[types.UnlockHash]spendableKey),
+		siacoinOutputs: make(map[types.SiacoinOutputID]types.SiacoinOutput),
+		siafundOutputs: make(map[types.SiafundOutputID]types.SiafundOutput),
+	}
+	for i := uint64(0); i < modules.PublicKeysPerSeed; i++ {
+		sk := generateSpendableKey(seed, i)
+		s.keys[sk.UnlockConditions.UnlockHash()] = sk
+	}
+	return s
+}
+
+// ProcessConsensusChange tracks the outputs that belong to the seed.
+func (s *seedScanner) ProcessConsensusChange(cc modules.ConsensusChange) {
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if _, exists := s.keys[diff.SiacoinOutput.UnlockHash]; !exists {
+			continue
+		}
+		if diff.Direction == modules.DiffApply {
+			s.siacoinOutputs[diff.ID] = diff.SiacoinOutput
+		} else {
+			delete(s.siacoinOutputs, diff.ID)
+		}
+	}
+	for _, diff := range cc.SiafundOutputDiffs {
+		if _, exists := s.keys[diff.SiafundOutput.UnlockHash]; !exists {
+			continue
+		}
+		if diff.Direction == modules.DiffApply {
+			s.siafundOutputs[diff.ID] = diff.SiafundOutput
+		} else {
+			delete(s.siafundOutputs, diff.ID)
+		}
+	}
+}
+
+// WatchedAddresses returns the addresses of the seed, so that a light
+// consensus set downloads the blocks that involve them.
+func (s *seedScanner) WatchedAddresses() []types.UnlockHash {
+	addrs := make([]types.UnlockHash, 0, len(s.keys))
+	for uh := range s.keys {
+		addrs = append(addrs, uh)
+	}
+	return addrs
+}
+
+// signatures returns the signatures of the inputs of txn that belong to the
+// seed. The signatures cover the whole transaction, so they remain valid when
+// the wallet signs its own inputs afterwards.
+func (s *seedScanner) signatures(txn types.Transaction) ([]types.TransactionSignature, error) {
+	// Copy the signatures so that the caller's transaction is not modified.
+	txn.TransactionSignatures = append([]types.TransactionSignature(nil), txn.TransactionSignatures...)
+	n := len(txn.TransactionSignatures)
+	for _, sci := range txn.SiacoinInputs {
+		sk, exists := s.keys[sci.UnlockConditions.UnlockHash()]
+		if !exists {
+			continue
+		}
+		_, err := addSignatures(&txn, types.FullCoveredFields, sci.UnlockConditions, crypto.Hash(sci.ParentID), sk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, sfi := range txn.SiafundInputs {
+		sk, exists := s.keys[sfi.UnlockConditions.UnlockHash()]
+		if !exists {
+			continue
+		}
+		_, err := addSignatures(&txn, types.FullCoveredFields, sfi.UnlockConditions, crypto.Hash(sfi.ParentID), sk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txn.TransactionSignatures[n:], nil
+}
+
+// wipe erases the secret keys of the scanner.
+func (s *seedScanner) wipe() {
+	for _, sk := range s.keys {
+		for i := range sk.SecretKeys {
+			crypto.SecureWipe(sk.SecretKeys[i][:])
+		}
+	}
+}
+
+// enforce that seedScanner satisfies the
+// modules.FilteredConsensusSetSubscriber interface
+var _ modules.FilteredConsensusSetSubscriber = (*seedScanner)(nil)
+
+// SweepSeed moves the siacoins and siafunds held by the first
+// modules.PublicKeysPerSeed addresses of a seed to a new address of the
+// wallet, without adding the seed to the wallet. The consensus set is scanned
+// for the outputs of the seed, which are spent in batches of at most
+// sweepBatchSize outputs. Each transaction is signed with keys derived from
+// the seed, which are discarded afterwards. The miner fees are sized from the
+// fee estimation of the transaction pool, and are paid from the swept siacoins
+// when they suffice; batches that hold siafunds but not enough siacoins are
+// funded by the wallet instead, and siacoin-only batches that cannot pay their
+// fee are skipped. The amounts that were sent to the wallet are returned, also
+// when a later batch fails.
+func (w *Wallet) SweepSeed(seed modules.Seed) (coins, funds types.Currency, err error) {
+	w.mu.RLock()
+	unlocked := w.unlocked
+	known := seed == w.primarySeed
+	for _, wSeed := range w.seeds {
+		known = known || seed == wSeed
+	}
+	w.mu.RUnlock()
+	if !unlocked {
+		return types.Currency{}, types.Currency{}, modules.ErrLockedWallet
+	}
+	if known {
+		return types.Currency{}, types.Currency{}, errKnownSeed
+	}
+
+	// Scan the consensus set for the outputs of the seed. A light consensus
+	// set only knows about the outputs of the seed once it has downloaded the
+	// blocks again with the addresses of the seed added to its filter, so the
+	// scanner stays subscribed until the consensus set is synced. Unsubscribing
+	// removes the addresses from the filter again. Once the scanner has been
+	// unsubscribed, it no longer receives updates and can be read without
+	// locking.
+	s := newSeedScanner(seed)
+	defer s.wipe()
+	err = w.cs.ConsensusSetSubscribe(s, modules.ConsensusChangeBeginning)
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	for deadline := time.Now().Add(sweepSyncTimeout); !w.cs.Synced() && time.Now().Before(deadline); {
+		time.Sleep(sweepSyncInterval)
+	}
+	synced := w.cs.Synced()
+	w.cs.Unsubscribe(s)
+	if !synced {
+		return types.Currency{}, types.Currency{}, errSweepNotSynced
+	}
+	if len(s.siacoinOutputs) == 0 && len(s.siafundOutputs) == 0 {
+		return types.Currency{}, types.Currency{}, errNothingToSweep
+	}
+
+	var scoids []types.SiacoinOutputID
+	for scoid := range s.siacoinOutputs {
+		scoids = append(scoids, scoid)
+	}
+	var sfoids []types.SiafundOutputID
+	for sfoid := range s.siafundOutputs {
+		sfoids = append(sfoids, sfoid)
+	}
+
+	w.mu.Lock()
+	uc, err := w.nextPrimarySeedAddress()
+	w.mu.Unlock()
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	dest := uc.UnlockHash()
+
+	// Sweep the siacoin outputs first, so that the siafund outputs end up in
+	// as few batches as possible.
+	_, maxFee := w.tpool.FeeEstimation()
+	for len(scoids) > 0 || len(sfoids) > 0 {
+		batchCoins := scoids
+		if len(batchCoins) > sweepBatchSize {
+			batchCoins = batchCoins[:sweepBatchSize]
+		}
+		batchFunds := sfoids
+		if len(batchFunds) > sweepBatchSize-len(batchCoins) {
+			batchFunds = batchFunds[:sweepBatchSize-len(batchCoins)]
+		}
+		scoids = scoids[len(batchCoins):]
+		sfoids = sfoids[len(batchFunds):]
+
+		sweptCoins, sweptFunds, err := w.managedSweepBatch(s, batchCoins, batchFunds, dest, maxFee)
+		if err == errSweepFee {
+			continue
+		} else if err != nil {
+			return coins, funds, err
+		}
+		coins = coins.Add(sweptCoins)
+		funds = funds.Add(sweptFunds)
+	}
+	if coins.IsZero() && funds.IsZero() {
+		return types.Currency{}, types.Currency{}, errSweepFee
+	}
+	return coins, funds, nil
+}
+
+// managedSweepBatch submits a transaction that sends the given outputs of a
+// seed to dest, paying 'feePerByte' for the signed size of the transaction.
+// The fee is paid from the siacoins of the batch if they suffice. Otherwise,
+// the fee of a batch that holds siafunds is paid by the wallet, and
+// errSweepFee is returned for a batch that only holds siacoins. The amounts
+// that were sent to dest are returned.
+func (w *Wallet) managedSweepBatch(s *seedScanner, scoids []types.SiacoinOutputID, sfoids []types.SiafundOutputID, dest types.UnlockHash, feePerByte types.Currency) (coins, funds types.Currency, err error) {
+	var txn types.Transaction
+	for _, scoid := range scoids {
+		sco := s.siacoinOutputs[scoid]
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+			ParentID:         scoid,
+			UnlockConditions: s.keys[sco.UnlockHash].UnlockConditions,
+		})
+		coins = coins.Add(sco.Value)
+	}
+	for _, sfoid := range sfoids {
+		sfo := s.siafundOutputs[sfoid]
+		txn.SiafundInputs = append(txn.SiafundInputs, types.SiafundInput{
+			ParentID:         sfoid,
+			UnlockConditions: s.keys[sfo.UnlockHash].UnlockConditions,
+			ClaimUnlockHash:  dest,
+		})
+		funds = funds.Add(sfo.Value)
+	}
+	if !funds.IsZero() {
+		txn.SiafundOutputs = append(txn.SiafundOutputs, types.SiafundOutput{
+			Value:      funds,
+			UnlockHash: dest,
+		})
+	}
+
+	// Size the fee from the signed transaction, including the siacoin output
+	// that receives the change. The encoded size of the fee depends on its
+	// value, so it is raised until it covers the size.
+	txn.MinerFees = []types.Currency{{}}
+	txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+		Value:      coins,
+		UnlockHash: dest,
+	})
+	var fee types.Currency
+	for {
+		txn.MinerFees[0] = fee
+		required := feePerByte.Mul(types.NewCurrency64(signedSize(txn, nil)))
+		if fee.Cmp(required) >= 0 {
+			break
+		}
+		fee = required
+	}
+
+	// Pay the fee from the siacoins of the seed.
+	if coins.Cmp(fee) > 0 {
+		txn.SiacoinOutputs[0].Value = coins.Sub(fee)
+		sigs, err := s.signatures(txn)
+		if err != nil {
+			return types.Currency{}, types.Currency{}, err
+		}
+		txn.TransactionSignatures = append(txn.TransactionSignatures, sigs...)
+		err = w.tpool.AcceptTransactionSet([]types.Transaction{txn})
+		if err != nil {
+			return types.Currency{}, types.Currency{}, err
+		}
+		return coins.Sub(fee), funds, nil
+	}
+	if funds.IsZero() {
+		return types.Currency{}, types.Currency{}, errSweepFee
+	}
+
+	// The siacoins of the seed cannot pay the fee, so the wallet funds it and
+	// signs its own inputs after the inputs of the seed have been signed.
+	txnBuilder := w.StartTransaction()
+	for _, sci := range txn.SiacoinInputs {
+		txnBuilder.AddSiacoinInput(sci)
+	}
+	for _, sfi := range txn.SiafundInputs {
+		txnBuilder.AddSiafundInput(sfi)
+	}
+	if !coins.IsZero() {
+		txnBuilder.AddSiacoinOutput(types.SiacoinOutput{
+			Value:      coins,
+			UnlockHash: dest,
+		})
+	}
+	txnBuilder.AddSiafundOutput(txn.SiafundOutputs[0])
+	view, parents := txnBuilder.View()
+	fee = feePerByte.Mul(types.NewCurrency64(signedSize(view, parents)))
+	err = txnBuilder.FundSiacoins(fee)
+	if err != nil {
+		txnBuilder.Drop()
+		return types.Currency{}, types.Currency{}, err
+	}
+	txnBuilder.AddMinerFee(fee)
+	err = topUpMinerFee(txnBuilder, fee, feePerByte)
+	if err != nil {
+		txnBuilder.Drop()
+		return types.Currency{}, types.Currency{}, err
+	}
+	view, _ = txnBuilder.View()
+	sigs, err := s.signatures(view)
+	if err != nil {
+		txnBuilder.Drop()
+		return types.Currency{}, types.Currency{}, err
+	}
+	for _, sig := range sigs {
+		txnBuilder.AddTransactionSignature(sig)
+	}
+	txnSet, err := txnBuilder.Sign(true)
+	if err != nil {
+		txnBuilder.Drop()
+		return types.Currency{}, types.Currency{}, err
+	}
+	err = w.tpool.AcceptTransactionSet(txnSet)
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	return coins, funds, nil
+}
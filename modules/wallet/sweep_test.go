@@ -0,0 +1,204 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationSweepSeed checks that the outputs of a seed are moved into
+// the wallet without the seed being added to the wallet.
+func TestIntegrationSweepSeed(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSweepSeed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	var seed modules.Seed
+	_, err = rand.Read(seed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wt.wallet.SweepSeed(seed); err != errNothingToSweep {
+		t.Error("expected errNothingToSweep, got", err)
+	}
+	primary, _, err := wt.wallet.PrimarySeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wt.wallet.SweepSeed(primary); err != errKnownSeed {
+		t.Error("expected errKnownSeed, got", err)
+	}
+
+	// Fund two addresses of the seed.
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(100))
+	for _, index := range []uint64{0, 5} {
+		_, err = wt.wallet.SendSiacoins(amount, generateSpendableKey(seed, index).UnlockConditions.UnlockHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sweep the seed.
+	coins, funds, err := wt.wallet.SweepSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins.Cmp(amount.Mul(types.NewCurrency64(2))) >= 0 || coins.IsZero() || !funds.IsZero() {
+		t.Fatal("unexpected swept amounts:", coins, funds)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wt.wallet.SweepSeed(seed); err != errNothingToSweep {
+		t.Error("expected errNothingToSweep after sweeping, got", err)
+	}
+	found := false
+	for _, uo := range wt.wallet.UnspentOutputs() {
+		found = found || (uo.FundType == types.SpecifierSiacoinOutput && uo.Value.Cmp(coins) == 0)
+	}
+	if !found {
+		t.Error("swept siacoins were not sent to the wallet")
+	}
+
+	// The seed should not have been added to the wallet.
+	seeds, err := wt.wallet.AllSeeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) != 1 {
+		t.Error("seed was added to the wallet")
+	}
+}
+
+// TestIntegrationSweepSeedSiafunds checks that a seed that only holds
+// siafunds is swept, with the miner fee paid by the wallet.
+func TestIntegrationSweepSeedSiafunds(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSweepSeedSiafunds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	err = wt.wallet.LoadSiagKeys(wt.walletMasterKey, []string{"../../types/siag0of1of1.siakey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seed modules.Seed
+	_, err = rand.Read(seed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := types.NewCurrency64(12)
+	_, err = wt.wallet.SendSiafunds(amount, generateSpendableKey(seed, 3).UnlockConditions.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coins, funds, err := wt.wallet.SweepSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !coins.IsZero() || funds.Cmp(amount) != 0 {
+		t.Fatal("unexpected swept amounts:", coins, funds)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wt.wallet.SweepSeed(seed); err != errNothingToSweep {
+		t.Error("expected errNothingToSweep after sweeping, got", err)
+	}
+	_, siafundBal, _ := wt.wallet.ConfirmedBalance()
+	if siafundBal.Cmp(types.NewCurrency64(2000)) != 0 {
+		t.Error("swept siafunds were not sent to the wallet:", siafundBal)
+	}
+}
+
+// TestIntegrationSweepSeedBatches checks that a seed with more outputs than
+// fit in a single sweep transaction is swept in several transactions.
+func TestIntegrationSweepSeedBatches(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationSweepSeedBatches")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	var seed modules.Seed
+	_, err = rand.Read(seed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(10))
+	var outputs []types.SiacoinOutput
+	for i := uint64(0); i < sweepBatchSize*2+1; i++ {
+		outputs = append(outputs, types.SiacoinOutput{
+			Value:      amount,
+			UnlockHash: generateSpendableKey(seed, i).UnlockConditions.UnlockHash(),
+		})
+	}
+	_, err = wt.wallet.SendSiacoinsMulti(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coins, _, err := wt.wallet.SweepSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins.IsZero() || coins.Cmp(amount.Mul(types.NewCurrency64(uint64(len(outputs))))) >= 0 {
+		t.Fatal("unexpected swept amount:", coins)
+	}
+	seedAddrs := make(map[types.UnlockHash]struct{})
+	for _, sco := range outputs {
+		seedAddrs[sco.UnlockHash] = struct{}{}
+	}
+	var sweeps int
+	for _, txn := range wt.tpool.TransactionList() {
+		if len(txn.SiacoinInputs) == 0 {
+			continue
+		}
+		if _, exists := seedAddrs[txn.SiacoinInputs[0].UnlockConditions.UnlockHash()]; !exists {
+			continue
+		}
+		sweeps++
+		if len(txn.SiacoinInputs) > sweepBatchSize {
+			t.Error("sweep transaction has too many inputs:", len(txn.SiacoinInputs))
+		}
+	}
+	if sweeps != 3 {
+		t.Error("expected 3 sweep transactions, got", sweeps)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wt.wallet.SweepSeed(seed); err != errNothingToSweep {
+		t.Error("expected errNothingToSweep after sweeping, got", err)
+	}
+}
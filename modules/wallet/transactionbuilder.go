@@ -9,6 +9,8 @@ import (
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
 )
 
 var (
@@ -16,6 +18,18 @@ var (
 	// already added at least one successful signature to the transaction,
 	// meaning that future calls to Sign will result in an invalid transaction.
 	errBuilderAlreadySigned = errors.New("sign has already been called on this transaction builder, multiple calls can cause issues")
+
+	// errDuplicateOutput indicates that the same output was listed more than
+	// once when funding a transaction.
+	errDuplicateOutput = errors.New("output was listed more than once")
+
+	// errUnknownOutput indicates that an output listed when funding a
+	// transaction is not a siacoin output of the wallet.
+	errUnknownOutput = errors.New("output is not a siacoin output of the wallet")
+
+	// errTimelockedOutput indicates that an output listed when funding a
+	// transaction cannot be spent until a later height.
+	errTimelockedOutput = errors.New("output cannot be spent until a later height")
 )
 
 // transactionBuilder allows transactions to be manually constructed, including
@@ -90,23 +104,37 @@ func (tb *transactionBuilder) FundSiacoins(amount types.Currency) error {
 	tb.wallet.mu.Lock()
 	defer tb.wallet.mu.Unlock()
 
-	// Collect a value-sorted set of siacoin outputs.
+	// Collect a value-sorted set of siacoin outputs, along with the outputs
+	// that have recently been spent by the wallet.
 	var so sortedOutputs
-	for scoid, sco := range tb.wallet.siacoinOutputs {
-		so.ids = append(so.ids, scoid)
-		so.outputs = append(so.outputs, sco)
-	}
-	// Add all of the unconfirmed outputs as well.
-	for _, upt := range tb.wallet.unconfirmedProcessedTransactions {
-		for i, sco := range upt.Transaction.SiacoinOutputs {
-			// Determine if the output belongs to the wallet.
-			_, exists := tb.wallet.keys[sco.UnlockHash]
-			if !exists {
-				continue
-			}
-			so.ids = append(so.ids, upt.Transaction.SiacoinOutputID(uint64(i)))
+	recentlySpent := make(map[types.SiacoinOutputID]bool)
+	err := tb.wallet.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachSiacoinOutput(tx.Bucket(bucketSiacoinOutputs), func(scoid types.SiacoinOutputID, sco types.SiacoinOutput) {
+			so.ids = append(so.ids, scoid)
 			so.outputs = append(so.outputs, sco)
+		})
+		if err != nil {
+			return err
+		}
+		// Add all of the unconfirmed outputs as well.
+		for _, upt := range tb.wallet.unconfirmedProcessedTransactions {
+			for i, sco := range upt.Transaction.SiacoinOutputs {
+				// Determine if the output belongs to the wallet.
+				_, exists := tb.wallet.keys[sco.UnlockHash]
+				if !exists {
+					continue
+				}
+				so.ids = append(so.ids, upt.Transaction.SiacoinOutputID(uint64(i)))
+				so.outputs = append(so.outputs, sco)
+			}
+		}
+		for _, scoid := range so.ids {
+			recentlySpent[scoid] = tb.wallet.recentlySpent(tx, types.OutputID(scoid))
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	sort.Sort(sort.Reverse(so))
 
@@ -124,13 +152,7 @@ func (tb *transactionBuilder) FundSiacoins(amount types.Currency) error {
 		scoid := so.ids[i]
 		sco := so.outputs[i]
 		// Check that this output has not recently been spent by the wallet.
-		spendHeight := tb.wallet.spentOutputs[types.OutputID(scoid)]
-		// Prevent an underflow error.
-		allowedHeight := tb.wallet.consensusSetHeight - RespendTimeout
-		if tb.wallet.consensusSetHeight < RespendTimeout {
-			allowedHeight = 0
-		}
-		if spendHeight > allowedHeight {
+		if recentlySpent[scoid] {
 			potentialFund = potentialFund.Add(sco.Value)
 			continue
 		}
@@ -193,9 +215,17 @@ func (tb *transactionBuilder) FundSiacoins(amount types.Currency) error {
 			return err
 		}
 	}
-	// Mark the parent output as spent. Must be done after the transaction is
-	// finished because otherwise the txid and output id will change.
-	tb.wallet.spentOutputs[types.OutputID(parentTxn.SiacoinOutputID(0))] = tb.wallet.consensusSetHeight
+	// Mark the parent output and all outputs that were spent as spent. Must
+	// be done after the transaction is finished because otherwise the txid
+	// and output id will change.
+	spent := []types.OutputID{types.OutputID(parentTxn.SiacoinOutputID(0))}
+	for _, scoid := range spentScoids {
+		spent = append(spent, types.OutputID(scoid))
+	}
+	err = tb.wallet.markSpent(spent)
+	if err != nil {
+		return err
+	}
 
 	// Add the exact output.
 	newInput := types.SiacoinInput{
@@ -206,10 +236,84 @@ func (tb *transactionBuilder) FundSiacoins(amount types.Currency) error {
 	tb.parents = append(tb.parents, parentTxn)
 	tb.siacoinInputs = append(tb.siacoinInputs, len(tb.transaction.SiacoinInputs))
 	tb.transaction.SiacoinInputs = append(tb.transaction.SiacoinInputs, newInput)
+	return nil
+}
 
-	// Mark all outputs that were spent as spent.
-	for _, scoid := range spentScoids {
-		tb.wallet.spentOutputs[types.OutputID(scoid)] = tb.wallet.consensusSetHeight
+// FundSiacoinsWithOutputs will add each of the given outputs as a siacoin
+// input of the transaction. If the outputs are worth more than 'amount', a
+// refund output is added to the transaction. Unlike 'FundSiacoins', no parent
+// transaction is created, so the caller controls exactly which outputs are
+// spent. The siacoin inputs will not be signed until 'Sign' is called on the
+// transaction builder.
+func (tb *transactionBuilder) FundSiacoinsWithOutputs(amount types.Currency, ids []types.SiacoinOutputID) error {
+	tb.wallet.mu.Lock()
+	defer tb.wallet.mu.Unlock()
+
+	if len(ids) == 0 {
+		return errNoOutputs
+	}
+
+	// Check that all of the outputs can be spent before modifying the
+	// transaction.
+	var fund types.Currency
+	var inputs []types.SiacoinInput
+	listed := make(map[types.SiacoinOutputID]struct{})
+	err := tb.wallet.db.View(func(tx *bolt.Tx) error {
+		for _, scoid := range ids {
+			if _, exists := listed[scoid]; exists {
+				return errDuplicateOutput
+			}
+			listed[scoid] = struct{}{}
+			sco, exists := tb.wallet.findSiacoinOutput(tx, scoid)
+			if !exists {
+				return errUnknownOutput
+			}
+			if tb.wallet.recentlySpent(tx, types.OutputID(scoid)) {
+				return modules.ErrPotentialDoubleSpend
+			}
+			outputUnlockConditions := tb.wallet.keys[sco.UnlockHash].UnlockConditions
+			if tb.wallet.consensusSetHeight < outputUnlockConditions.Timelock {
+				return errTimelockedOutput
+			}
+			inputs = append(inputs, types.SiacoinInput{
+				ParentID:         scoid,
+				UnlockConditions: outputUnlockConditions,
+			})
+			fund = fund.Add(sco.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if fund.Cmp(amount) < 0 {
+		return modules.ErrLowBalance
+	}
+
+	// Create a refund output if needed.
+	if fund.Cmp(amount) != 0 {
+		refundUnlockConditions, err := tb.wallet.nextPrimarySeedAddress()
+		if err != nil {
+			return err
+		}
+		tb.transaction.SiacoinOutputs = append(tb.transaction.SiacoinOutputs, types.SiacoinOutput{
+			Value:      fund.Sub(amount),
+			UnlockHash: refundUnlockConditions.UnlockHash(),
+		})
+	}
+
+	// Mark the outputs as spent and add the inputs.
+	var spent []types.OutputID
+	for _, sci := range inputs {
+		spent = append(spent, types.OutputID(sci.ParentID))
+	}
+	err = tb.wallet.markSpent(spent)
+	if err != nil {
+		return err
+	}
+	for _, sci := range inputs {
+		tb.siacoinInputs = append(tb.siacoinInputs, len(tb.transaction.SiacoinInputs))
+		tb.transaction.SiacoinInputs = append(tb.transaction.SiacoinInputs, sci)
 	}
 	return nil
 }
@@ -228,15 +332,23 @@ func (tb *transactionBuilder) FundSiafunds(amount types.Currency) error {
 	var potentialFund types.Currency
 	parentTxn := types.Transaction{}
 	var spentSfoids []types.SiafundOutputID
-	for sfoid, sfo := range tb.wallet.siafundOutputs {
+	var sfoids []types.SiafundOutputID
+	var sfos []types.SiafundOutput
+	recentlySpent := make(map[types.SiafundOutputID]bool)
+	err := tb.wallet.db.View(func(tx *bolt.Tx) error {
+		return dbForEachSiafundOutput(tx.Bucket(bucketSiafundOutputs), func(sfoid types.SiafundOutputID, sfo types.SiafundOutput) {
+			sfoids = append(sfoids, sfoid)
+			sfos = append(sfos, sfo)
+			recentlySpent[sfoid] = tb.wallet.recentlySpent(tx, types.OutputID(sfoid))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, sfoid := range sfoids {
+		sfo := sfos[i]
 		// Check that this output has not recently been spent by the wallet.
-		spendHeight := tb.wallet.spentOutputs[types.OutputID(sfoid)]
-		// Prevent an underflow error.
-		allowedHeight := tb.wallet.consensusSetHeight - RespendTimeout
-		if tb.wallet.consensusSetHeight < RespendTimeout {
-			allowedHeight = 0
-		}
-		if spendHeight > allowedHeight {
+		if recentlySpent[sfoid] {
 			potentialFund = potentialFund.Add(sfo.Value)
 			continue
 		}
@@ -321,10 +433,11 @@ func (tb *transactionBuilder) FundSiafunds(amount types.Currency) error {
 	tb.transaction.SiafundInputs = append(tb.transaction.SiafundInputs, newInput)
 
 	// Mark all outputs that were spent as spent.
+	var spent []types.OutputID
 	for _, sfoid := range spentSfoids {
-		tb.wallet.spentOutputs[types.OutputID(sfoid)] = tb.wallet.consensusSetHeight
+		spent = append(spent, types.OutputID(sfoid))
 	}
-	return nil
+	return tb.wallet.markSpent(spent)
 }
 
 // AddParents adds a set of parents to the transaction.
@@ -417,11 +530,16 @@ func (tb *transactionBuilder) Drop() {
 	// Iterate through all parents and the transaction itself and restore all
 	// outputs to the list of available outputs.
 	txns := append(tb.parents, tb.transaction)
+	var spent []types.OutputID
 	for _, txn := range txns {
 		for _, sci := range txn.SiacoinInputs {
-			delete(tb.wallet.spentOutputs, types.OutputID(sci.ParentID))
+			spent = append(spent, types.OutputID(sci.ParentID))
 		}
 	}
+	err := tb.wallet.unmarkSpent(spent)
+	if err != nil {
+		tb.wallet.log.Println("ERROR: unable to return dropped outputs to the wallet:", err)
+	}
 
 	tb.parents = nil
 	tb.signed = false
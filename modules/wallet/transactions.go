@@ -5,36 +5,32 @@ import (
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
 )
 
 var (
-	errOutOfBounds      = errors.New("requesting transactions at unknown confirmation heights")
-	errNoHistoryForAddr = errors.New("no history found for provided address")
+	errInvalidAmountRange = errors.New("minimum amount is greater than the maximum amount")
+	errInvalidDirection   = errors.New("direction must be '" + modules.TransactionDirectionIncoming + "' or '" + modules.TransactionDirectionOutgoing + "'")
+	errInvalidLimit       = errors.New("limit must be greater than zero")
+	errNoHistoryForAddr   = errors.New("no history found for provided address")
+	errOutOfBounds        = errors.New("requesting transactions at unknown confirmation heights")
 )
 
 // AddressTransactions returns all of the wallet transactions associated with a
 // single unlock hash.
 func (w *Wallet) AddressTransactions(uh types.UnlockHash) (pts []modules.ProcessedTransaction) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
-	for _, pt := range w.processedTransactions {
-		relevant := false
-		for _, input := range pt.Inputs {
-			if input.RelatedAddress == uh {
-				relevant = true
-				break
-			}
-		}
-		for _, output := range pt.Outputs {
-			if output.RelatedAddress == uh {
-				relevant = true
-				break
-			}
-		}
-		if relevant {
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return dbForEachAddrTransaction(tx, uh, 0, func(_ uint64, pt modules.ProcessedTransaction) bool {
 			pts = append(pts, pt)
-		}
+			return true
+		})
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the history of an address:", err)
 	}
 	return pts
 }
@@ -70,38 +66,138 @@ func (w *Wallet) AddressUnconfirmedTransactions(uh types.UnlockHash) (pts []modu
 
 // Transaction returns the transaction with the given id. 'False' is returned
 // if the transaction does not exist.
-func (w *Wallet) Transaction(txid types.TransactionID) (modules.ProcessedTransaction, bool) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	pt, exists := w.processedTransactionMap[txid]
-	if !exists {
-		return modules.ProcessedTransaction{}, exists
+func (w *Wallet) Transaction(txid types.TransactionID) (pt modules.ProcessedTransaction, exists bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	err := w.db.View(func(tx *bolt.Tx) error {
+		index, ok := dbGetProcessedTransactionIndex(tx, txid)
+		if !ok {
+			return nil
+		}
+		var err error
+		pt, err = dbGetProcessedTransaction(tx, index)
+		exists = err == nil
+		return err
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read a transaction from the history:", err)
 	}
-	return *pt, exists
+	return pt, exists
 }
 
 // Transactions returns all transactions relevant to the wallet that were
 // confirmed in the range [startHeight, endHeight].
 func (w *Wallet) Transactions(startHeight, endHeight types.BlockHeight) (pts []modules.ProcessedTransaction, err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
 	if startHeight > w.consensusSetHeight || startHeight > endHeight {
 		return nil, errOutOfBounds
 	}
-	if len(w.processedTransactions) == 0 {
-		return nil, nil
+	err = w.db.View(func(tx *bolt.Tx) error {
+		return dbForEachProcessedTransaction(tx, 0, func(_ uint64, pt modules.ProcessedTransaction) bool {
+			if pt.ConfirmationHeight > endHeight {
+				return false
+			}
+			if pt.ConfirmationHeight >= startHeight {
+				pts = append(pts, pt)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pts, nil
+}
+
+// matchesFilter returns whether a processed transaction is selected by a
+// transaction filter.
+func matchesFilter(pt modules.ProcessedTransaction, filter modules.TransactionFilter) bool {
+	if filter.FundType != (types.Specifier{}) {
+		found := false
+		for _, input := range pt.Inputs {
+			found = found || (input.FundType == filter.FundType && (input.WalletAddress || input.WatchOnly))
+		}
+		for _, output := range pt.Outputs {
+			found = found || (output.FundType == filter.FundType && (output.WalletAddress || output.WatchOnly))
+		}
+		if !found {
+			return false
+		}
+	}
+
+	// Determine the direction and the absolute value of the net flow. The
+	// flow of siafunds is used if the filter selects a siafund fund type.
+	incoming, outgoing, incomingSiafunds, outgoingSiafunds := modules.WalletFlows(pt)
+	if filter.FundType == types.SpecifierSiafundInput || filter.FundType == types.SpecifierSiafundOutput {
+		incoming, outgoing = incomingSiafunds, outgoingSiafunds
+	}
+	var direction string
+	var amount types.Currency
+	if incoming.Cmp(outgoing) > 0 {
+		direction = modules.TransactionDirectionIncoming
+		amount = incoming.Sub(outgoing)
+	} else if incoming.Cmp(outgoing) < 0 {
+		direction = modules.TransactionDirectionOutgoing
+		amount = outgoing.Sub(incoming)
+	}
+	if filter.Direction != "" && filter.Direction != direction {
+		return false
+	}
+	if amount.Cmp(filter.MinAmount) < 0 {
+		return false
+	}
+	if !filter.MaxAmount.IsZero() && amount.Cmp(filter.MaxAmount) > 0 {
+		return false
+	}
+	return true
+}
+
+// TransactionHistory returns up to 'limit' confirmed transactions that match
+// the filter, in the order that they were confirmed, starting at 'cursor'. The
+// cursor is the index of a transaction in the history, and a cursor of zero
+// starts at the oldest transaction. Indices are never reused, so a cursor
+// remains valid when blocks are reverted: reverted transactions are removed
+// from the history, and transactions confirmed afterwards are appended with
+// new indices. The cursor of the next page is returned, and is zero once the
+// end of the history has been reached. If the filter
+// selects an address, only the transactions related to the address are read
+// from the database.
+func (w *Wallet) TransactionHistory(cursor uint64, limit int, filter modules.TransactionFilter) (pts []modules.ProcessedTransaction, next uint64, err error) {
+	if limit <= 0 {
+		return nil, 0, errInvalidLimit
+	}
+	if filter.Direction != "" && filter.Direction != modules.TransactionDirectionIncoming && filter.Direction != modules.TransactionDirectionOutgoing {
+		return nil, 0, errInvalidDirection
+	}
+	if !filter.MaxAmount.IsZero() && filter.MinAmount.Cmp(filter.MaxAmount) > 0 {
+		return nil, 0, errInvalidAmountRange
 	}
 
-	for _, pt := range w.processedTransactions {
-		if pt.ConfirmationHeight > endHeight {
-			break
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	collect := func(index uint64, pt modules.ProcessedTransaction) bool {
+		if len(pts) == limit {
+			next = index
+			return false
 		}
-		if pt.ConfirmationHeight >= startHeight {
+		if matchesFilter(pt, filter) {
 			pts = append(pts, pt)
 		}
+		return true
 	}
-	return pts, nil
+	err = w.db.View(func(tx *bolt.Tx) error {
+		if filter.Address != (types.UnlockHash{}) {
+			return dbForEachAddrTransaction(tx, filter.Address, cursor, collect)
+		}
+		return dbForEachProcessedTransaction(tx, cursor, collect)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return pts, next, nil
 }
 
 // UnconfirmedTransactions returns the set of unconfirmed transactions that are
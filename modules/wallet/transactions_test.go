@@ -3,6 +3,7 @@ package wallet
 import (
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -131,3 +132,130 @@ func TestIntegrationAddressTransactions(t *testing.T) {
 		t.Error("addresses unconfirmed transactions should be empty")
 	}
 }
+
+// TestIntegrationTransactionHistory checks that the history can be paginated
+// and filtered.
+func TestIntegrationTransactionHistory(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationTransactionHistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Send siacoins to an address of the wallet and to the void.
+	uc, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.wallet.SendSiacoins(types.SiacoinPrecision, uc.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(1000))
+	sendTxns, err := wt.wallet.SendSiacoins(amount, types.UnlockHash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading the history one page at a time should return the same
+	// transactions as Transactions.
+	all, err := wt.wallet.Transactions(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paged []modules.ProcessedTransaction
+	var cursor uint64
+	for {
+		pts, next, err := wt.wallet.TransactionHistory(cursor, 4, modules.TransactionFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pts) > 4 {
+			t.Fatal("page is larger than the limit:", len(pts))
+		}
+		paged = append(paged, pts...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("expected %v transactions, got %v", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i].TransactionID != all[i].TransactionID {
+			t.Fatal("paged history does not match the full history at", i)
+		}
+	}
+
+	// Every miner payout of the wallet is incoming.
+	pts, _, err := wt.wallet.TransactionHistory(0, 100, modules.TransactionFilter{
+		Direction: modules.TransactionDirectionIncoming,
+		FundType:  types.SpecifierMinerPayout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pts) != int(types.MaturityDelay+2) {
+		t.Error("unexpected number of miner payouts:", len(pts))
+	}
+
+	// Only the send to the void moves at least 'amount' out of the wallet.
+	pts, _, err = wt.wallet.TransactionHistory(0, 100, modules.TransactionFilter{
+		Direction: modules.TransactionDirectionOutgoing,
+		MinAmount: amount,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pts) != 1 || pts[0].TransactionID != sendTxns[len(sendTxns)-1].ID() {
+		t.Error("amount filter did not select the send:", pts)
+	}
+	pts, _, err = wt.wallet.TransactionHistory(0, 100, modules.TransactionFilter{
+		Direction: modules.TransactionDirectionOutgoing,
+		MaxAmount: types.NewCurrency64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pts) != 0 {
+		t.Error("expected no outgoing transactions below 1 hasting, got", len(pts))
+	}
+
+	// The address filter should match AddressTransactions.
+	addrHist := wt.wallet.AddressTransactions(uc.UnlockHash())
+	pts, _, err = wt.wallet.TransactionHistory(0, 100, modules.TransactionFilter{Address: uc.UnlockHash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrHist) == 0 || len(pts) != len(addrHist) {
+		t.Errorf("expected %v transactions for the address, got %v", len(addrHist), len(pts))
+	}
+
+	// The wallet has no siafunds.
+	pts, _, err = wt.wallet.TransactionHistory(0, 100, modules.TransactionFilter{FundType: types.SpecifierSiafundOutput})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pts) != 0 {
+		t.Error("expected no siafund transactions, got", len(pts))
+	}
+
+	// Invalid parameters should be rejected.
+	if _, _, err := wt.wallet.TransactionHistory(0, 0, modules.TransactionFilter{}); err != errInvalidLimit {
+		t.Error("expected errInvalidLimit, got", err)
+	}
+	if _, _, err := wt.wallet.TransactionHistory(0, 10, modules.TransactionFilter{Direction: "sideways"}); err != errInvalidDirection {
+		t.Error("expected errInvalidDirection, got", err)
+	}
+	if _, _, err := wt.wallet.TransactionHistory(0, 10, modules.TransactionFilter{MinAmount: types.NewCurrency64(2), MaxAmount: types.NewCurrency64(1)}); err != errInvalidAmountRange {
+		t.Error("expected errInvalidAmountRange, got", err)
+	}
+}
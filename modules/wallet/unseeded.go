@@ -4,12 +4,10 @@ import (
 	"bytes"
 	"crypto/rand"
 	"errors"
-	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
-	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -51,28 +49,61 @@ type SavedKey033x struct {
 	Visible          bool
 }
 
+// encryptSpendableKey encrypts a spendable key using a key derived from the
+// master key and a new UID.
+func encryptSpendableKey(masterKey crypto.TwofishKey, sk spendableKey) (SpendableKeyFile, error) {
+	// Create a UID and encryption verification.
+	var skf SpendableKeyFile
+	_, err := rand.Read(skf.UID[:])
+	if err != nil {
+		return SpendableKeyFile{}, err
+	}
+	encryptionKey := uidEncryptionKey(masterKey, skf.UID)
+	plaintextVerification := make([]byte, encryptionVerificationLen)
+	skf.EncryptionVerification, err = encryptionKey.EncryptBytes(plaintextVerification)
+	if err != nil {
+		return SpendableKeyFile{}, err
+	}
+
+	// Encrypt the key.
+	skf.SpendableKey, err = encryptionKey.EncryptBytes(encoding.Marshal(sk))
+	if err != nil {
+		return SpendableKeyFile{}, err
+	}
+	return skf, nil
+}
+
+// decryptSpendableKeyFile decrypts a spendable key file using the master key.
+func decryptSpendableKeyFile(masterKey crypto.TwofishKey, uk SpendableKeyFile) (spendableKey, error) {
+	// Verify that the decryption key is correct.
+	encKey := uidEncryptionKey(masterKey, uk.UID)
+	expectedDecryptedVerification := make([]byte, crypto.EntropySize)
+	decryptedVerification, err := encKey.DecryptBytes(uk.EncryptionVerification)
+	if err != nil {
+		return spendableKey{}, err
+	}
+	if !bytes.Equal(expectedDecryptedVerification, decryptedVerification) {
+		return spendableKey{}, modules.ErrBadEncryptionKey
+	}
+
+	// Decrypt the spendable key.
+	encodedKey, err := encKey.DecryptBytes(uk.SpendableKey)
+	if err != nil {
+		return spendableKey{}, err
+	}
+	var sk spendableKey
+	err = encoding.Unmarshal(encodedKey, &sk)
+	if err != nil {
+		return spendableKey{}, err
+	}
+	return sk, nil
+}
+
 // initUnseededKeys loads all of the unseeded keys into the wallet after the
 // wallet gets unlocked.
 func (w *Wallet) initUnseededKeys(masterKey crypto.TwofishKey) error {
 	for _, uk := range w.persist.UnseededKeys {
-		// Verify that the decryption key is correct.
-		encKey := uidEncryptionKey(masterKey, uk.UID)
-		expectedDecryptedVerification := make([]byte, crypto.EntropySize)
-		decryptedVerification, err := encKey.DecryptBytes(uk.EncryptionVerification)
-		if err != nil {
-			return err
-		}
-		if !bytes.Equal(expectedDecryptedVerification, decryptedVerification) {
-			return modules.ErrBadEncryptionKey
-		}
-
-		// Decrypt the spendable key and add it to the wallet.
-		encodedKey, err := encKey.DecryptBytes(uk.SpendableKey)
-		if err != nil {
-			return err
-		}
-		var sk spendableKey
-		err = encoding.Unmarshal(encodedKey, &sk)
+		sk, err := decryptSpendableKeyFile(masterKey, uk)
 		if err != nil {
 			return err
 		}
@@ -97,21 +128,8 @@ func (w *Wallet) loadSpendableKey(masterKey crypto.TwofishKey, sk spendableKey)
 
 	// TODO: Check that the key is actually spendable.
 
-	// Create a UID and encryption verification.
-	var skf SpendableKeyFile
-	_, err := rand.Read(skf.UID[:])
-	if err != nil {
-		return err
-	}
-	encryptionKey := uidEncryptionKey(masterKey, skf.UID)
-	plaintextVerification := make([]byte, encryptionVerificationLen)
-	skf.EncryptionVerification, err = encryptionKey.EncryptBytes(plaintextVerification)
-	if err != nil {
-		return err
-	}
-
 	// Encrypt and save the key.
-	skf.SpendableKey, err = encryptionKey.EncryptBytes(encoding.Marshal(sk))
+	skf, err := encryptSpendableKey(masterKey, sk)
 	if err != nil {
 		return err
 	}
@@ -172,23 +190,40 @@ func (w *Wallet) loadSiagKeys(masterKey crypto.TwofishKey, keyfiles []string) er
 	if err != nil {
 		return err
 	}
-	return w.createBackup(filepath.Join(w.persistDir, "Sia Wallet Encrypted Backup - "+persist.RandomSuffix()+settingsFileSuffix))
+	return w.createSettingsBackup()
 }
 
-// LoadSiagKeys loads a set of siag-generated keys into the wallet.
+// LoadSiagKeys loads a set of siag-generated keys into the wallet. The
+// blockchain is rescanned to find the outputs and history of the keys.
 func (w *Wallet) LoadSiagKeys(masterKey crypto.TwofishKey, keyfiles []string) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	err := w.checkMasterKey(masterKey)
+	err := func() error {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		err := w.checkMasterKey(masterKey)
+		if err != nil {
+			return err
+		}
+		return w.loadSiagKeys(masterKey, keyfiles)
+	}()
 	if err != nil {
 		return err
 	}
-	return w.loadSiagKeys(masterKey, keyfiles)
+	return w.managedRescan()
 }
 
 // Load033xWallet loads a v0.3.3.x wallet as an unseeded key, such that the
-// funds become spendable to the current wallet.
+// funds become spendable to the current wallet. The blockchain is rescanned to
+// find the outputs and history of the keys.
 func (w *Wallet) Load033xWallet(masterKey crypto.TwofishKey, filepath033x string) error {
+	err := w.managedLoad033xWallet(masterKey, filepath033x)
+	if err != nil {
+		return err
+	}
+	return w.managedRescan()
+}
+
+// managedLoad033xWallet loads the keys of a v0.3.3.x wallet as unseeded keys.
+func (w *Wallet) managedLoad033xWallet(masterKey crypto.TwofishKey, filepath033x string) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	err := w.checkMasterKey(masterKey)
@@ -222,5 +257,5 @@ func (w *Wallet) Load033xWallet(masterKey crypto.TwofishKey, filepath033x string
 	if seedsLoaded == 0 {
 		return errAllDuplicates
 	}
-	return w.createBackup(filepath.Join(w.persistDir, "Sia Wallet Encrypted Backup - "+persist.RandomSuffix()+settingsFileSuffix))
+	return w.createSettingsBackup()
 }
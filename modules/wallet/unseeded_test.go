@@ -1,8 +1,11 @@
 package wallet
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/miner"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -25,7 +28,13 @@ func TestIntegrationLoad1of1Siag(t *testing.T) {
 	}
 
 	// Create a second wallet that loads the persist structures of the existing
-	// wallet. This wallet should have a siafund balance.
+	// wallet. This wallet should have a siafund balance. The existing wallet
+	// is closed first, so a new miner is needed to mine into the second
+	// wallet.
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
 	w, err := New(wt.cs, wt.tpool, wt.wallet.persistDir)
 	if err != nil {
 		t.Fatal(err)
@@ -34,6 +43,10 @@ func TestIntegrationLoad1of1Siag(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	m, err := miner.New(wt.cs, wt.tpool, w, filepath.Join(wt.persistDir, modules.MinerDir))
+	if err != nil {
+		t.Fatal(err)
+	}
 	_, siafundBal, _ := w.ConfirmedBalance()
 	if siafundBal.Cmp(types.NewCurrency64(2000)) != 0 {
 		t.Error("expecting a siafund balance of 2000 from the 1of1 key")
@@ -44,7 +57,7 @@ func TestIntegrationLoad1of1Siag(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = wt.miner.AddBlock()
+	_, err = m.AddBlock()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -73,7 +86,13 @@ func TestIntegrationLoad2of3Siag(t *testing.T) {
 	}
 
 	// Create a second wallet that loads the persist structures of the existing
-	// wallet. This wallet should have a siafund balance.
+	// wallet. This wallet should have a siafund balance. The existing wallet
+	// is closed first, so a new miner is needed to mine into the second
+	// wallet.
+	err = wt.wallet.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
 	w, err := New(wt.cs, wt.tpool, wt.wallet.persistDir)
 	if err != nil {
 		t.Fatal(err)
@@ -82,6 +101,10 @@ func TestIntegrationLoad2of3Siag(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	m, err := miner.New(wt.cs, wt.tpool, w, filepath.Join(wt.persistDir, modules.MinerDir))
+	if err != nil {
+		t.Fatal(err)
+	}
 	_, siafundBal, _ := w.ConfirmedBalance()
 	if siafundBal.Cmp(types.NewCurrency64(7000)) != 0 {
 		t.Error("expecting a siafund balance of 7000 from the 2of3 key")
@@ -92,7 +115,7 @@ func TestIntegrationLoad2of3Siag(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = wt.miner.AddBlock()
+	_, err = m.AddBlock()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,54 +1,96 @@
 package wallet
 
 import (
+	"errors"
 	"math"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	// errPrunedBlockchain is returned when the wallet subscribes to a pruned
+	// consensus set that no longer has the blocks needed to bring the wallet
+	// up to date.
+	errPrunedBlockchain = errors.New("the consensus set has pruned the blocks that the wallet needs to catch up; scan the wallet on a node that was not started with --prune-depth")
 )
 
 // updateConfirmedSet uses a consensus change to update the confirmed set of
 // outputs as understood by the wallet.
-func (w *Wallet) updateConfirmedSet(cc modules.ConsensusChange) {
+func (w *Wallet) updateConfirmedSet(tx *bolt.Tx, cc modules.ConsensusChange) error {
 	for _, diff := range cc.SiacoinOutputDiffs {
-		// Verify that the diff is relevant to the wallet.
-		_, exists := w.keys[diff.SiacoinOutput.UnlockHash]
-		if !exists {
-			continue
+		// Verify that the diff is relevant to the wallet. Outputs of watched
+		// addresses are tracked separately from the spendable outputs.
+		outputs := tx.Bucket(bucketSiacoinOutputs)
+		if _, exists := w.keys[diff.SiacoinOutput.UnlockHash]; !exists {
+			if _, watched := w.watchedAddrs[diff.SiacoinOutput.UnlockHash]; !watched {
+				continue
+			}
+			outputs = tx.Bucket(bucketWatchedSiacoinOutputs)
 		}
 
-		_, exists = w.siacoinOutputs[diff.ID]
+		exists := dbExists(outputs, diff.ID)
+		var err error
 		if diff.Direction == modules.DiffApply {
 			if build.DEBUG && exists {
 				panic("adding an existing output to wallet")
 			}
-			w.siacoinOutputs[diff.ID] = diff.SiacoinOutput
+			err = dbPut(outputs, diff.ID, diff.SiacoinOutput)
 		} else {
 			if build.DEBUG && !exists {
 				panic("deleting nonexisting output from wallet")
 			}
-			delete(w.siacoinOutputs, diff.ID)
+			err = dbDelete(outputs, diff.ID)
+			if err == nil {
+				err = dbDelete(tx.Bucket(bucketConfirmationHeights), types.OutputID(diff.ID))
+			}
+		}
+		if err != nil {
+			return err
 		}
 	}
 	for _, diff := range cc.SiafundOutputDiffs {
-		// Verify that the diff is relevant to the wallet.
-		_, exists := w.keys[diff.SiafundOutput.UnlockHash]
-		if !exists {
-			continue
+		// The claim start of a siafund output is set by the consensus set
+		// when the output is created, so it is recorded from the diff rather
+		// than from the transaction.
+		if diff.Direction == modules.DiffApply {
+			err := dbPut(tx.Bucket(bucketHistoricClaimStarts), diff.ID, diff.SiafundOutput.ClaimStart)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Verify that the diff is relevant to the wallet. Outputs of watched
+		// addresses are tracked separately from the spendable outputs.
+		outputs := tx.Bucket(bucketSiafundOutputs)
+		if _, exists := w.keys[diff.SiafundOutput.UnlockHash]; !exists {
+			if _, watched := w.watchedAddrs[diff.SiafundOutput.UnlockHash]; !watched {
+				continue
+			}
+			outputs = tx.Bucket(bucketWatchedSiafundOutputs)
 		}
 
-		_, exists = w.siafundOutputs[diff.ID]
+		exists := dbExists(outputs, diff.ID)
+		var err error
 		if diff.Direction == modules.DiffApply {
 			if build.DEBUG && exists {
 				panic("adding an existing output to wallet")
 			}
-			w.siafundOutputs[diff.ID] = diff.SiafundOutput
+			err = dbPut(outputs, diff.ID, diff.SiafundOutput)
 		} else {
 			if build.DEBUG && !exists {
 				panic("deleting nonexisting output from wallet")
 			}
-			delete(w.siafundOutputs, diff.ID)
+			err = dbDelete(outputs, diff.ID)
+			if err == nil {
+				err = dbDelete(tx.Bucket(bucketConfirmationHeights), types.OutputID(diff.ID))
+			}
+		}
+		if err != nil {
+			return err
 		}
 	}
 	for _, diff := range cc.SiafundPoolDiffs {
@@ -58,42 +100,63 @@ func (w *Wallet) updateConfirmedSet(cc modules.ConsensusChange) {
 			w.siafundPool = diff.Previous
 		}
 	}
+	return nil
 }
 
 // revertHistory reverts any transaction history that was destroyed by reverted
 // blocks in the consensus change.
-func (w *Wallet) revertHistory(cc modules.ConsensusChange) {
+func (w *Wallet) revertHistory(tx *bolt.Tx, cc modules.ConsensusChange) error {
 	for _, block := range cc.RevertedBlocks {
 		// Remove any transactions that have been reverted.
 		for i := len(block.Transactions) - 1; i >= 0; i-- {
 			// If the transaction is relevant to the wallet, it will be the
-			// most recent transaction appended to w.processedTransactions.
-			// Relevance can be determined just by looking at the last element
-			// of w.processedTransactions.
-			txn := block.Transactions[i]
-			txid := txn.ID()
-			if len(w.processedTransactions) > 0 && txid == w.processedTransactions[len(w.processedTransactions)-1].TransactionID {
-				w.processedTransactions = w.processedTransactions[:len(w.processedTransactions)-1]
-				delete(w.processedTransactionMap, txid)
+			// most recent transaction in the history. Relevance can be
+			// determined just by looking at the last transaction of the
+			// history.
+			txid := block.Transactions[i].ID()
+			last, err := dbGetLastProcessedTransaction(tx)
+			if err == errNoHistory {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if txid == last.TransactionID {
+				err = dbDeleteLastProcessedTransaction(tx)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
 		// Remove the miner payout transaction if applicable.
 		for _, mp := range block.MinerPayouts {
 			_, exists := w.keys[mp.UnlockHash]
-			if exists {
-				w.processedTransactions = w.processedTransactions[:len(w.processedTransactions)-1]
-				delete(w.processedTransactionMap, types.TransactionID(block.ID()))
+			_, watched := w.watchedAddrs[mp.UnlockHash]
+			if exists || watched {
+				err := dbDeleteLastProcessedTransaction(tx)
+				if err != nil {
+					return err
+				}
 				break
 			}
 		}
 		w.consensusSetHeight--
 	}
+	return nil
 }
 
 // applyHistory applies any transaction history that was introduced by the
 // applied blocks.
-func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
+func (w *Wallet) applyHistory(tx *bolt.Tx, cc modules.ConsensusChange) error {
+	// The value of a claim output depends on the siafund pool at the moment
+	// that the siafund input is applied, which the consensus set reports in
+	// the delayed output diff of the claim.
+	claimValues := make(map[types.SiacoinOutputID]types.Currency)
+	for _, diff := range cc.DelayedSiacoinOutputDiffs {
+		if diff.Direction == modules.DiffApply {
+			claimValues[diff.ID] = diff.SiacoinOutput.Value
+		}
+	}
 	for _, block := range cc.AppliedBlocks {
 		w.consensusSetHeight++
 		// Apply the miner payout transaction if applicable.
@@ -106,21 +169,28 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 		relevant := false
 		for i, mp := range block.MinerPayouts {
 			_, exists := w.keys[mp.UnlockHash]
-			if exists {
+			_, watched := w.watchedAddrs[mp.UnlockHash]
+			if exists || watched {
 				relevant = true
 			}
 			minerPT.Outputs = append(minerPT.Outputs, modules.ProcessedOutput{
 				FundType:       types.SpecifierMinerPayout,
 				MaturityHeight: w.consensusSetHeight + types.MaturityDelay,
 				WalletAddress:  exists,
+				WatchOnly:      watched,
 				RelatedAddress: mp.UnlockHash,
 				Value:          mp.Value,
 			})
-			w.historicOutputs[types.OutputID(block.MinerPayoutID(uint64(i)))] = mp.Value
+			err := w.recordOutput(tx, types.OutputID(block.MinerPayoutID(uint64(i))), mp.Value, exists)
+			if err != nil {
+				return err
+			}
 		}
 		if relevant {
-			w.processedTransactions = append(w.processedTransactions, minerPT)
-			w.processedTransactionMap[minerPT.TransactionID] = &w.processedTransactions[len(w.processedTransactions)-1]
+			err := dbAppendProcessedTransaction(tx, minerPT)
+			if err != nil {
+				return err
+			}
 		}
 		for _, txn := range block.Transactions {
 			relevant := false
@@ -132,65 +202,92 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 			}
 			for _, sci := range txn.SiacoinInputs {
 				_, exists := w.keys[sci.UnlockConditions.UnlockHash()]
-				if exists {
+				_, watched := w.watchedAddrs[sci.UnlockConditions.UnlockHash()]
+				if exists || watched {
 					relevant = true
 				}
+				sciValue, err := dbGetHistoricOutput(tx, types.OutputID(sci.ParentID))
+				if err != nil {
+					return err
+				}
 				pt.Inputs = append(pt.Inputs, modules.ProcessedInput{
 					FundType:       types.SpecifierSiacoinInput,
 					WalletAddress:  exists,
+					WatchOnly:      watched,
 					RelatedAddress: sci.UnlockConditions.UnlockHash(),
-					Value:          w.historicOutputs[types.OutputID(sci.ParentID)],
+					Value:          sciValue,
 				})
 			}
 			for i, sco := range txn.SiacoinOutputs {
 				_, exists := w.keys[sco.UnlockHash]
-				if exists {
+				_, watched := w.watchedAddrs[sco.UnlockHash]
+				if exists || watched {
 					relevant = true
 				}
 				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
 					FundType:       types.SpecifierSiacoinOutput,
 					MaturityHeight: w.consensusSetHeight,
 					WalletAddress:  exists,
+					WatchOnly:      watched,
 					RelatedAddress: sco.UnlockHash,
 					Value:          sco.Value,
 				})
-				w.historicOutputs[types.OutputID(txn.SiacoinOutputID(uint64(i)))] = sco.Value
+				err := w.recordOutput(tx, types.OutputID(txn.SiacoinOutputID(uint64(i))), sco.Value, exists)
+				if err != nil {
+					return err
+				}
 			}
 			for _, sfi := range txn.SiafundInputs {
 				_, exists := w.keys[sfi.UnlockConditions.UnlockHash()]
-				if exists {
+				_, watched := w.watchedAddrs[sfi.UnlockConditions.UnlockHash()]
+				if exists || watched {
 					relevant = true
 				}
-				sfiValue := w.historicOutputs[types.OutputID(sfi.ParentID)]
+				sfiValue, err := dbGetHistoricOutput(tx, types.OutputID(sfi.ParentID))
+				if err != nil {
+					return err
+				}
 				pt.Inputs = append(pt.Inputs, modules.ProcessedInput{
 					FundType:       types.SpecifierSiafundInput,
 					WalletAddress:  exists,
+					WatchOnly:      watched,
 					RelatedAddress: sfi.UnlockConditions.UnlockHash(),
 					Value:          sfiValue,
 				})
-				claimValue := w.siafundPool.Sub(w.historicClaimStarts[sfi.ParentID]).Mul(sfiValue)
+				claimValue := claimValues[sfi.ParentID.SiaClaimOutputID()]
 				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
 					FundType:       types.SpecifierClaimOutput,
 					MaturityHeight: w.consensusSetHeight + types.MaturityDelay,
 					WalletAddress:  exists,
+					WatchOnly:      watched,
 					RelatedAddress: sfi.ClaimUnlockHash,
 					Value:          claimValue,
 				})
+				if _, exists := w.keys[sfi.ClaimUnlockHash]; exists {
+					err = dbPut(tx.Bucket(bucketConfirmationHeights), types.OutputID(sfi.ParentID.SiaClaimOutputID()), w.consensusSetHeight)
+					if err != nil {
+						return err
+					}
+				}
 			}
 			for i, sfo := range txn.SiafundOutputs {
 				_, exists := w.keys[sfo.UnlockHash]
-				if exists {
+				_, watched := w.watchedAddrs[sfo.UnlockHash]
+				if exists || watched {
 					relevant = true
 				}
 				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
 					FundType:       types.SpecifierSiafundOutput,
 					MaturityHeight: w.consensusSetHeight,
 					WalletAddress:  exists,
+					WatchOnly:      watched,
 					RelatedAddress: sfo.UnlockHash,
 					Value:          sfo.Value,
 				})
-				w.historicOutputs[types.OutputID(txn.SiafundOutputID(uint64(i)))] = sfo.Value
-				w.historicClaimStarts[txn.SiafundOutputID(uint64(i))] = sfo.ClaimStart
+				err := w.recordOutput(tx, types.OutputID(txn.SiafundOutputID(uint64(i))), sfo.Value, exists)
+				if err != nil {
+					return err
+				}
 			}
 			for _, fee := range txn.MinerFees {
 				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
@@ -199,21 +296,117 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 				})
 			}
 			if relevant {
-				w.processedTransactions = append(w.processedTransactions, pt)
-				w.processedTransactionMap[pt.TransactionID] = &w.processedTransactions[len(w.processedTransactions)-1]
+				err := dbAppendProcessedTransaction(tx, pt)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
+	return nil
+}
+
+// recordOutput records the value of an output created in the blockchain, and
+// the height at which it was confirmed if it belongs to the wallet.
+func (w *Wallet) recordOutput(tx *bolt.Tx, oid types.OutputID, value types.Currency, walletAddress bool) error {
+	err := dbPut(tx.Bucket(bucketHistoricOutputs), oid, value)
+	if err != nil || !walletAddress {
+		return err
+	}
+	return dbPut(tx.Bucket(bucketConfirmationHeights), oid, w.consensusSetHeight)
 }
 
 // ProcessConsensusChange parses a consensus change to update the set of
-// confirmed outputs known to the wallet.
+// confirmed outputs known to the wallet. The outputs, the history, and the id
+// of the change are written to the database in a single transaction, so that
+// the wallet can resume its subscription from the change.
 func (w *Wallet) ProcessConsensusChange(cc modules.ConsensusChange) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	w.updateConfirmedSet(cc)
-	w.revertHistory(cc)
-	w.applyHistory(cc)
+	err := w.db.Update(func(tx *bolt.Tx) error {
+		err := w.updateConfirmedSet(tx, cc)
+		if err != nil {
+			return err
+		}
+		err = w.revertHistory(tx, cc)
+		if err != nil {
+			return err
+		}
+		err = w.applyHistory(tx, cc)
+		if err != nil {
+			return err
+		}
+
+		// Outputs that were not created by a transaction or a miner payout,
+		// such as file contract payouts, are recorded as confirmed at the
+		// current height.
+		for _, diff := range cc.SiacoinOutputDiffs {
+			oid := types.OutputID(diff.ID)
+			if !dbExists(tx.Bucket(bucketSiacoinOutputs), diff.ID) || dbExists(tx.Bucket(bucketConfirmationHeights), oid) {
+				continue
+			}
+			err = dbPut(tx.Bucket(bucketConfirmationHeights), oid, w.consensusSetHeight)
+			if err != nil {
+				return err
+			}
+		}
+		err = dbPruneSpentOutputs(tx, w.consensusSetHeight)
+		if err != nil {
+			return err
+		}
+		return dbPutConsensusState(tx, cc.ID, w.consensusSetHeight, w.siafundPool)
+	})
+	if err != nil {
+		build.Critical("wallet consensus update failed:", err)
+	}
+}
+
+// managedSubscribe subscribes the wallet to the consensus set, resuming from
+// the last consensus change recorded in the database. If the consensus set
+// does not know the change, the wallet's view of the blockchain is reset and
+// the blockchain is scanned from the beginning. errPrunedBlockchain is returned
+// if the consensus set has pruned the blocks needed for the scan.
+func (w *Wallet) managedSubscribe() error {
+	var ccid modules.ConsensusChangeID
+	err := w.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ccid, _, _, err = dbGetConsensusState(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = w.cs.ConsensusSetSubscribe(w, ccid)
+	if err == modules.ErrInvalidConsensusChangeID {
+		// The consensus set and the wallet's database are out of sync, which
+		// happens if the consensus set was deleted or replaced.
+		w.log.Println("WARN: last consensus change of the wallet is unknown, rescanning the blockchain.")
+		w.cs.Unsubscribe(w)
+		err = w.managedReset()
+		if err != nil {
+			return err
+		}
+		err = w.cs.ConsensusSetSubscribe(w, modules.ConsensusChangeBeginning)
+	}
+	if err == modules.ErrPrunedConsensusChangeID {
+		w.log.Println("WARN: the consensus set has pruned the blocks that the wallet needs to catch up.")
+		w.cs.Unsubscribe(w)
+		return errPrunedBlockchain
+	}
+	return err
+}
+
+// WatchedAddresses returns the addresses of the wallet, including the
+// watch-only addresses, so that a light consensus set only downloads the
+// blocks that involve the wallet.
+func (w *Wallet) WatchedAddresses() []types.UnlockHash {
+	addrs := w.AllAddresses()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for uh := range w.watchedAddrs {
+		addrs = append(addrs, uh)
+	}
+	return addrs
 }
 
 // ReceiveUpdatedUnconfirmedTransactions updates the wallet's unconfirmed
@@ -222,51 +415,73 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(txns []types.Transaction,
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	// unconfirmedOutputs holds the values of the outputs created by the
+	// unconfirmed transactions, which may be spent by later transactions of
+	// the set.
+	unconfirmedOutputs := make(map[types.OutputID]types.Currency)
 	w.unconfirmedProcessedTransactions = nil
-	for _, txn := range txns {
-		// To save on  code complexity, relveancy is determined while building
-		// up the wallet transaction.
-		relevant := false
-		pt := modules.ProcessedTransaction{
-			Transaction:           txn,
-			TransactionID:         txn.ID(),
-			ConfirmationHeight:    types.BlockHeight(math.MaxUint64),
-			ConfirmationTimestamp: types.Timestamp(math.MaxUint64),
-		}
-		for _, sci := range txn.SiacoinInputs {
-			_, exists := w.keys[sci.UnlockConditions.UnlockHash()]
-			if exists {
-				relevant = true
+	err := w.db.View(func(tx *bolt.Tx) error {
+		for _, txn := range txns {
+			// To save on  code complexity, relveancy is determined while
+			// building up the wallet transaction.
+			relevant := false
+			pt := modules.ProcessedTransaction{
+				Transaction:           txn,
+				TransactionID:         txn.ID(),
+				ConfirmationHeight:    types.BlockHeight(math.MaxUint64),
+				ConfirmationTimestamp: types.Timestamp(math.MaxUint64),
 			}
-			pt.Inputs = append(pt.Inputs, modules.ProcessedInput{
-				FundType:       types.SpecifierSiacoinInput,
-				WalletAddress:  exists,
-				RelatedAddress: sci.UnlockConditions.UnlockHash(),
-				Value:          w.historicOutputs[types.OutputID(sci.ParentID)],
-			})
-		}
-		for i, sco := range txn.SiacoinOutputs {
-			_, exists := w.keys[sco.UnlockHash]
-			if exists {
-				relevant = true
+			for _, sci := range txn.SiacoinInputs {
+				_, exists := w.keys[sci.UnlockConditions.UnlockHash()]
+				_, watched := w.watchedAddrs[sci.UnlockConditions.UnlockHash()]
+				if exists || watched {
+					relevant = true
+				}
+				sciValue, unconfirmed := unconfirmedOutputs[types.OutputID(sci.ParentID)]
+				if !unconfirmed {
+					var err error
+					sciValue, err = dbGetHistoricOutput(tx, types.OutputID(sci.ParentID))
+					if err != nil {
+						return err
+					}
+				}
+				pt.Inputs = append(pt.Inputs, modules.ProcessedInput{
+					FundType:       types.SpecifierSiacoinInput,
+					WalletAddress:  exists,
+					WatchOnly:      watched,
+					RelatedAddress: sci.UnlockConditions.UnlockHash(),
+					Value:          sciValue,
+				})
+			}
+			for i, sco := range txn.SiacoinOutputs {
+				_, exists := w.keys[sco.UnlockHash]
+				_, watched := w.watchedAddrs[sco.UnlockHash]
+				if exists || watched {
+					relevant = true
+				}
+				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
+					FundType:       types.SpecifierSiacoinOutput,
+					MaturityHeight: types.BlockHeight(math.MaxUint64),
+					WalletAddress:  exists,
+					WatchOnly:      watched,
+					RelatedAddress: sco.UnlockHash,
+					Value:          sco.Value,
+				})
+				unconfirmedOutputs[types.OutputID(txn.SiacoinOutputID(uint64(i)))] = sco.Value
+			}
+			for _, fee := range txn.MinerFees {
+				pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
+					FundType: types.SpecifierMinerFee,
+					Value:    fee,
+				})
+			}
+			if relevant {
+				w.unconfirmedProcessedTransactions = append(w.unconfirmedProcessedTransactions, pt)
 			}
-			pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
-				FundType:       types.SpecifierSiacoinOutput,
-				MaturityHeight: types.BlockHeight(math.MaxUint64),
-				WalletAddress:  exists,
-				RelatedAddress: sco.UnlockHash,
-				Value:          sco.Value,
-			})
-			w.historicOutputs[types.OutputID(txn.SiacoinOutputID(uint64(i)))] = sco.Value
-		}
-		for _, fee := range txn.MinerFees {
-			pt.Outputs = append(pt.Outputs, modules.ProcessedOutput{
-				FundType: types.SpecifierMinerFee,
-				Value:    fee,
-			})
-		}
-		if relevant {
-			w.unconfirmedProcessedTransactions = append(w.unconfirmedProcessedTransactions, pt)
 		}
+		return nil
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the values of unconfirmed inputs:", err)
 	}
 }
@@ -5,9 +5,11 @@ package wallet
 
 import (
 	"errors"
+	"fmt"
 	"sort"
 	"sync"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -41,63 +43,57 @@ type spendableKey struct {
 // manages building and sending transactions.
 type Wallet struct {
 	// unlocked indicates whether the wallet is currently storing secret keys
-	// in memory. subscribed indicates whether the wallet has subscribed to the
-	// consensus set yet - the wallet is unable to subscribe to the consensus
-	// set until it has been unlocked for the first time. The primary seed is
-	// used to generate new addresses for the wallet.
-	unlocked    bool
-	subscribed  bool
-	persist     WalletPersist
-	primarySeed modules.Seed
+	// in memory. subscribed indicates whether the wallet is subscribed to the
+	// consensus set - the wallet is unable to subscribe to the consensus set
+	// until it has been unlocked for the first time, and loses the
+	// subscription if a rescan fails. tpoolSubscribed indicates whether the
+	// wallet has subscribed to the transaction pool, which is never undone.
+	// The primary seed is used to generate new addresses for the wallet.
+	unlocked        bool
+	subscribed      bool
+	tpoolSubscribed bool
+	persist         WalletPersist
+	primarySeed     modules.Seed
 
 	// The wallet's dependencies. The items 'consensusSetHeight' and
 	// 'siafundPool' are tracked separately from the consensus set to minimize
 	// the number of queries that the wallet needs to make to the consensus
-	// set; queries to the consensus set are very slow.
+	// set; queries to the consensus set are very slow. Both are stored in the
+	// database along with the id of the last consensus change processed.
 	cs                 modules.ConsensusSet
 	tpool              modules.TransactionPool
 	consensusSetHeight types.BlockHeight
 	siafundPool        types.Currency
 
-	// The following set of fields are responsible for tracking the confirmed
-	// outputs, and for being able to spend them. The seeds are used to derive
-	// the keys that are tracked on the blockchain. All keys are pregenerated
-	// from the seeds, when checking new outputs or spending outputs, the seeds
-	// are not referenced at all. The seeds are only stored so that the user
-	// may access them.
+	// The seeds are used to derive the keys that are tracked on the
+	// blockchain. All keys are pregenerated from the seeds, when checking new
+	// outputs or spending outputs, the seeds are not referenced at all. The
+	// seeds are only stored so that the user may access them.
 	//
-	// siacoinOutptus, siafundOutputs, and spentOutputs are kept so that they
-	// can be scanned when trying to fund transactions.
-	seeds          []modules.Seed
-	keys           map[types.UnlockHash]spendableKey
-	siacoinOutputs map[types.SiacoinOutputID]types.SiacoinOutput
-	siafundOutputs map[types.SiafundOutputID]types.SiafundOutput
-	spentOutputs   map[types.OutputID]types.BlockHeight
-
-	// The following fields are kept to track transaction history.
-	// walletTransactions are stored in chronological order, and have a map for
-	// constant time random access. The set of full transactions is kept as
-	// well, ordering can be determined by the walletTransactions slice.
-	//
-	// The unconfirmed transactions are kept the same way, except without the
-	// random access. It is assumed that the list of unconfirmed transactions
-	// will be small enough that this will not be a problem.
-	//
-	// historicOutputs is kept so that the values of transaction inputs can be
-	// determined. historicOutputs is never cleared, but in general should be
-	// small compared to the list of transactions.
-	processedTransactions            []modules.ProcessedTransaction
-	processedTransactionMap          map[types.TransactionID]*modules.ProcessedTransaction
+	// The confirmed outputs of the keys and of the watched addresses, the
+	// outputs spent by the wallet, and the transaction history are kept in
+	// the database, which is updated by each consensus change. The wallet
+	// resumes its subscription from the last consensus change processed, so
+	// that unlocking the wallet does not require a rescan of the blockchain.
+	// The outputs of the watched addresses are tracked separately, so that
+	// they are never used to fund transactions signed by the wallet. Watched
+	// addresses are not secret, and are loaded when the wallet is created.
+	seeds        []modules.Seed
+	keys         map[types.UnlockHash]spendableKey
+	watchedAddrs map[types.UnlockHash]modules.WatchedAddress
+
+	// The unconfirmed transactions are kept in memory. It is assumed that the
+	// list of unconfirmed transactions will be small enough that this will
+	// not be a problem.
 	unconfirmedProcessedTransactions []modules.ProcessedTransaction
 
-	// TODO: Storing the whole set of historic outputs is expensive and
-	// unnecessary. There's a better way to do it.
-	historicOutputs     map[types.OutputID]types.Currency
-	historicClaimStarts map[types.SiafundOutputID]types.Currency
-
+	db         *persist.BoltDatabase
 	persistDir string
 	log        *persist.Logger
 	mu         sync.RWMutex
+
+	// rescanMu prevents rescans from running concurrently.
+	rescanMu sync.Mutex
 }
 
 // New creates a new wallet, loading any known addresses from the input file
@@ -118,15 +114,8 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, persistDir stri
 		cs:    cs,
 		tpool: tpool,
 
-		keys:           make(map[types.UnlockHash]spendableKey),
-		siacoinOutputs: make(map[types.SiacoinOutputID]types.SiacoinOutput),
-		siafundOutputs: make(map[types.SiafundOutputID]types.SiafundOutput),
-		spentOutputs:   make(map[types.OutputID]types.BlockHeight),
-
-		processedTransactionMap: make(map[types.TransactionID]*modules.ProcessedTransaction),
-
-		historicOutputs:     make(map[types.OutputID]types.Currency),
-		historicClaimStarts: make(map[types.SiafundOutputID]types.Currency),
+		keys:         make(map[types.UnlockHash]spendableKey),
+		watchedAddrs: make(map[types.UnlockHash]modules.WatchedAddress),
 
 		persistDir: persistDir,
 	}
@@ -134,9 +123,38 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, persistDir stri
 	if err != nil {
 		return nil, err
 	}
+	for _, wa := range w.persist.WatchedAddresses {
+		w.watchedAddrs[wa.UnlockHash] = wa
+	}
 	return w, nil
 }
 
+// Close unsubscribes the wallet from the consensus set, wipes the secret keys
+// of the wallet if it is unlocked, and closes the wallet's database and log.
+func (w *Wallet) Close() error {
+	w.mu.RLock()
+	subscribed := w.subscribed
+	unlocked := w.unlocked
+	w.mu.RUnlock()
+	if subscribed {
+		w.cs.Unsubscribe(w)
+	}
+
+	var errs []error
+	if unlocked {
+		if err := w.Lock(); err != nil {
+			errs = append(errs, fmt.Errorf("Lock failed: %v", err))
+		}
+	}
+	if err := w.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("db.Close failed: %v", err))
+	}
+	if err := w.log.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("log.Close failed: %v", err))
+	}
+	return build.JoinErrors(errs, "; ")
+}
+
 // AllAddresses returns all addresses that the wallet is able to spend from,
 // including unseeded addresses. Addresses are returned sorted in byte-order.
 func (w *Wallet) AllAddresses() []types.UnlockHash {
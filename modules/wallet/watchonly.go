@@ -0,0 +1,270 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	errDuplicateWatchAddress = errors.New("address is already watched by the wallet")
+	errEmptyWatchAddress     = errors.New("no address or unlock conditions were provided")
+	errUnknownWatchAddress   = errors.New("address is not watched by the wallet")
+	errWatchMismatch         = errors.New("unlock conditions do not match the address")
+	errWatchSpendable        = errors.New("address is already spendable by the wallet")
+)
+
+// watchedAddressesByHash sorts watched addresses in byte-order.
+type watchedAddressesByHash []modules.WatchedAddress
+
+func (wa watchedAddressesByHash) Len() int      { return len(wa) }
+func (wa watchedAddressesByHash) Swap(i, j int) { wa[i], wa[j] = wa[j], wa[i] }
+func (wa watchedAddressesByHash) Less(i, j int) bool {
+	return bytes.Compare(wa[i].UnlockHash[:], wa[j].UnlockHash[:]) < 0
+}
+
+// managedReset clears the wallet's view of the blockchain, including the id
+// of the last consensus change processed.
+func (w *Wallet) managedReset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.consensusSetHeight = 0
+	w.siafundPool = types.ZeroCurrency
+	return w.db.Update(dbReset)
+}
+
+// managedRescan resets the wallet's view of the blockchain and subscribes to
+// the consensus set again from the beginning, so that the outputs and history
+// of new keys and watched addresses are up to date. If the wallet has not
+// been unlocked yet, only the reset is performed, so that the first
+// subscription scans the whole blockchain instead of resuming. If the
+// subscription fails, the wallet is left unsubscribed, and the next rescan
+// or unlock tries to subscribe again.
+func (w *Wallet) managedRescan() error {
+	w.rescanMu.Lock()
+	defer w.rescanMu.Unlock()
+
+	w.mu.Lock()
+	subscribed := w.subscribed
+	resubscribe := subscribed || w.tpoolSubscribed
+	w.subscribed = false
+	w.mu.Unlock()
+	if subscribed {
+		w.cs.Unsubscribe(w)
+	}
+	err := w.managedReset()
+	if err != nil || !resubscribe {
+		return err
+	}
+	err = w.cs.ConsensusSetSubscribe(w, modules.ConsensusChangeBeginning)
+	if err == modules.ErrPrunedConsensusChangeID {
+		w.log.Println("WARN: the consensus set has pruned the blocks that the wallet needs to rescan.")
+		err = errPrunedBlockchain
+	}
+	if err != nil {
+		w.cs.Unsubscribe(w)
+		return err
+	}
+	w.mu.Lock()
+	w.subscribed = true
+	w.mu.Unlock()
+	return nil
+}
+
+// AddWatchAddress adds an address to the set of addresses that are watched by
+// the wallet. If only the unlock conditions are provided, the address is
+// derived from them. The blockchain is rescanned to find the outputs and
+// history of the address.
+func (w *Wallet) AddWatchAddress(wa modules.WatchedAddress) error {
+	if wa.UnlockConditions != nil {
+		if wa.UnlockHash == (types.UnlockHash{}) {
+			wa.UnlockHash = wa.UnlockConditions.UnlockHash()
+		} else if wa.UnlockConditions.UnlockHash() != wa.UnlockHash {
+			return errWatchMismatch
+		}
+	}
+	if wa.UnlockHash == (types.UnlockHash{}) {
+		return errEmptyWatchAddress
+	}
+
+	w.mu.Lock()
+	if _, exists := w.keys[wa.UnlockHash]; exists {
+		w.mu.Unlock()
+		return errWatchSpendable
+	}
+	if _, exists := w.watchedAddrs[wa.UnlockHash]; exists {
+		w.mu.Unlock()
+		return errDuplicateWatchAddress
+	}
+	w.watchedAddrs[wa.UnlockHash] = wa
+	w.persist.WatchedAddresses = append(w.persist.WatchedAddresses, wa)
+	err := w.saveSettingsSync()
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.managedRescan()
+}
+
+// RemoveWatchAddress removes an address from the set of addresses that are
+// watched by the wallet. The blockchain is rescanned to remove the outputs
+// and history of the address.
+func (w *Wallet) RemoveWatchAddress(uh types.UnlockHash) error {
+	w.mu.Lock()
+	if _, exists := w.watchedAddrs[uh]; !exists {
+		w.mu.Unlock()
+		return errUnknownWatchAddress
+	}
+	delete(w.watchedAddrs, uh)
+	for i, wa := range w.persist.WatchedAddresses {
+		if wa.UnlockHash == uh {
+			w.persist.WatchedAddresses = append(w.persist.WatchedAddresses[:i], w.persist.WatchedAddresses[i+1:]...)
+			break
+		}
+	}
+	err := w.saveSettingsSync()
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.managedRescan()
+}
+
+// WatchAddresses returns the addresses that are watched by the wallet, sorted
+// in byte-order.
+func (w *Wallet) WatchAddresses() []modules.WatchedAddress {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	addrs := make([]modules.WatchedAddress, 0, len(w.watchedAddrs))
+	for _, wa := range w.watchedAddrs {
+		addrs = append(addrs, wa)
+	}
+	sort.Sort(watchedAddressesByHash(addrs))
+	return addrs
+}
+
+// WatchOnlyBalance returns the confirmed balance of the watched addresses.
+func (w *Wallet) WatchOnlyBalance() (siacoinBalance types.Currency, siafundBalance types.Currency) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	err := w.db.View(func(tx *bolt.Tx) error {
+		err := dbForEachSiacoinOutput(tx.Bucket(bucketWatchedSiacoinOutputs), func(_ types.SiacoinOutputID, sco types.SiacoinOutput) {
+			siacoinBalance = siacoinBalance.Add(sco.Value)
+		})
+		if err != nil {
+			return err
+		}
+		return dbForEachSiafundOutput(tx.Bucket(bucketWatchedSiafundOutputs), func(_ types.SiafundOutputID, sfo types.SiafundOutput) {
+			siafundBalance = siafundBalance.Add(sfo.Value)
+		})
+	})
+	if err != nil {
+		w.log.Println("ERROR: unable to read the watched outputs:", err)
+	}
+	return siacoinBalance, siafundBalance
+}
+
+// managedUnsignedTransaction builds a transaction paying 'outputs' from the
+// watched addresses that are accepted by 'from' and whose unlock conditions
+// are known, spending the largest outputs first. Any change is returned to
+// the address of the first output spent, and the miner fee is sized from the
+// signed size of the transaction and the fee estimation of the transaction
+// pool. The transaction is returned unsigned along with a required signature
+// for each input, and is not given to the transaction pool.
+func (w *Wallet) managedUnsignedTransaction(outputs []types.SiacoinOutput, from func(types.UnlockHash) bool) (modules.UnsignedTransaction, error) {
+	if len(outputs) == 0 {
+		return modules.UnsignedTransaction{}, errNoOutputs
+	}
+	_, maxFee := w.tpool.FeeEstimation()
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	// Collect a value-sorted set of the spendable watched outputs.
+	spent := w.unconfirmedSpentOutputs()
+	var so sortedOutputs
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return dbForEachSiacoinOutput(tx.Bucket(bucketWatchedSiacoinOutputs), func(scoid types.SiacoinOutputID, sco types.SiacoinOutput) {
+			uc := w.watchedAddrs[sco.UnlockHash].UnlockConditions
+			if uc == nil || w.consensusSetHeight < uc.Timelock || !from(sco.UnlockHash) {
+				return
+			}
+			if _, exists := spent[types.OutputID(scoid)]; exists {
+				return
+			}
+			so.ids = append(so.ids, scoid)
+			so.outputs = append(so.outputs, sco)
+		})
+	})
+	if err != nil {
+		return modules.UnsignedTransaction{}, err
+	}
+	sort.Sort(sort.Reverse(so))
+
+	// Build the transaction with an estimated fee, and rebuild it with a
+	// larger fee until the fee covers the signed size of the transaction.
+	tpoolFee := maxFee.Mul(types.NewCurrency64(uint64(len(encoding.Marshal(outputs)) + estimatedTransactionOverhead)))
+	for {
+		amount := tpoolFee
+		for _, sco := range outputs {
+			amount = amount.Add(sco.Value)
+		}
+		txn := types.Transaction{
+			SiacoinOutputs: append([]types.SiacoinOutput(nil), outputs...),
+			MinerFees:      []types.Currency{tpoolFee},
+		}
+		var required []modules.RequiredSignature
+		var fund types.Currency
+		for i := range so.ids {
+			if fund.Cmp(amount) >= 0 {
+				break
+			}
+			uc := *w.watchedAddrs[so.outputs[i].UnlockHash].UnlockConditions
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+				ParentID:         so.ids[i],
+				UnlockConditions: uc,
+			})
+			required = append(required, modules.RequiredSignature{
+				ParentID:         crypto.Hash(so.ids[i]),
+				UnlockConditions: uc,
+				CoveredFields:    types.FullCoveredFields,
+			})
+			fund = fund.Add(so.outputs[i].Value)
+		}
+		if fund.Cmp(amount) < 0 {
+			return modules.UnsignedTransaction{}, modules.ErrLowBalance
+		}
+		if fund.Cmp(amount) > 0 {
+			txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+				Value:      fund.Sub(amount),
+				UnlockHash: so.outputs[0].UnlockHash,
+			})
+		}
+
+		minFee := maxFee.Mul(types.NewCurrency64(signedSize(txn, nil)))
+		if tpoolFee.Cmp(minFee) >= 0 {
+			return modules.UnsignedTransaction{
+				Transaction:        txn,
+				RequiredSignatures: required,
+			}, nil
+		}
+		tpoolFee = minFee
+	}
+}
+
+// UnsignedWatchOnlyTransaction builds a transaction paying 'outputs' from the
+// watched addresses whose unlock conditions are known. The transaction is
+// returned unsigned along with a required signature for each input, and is
+// not given to the transaction pool.
+func (w *Wallet) UnsignedWatchOnlyTransaction(outputs []types.SiacoinOutput) (modules.UnsignedTransaction, error) {
+	return w.managedUnsignedTransaction(outputs, func(types.UnlockHash) bool { return true })
+}
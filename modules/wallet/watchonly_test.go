@@ -0,0 +1,127 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationWatchOnly checks that the wallet tracks the outputs and
+// history of watched addresses, and builds unsigned transactions that spend
+// from them.
+func TestIntegrationWatchOnly(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	wt, err := createWalletTester("TestIntegrationWatchOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wt.closeWt()
+
+	// Create a cold storage key that the wallet does not hold.
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: pk[:]}},
+		SignaturesRequired: 1,
+	}
+	uh := uc.UnlockHash()
+
+	// Addresses that are spendable, already watched, or do not match their
+	// unlock conditions should be rejected.
+	ownUC, err := wt.wallet.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.wallet.AddWatchAddress(modules.WatchedAddress{UnlockHash: ownUC.UnlockHash()}); err != errWatchSpendable {
+		t.Error("expected errWatchSpendable, got", err)
+	}
+	if err := wt.wallet.AddWatchAddress(modules.WatchedAddress{UnlockHash: ownUC.UnlockHash(), UnlockConditions: &uc}); err != errWatchMismatch {
+		t.Error("expected errWatchMismatch, got", err)
+	}
+	if err := wt.wallet.AddWatchAddress(modules.WatchedAddress{UnlockConditions: &uc}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.wallet.AddWatchAddress(modules.WatchedAddress{UnlockHash: uh}); err != errDuplicateWatchAddress {
+		t.Error("expected errDuplicateWatchAddress, got", err)
+	}
+	if addrs := wt.wallet.WatchAddresses(); len(addrs) != 1 || addrs[0].UnlockHash != uh {
+		t.Fatal("watched address was not added:", addrs)
+	}
+
+	// Send coins to the watched address. They should count towards the
+	// watch-only balance, and appear in the history.
+	amount := types.SiacoinPrecision.Mul(types.NewCurrency64(100))
+	sendTxns, err := wt.wallet.SendSiacoins(amount, uh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoins, _ := wt.wallet.WatchOnlyBalance()
+	if siacoins.Cmp(amount) != 0 {
+		t.Fatal("wrong watch-only balance:", siacoins)
+	}
+	pt, exists := wt.wallet.Transaction(sendTxns[len(sendTxns)-1].ID())
+	if !exists {
+		t.Fatal("transaction paying the watched address is not in the history")
+	}
+	found := false
+	for _, output := range pt.Outputs {
+		found = found || (output.RelatedAddress == uh && output.WatchOnly && !output.WalletAddress)
+	}
+	if !found {
+		t.Error("output to the watched address is not marked as watch-only")
+	}
+
+	// Build an unsigned transaction from the watched address, sign it with the
+	// cold storage key, and submit it.
+	payment := types.SiacoinOutput{Value: types.SiacoinPrecision.Mul(types.NewCurrency64(10)), UnlockHash: types.UnlockHash{1}}
+	ut, err := wt.wallet.UnsignedWatchOnlyTransaction([]types.SiacoinOutput{payment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := ut.Transaction
+	if len(txn.SiacoinInputs) != 1 || len(txn.TransactionSignatures) != 0 || len(ut.RequiredSignatures) != 1 {
+		t.Fatal("unexpected unsigned transaction:", ut)
+	}
+	rs := ut.RequiredSignatures[0]
+	if rs.ParentID != crypto.Hash(txn.SiacoinInputs[0].ParentID) || rs.UnlockConditions.UnlockHash() != uh {
+		t.Fatal("unexpected required signature:", rs)
+	}
+	_, err = addSignatures(&txn, rs.CoveredFields, rs.UnlockConditions, rs.ParentID, spendableKey{UnlockConditions: uc, SecretKeys: []crypto.SecretKey{sk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	siacoins, _ = wt.wallet.WatchOnlyBalance()
+	if siacoins.Cmp(amount.Sub(payment.Value).Sub(txn.MinerFees[0])) != 0 {
+		t.Error("watch-only balance did not decrease:", siacoins)
+	}
+
+	// Removing the address should remove its outputs.
+	if err := wt.wallet.RemoveWatchAddress(uh); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.wallet.RemoveWatchAddress(uh); err != errUnknownWatchAddress {
+		t.Error("expected errUnknownWatchAddress, got", err)
+	}
+	siacoins, _ = wt.wallet.WatchOnlyBalance()
+	if !siacoins.IsZero() {
+		t.Error("watch-only balance should be zero after removing the address:", siacoins)
+	}
+}
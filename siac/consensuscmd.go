@@ -30,4 +30,7 @@ Block:  %v
 Height: %v
 Target: %v
 `, yesNo(cg.Synced), cg.CurrentBlock, cg.Height, cg.Target)
+	if !cg.Synced && cg.HeaderHeight > cg.Height {
+		fmt.Printf("Progress: %v / %v blocks\n", cg.Height, cg.HeaderHeight)
+	}
 }
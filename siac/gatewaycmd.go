@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -32,6 +33,27 @@ var (
 		Run:   wrap(gatewayremovecmd),
 	}
 
+	gatewayBanCmd = &cobra.Command{
+		Use:   "ban [address]",
+		Short: "Ban a peer",
+		Long:  "Disconnect from a peer and refuse all future connections to and from its host.",
+		Run:   wrap(gatewaybancmd),
+	}
+
+	gatewayUnbanCmd = &cobra.Command{
+		Use:   "unban [address]",
+		Short: "Unban a peer",
+		Long:  "Remove a host from the blocklist.",
+		Run:   wrap(gatewayunbancmd),
+	}
+
+	gatewayBlocklistCmd = &cobra.Command{
+		Use:   "blocklist",
+		Short: "View a list of banned peers",
+		Long:  "View the hosts that the gateway refuses to connect to.",
+		Run:   wrap(gatewayblocklistcmd),
+	}
+
 	gatewayAddressCmd = &cobra.Command{
 		Use:   "address",
 		Short: "Print the gateway address",
@@ -67,6 +89,51 @@ func gatewayremovecmd(addr string) {
 	fmt.Println("Removed", addr, "from peer list.")
 }
 
+// gatewaybancmd is the handler for the command `siac gateway ban [address]`.
+// Bans a peer.
+func gatewaybancmd(addr string) {
+	err := post("/gateway/blocklist/add/"+addr, "")
+	if err != nil {
+		die("Could not ban peer:", err)
+	}
+	fmt.Println("Banned", addr+".")
+}
+
+// gatewayunbancmd is the handler for the command `siac gateway unban
+// [address]`. Removes a peer from the blocklist.
+func gatewayunbancmd(addr string) {
+	err := post("/gateway/blocklist/remove/"+addr, "")
+	if err != nil {
+		die("Could not unban peer:", err)
+	}
+	fmt.Println("Unbanned", addr+".")
+}
+
+// gatewayblocklistcmd is the handler for the command `siac gateway
+// blocklist`. Prints a list of all banned hosts.
+func gatewayblocklistcmd() {
+	var bl api.GatewayBlocklistGET
+	err := getAPI("/gateway/blocklist", &bl)
+	if err != nil {
+		die("Could not get blocklist:", err)
+	}
+	if len(bl.Blocklist) == 0 {
+		fmt.Println("No banned peers.")
+		return
+	}
+	fmt.Println(len(bl.Blocklist), "banned peers:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tExpires\tReason")
+	for _, bp := range bl.Blocklist {
+		expiry := "Never"
+		if bp.Expiry != 0 {
+			expiry = time.Unix(int64(bp.Expiry), 0).Format("Jan 02 03:04 PM")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", bp.Host, expiry, bp.Reason)
+	}
+	w.Flush()
+}
+
 // gatewayaddresscmd is the handler for the command `siac gateway address`.
 // Prints the gateway's network address.
 func gatewayaddresscmd() {
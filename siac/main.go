@@ -24,6 +24,7 @@ var (
 	hostVerbose       bool   // display additional host info
 	renterShowHistory bool   // Show download history in addition to download queue.
 	renterListVerbose bool   // Show additional info about uploaded files.
+	walletExportCSV   bool   // Export the transaction history as CSV.
 )
 
 // exit codes
@@ -203,12 +204,17 @@ func main() {
 	minerCmd.AddCommand(minerStartCmd, minerStopCmd)
 
 	root.AddCommand(walletCmd)
-	walletCmd.AddCommand(walletAddressCmd, walletAddressesCmd, walletInitCmd,
-		walletLoadCmd, walletLockCmd, walletSeedsCmd, walletSendCmd,
-		walletBalanceCmd, walletTransactionsCmd, walletUnlockCmd)
+	walletCmd.AddCommand(walletAddressCmd, walletAddressesCmd, walletChangePasswordCmd,
+		walletInitCmd, walletLoadCmd, walletLockCmd, walletSeedsCmd, walletSendCmd,
+		walletBalanceCmd, walletTransactionsCmd, walletUnlockCmd,
+		walletUnsignedCmd, walletSignCmd, walletBroadcastCmd, walletMultisigCmd,
+		walletSweepCmd, walletClaimCmd, walletClaimsCmd)
 	walletInitCmd.Flags().BoolVarP(&initPassword, "password", "p", false, "Prompt for a custom password")
+	walletTransactionsCmd.Flags().BoolVarP(&walletExportCSV, "csv", "c", false, "Export the confirmed transaction history as CSV")
 	walletLoadCmd.AddCommand(walletLoad033xCmd, walletLoadSeedCmd, walletLoadSiagCmd)
-	walletSendCmd.AddCommand(walletSendSiacoinsCmd, walletSendSiafundsCmd)
+	walletSendCmd.AddCommand(walletSendSiacoinsCmd, walletSendSiafundsCmd, walletSendBatchCmd)
+	walletMultisigCmd.AddCommand(walletMultisigPublicKeyCmd, walletMultisigCreateCmd,
+		walletMultisigWatchCmd, walletMultisigSendCmd, walletMultisigMergeCmd)
 
 	root.AddCommand(renterCmd)
 	renterCmd.AddCommand(renterFilesDeleteCmd, renterFilesDownloadCmd,
@@ -220,7 +226,8 @@ func main() {
 	renterFilesListCmd.Flags().BoolVarP(&renterListVerbose, "verbose", "v", false, "Show additional file info such as redundancy")
 
 	root.AddCommand(gatewayCmd)
-	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayAddressCmd, gatewayListCmd)
+	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayAddressCmd, gatewayListCmd,
+		gatewayBanCmd, gatewayUnbanCmd, gatewayBlocklistCmd)
 
 	root.AddCommand(consensusCmd)
 
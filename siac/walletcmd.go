@@ -1,13 +1,22 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/bgentry/speakeasy"
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -45,6 +54,16 @@ The smallest unit of siacoins is the hasting. One siacoin is 10^24 hastings. Oth
 		Run:   wrap(walletaddressescmd),
 	}
 
+	walletChangePasswordCmd = &cobra.Command{
+		Use:   "change-password",
+		Short: "Change the wallet password",
+		Long: `Change the password used to encrypt the wallet. The current password, or the
+seed if no password was chosen, is required. Copies of the wallet folder and
+wallet backups made before the change can still be opened with the old
+password.`,
+		Run: wrap(walletchangepasswordcmd),
+	}
+
 	walletInitCmd = &cobra.Command{
 		Use:   "init",
 		Short: "Initialize and encrypt a new wallet",
@@ -116,6 +135,17 @@ A miner fee of 10 SC is levied on all transactions.`,
 		Run: wrap(walletsendsiacoinscmd),
 	}
 
+	walletSendBatchCmd = &cobra.Command{
+		Use:   "batch [csv]",
+		Short: "Send siacoins to multiple addresses",
+		Long: `Send siacoins to multiple addresses in a single transaction. Each line of the
+csv file has the form 'dest,amount', where 'amount' can be specified in units,
+e.g. 1.23KS. Run 'wallet --help' for a list of units.
+
+The miner fee is sized from the fee estimation of the transaction pool.`,
+		Run: wrap(walletsendbatchcmd),
+	}
+
 	walletSendSiafundsCmd = &cobra.Command{
 		Use:   "siafunds [amount] [dest]",
 		Short: "Send siafunds",
@@ -124,6 +154,122 @@ Run 'wallet send --help' to see a list of available units.`,
 		Run: wrap(walletsendsiafundscmd),
 	}
 
+	walletUnsignedCmd = &cobra.Command{
+		Use:   "unsigned [amount] [dest] [file]",
+		Short: "Build an unsigned transaction from the watched addresses",
+		Long: `Build a transaction sending siacoins from the watched addresses to 'dest', and
+write it unsigned to 'file'. 'amount' can be specified in units, e.g. 1.23KS.
+Run 'wallet --help' for a list of units.
+
+The file can be signed with 'wallet sign' on a machine holding the seed of the
+watched addresses, and then broadcast with 'wallet broadcast'.`,
+		Run: wrap(walletunsignedcmd),
+	}
+
+	walletSignCmd = &cobra.Command{
+		Use:   "sign [unsigned] [signed]",
+		Short: "Sign an unsigned transaction",
+		Long: `Sign the transaction in the file 'unsigned' with the keys of the wallet, and
+write the result to the file 'signed'. The wallet must be unlocked, but does
+not need to be synced, so this can be run on an offline machine.`,
+		Run: wrap(walletsigncmd),
+	}
+
+	walletBroadcastCmd = &cobra.Command{
+		Use:   "broadcast [signed]",
+		Short: "Broadcast a signed transaction",
+		Long:  "Submit the transaction in the file 'signed', created by 'wallet sign', to the transaction pool.",
+		Run:   wrap(walletbroadcastcmd),
+	}
+
+	walletMultisigCmd = &cobra.Command{
+		Use:   "multisig",
+		Short: "Create and spend from multisig addresses",
+		Long: `Create M-of-N multisig addresses shared with cosigners, and build, sign, and
+merge transactions that spend from them.
+
+A transaction is spent from a multisig address as follows:
+  1. One cosigner builds the transaction with 'wallet multisig send'.
+  2. Each cosigner signs a copy of the file with 'wallet sign'.
+  3. The signed copies are combined with 'wallet multisig merge', which
+     broadcasts the transaction once enough signatures have been added.`,
+		// Run field is not set, as the multisig command itself is not a valid
+		// command. A subcommand must be provided.
+	}
+
+	walletMultisigPublicKeyCmd = &cobra.Command{
+		Use:   "publickey",
+		Short: "Get a public key to give to a cosigner",
+		Long:  "Generate a new public key of the wallet, to be given to a cosigner that is creating a multisig address.",
+		Run:   wrap(walletmultisigpublickeycmd),
+	}
+
+	walletMultisigCreateCmd = &cobra.Command{
+		Use:   "create [required] [publickeys]",
+		Short: "Create a multisig address",
+		Long: `Create a multisig address that requires 'required' signatures from a new key of
+the wallet and the public keys of the cosigners. 'publickeys' is a comma
+separated list of keys in the form printed by 'wallet multisig publickey'.
+
+The printed unlock conditions should be given to the cosigners, who can track
+the address with 'wallet multisig watch'.`,
+		Run: wrap(walletmultisigcreatecmd),
+	}
+
+	walletMultisigWatchCmd = &cobra.Command{
+		Use:   "watch [unlockconditions]",
+		Short: "Track a multisig address created by a cosigner",
+		Long:  "Track the outputs and history of a multisig address, given the unlock conditions printed by 'wallet multisig create'.",
+		Run:   wrap(walletmultisigwatchcmd),
+	}
+
+	walletMultisigSendCmd = &cobra.Command{
+		Use:   "send [address] [amount] [dest] [file]",
+		Short: "Build an unsigned transaction from a multisig address",
+		Long: `Build a transaction sending siacoins from a multisig address to 'dest', and
+write it unsigned to 'file'. 'amount' can be specified in units, e.g. 1.23KS.
+Run 'wallet --help' for a list of units.`,
+		Run: wrap(walletmultisigsendcmd),
+	}
+
+	walletMultisigMergeCmd = &cobra.Command{
+		Use:   "merge [signed] [files]",
+		Short: "Merge the signatures of cosigners",
+		Long: `Merge the signatures of the transactions in 'files', a comma separated list of
+copies of the same transaction signed by different cosigners, and write the
+result to 'signed'. The transaction is broadcast once enough signatures have
+been added.`,
+		Run: wrap(walletmultisigmergecmd),
+	}
+
+	walletSweepCmd = &cobra.Command{
+		Use:   "sweep",
+		Short: "Sweep the funds of a seed into the wallet",
+		Long: `Move the siacoins and siafunds held by a seed to a new address of the wallet,
+without adding the seed to the wallet. The miner fees are paid from the swept
+siacoins, or by the wallet if the seed does not hold enough siacoins to move
+its siafunds. Light nodes download the blocks of the seed's addresses again
+before sweeping, which can take several minutes.`,
+		Run: wrap(walletsweepcmd),
+	}
+
+	walletClaimCmd = &cobra.Command{
+		Use:   "claim",
+		Short: "Claim the siacoins of the wallet's siafunds",
+		Long: `Pay out the siacoin claims of all of the wallet's siafunds by sending the
+siafunds to a new address of the wallet. The claimed siacoins are paid to the
+wallet, and become spendable after 144 confirmations.`,
+		Run: wrap(walletclaimcmd),
+	}
+
+	walletClaimsCmd = &cobra.Command{
+		Use:   "claims",
+		Short: "View siafund claims",
+		Long: `List the siacoin claim of each siafund output of the wallet, and the claims
+that were paid out when siafunds of the wallet were spent.`,
+		Run: wrap(walletclaimscmd),
+	}
+
 	walletBalanceCmd = &cobra.Command{
 		Use:   "balance",
 		Short: "View wallet balance",
@@ -134,8 +280,11 @@ Run 'wallet send --help' to see a list of available units.`,
 	walletTransactionsCmd = &cobra.Command{
 		Use:   "transactions",
 		Short: "View transactions",
-		Long:  "View transactions related to addresses spendable by the wallet, providing a net flow of siacoins and siafunds for each transaction",
-		Run:   wrap(wallettransactionscmd),
+		Long: `View transactions related to addresses spendable by the wallet, providing a net
+flow of siacoins and siafunds for each transaction. With --csv, the confirmed
+transaction history is written to stdout as CSV, listing the siacoins and
+siafunds moved into and out of the wallet by each transaction.`,
+		Run: wrap(wallettransactionscmd),
 	}
 
 	walletUnlockCmd = &cobra.Command{
@@ -192,6 +341,32 @@ func walletinitcmd() {
 	}
 }
 
+// walletchangepasswordcmd changes the encryption password of the wallet.
+func walletchangepasswordcmd() {
+	password, err := speakeasy.Ask("Current wallet password: ")
+	if err != nil {
+		die("Reading password failed:", err)
+	}
+	newPassword, err := speakeasy.Ask("New wallet password: ")
+	if err != nil {
+		die("Reading password failed:", err)
+	}
+	confirm, err := speakeasy.Ask("Confirm new wallet password: ")
+	if err != nil {
+		die("Reading password failed:", err)
+	}
+	if newPassword != confirm {
+		die("New passwords do not match")
+	}
+	qs := url.Values{"encryptionpassword": {password}, "newpassword": {newPassword}}.Encode()
+	err = post("/wallet/changepassword", qs)
+	if err != nil {
+		die("Could not change wallet password:", err)
+	}
+	fmt.Println("Wallet password changed")
+	fmt.Println("Copies of the wallet folder and wallet backups made before the change can still be opened with the old password, and should be deleted or replaced.")
+}
+
 // walletload033xcmd loads a v0.3.3.x wallet into the current wallet.
 func walletload033xcmd(filepath string) {
 	password, err := speakeasy.Ask("Wallet password: ")
@@ -224,6 +399,52 @@ func walletloadseedcmd() {
 	fmt.Println("Added Key")
 }
 
+// walletsweepcmd sweeps the funds of a seed into the wallet.
+func walletsweepcmd() {
+	seed, err := speakeasy.Ask("Seed: ")
+	if err != nil {
+		die("Reading seed failed:", err)
+	}
+	var swept api.WalletSweepPOST
+	qs := url.Values{"seed": {seed}, "dictionary": {"english"}}.Encode()
+	err = postResp("/wallet/sweep/seed", qs, &swept)
+	if err != nil {
+		die("Could not sweep seed:", err)
+	}
+	fmt.Printf("Swept %v and %v siafunds\n", currencyUnits(swept.Coins), swept.Funds)
+}
+
+// walletclaimcmd pays out the siacoin claims of the wallet's siafunds.
+func walletclaimcmd() {
+	var claimed api.WalletSiafundsClaimPOST
+	err := postResp("/wallet/siafunds/claim", "", &claimed)
+	if err != nil {
+		die("Could not claim siacoins:", err)
+	}
+	fmt.Printf("Submitted %v transactions to claim siacoins\n", len(claimed.TransactionIDs))
+}
+
+// walletclaimscmd lists the siacoin claims of the wallet's siafunds.
+func walletclaimscmd() {
+	var wsc api.WalletSiafundsClaimsGET
+	err := getAPI("/wallet/siafunds/claims", &wsc)
+	if err != nil {
+		die("Could not fetch siafund claims:", err)
+	}
+
+	fmt.Println("Siafund outputs:")
+	fmt.Println("    [height]                                                        [output id]      [siafunds]   [claim]")
+	for _, claim := range wsc.Claims {
+		fmt.Printf("%12v%67v%14v SF   %v\n", claim.ConfirmationHeight, claim.ID, claim.Value, currencyUnits(claim.ClaimValue))
+	}
+	fmt.Println()
+	fmt.Println("Claim payouts:")
+	fmt.Println("    [height]                                                   [transaction id]      [siafunds]   [claim]")
+	for _, payout := range wsc.Payouts {
+		fmt.Printf("%12v%67v%14v SF   %v\n", payout.ConfirmationHeight, payout.TransactionID, payout.Siafunds, currencyUnits(payout.Value))
+	}
+}
+
 // walletloadsiagcmd loads a siag key set into the wallet.
 func walletloadsiagcmd(keyfiles string) {
 	password, err := speakeasy.Ask("Wallet password: ")
@@ -274,6 +495,225 @@ func walletsendsiacoinscmd(amount, dest string) {
 	fmt.Printf("Sent %s hastings to %s\n", hastings, dest)
 }
 
+// walletsendbatchcmd sends siacoins to each of the addresses listed in a csv
+// file.
+func walletsendbatchcmd(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		die("Could not open csv file:", err)
+	}
+	records, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		die("Could not read csv file:", err)
+	}
+	var outputs []types.SiacoinOutput
+	total := types.ZeroCurrency
+	for i, record := range records {
+		if len(record) != 2 {
+			die(fmt.Sprintf("Line %v: expected 'dest,amount'", i+1))
+		}
+		var dest types.UnlockHash
+		err = dest.LoadString(record[0])
+		if err != nil {
+			die(fmt.Sprintf("Line %v: could not parse address: %v", i+1, err))
+		}
+		hastings, err := parseCurrency(record[1])
+		if err != nil {
+			die(fmt.Sprintf("Line %v: could not parse amount: %v", i+1, err))
+		}
+		value, _ := new(big.Int).SetString(hastings, 10)
+		outputs = append(outputs, types.SiacoinOutput{Value: types.NewCurrency(value), UnlockHash: dest})
+		total = total.Add(types.NewCurrency(value))
+	}
+	encOutputs, err := json.Marshal(outputs)
+	if err != nil {
+		die("Could not encode outputs:", err)
+	}
+	err = post("/wallet/siacoins", url.Values{"outputs": {string(encOutputs)}}.Encode())
+	if err != nil {
+		die("Could not send siacoins:", err)
+	}
+	fmt.Printf("Sent %s hastings to %v addresses\n", total, len(outputs))
+}
+
+// readUnsignedTransaction reads an unsigned transaction from a file.
+func readUnsignedTransaction(path string) modules.UnsignedTransaction {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		die("Could not read transaction file:", err)
+	}
+	var ut modules.UnsignedTransaction
+	err = json.Unmarshal(data, &ut)
+	if err != nil {
+		die("Could not decode transaction file:", err)
+	}
+	return ut
+}
+
+// writeUnsignedTransaction writes an unsigned transaction to a file.
+func writeUnsignedTransaction(path string, ut modules.UnsignedTransaction) {
+	data, err := json.MarshalIndent(ut, "", "\t")
+	if err != nil {
+		die("Could not encode transaction:", err)
+	}
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		die("Could not write transaction file:", err)
+	}
+}
+
+// walletunsignedcmd builds an unsigned transaction sending siacoins from the
+// watched addresses, and writes it to a file.
+func walletunsignedcmd(amount, dest, path string) {
+	hastings, err := parseCurrency(amount)
+	if err != nil {
+		die("Could not parse amount:", err)
+	}
+	encOutputs := fmt.Sprintf(`[{"unlockhash":"%s","value":"%s"}]`, dest, hastings)
+	var ut modules.UnsignedTransaction
+	err = postResp("/wallet/watch/transaction", url.Values{"outputs": {encOutputs}}.Encode(), &ut)
+	if err != nil {
+		die("Could not build transaction:", err)
+	}
+	writeUnsignedTransaction(path, ut)
+	fmt.Printf("Wrote unsigned transaction requiring %v signatures to %s\n", len(ut.RequiredSignatures), path)
+}
+
+// walletsigncmd signs the transaction in a file with the keys of the wallet.
+func walletsigncmd(unsignedPath, signedPath string) {
+	ut := readUnsignedTransaction(unsignedPath)
+	encUT, err := json.Marshal(ut)
+	if err != nil {
+		die("Could not encode transaction:", err)
+	}
+	var signed modules.UnsignedTransaction
+	err = postResp("/wallet/sign", url.Values{"transaction": {string(encUT)}}.Encode(), &signed)
+	if err != nil {
+		die("Could not sign transaction:", err)
+	}
+	writeUnsignedTransaction(signedPath, signed)
+	if len(signed.RequiredSignatures) != 0 {
+		fmt.Printf("Wrote partially signed transaction to %s; %v signatures are still missing\n", signedPath, len(signed.RequiredSignatures))
+		return
+	}
+	fmt.Printf("Wrote signed transaction to %s\n", signedPath)
+}
+
+// walletbroadcastcmd submits the signed transaction in a file to the
+// transaction pool.
+func walletbroadcastcmd(path string) {
+	ut := readUnsignedTransaction(path)
+	if len(ut.RequiredSignatures) != 0 {
+		die(fmt.Sprintf("Transaction is missing %v signatures", len(ut.RequiredSignatures)))
+	}
+	encTxns, err := json.Marshal(append(ut.Parents, ut.Transaction))
+	if err != nil {
+		die("Could not encode transaction:", err)
+	}
+	err = post("/transactionpool/transactions", url.Values{"transactions": {string(encTxns)}}.Encode())
+	if err != nil {
+		die("Could not broadcast transaction:", err)
+	}
+	fmt.Println("Broadcast transaction", ut.Transaction.ID())
+}
+
+// walletmultisigpublickeycmd prints a new public key of the wallet.
+func walletmultisigpublickeycmd() {
+	var wmpg api.WalletMultisigPublicKeyGET
+	err := getAPI("/wallet/multisig/publickey", &wmpg)
+	if err != nil {
+		die("Could not get public key:", err)
+	}
+	fmt.Printf("Public key: %s:%x\n", wmpg.PublicKey.Algorithm, wmpg.PublicKey.Key)
+}
+
+// walletmultisigcreatecmd creates a multisig address from the public keys of
+// the cosigners.
+func walletmultisigcreatecmd(required, publickeys string) {
+	var cosigners []types.SiaPublicKey
+	for _, str := range strings.Split(publickeys, ",") {
+		parts := strings.SplitN(str, ":", 2)
+		if len(parts) != 2 || parts[0] != types.SignatureEd25519.String() {
+			die("Public keys must have the form 'ed25519:<hex>':", str)
+		}
+		key, err := hex.DecodeString(parts[1])
+		if err != nil {
+			die("Could not decode public key:", err)
+		}
+		cosigners = append(cosigners, types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: key})
+	}
+	encKeys, err := json.Marshal(cosigners)
+	if err != nil {
+		die("Could not encode public keys:", err)
+	}
+	var wmcp api.WalletMultisigCreatePOST
+	err = postResp("/wallet/multisig/create", url.Values{"required": {required}, "publickeys": {string(encKeys)}}.Encode(), &wmcp)
+	if err != nil {
+		die("Could not create multisig address:", err)
+	}
+	encUC, err := json.Marshal(wmcp.UnlockConditions)
+	if err != nil {
+		die("Could not encode unlock conditions:", err)
+	}
+	fmt.Printf("Created multisig address %s\nUnlock conditions: %s\n", wmcp.Address, encUC)
+}
+
+// walletmultisigwatchcmd tracks a multisig address created by a cosigner.
+func walletmultisigwatchcmd(unlockconditions string) {
+	var uc types.UnlockConditions
+	err := json.Unmarshal([]byte(unlockconditions), &uc)
+	if err != nil {
+		die("Could not decode unlock conditions:", err)
+	}
+	err = post("/wallet/watch/add", url.Values{"unlockconditions": {unlockconditions}}.Encode())
+	if err != nil {
+		die("Could not watch multisig address:", err)
+	}
+	fmt.Println("Watching multisig address", uc.UnlockHash())
+}
+
+// walletmultisigsendcmd builds an unsigned transaction sending siacoins from a
+// multisig address, and writes it to a file.
+func walletmultisigsendcmd(addr, amount, dest, path string) {
+	hastings, err := parseCurrency(amount)
+	if err != nil {
+		die("Could not parse amount:", err)
+	}
+	encOutputs := fmt.Sprintf(`[{"unlockhash":"%s","value":"%s"}]`, dest, hastings)
+	var ut modules.UnsignedTransaction
+	err = postResp("/wallet/multisig/transaction", url.Values{"address": {addr}, "outputs": {encOutputs}}.Encode(), &ut)
+	if err != nil {
+		die("Could not build transaction:", err)
+	}
+	writeUnsignedTransaction(path, ut)
+	fmt.Printf("Wrote unsigned transaction to %s; sign it with 'wallet sign' on each cosigner\n", path)
+}
+
+// walletmultisigmergecmd merges the signatures of several copies of a
+// transaction, and broadcasts the result if it is complete.
+func walletmultisigmergecmd(signedPath, files string) {
+	var uts []modules.UnsignedTransaction
+	for _, path := range strings.Split(files, ",") {
+		uts = append(uts, readUnsignedTransaction(path))
+	}
+	encUTs, err := json.Marshal(uts)
+	if err != nil {
+		die("Could not encode transactions:", err)
+	}
+	var merged modules.UnsignedTransaction
+	err = postResp("/wallet/multisig/merge", url.Values{"transactions": {string(encUTs)}}.Encode(), &merged)
+	if err != nil {
+		die("Could not merge signatures:", err)
+	}
+	writeUnsignedTransaction(signedPath, merged)
+	if len(merged.RequiredSignatures) != 0 {
+		fmt.Printf("Wrote merged transaction to %s; %v signatures are still missing\n", signedPath, len(merged.RequiredSignatures))
+		return
+	}
+	walletbroadcastcmd(signedPath)
+}
+
 // walletsendsiafundscmd sends siafunds to a destination address.
 func walletsendsiafundscmd(amount, dest string) {
 	err := post("/wallet/siafunds", fmt.Sprintf("amount=%s&destination=%s", amount, dest))
@@ -321,6 +761,19 @@ Siafund Claims:      %v H
 // wallettransactionscmd lists all of the transactions related to the wallet,
 // providing a net flow of siacoins and siafunds for each.
 func wallettransactionscmd() {
+	if walletExportCSV {
+		resp, err := apiGet("/wallet/history/export?format=csv")
+		if err != nil {
+			die("Could not export transaction history:", err)
+		}
+		defer resp.Body.Close()
+		_, err = io.Copy(os.Stdout, resp.Body)
+		if err != nil {
+			die("Could not export transaction history:", err)
+		}
+		return
+	}
+
 	wtg := new(api.WalletTransactionsGET)
 	err := getAPI("/wallet/transactions?startheight=0&endheight=10000000", wtg)
 	if err != nil {
@@ -330,32 +783,9 @@ func wallettransactionscmd() {
 	fmt.Println("    [height]                                                   [transaction id]    [net siacoins]   [net siafunds]")
 	txns := append(wtg.ConfirmedTransactions, wtg.UnconfirmedTransactions...)
 	for _, txn := range txns {
-		// Determine the number of outgoing siacoins and siafunds.
-		var outgoingSiacoins types.Currency
-		var outgoingSiafunds types.Currency
-		for _, input := range txn.Inputs {
-			if input.FundType == types.SpecifierSiacoinInput && input.WalletAddress {
-				outgoingSiacoins = outgoingSiacoins.Add(input.Value)
-			}
-			if input.FundType == types.SpecifierSiafundInput && input.WalletAddress {
-				outgoingSiafunds = outgoingSiafunds.Add(input.Value)
-			}
-		}
-
-		// Determine the number of incoming siacoins and siafunds.
-		var incomingSiacoins types.Currency
-		var incomingSiafunds types.Currency
-		for _, output := range txn.Outputs {
-			if output.FundType == types.SpecifierMinerPayout {
-				incomingSiacoins = incomingSiacoins.Add(output.Value)
-			}
-			if output.FundType == types.SpecifierSiacoinOutput && output.WalletAddress {
-				incomingSiacoins = incomingSiacoins.Add(output.Value)
-			}
-			if output.FundType == types.SpecifierSiafundOutput && output.WalletAddress {
-				incomingSiafunds = incomingSiafunds.Add(output.Value)
-			}
-		}
+		// Determine the number of incoming and outgoing siacoins and
+		// siafunds.
+		incomingSiacoins, outgoingSiacoins, incomingSiafunds, outgoingSiafunds := modules.WalletFlows(txn)
 
 		// Convert the siacoins to a float.
 		incomingSiacoinsFloat, _ := new(big.Rat).SetFrac(incomingSiacoins.Big(), types.SiacoinPrecision.Big()).Float64()
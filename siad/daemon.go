@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -21,6 +23,7 @@ import (
 	"github.com/NebulousLabs/Sia/modules/transactionpool"
 	"github.com/NebulousLabs/Sia/modules/wallet"
 	"github.com/NebulousLabs/Sia/profile"
+	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/spf13/cobra"
 )
@@ -51,6 +54,145 @@ func processModules(modules string) (string, error) {
 	return modules, nil
 }
 
+// processList splits a comma-separated list, removing whitespace and empty
+// entries.
+func processList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// processBootstrapPeers returns an error if any of the addresses in the
+// comma-separated list of bootstrap peers is invalid. The returned list has
+// been normalized.
+func processBootstrapPeers(peers string) (string, error) {
+	addrs := processList(peers)
+	for _, addr := range addrs {
+		if err := modules.NetAddress(addr).IsValid(); err != nil {
+			return "", fmt.Errorf("Unable to parse --bootstrap-peers flag, invalid address %q: %v", addr, err)
+		}
+	}
+	return strings.Join(addrs, ","), nil
+}
+
+// processPeerWhitelist returns an error if any of the hosts in the
+// comma-separated whitelist is not an IP address. The returned list has been
+// normalized.
+func processPeerWhitelist(whitelist string) (string, error) {
+	hosts := processList(whitelist)
+	for _, host := range hosts {
+		if net.ParseIP(host) == nil {
+			return "", fmt.Errorf("Unable to parse --peer-whitelist flag, %q is not an IP address", host)
+		}
+	}
+	return strings.Join(hosts, ","), nil
+}
+
+// parseCheckpoint parses a checkpoint of the form height:blockid.
+func parseCheckpoint(checkpoint string) (types.BlockHeight, types.BlockID, error) {
+	parts := strings.Split(checkpoint, ":")
+	if len(parts) != 2 {
+		return 0, types.BlockID{}, errors.New("checkpoint must have the form height:blockid")
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, types.BlockID{}, errors.New("checkpoint height must be a number")
+	}
+	idBytes, err := hex.DecodeString(parts[1])
+	if err != nil || len(idBytes) != crypto.HashSize {
+		return 0, types.BlockID{}, errors.New("checkpoint block id must be a hex-encoded hash")
+	}
+	var id types.BlockID
+	copy(id[:], idBytes)
+	return types.BlockHeight(height), id, nil
+}
+
+// processCheckpoints returns an error if any of the checkpoints in the
+// comma-separated list is invalid, or if two checkpoints have the same
+// height. The returned list has been normalized.
+func processCheckpoints(checkpoints string) (string, error) {
+	items := processList(checkpoints)
+	heights := make(map[types.BlockHeight]struct{})
+	for _, item := range items {
+		height, _, err := parseCheckpoint(item)
+		if err != nil {
+			return "", fmt.Errorf("Unable to parse --checkpoints flag, invalid checkpoint %q: %v", item, err)
+		}
+		if _, exists := heights[height]; exists {
+			return "", fmt.Errorf("Unable to parse --checkpoints flag, multiple checkpoints at height %v", height)
+		}
+		heights[height] = struct{}{}
+	}
+	return strings.Join(items, ","), nil
+}
+
+// consensusCheckpoints returns the checkpoints specified by the config. The
+// config must already have been processed.
+func consensusCheckpoints(config Config) map[types.BlockHeight]types.BlockID {
+	checkpoints := make(map[types.BlockHeight]types.BlockID)
+	for _, item := range processList(config.Siad.Checkpoints) {
+		height, id, _ := parseCheckpoint(item)
+		checkpoints[height] = id
+	}
+	return checkpoints
+}
+
+// consensusSettings returns the consensus settings specified by the config.
+func consensusSettings(config Config) consensus.Settings {
+	return consensus.Settings{
+		Checkpoints: consensusCheckpoints(config),
+		PruneDepth:  types.BlockHeight(config.Siad.PruneDepth),
+	}
+}
+
+// processPruneDepth returns an error if the prune depth is too small, or if
+// pruning is enabled together with a module that needs the full blockchain.
+func processPruneDepth(pruneDepth uint64, modules string) error {
+	if pruneDepth == 0 {
+		return nil
+	}
+	if types.BlockHeight(pruneDepth) < consensus.MinPruneDepth {
+		return fmt.Errorf("Unable to parse --prune-depth flag, the minimum prune depth is %v", consensus.MinPruneDepth)
+	}
+	if strings.Contains(modules, "e") {
+		return errors.New("Unable to parse --prune-depth flag, the explorer requires the full blockchain")
+	}
+	return nil
+}
+
+// processLight returns an error if light mode is enabled together with pruning
+// or with a module that needs the full blockchain. Only the gateway,
+// consensus, transaction pool and wallet can run on top of a light consensus
+// set.
+func processLight(light bool, modules string, pruneDepth uint64) error {
+	if !light {
+		return nil
+	}
+	if pruneDepth != 0 {
+		return errors.New("Unable to parse --light flag, a light node cannot be pruned")
+	}
+	if strings.Trim(modules, "cgtw") != "" {
+		return errors.New("Unable to parse --light flag, only the gateway, consensus, transaction pool and wallet modules can be used in light mode")
+	}
+	return nil
+}
+
+// gatewaySettings returns the gateway settings specified by the config.
+func gatewaySettings(config Config) gateway.Settings {
+	var settings gateway.Settings
+	for _, addr := range processList(config.Siad.BootstrapPeers) {
+		settings.BootstrapPeers = append(settings.BootstrapPeers, modules.NetAddress(addr))
+	}
+	settings.Private = config.Siad.PrivateNetwork
+	settings.Whitelist = processList(config.Siad.PeerWhitelist)
+	settings.RequireEncryption = config.Siad.RequireEncryption
+	return settings
+}
+
 // processConfig checks the configuration values and performs cleanup on
 // incorrect-but-allowed values.
 func processConfig(config Config) (Config, error) {
@@ -62,6 +204,26 @@ func processConfig(config Config) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	config.Siad.BootstrapPeers, err = processBootstrapPeers(config.Siad.BootstrapPeers)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Siad.PeerWhitelist, err = processPeerWhitelist(config.Siad.PeerWhitelist)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Siad.Checkpoints, err = processCheckpoints(config.Siad.Checkpoints)
+	if err != nil {
+		return Config{}, err
+	}
+	err = processPruneDepth(config.Siad.PruneDepth, config.Siad.Modules)
+	if err != nil {
+		return Config{}, err
+	}
+	err = processLight(config.Siad.Light, config.Siad.Modules, config.Siad.PruneDepth)
+	if err != nil {
+		return Config{}, err
+	}
 	return config, nil
 }
 
@@ -77,7 +239,7 @@ func startDaemon(config Config) (err error) {
 	if strings.Contains(config.Siad.Modules, "g") {
 		i++
 		fmt.Printf("(%d/%d) Loading gateway...\n", i, len(config.Siad.Modules))
-		g, err = gateway.New(config.Siad.RPCaddr, filepath.Join(config.Siad.SiaDir, modules.GatewayDir))
+		g, err = gateway.NewWithSettings(config.Siad.RPCaddr, filepath.Join(config.Siad.SiaDir, modules.GatewayDir), gatewaySettings(config))
 		if err != nil {
 			return err
 		}
@@ -86,7 +248,11 @@ func startDaemon(config Config) (err error) {
 	if strings.Contains(config.Siad.Modules, "c") {
 		i++
 		fmt.Printf("(%d/%d) Loading consensus...\n", i, len(config.Siad.Modules))
-		cs, err = consensus.New(g, filepath.Join(config.Siad.SiaDir, modules.ConsensusDir))
+		if config.Siad.Light {
+			cs, err = consensus.NewLight(g, filepath.Join(config.Siad.SiaDir, modules.ConsensusDir))
+		} else {
+			cs, err = consensus.NewWithSettings(g, filepath.Join(config.Siad.SiaDir, modules.ConsensusDir), consensusSettings(config))
+		}
 		if err != nil {
 			return err
 		}
@@ -161,15 +327,23 @@ func startDaemon(config Config) (err error) {
 		return err
 	}
 
-	// Bootstrap to the network.
-	if !config.Siad.NoBootstrap && g != nil {
-		// connect to 3 random bootstrap nodes
-		perm, err := crypto.Perm(len(modules.BootstrapPeers))
+	// Bootstrap to the network. Private networks only bootstrap from the
+	// peers that were specified.
+	bootstrapPeers := gatewaySettings(config).BootstrapPeers
+	if len(bootstrapPeers) == 0 && !config.Siad.PrivateNetwork {
+		bootstrapPeers = modules.BootstrapPeers
+	}
+	if !config.Siad.NoBootstrap && g != nil && len(bootstrapPeers) > 0 {
+		// connect to up to 3 random bootstrap nodes
+		perm, err := crypto.Perm(len(bootstrapPeers))
 		if err != nil {
 			return err
 		}
-		for _, i := range perm[:3] {
-			go g.Connect(modules.BootstrapPeers[i])
+		if len(perm) > 3 {
+			perm = perm[:3]
+		}
+		for _, i := range perm {
+			go g.Connect(bootstrapPeers[i])
 		}
 	}
 
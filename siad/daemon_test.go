@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/hex"
+	"strings"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules/consensus"
 )
 
 // TestUnitProcessNetAddr probes the 'processNetAddr' function.
@@ -112,3 +117,93 @@ func TestUnitProcessConfig(t *testing.T) {
 		t.Error("processModules didn't error on invalid module:", invalidModule)
 	}
 }
+
+// TestUnitProcessBootstrapPeers probes the 'processBootstrapPeers' and
+// 'processPeerWhitelist' functions.
+func TestUnitProcessBootstrapPeers(t *testing.T) {
+	peers, err := processBootstrapPeers(" 1.2.3.4:9981, ,5.6.7.8:9981,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers != "1.2.3.4:9981,5.6.7.8:9981" {
+		t.Error("processBootstrapPeers returned incorrect peers:", peers)
+	}
+	if _, err := processBootstrapPeers("1.2.3.4"); err == nil {
+		t.Error("processBootstrapPeers didn't error on an address without a port")
+	}
+
+	whitelist, err := processPeerWhitelist("1.2.3.4, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whitelist != "1.2.3.4,::1" {
+		t.Error("processPeerWhitelist returned incorrect hosts:", whitelist)
+	}
+	if _, err := processPeerWhitelist("1.2.3.4:9981"); err == nil {
+		t.Error("processPeerWhitelist didn't error on an address with a port")
+	}
+}
+
+// TestUnitProcessCheckpoints probes the 'processCheckpoints' and
+// 'consensusCheckpoints' functions.
+func TestUnitProcessCheckpoints(t *testing.T) {
+	id := strings.Repeat("ab", crypto.HashSize)
+	checkpoints, err := processCheckpoints(" 10:" + id + ", ,20:" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoints != "10:"+id+",20:"+id {
+		t.Error("processCheckpoints returned incorrect checkpoints:", checkpoints)
+	}
+	var config Config
+	config.Siad.Checkpoints = checkpoints
+	parsed := consensusCheckpoints(config)
+	if id10 := parsed[10]; len(parsed) != 2 || hex.EncodeToString(id10[:]) != id {
+		t.Error("consensusCheckpoints returned incorrect checkpoints:", parsed)
+	}
+
+	invalid := []string{
+		"10",
+		"ten:" + id,
+		"10:" + id[2:],
+		"10:zz" + id[2:],
+		"10:" + id + ",10:" + id,
+	}
+	for _, c := range invalid {
+		if _, err := processCheckpoints(c); err == nil {
+			t.Errorf("processCheckpoints didn't error on %q", c)
+		}
+	}
+}
+
+// TestUnitProcessPruneDepth probes the 'processPruneDepth' function.
+func TestUnitProcessPruneDepth(t *testing.T) {
+	if err := processPruneDepth(0, "cghmrtwe"); err != nil {
+		t.Error(err)
+	}
+	if err := processPruneDepth(uint64(consensus.MinPruneDepth), "cgtw"); err != nil {
+		t.Error(err)
+	}
+	if err := processPruneDepth(uint64(consensus.MinPruneDepth)-1, "cgtw"); err == nil {
+		t.Error("processPruneDepth didn't error on a prune depth below the minimum")
+	}
+	if err := processPruneDepth(uint64(consensus.MinPruneDepth), "cgtwe"); err == nil {
+		t.Error("processPruneDepth didn't error when the explorer is enabled")
+	}
+}
+
+// TestUnitProcessLight probes the 'processLight' function.
+func TestUnitProcessLight(t *testing.T) {
+	if err := processLight(false, "cghmrtwe", 100); err != nil {
+		t.Error(err)
+	}
+	if err := processLight(true, "cgtw", 0); err != nil {
+		t.Error(err)
+	}
+	if err := processLight(true, "cgtwh", 0); err == nil {
+		t.Error("processLight didn't error when the host is enabled")
+	}
+	if err := processLight(true, "cgtw", uint64(consensus.MinPruneDepth)); err == nil {
+		t.Error("processLight didn't error when pruning is enabled")
+	}
+}
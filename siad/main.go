@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/consensus"
 )
 
 var (
@@ -34,6 +39,15 @@ type Config struct {
 		NoBootstrap       bool
 		RequiredUserAgent string
 
+		BootstrapPeers    string
+		PrivateNetwork    bool
+		PeerWhitelist     string
+		RequireEncryption bool
+
+		Checkpoints string
+		PruneDepth  uint64
+		Light       bool
+
 		Profile    bool
 		ProfileDir string
 		SiaDir     string
@@ -122,6 +136,47 @@ Explorer (e):
 		siad -M gce`)
 }
 
+// importSnapshotCmd is a cobra command that installs a consensus snapshot
+// after checking it against a trusted checksum.
+func importSnapshotCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Usage()
+		os.Exit(exitCodeUsage)
+	}
+	checksumBytes, err := hex.DecodeString(args[1])
+	if err != nil || len(checksumBytes) != crypto.HashSize {
+		fmt.Fprintln(os.Stderr, "Could not parse checksum: must be a hex-encoded hash")
+		os.Exit(exitCodeUsage)
+	}
+	var checksum crypto.Hash
+	copy(checksum[:], checksumBytes)
+
+	snapshot, err := consensus.ImportSnapshot(args[0], filepath.Join(globalConfig.Siad.SiaDir, modules.ConsensusDir), checksum)
+	if err != nil {
+		die("Could not import snapshot:", err)
+	}
+	fmt.Printf("Imported snapshot at height %v (block %v).\n", snapshot.Height, snapshot.BlockID)
+	fmt.Println("siad will download the remaining blocks the next time it starts.")
+}
+
+// consensusVerifyCmd is a cobra command that runs the consistency checks on
+// the consensus database.
+func consensusVerifyCmd(*cobra.Command, []string) {
+	err := consensus.VerifyDatabase(filepath.Join(globalConfig.Siad.SiaDir, modules.ConsensusDir), os.Stdout)
+	if err != nil {
+		die("Verification failed:", err)
+	}
+}
+
+// consensusRebuildCmd is a cobra command that rebuilds the consensus database
+// from the stored blocks.
+func consensusRebuildCmd(*cobra.Command, []string) {
+	err := consensus.RebuildDatabase(filepath.Join(globalConfig.Siad.SiaDir, modules.ConsensusDir), os.Stdout)
+	if err != nil {
+		die("Could not rebuild consensus database:", err)
+	}
+}
+
 // main establishes a set of commands and flags using the cobra package.
 func main() {
 	root := &cobra.Command{
@@ -145,6 +200,42 @@ func main() {
 		Run:   modulesCmd,
 	})
 
+	importSnapshot := &cobra.Command{
+		Use:   "import-snapshot [file] [checksum]",
+		Short: "Import a consensus snapshot",
+		Long: `Import a consensus snapshot, replacing the existing consensus database. The
+snapshot is only imported if its checksum matches the provided checksum, which
+should be obtained from a trusted source. siad must not be running.`,
+		Run: importSnapshotCmd,
+	}
+	importSnapshot.Flags().StringVarP(&globalConfig.Siad.SiaDir, "sia-directory", "d", "", "location of the sia directory")
+	root.AddCommand(importSnapshot)
+
+	consensusCmd := &cobra.Command{
+		Use:   "consensus",
+		Short: "Check or repair the consensus database",
+		Long:  "Check or repair the consensus database. siad must not be running.",
+	}
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the consensus database for inconsistencies",
+		Long: `Run the full set of consistency checks on the consensus database without
+modifying it. siad must not be running.`,
+		Run: consensusVerifyCmd,
+	}
+	rebuildCmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Rebuild the consensus database from the stored blocks",
+		Long: `Rebuild the block path, the unspent outputs and the rest of the consensus
+state from the blocks stored in the consensus database, validating every block
+again. The existing database is backed up first. Pruned databases cannot be
+rebuilt. siad must not be running.`,
+		Run: consensusRebuildCmd,
+	}
+	consensusCmd.PersistentFlags().StringVarP(&globalConfig.Siad.SiaDir, "sia-directory", "d", "", "location of the sia directory")
+	consensusCmd.AddCommand(verifyCmd, rebuildCmd)
+	root.AddCommand(consensusCmd)
+
 	// Set default values, which have the lowest priority.
 	root.Flags().StringVarP(&globalConfig.Siad.RequiredUserAgent, "agent", "A", "Sia-Agent", "required substring for the user agent")
 	root.Flags().StringVarP(&globalConfig.Siad.HostAddr, "host-addr", "H", ":9982", "which port the host listens on")
@@ -155,6 +246,13 @@ func main() {
 	root.Flags().BoolVarP(&globalConfig.Siad.Profile, "profile", "p", false, "enable profiling")
 	root.Flags().StringVarP(&globalConfig.Siad.RPCaddr, "rpc-addr", "r", ":9981", "which port the gateway listens on")
 	root.Flags().StringVarP(&globalConfig.Siad.Modules, "modules", "M", "cghmrtw", "enabled modules, see 'siad modules' for more info")
+	root.Flags().StringVarP(&globalConfig.Siad.BootstrapPeers, "bootstrap-peers", "", "", "comma-separated list of host:port addresses to bootstrap from instead of the default peers")
+	root.Flags().BoolVarP(&globalConfig.Siad.PrivateNetwork, "private-network", "", false, "disable peer discovery, only connecting to the bootstrap peers")
+	root.Flags().StringVarP(&globalConfig.Siad.PeerWhitelist, "peer-whitelist", "", "", "comma-separated list of hosts that are allowed to connect to the gateway")
+	root.Flags().BoolVarP(&globalConfig.Siad.RequireEncryption, "require-encryption", "", false, "refuse to connect to peers that do not support encrypted connections")
+	root.Flags().StringVarP(&globalConfig.Siad.Checkpoints, "checkpoints", "", "", "comma-separated list of height:blockid checkpoints that the blockchain must follow")
+	root.Flags().Uint64VarP(&globalConfig.Siad.PruneDepth, "prune-depth", "", 0, "prune blocks that are more than this many blocks deep, 0 disables pruning")
+	root.Flags().BoolVarP(&globalConfig.Siad.Light, "light", "", false, "download only block headers, and the blocks that involve the wallet")
 
 	// Deprecate shorthand flags that aren't commonly used.
 	// COMPATv0.5.2
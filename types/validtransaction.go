@@ -266,6 +266,22 @@ func (t Transaction) validUnlockConditions(currentHeight BlockHeight) (err error
 // transaction. StandaloneValid will not check that all outputs being spent are
 // legal outputs, as it has no confirmed or unconfirmed set to look at.
 func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
+	err = t.StandaloneValidWithoutSignatures(currentHeight)
+	if err != nil {
+		return
+	}
+	err = t.validSignatures(currentHeight)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// StandaloneValidWithoutSignatures performs all of the checks of
+// StandaloneValid except for signature verification, which is the most
+// expensive check. It should only be used for transactions that are already
+// known to be valid, such as those in blocks below a checkpoint.
+func (t Transaction) StandaloneValidWithoutSignatures(currentHeight BlockHeight) (err error) {
 	err = t.fitsInABlock()
 	if err != nil {
 		return
@@ -294,9 +310,5 @@ func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
 	if err != nil {
 		return
 	}
-	err = t.validSignatures(currentHeight)
-	if err != nil {
-		return
-	}
 	return
 }